@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/prober"
+	"github.com/go-kit/log"
+)
+
+// bounds of the load of `bench`, which validates a listener rather than load tests a cluster
+const (
+	benchMaxConnections = 10000
+	benchMaxRate        = 10000
+	benchMaxDuration    = 10 * time.Minute
+)
+
+type benchOptions struct {
+	probe config.Probe
+	bench prober.BenchOptions
+}
+
+// addBenchCommand adds the `bench` command, which drives a short synthetic load with the clients of the probes
+func addBenchCommand(app *kingpin.Application) (*kingpin.CmdClause, *benchOptions) {
+	opts := &benchOptions{}
+	cmd := app.Command("bench", fmt.Sprintf("Connect MQTT clients to the broker and publish messages round trip through them for a while, and print the latency percentiles, "+
+		"to validate a listener before production. The load is bounded to %d connections, %d messages per second and %s, it's not a load testing tool.",
+		benchMaxConnections, benchMaxRate, benchMaxDuration))
+	cmd.Flag("target", "host:port of the MQTT broker.").Required().StringVar(&opts.probe.Target)
+	cmd.Flag("scheme", "Scheme of the MQTT broker, like tcp, ssl, ws or wss.").Default("tcp").StringVar(&opts.probe.Scheme)
+	cmd.Flag("client-id", "Prefix of the client IDs, which are suffixed with the index of the client.").Default("emqx_exporter_bench").StringVar(&opts.probe.ClientID)
+	cmd.Flag("username", "Username of the clients.").StringVar(&opts.probe.Username)
+	cmd.Flag("password", "Password of the clients.").StringVar((*string)(&opts.probe.Password))
+	cmd.Flag("topic", "Prefix of the topics, each client publishes to and subscribes a topic of its own below it.").Default("emqx-exporter-bench").StringVar(&opts.probe.Topic)
+	cmd.Flag("qos", "QoS of the messages.").Default("0").Uint8Var(&opts.probe.QoS)
+	cmd.Flag("connections", "Number of clients.").Default("500").IntVar(&opts.bench.Connections)
+	cmd.Flag("concurrency", "Number of clients connecting at once.").Default("50").IntVar(&opts.bench.Concurrency)
+	cmd.Flag("rate", "Messages per second over all the clients.").Default("100").Float64Var(&opts.bench.Rate)
+	cmd.Flag("duration", "How long the messages are published once the clients are connected.").Default("30s").DurationVar(&opts.bench.Duration)
+	cmd.Flag("timeout", "Timeout of the connection of each client.").Default("10s").DurationVar(&opts.bench.ConnectTimeout)
+	cmd.Flag("drain", "How long the messages in flight are waited for once the publishing stopped.").Default("5s").DurationVar(&opts.bench.Drain)
+	return cmd, opts
+}
+
+// runBench runs the bench of opts until its duration or a signal, writes the report to w,
+// and returns 1 if any client failed to connect or any message was lost
+func runBench(opts *benchOptions, w io.Writer, logger log.Logger) int {
+	if err := validateBench(opts); err != nil {
+		fmt.Fprintln(w, "Error:", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	result := prober.Bench(ctx, opts.probe, opts.bench, logger)
+	elapsed := time.Since(start)
+
+	fmt.Fprintf(w, "Bench of %s://%s in %s\n", opts.probe.Scheme, opts.probe.Target, elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "  connections  %d of %d connected, %d failed, %d lost during the bench\n",
+		len(result.Connect), opts.bench.Connections, result.ConnectFailed, result.ConnectionLost)
+	fmt.Fprintf(w, "  connect      %s\n", percentiles(result.Connect))
+	fmt.Fprintf(w, "  messages     %d published at QoS %d, %d received, %d failed to publish, %d lost\n",
+		result.Sent, opts.probe.QoS, len(result.RoundTrip), result.PublishFailed, result.Lost())
+	fmt.Fprintf(w, "  round trip   %s\n", percentiles(result.RoundTrip))
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(w, "Interrupted, the results are partial")
+	}
+	if result.ConnectFailed > 0 || result.ConnectionLost > 0 || result.PublishFailed > 0 || result.Lost() > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validateBench checks the options of the bench are within its bounds
+func validateBench(opts *benchOptions) error {
+	b := opts.bench
+	switch {
+	case b.Connections < 1 || b.Connections > benchMaxConnections:
+		return fmt.Errorf("--connections %d must be in [1, %d]", b.Connections, benchMaxConnections)
+	case b.Concurrency < 1:
+		return fmt.Errorf("--concurrency %d must be at least 1", b.Concurrency)
+	case b.Rate <= 0 || b.Rate > benchMaxRate:
+		return fmt.Errorf("--rate %g must be in (0, %d]", b.Rate, benchMaxRate)
+	case b.Duration <= 0 || b.Duration > benchMaxDuration:
+		return fmt.Errorf("--duration %s must be in (0, %s]", b.Duration, benchMaxDuration)
+	case opts.probe.QoS > 2:
+		return fmt.Errorf("--qos %d is not 0, 1 or 2", opts.probe.QoS)
+	}
+	return nil
+}
+
+// percentiles formats the p50, p90, p99 and max of the latencies
+func percentiles(latencies []time.Duration) string {
+	if len(latencies) == 0 {
+		return "no samples"
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s",
+		percentile(sorted, 0.5), percentile(sorted, 0.9), percentile(sorted, 0.99), roundLatency(sorted[len(sorted)-1]))
+}
+
+// percentile returns the q-quantile of the sorted latencies by the nearest rank, rounded for the report
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return roundLatency(sorted[rank])
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestPercentiles(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	if got, want := percentiles(latencies), "p50=50ms p90=90ms p99=99ms max=100ms"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if latencies[0] != 100*time.Millisecond {
+		t.Error("Expected the latencies not to be sorted in place")
+	}
+	if got, want := percentiles([]time.Duration{1234567 * time.Nanosecond}), "p50=1.23ms p90=1.23ms p99=1.23ms max=1.23ms"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := percentiles(nil); got != "no samples" {
+		t.Errorf("Expected no samples, got %q", got)
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	opts := &benchOptions{}
+	opts.probe.Target, opts.probe.Scheme, opts.probe.ClientID, opts.probe.Topic = "127.0.0.1:1", "tcp", "bench", "bench"
+	opts.bench.Connections, opts.bench.Concurrency, opts.bench.Rate = 20000, 50, 100
+	opts.bench.Duration, opts.bench.ConnectTimeout, opts.bench.Drain = time.Second, time.Second, time.Second
+
+	var out bytes.Buffer
+	if code := runBench(opts, &out, log.NewNopLogger()); code != 1 || !strings.Contains(out.String(), "--connections 20000 must be in [1, 10000]") {
+		t.Errorf("Expected exit code 1 for too many connections, got %d: %s", code, out.String())
+	}
+
+	// nothing listens on port 1, so the clients fail to connect right away
+	opts.bench.Connections = 3
+	out.Reset()
+	if code := runBench(opts, &out, log.NewNopLogger()); code != 1 {
+		t.Errorf("Expected exit code 1 as no client connected, got %d", code)
+	}
+	for _, line := range []string{
+		"connections  0 of 3 connected, 3 failed",
+		"connect      no samples",
+		"messages     0 published at QoS 0, 0 received",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in the report, got %s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/prober"
+	"github.com/go-kit/log"
+)
+
+// exit codes of Nagios plugins
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+type checkOptions struct {
+	probe   config.Probe
+	warn    time.Duration
+	crit    time.Duration
+	timeout time.Duration
+}
+
+// addCheckCommand adds the `check` command, which probes an MQTT broker once like a Nagios or Icinga plugin
+func addCheckCommand(app *kingpin.Application) (*kingpin.CmdClause, *checkOptions) {
+	opts := &checkOptions{}
+	cmd := app.Command("check", "Probe the MQTT broker once, and exit with the code of a Nagios plugin, OK, WARNING, CRITICAL or UNKNOWN.")
+	cmd.Flag("target", "host:port of the MQTT broker.").Required().StringVar(&opts.probe.Target)
+	cmd.Flag("scheme", "Scheme of the MQTT broker, like tcp, ssl, ws or wss.").Default("tcp").StringVar(&opts.probe.Scheme)
+	cmd.Flag("client-id", "Client ID of the probe.").Default("emqx_exporter_check").StringVar(&opts.probe.ClientID)
+	cmd.Flag("username", "Username of the probe.").StringVar(&opts.probe.Username)
+	cmd.Flag("password", "Password of the probe.").StringVar((*string)(&opts.probe.Password))
+	cmd.Flag("topic", "Topic the probe publishes to and subscribes.").Default("emqx-exporter-check").StringVar(&opts.probe.Topic)
+	cmd.Flag("qos", "QoS of the probe message.").Default("0").Uint8Var(&opts.probe.QoS)
+	cmd.Flag("warn", "The state is WARNING if the probe takes at least this long.").Default("1s").DurationVar(&opts.warn)
+	cmd.Flag("crit", "The state is CRITICAL if the probe takes at least this long.").Default("5s").DurationVar(&opts.crit)
+	cmd.Flag("timeout", "Timeout of the probe, which is CRITICAL if it times out.").Default("10s").DurationVar(&opts.timeout)
+	return cmd, opts
+}
+
+// runCheck probes the target once, writes the result with its perfdata to w, and returns the exit code of the state
+func runCheck(opts *checkOptions, w io.Writer, logger log.Logger) int {
+	if opts.warn > opts.crit {
+		fmt.Fprintf(w, "UNKNOWN - --warn %s is greater than --crit %s\n", opts.warn, opts.crit)
+		return checkUnknown
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	start := time.Now()
+	success := prober.ProbeMQTT(ctx, opts.probe, logger)
+	duration := time.Since(start)
+
+	state := checkState(success, duration, opts.warn, opts.crit)
+	result, successValue := "failed after", 0
+	if success {
+		result, successValue = "succeeded in", 1
+	}
+	fmt.Fprintf(w, "%s - MQTT probe of %s %s %.3fs | duration=%.6fs;%g;%g;0 success=%d;;;0;1\n",
+		checkStates[state], opts.probe.Target, result, duration.Seconds(),
+		duration.Seconds(), opts.warn.Seconds(), opts.crit.Seconds(), successValue)
+	return state
+}
+
+// checkState returns CRITICAL if the probe failed, otherwise the state of the duration against the thresholds
+func checkState(success bool, duration, warn, crit time.Duration) int {
+	switch {
+	case !success || duration >= crit:
+		return checkCritical
+	case duration >= warn:
+		return checkWarning
+	default:
+		return checkOK
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckState(t *testing.T) {
+	testcases := []struct {
+		success  bool
+		duration time.Duration
+		expected int
+	}{
+		{success: true, duration: 100 * time.Millisecond, expected: checkOK},
+		{success: true, duration: time.Second, expected: checkWarning},
+		{success: true, duration: 5 * time.Second, expected: checkCritical},
+		{success: false, duration: 100 * time.Millisecond, expected: checkCritical},
+	}
+
+	for _, tc := range testcases {
+		if got := checkState(tc.success, tc.duration, time.Second, 5*time.Second); got != tc.expected {
+			t.Errorf("Expected %s for success %v in %s, got %s", checkStates[tc.expected], tc.success, tc.duration, checkStates[got])
+		}
+	}
+}
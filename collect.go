@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/prober"
+	"github.com/emqx/emqx-exporter/push"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+type collectOptions struct {
+	config   string
+	output   string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// addCollectCommand adds the `collect` command, which writes the metrics of the config file without serving them
+func addCollectCommand(app *kingpin.Application) (*kingpin.CmdClause, *collectOptions) {
+	opts := &collectOptions{}
+	cmd := app.Command("collect", "Collect the metrics of all clusters and probes of the config file, and write them in the text format, once and exit with --once, or on --interval until interrupted.")
+	cmd.Flag("config", "EMQX exporter configuration file, --config.file by default.").StringVar(&opts.config)
+	cmd.Flag("output", "File to write the metrics to rather than stdout, which is replaced as a whole each time.").Short('o').StringVar(&opts.output)
+	cmd.Flag("interval", "Interval of collecting the metrics without --once.").Default("1m").DurationVar(&opts.interval)
+	cmd.Flag("timeout", "Timeout of reaching the clusters and collecting the metrics each time.").Default("30s").DurationVar(&opts.timeout)
+	return cmd, opts
+}
+
+// runCollect writes the metrics of the config file to the output of opts, or to stdout, once if once is set,
+// and otherwise on the interval of opts until interrupted
+func runCollect(opts *collectOptions, once bool, stdout io.Writer, logger log.Logger) int {
+	if opts.interval <= 0 || opts.timeout <= 0 {
+		level.Error(logger).Log("msg", "--interval and --timeout must be positive", "interval", opts.interval, "timeout", opts.timeout)
+		return 1
+	}
+	c, err := config.LoadConfig(opts.config)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error loading config", "err", err)
+		return 1
+	}
+	clusters, err := newClusters(c, collector.Shard{Total: 1}, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating cluster", "err", err)
+		return 1
+	}
+	gather := newPushGatherer(clusters, c.Probes, nil, prober.HandlerOpts{}, logger)
+
+	if once {
+		if err := collectOnce(context.Background(), opts, clusters, gather, stdout); err != nil {
+			level.Error(logger).Log("msg", "Error collecting metrics", "err", err)
+			return 1
+		}
+		return 0
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		if err := collectOnce(ctx, opts, clusters, gather, stdout); err != nil && ctx.Err() == nil {
+			level.Warn(logger).Log("msg", "Error collecting metrics", "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
+
+// collectOnce waits for the clusters to be reached, and writes the metrics gathered once.
+// The metrics gathered are written even if some failed, which are returned as the error then
+func collectOnce(ctx context.Context, opts *collectOptions, clusters map[string]*collector.Cluster, gather push.Gatherer, stdout io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	if err := waitDetected(ctx, clusters); err != nil {
+		return err
+	}
+	families, gatherErr := gather(ctx)
+	var err error
+	if opts.output == "" {
+		err = writeText(stdout, families)
+	} else {
+		err = writeTextFile(opts.output, families)
+	}
+	return errors.Join(gatherErr, err)
+}
+
+// writeTextFile writes the families to a temporary file renamed to path, so that path is never read half written
+func writeTextFile(path string, families []*dto.MetricFamily) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if err = writeText(f, families); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file readable by the owner only
+	if err = os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func writeText(w io.Writer, families []*dto.MetricFamily) error {
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return fmt.Errorf("error encoding %s: %w", family.GetName(), err)
+		}
+	}
+	return nil
+}
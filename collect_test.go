@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestRunCollectOnce(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	// nothing listens on port 1, so the probe fails right away
+	if err := os.WriteFile(configFile, []byte("probes:\n  - target: 127.0.0.1:1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	opts := &collectOptions{config: configFile, interval: time.Minute, timeout: 5 * time.Second}
+	if code := runCollect(opts, true, &stdout, log.NewNopLogger()); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	opts.output = filepath.Join(dir, "metrics.prom")
+	if code := runCollect(opts, true, &stdout, log.NewNopLogger()); code != 0 {
+		t.Fatalf("Expected exit code 0 writing to a file, got %d", code)
+	}
+	file, err := os.ReadFile(opts.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, out := range []string{stdout.String(), string(file)} {
+		for _, line := range []string{"# TYPE emqx_exporter_build_info gauge", "emqx_mqtt_probe_success{target=\"127.0.0.1:1\"} 0"} {
+			if !strings.Contains(out, line) {
+				t.Errorf("Expected %q in the metrics written, got %s", line, out)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected no temporary file left behind, got %d files", len(entries))
+	}
+
+	opts.config = filepath.Join(dir, "missing.yaml")
+	if code := runCollect(opts, true, &stdout, log.NewNopLogger()); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing config file, got %d", code)
+	}
+}
@@ -0,0 +1,248 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// aggregationOp tells how the samples of the nodes are aggregated
+type aggregationOp int
+
+const (
+	aggregateSum aggregationOp = iota
+	aggregateMax
+)
+
+// nodeAggregations are the families aggregated across the nodes, by summing them up if they're additive, like counts and
+// current rates, or by their max if they're per node bounds, like the max rates, or replicated on every node, like
+// the retained messages. The others, like the latencies, the IDs and the families of the cluster itself, mean nothing
+// added up, and are served per node only
+var nodeAggregations = map[string]aggregationOp{
+	"emqx_alarm_active":                    aggregateSum,
+	"emqx_alarm_activations":               aggregateSum,
+	"emqx_authentication_total":            aggregateSum,
+	"emqx_authentication_allow_count":      aggregateSum,
+	"emqx_authentication_deny_count":       aggregateSum,
+	"emqx_authentication_failure_count":    aggregateSum,
+	"emqx_authentication_exec_rate":        aggregateSum,
+	"emqx_authentication_exec_last5m_rate": aggregateSum,
+	"emqx_authentication_exec_max_rate":    aggregateMax,
+	"emqx_authorization_total":             aggregateSum,
+	"emqx_authorization_allow_count":       aggregateSum,
+	"emqx_authorization_deny_count":        aggregateSum,
+	"emqx_authorization_exec_rate":         aggregateSum,
+	"emqx_authorization_exec_last5m_rate":  aggregateSum,
+	"emqx_authorization_exec_max_rate":     aggregateMax,
+	"emqx_authorization_cache_hits":        aggregateSum,
+	"emqx_authorization_cache_misses":      aggregateSum,
+	"emqx_clients_connections":             aggregateSum,
+	"emqx_exhook_hook_succeed":             aggregateSum,
+	"emqx_exhook_hook_failed":              aggregateSum,
+	"emqx_exhook_hook_rate":                aggregateSum,
+	"emqx_gateway_connections":             aggregateSum,
+	"emqx_listener_tls_errors":             aggregateSum,
+	"emqx_node_run_queue":                  aggregateMax,
+	"emqx_node_cluster_rpc_lag":            aggregateMax,
+	"emqx_retainer_messages":               aggregateMax,
+	"emqx_retainer_messages_max":           aggregateMax,
+	"emqx_retainer_received":               aggregateSum,
+	"emqx_rule_topic_hit_count":            aggregateSum,
+	"emqx_rule_exec_pass_count":            aggregateSum,
+	"emqx_rule_exec_failure_count":         aggregateSum,
+	"emqx_rule_exec_exception_count":       aggregateSum,
+	"emqx_rule_exec_no_result_count":       aggregateSum,
+	"emqx_rule_exec_rate":                  aggregateSum,
+	"emqx_rule_exec_last5m_rate":           aggregateSum,
+	"emqx_rule_exec_max_rate":              aggregateMax,
+	"emqx_rule_action_total":               aggregateSum,
+	"emqx_rule_action_success":             aggregateSum,
+	"emqx_rule_action_failed":              aggregateSum,
+}
+
+// aggregationModes tells the mode of aggregating the series of the nodes of each collector
+type aggregationModes struct {
+	mode       string
+	collectors map[string]string
+}
+
+// aggregate aggregates the series of the nodes of the collectors by the modes of conf
+func (n *EMQXCollector) aggregate(conf *config.Aggregation) error {
+	for name := range conf.Collectors {
+		if !n.known(name) {
+			return fmt.Errorf("unknown collector %q of aggregation.collectors", name)
+		}
+	}
+	n.aggregation = &aggregationModes{mode: conf.Mode, collectors: conf.Collectors}
+	return nil
+}
+
+// modeOf returns the mode of the family of name, which belongs to the collector of the longest name it's prefixed by,
+// like `emqx_rule_` for the collector `rule`. The families of no collector are in the default mode
+func (a *aggregationModes) modeOf(name string) string {
+	owner := ""
+	match := func(collector string) {
+		if len(collector) > len(owner) && strings.HasPrefix(name, namespace+"_"+collector+"_") {
+			owner = collector
+		}
+	}
+	for collector := range factories {
+		match(collector)
+	}
+	// the plugins
+	for collector := range a.collectors {
+		match(collector)
+	}
+	if mode, ok := a.collectors[owner]; ok {
+		return mode
+	}
+	return a.mode
+}
+
+// aggregatedGatherer serves the families of nodeAggregations labeled by `node` gathered by g per node, aggregated across the
+// nodes, or both, by the mode of their collector. The other families are served per node only
+type aggregatedGatherer struct {
+	g           prometheus.Gatherer
+	aggregation *aggregationModes
+}
+
+func (a aggregatedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := a.g.Gather()
+	byName := make(map[string]struct{}, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = struct{}{}
+	}
+	var errs []error
+	out := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		op, ok := nodeAggregations[family.GetName()]
+		mode := a.aggregation.modeOf(family.GetName())
+		if !ok || mode == config.AggregateNode || !aggregatable(family) {
+			out = append(out, family)
+			continue
+		}
+		if mode == config.AggregateBoth {
+			out = append(out, family)
+		}
+		aggregated := aggregateNodes(family, op)
+		if _, ok := byName[aggregated.GetName()]; ok {
+			errs = append(errs, fmt.Errorf("aggregated metric %s: a collected metric has the same name", aggregated.GetName()))
+			continue
+		}
+		out = append(out, aggregated)
+	}
+	// sorted by name like the families gathered by a registry
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	if len(errs) > 0 {
+		err = errors.Join(append([]error{err}, errs...)...)
+	}
+	return out, err
+}
+
+// withAggregation returns g with the series of the nodes aggregated by the modes of the collector, or g if it has none
+func (n EMQXCollector) withAggregation(g prometheus.Gatherer) prometheus.Gatherer {
+	if n.aggregation == nil {
+		return g
+	}
+	return aggregatedGatherer{g: g, aggregation: n.aggregation}
+}
+
+// gathered returns g with the derived metrics of the collector appended and the series of the nodes aggregated, like
+// every path serving the metrics of a cluster serves them. The derived metrics are computed from the series of the
+// nodes before they're aggregated
+func (n EMQXCollector) gathered(g prometheus.Gatherer) prometheus.Gatherer {
+	return n.withAggregation(n.withDerived(g))
+}
+
+// aggregatable returns whether family is a counter, a gauge or untyped labeled by `node`
+func aggregatable(family *dto.MetricFamily) bool {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+	default:
+		return false
+	}
+	for _, m := range family.Metric {
+		for _, l := range m.Label {
+			if l.GetName() == "node" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aggregateNodes returns the family `emqx_cluster_*` of the samples of family aggregated by op by all labels but `node`,
+// stamped with the latest timestamp of their samples if any
+func aggregateNodes(family *dto.MetricFamily, op aggregationOp) *dto.MetricFamily {
+	help := ", summed up across the nodes"
+	if op == aggregateMax {
+		help = ", the max across the nodes"
+	}
+	out := &dto.MetricFamily{
+		Name: proto.String(namespace + "_cluster_" + strings.TrimPrefix(family.GetName(), namespace+"_")),
+		Help: proto.String(family.GetHelp() + help),
+		Type: family.Type,
+	}
+	groups := make(map[string]*dto.Metric)
+	for _, m := range family.Metric {
+		labels := make([]*dto.LabelPair, 0, len(m.Label))
+		for _, l := range m.Label {
+			if l.GetName() != "node" {
+				labels = append(labels, l)
+			}
+		}
+		var value float64
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			value = m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			value = m.GetGauge().GetValue()
+		default:
+			value = m.GetUntyped().GetValue()
+		}
+		key := labelsKey(labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &dto.Metric{Label: labels}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				g.Counter = &dto.Counter{Value: proto.Float64(value)}
+			case dto.MetricType_GAUGE:
+				g.Gauge = &dto.Gauge{Value: proto.Float64(value)}
+			default:
+				g.Untyped = &dto.Untyped{Value: proto.Float64(value)}
+			}
+			groups[key] = g
+			out.Metric = append(out.Metric, g)
+		} else {
+			var aggregated *float64
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				aggregated = g.Counter.Value
+			case dto.MetricType_GAUGE:
+				aggregated = g.Gauge.Value
+			default:
+				aggregated = g.Untyped.Value
+			}
+			if op == aggregateMax {
+				*aggregated = math.Max(*aggregated, value)
+			} else {
+				*aggregated += value
+			}
+		}
+		if m.TimestampMs != nil && m.GetTimestampMs() > g.GetTimestampMs() {
+			g.TimestampMs = proto.Int64(m.GetTimestampMs())
+		}
+	}
+	sort.Slice(out.Metric, func(i, j int) bool {
+		return labelsKey(out.Metric[i].Label) < labelsKey(out.Metric[j].Label)
+	})
+	return out
+}
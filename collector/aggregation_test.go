@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAggregation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	hits := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "emqx_rule_topic_hit_count", Help: "The number of hits of a rule"}, []string{"node", "rule"})
+	cost := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_rule_exec_time_cost", Help: "The time cost of rule exec"}, []string{"node", "rule"})
+	retained := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_retainer_messages", Help: "The count of retained messages"}, []string{"node"})
+	fds := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_cluster_node_max_fds", Help: "The max fds of node"}, []string{"node"})
+	status := prometheus.NewGauge(prometheus.GaugeOpts{Name: "emqx_cluster_status", Help: "The status of cluster"})
+	registry.MustRegister(hits, cost, retained, fds, status)
+	hits.WithLabelValues("emqx-0", "r1").Add(100)
+	hits.WithLabelValues("emqx-1", "r1").Add(300)
+	hits.WithLabelValues("emqx-0", "r2").Add(5)
+	cost.WithLabelValues("emqx-0", "r1").Set(0.5)
+	retained.WithLabelValues("emqx-0").Set(10)
+	retained.WithLabelValues("emqx-1").Set(12)
+	fds.WithLabelValues("emqx-0").Set(1024)
+	fds.WithLabelValues("emqx-1").Set(2048)
+	status.Set(1)
+
+	n := &EMQXCollector{Collectors: map[string]Collector{"rule": nil, "retainer": nil, "cluster": nil}}
+	if err := n.aggregate(&config.Aggregation{Mode: config.AggregateCluster, Collectors: map[string]string{"rule": config.AggregateBoth}}); err != nil {
+		t.Fatal(err)
+	}
+	// the families not aggregatable, like the latencies and those of the cluster itself, are served per node
+	expected := `
+# HELP emqx_cluster_node_max_fds The max fds of node
+# TYPE emqx_cluster_node_max_fds gauge
+emqx_cluster_node_max_fds{node="emqx-0"} 1024
+emqx_cluster_node_max_fds{node="emqx-1"} 2048
+# HELP emqx_cluster_retainer_messages The count of retained messages, the max across the nodes
+# TYPE emqx_cluster_retainer_messages gauge
+emqx_cluster_retainer_messages 12
+# HELP emqx_cluster_rule_topic_hit_count The number of hits of a rule, summed up across the nodes
+# TYPE emqx_cluster_rule_topic_hit_count counter
+emqx_cluster_rule_topic_hit_count{rule="r1"} 400
+emqx_cluster_rule_topic_hit_count{rule="r2"} 5
+# HELP emqx_cluster_status The status of cluster
+# TYPE emqx_cluster_status gauge
+emqx_cluster_status 1
+# HELP emqx_rule_topic_hit_count The number of hits of a rule
+# TYPE emqx_rule_topic_hit_count counter
+emqx_rule_topic_hit_count{node="emqx-0",rule="r1"} 100
+emqx_rule_topic_hit_count{node="emqx-0",rule="r2"} 5
+emqx_rule_topic_hit_count{node="emqx-1",rule="r1"} 300
+# HELP emqx_rule_exec_time_cost The time cost of rule exec
+# TYPE emqx_rule_exec_time_cost gauge
+emqx_rule_exec_time_cost{node="emqx-0",rule="r1"} 0.5
+`
+	if err := testutil.GatherAndCompare(n.withAggregation(registry), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	if err := n.aggregate(&config.Aggregation{Mode: config.AggregateNode, Collectors: map[string]string{"unknown": config.AggregateBoth}}); err == nil {
+		t.Error("Expected an unknown collector to be rejected")
+	}
+}
+
+func TestNodeAggregations(t *testing.T) {
+	for name := range nodeAggregations {
+		// the aggregated family is prefixed by emqx_cluster_ in place of emqx_
+		if strings.HasPrefix(name, namespace+"_cluster_") || !strings.HasPrefix(name, namespace+"_") {
+			t.Errorf("Expected %s not to be aggregated", name)
+		}
+	}
+}
+
+func TestAggregationPaths(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_rule_topic_hit_count", "The count of topic hit", []string{"node", "rule"}, nil)
+	nc := &EMQXCollector{
+		Collectors: map[string]Collector{
+			"rule": testCollector(func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 100, "emqx-0", "r1")
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 300, "emqx-1", "r1")
+				return nil
+			}),
+		},
+		logger:    log.NewNopLogger(),
+		durations: newDurationHistogram(),
+		failures:  newFailureCounter(),
+		ctx:       context.Background(),
+	}
+	if err := nc.aggregate(&config.Aggregation{Mode: config.AggregateCluster}); err != nil {
+		t.Fatal(err)
+	}
+	derived, err := newDerivedMetrics([]config.Derived{{Name: "emqx_rule_hits", Help: "The hits of the rules", Expr: "sum(emqx_rule_topic_hit_count)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.derived = derived
+
+	// registered like by New, labeled by cluster
+	registry := prometheus.NewRegistry()
+	cluster := &Cluster{name: "eu", collector: nc}
+	if err := cluster.register(context.Background(), registry); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP emqx_cluster_rule_topic_hit_count The count of topic hit, summed up across the nodes
+# TYPE emqx_cluster_rule_topic_hit_count counter
+emqx_cluster_rule_topic_hit_count{cluster="eu",rule="r1"} 400
+# HELP emqx_rule_hits The hits of the rules
+# TYPE emqx_rule_hits gauge
+emqx_rule_hits{cluster="eu"} 400
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "emqx_cluster_rule_topic_hit_count", "emqx_rule_topic_hit_count", "emqx_rule_hits"); err != nil {
+		t.Error(err)
+	}
+
+	result := collectJSON(context.Background(), nc, "rule", nc.Collectors["rule"])
+	names := make(map[string]float64)
+	for _, s := range result.Metrics {
+		names[s.Name] = s.Value
+	}
+	if _, ok := names["emqx_rule_topic_hit_count"]; ok || names["emqx_cluster_rule_topic_hit_count"] != 400 || names["emqx_rule_hits"] != 400 {
+		t.Errorf("Expected the JSON API to serve the aggregated and derived metrics, got %+v", result.Metrics)
+	}
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiTelemetry measures the requests to the EMQX API by endpoint, to tell a slow API from a slow exporter
+type apiTelemetry struct {
+	requests  *prometheus.CounterVec
+	durations *prometheus.HistogramVec
+	bytes     *prometheus.CounterVec
+}
+
+func newAPITelemetry() *apiTelemetry {
+	return &apiTelemetry{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "emqx_exporter",
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Total number of requests to the EMQX API endpoints by status code, which is \"error\" if no response was received.",
+		}, []string{"endpoint", "code"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "emqx_exporter",
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Histogram of how long the requests to the EMQX API endpoints took in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "emqx_exporter",
+			Subsystem: "api",
+			Name:      "response_bytes_total",
+			Help:      "Total number of bytes of the response bodies of the EMQX API endpoints.",
+		}, []string{"endpoint"}),
+	}
+}
+
+// observe records a request to endpoint answered with statusCode, 0 if it failed without a response
+func (t *apiTelemetry) observe(endpoint string, statusCode int, duration time.Duration, bytes int) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	t.requests.WithLabelValues(endpoint, code).Inc()
+	t.durations.WithLabelValues(endpoint).Observe(duration.Seconds())
+	t.bytes.WithLabelValues(endpoint).Add(float64(bytes))
+}
+
+func (t *apiTelemetry) describe(ch chan<- *prometheus.Desc) {
+	t.requests.Describe(ch)
+	t.durations.Describe(ch)
+	t.bytes.Describe(ch)
+}
+
+func (t *apiTelemetry) collect(ch chan<- prometheus.Metric) {
+	t.requests.Collect(ch)
+	t.durations.Collect(ch)
+	t.bytes.Collect(ch)
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errNotCollectedYet = errors.New("not collected in the background yet")
+
+// backgroundCollector runs next on an interval, and serves the metrics it collected last, with the timestamp of the collection
+// unless timestamps is false
+type backgroundCollector struct {
+	timestamps bool
+
+	sync.RWMutex
+	metrics   []prometheus.Metric
+	err       error
+	timestamp time.Time
+}
+
+func newBackgroundCollector(ctx context.Context, name string, next Collector, interval time.Duration, timestamps bool, leadership *leadership, degradation *degradation, logger log.Logger) *backgroundCollector {
+	c := &backgroundCollector{timestamps: timestamps, err: errNotCollectedYet}
+	go c.run(ctx, name, next, interval, leadership, degradation, log.With(logger, "collector", name))
+	return c
+}
+
+// run collects on every tick while leading and not disabled by the memory guard,
+// and forgets the metrics collected as soon as it's not. It returns once ctx is done
+func (c *backgroundCollector) run(ctx context.Context, name string, next Collector, interval time.Duration, leadership *leadership, degradation *degradation, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if !leadership.leading() || degradation.skipped(name) {
+			c.Lock()
+			c.metrics, c.err = nil, errNotCollectedYet
+			c.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		begin := time.Now()
+		collectCtx, cancel := context.WithTimeout(ctx, interval)
+		metrics, err := collectAll(collectCtx, next)
+		cancel()
+		// failures are logged by the scrapes served them
+		level.Debug(logger).Log("msg", "collected in the background", "duration_seconds", time.Since(begin).Seconds(), "err", err)
+
+		c.Lock()
+		c.metrics, c.err, c.timestamp = metrics, err, begin
+		c.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update implements the Collector interface
+func (c *backgroundCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.RLock()
+	metrics, err, timestamp := c.metrics, c.err, c.timestamp
+	c.RUnlock()
+	for _, m := range metrics {
+		if c.timestamps {
+			m = prometheus.NewMetricWithTimestamp(timestamp, m)
+		}
+		ch <- m
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestBackgroundCollector(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test_ok", "ok", nil, nil)
+	collected := make(chan struct{}, 1)
+	next := testCollector(func(ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1)
+		select {
+		case collected <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	begin := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newBackgroundCollector(ctx, "test", next, time.Hour, true, nil, nil, log.NewNopLogger())
+	<-collected
+	// the snapshot is stored right after collecting
+	var err error
+	for i := 0; i < 100; i++ {
+		if _, err = drain(c); err != errNotCollectedYet {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := collectAll(context.Background(), c)
+	if err != nil || len(metrics) != 1 {
+		t.Fatalf("Expected the collected metric, got %d, %v", len(metrics), err)
+	}
+	m := &dto.Metric{}
+	if err := metrics[0].Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if ts := m.GetTimestampMs(); ts < begin.UnixMilli() || ts > time.Now().UnixMilli() {
+		t.Errorf("Expected the timestamp of the collection, got %d", ts)
+	}
+
+	c.timestamps = false
+	if metrics, err = collectAll(context.Background(), c); err != nil || len(metrics) != 1 {
+		t.Fatalf("Expected the collected metric, got %d, %v", len(metrics), err)
+	}
+	m.Reset()
+	if err := metrics[0].Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.TimestampMs != nil {
+		t.Errorf("Expected no timestamp with the timestamps disabled, got %d", m.GetTimestampMs())
+	}
+}
+
+func TestBackgroundCollectorClosed(t *testing.T) {
+	var collections int32
+	collected := make(chan struct{}, 1)
+	next := testCollector(func(ch chan<- prometheus.Metric) error {
+		atomic.AddInt32(&collections, 1)
+		select {
+		case collected <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	newBackgroundCollector(ctx, "test", next, 10*time.Millisecond, false, nil, nil, log.NewNopLogger())
+	<-collected
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	n := atomic.LoadInt32(&collections)
+	time.Sleep(50 * time.Millisecond)
+	if m := atomic.LoadInt32(&collections); m != n {
+		t.Errorf("Expected no collection once closed, got %d more", m-n)
+	}
+}
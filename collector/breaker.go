@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// errCircuitOpen is returned for the requests to an endpoint whose circuit breaker is open
+var errCircuitOpen = errors.New("circuit breaker open")
+
+var circuitBreakerStateDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("emqx_exporter", "api", "circuit_breaker_state"),
+	"State of the circuit breakers of the EMQX API endpoints, 0 closed, 1 open and 2 half-open.",
+	[]string{"endpoint"},
+	nil,
+)
+
+type breakerOutcome int
+
+const (
+	requestSucceeded breakerOutcome = iota
+	requestFailed
+	// requestAborted on behalf of the caller, which tells nothing about the endpoint
+	requestAborted
+)
+
+// breakers holds a circuit breaker per endpoint, see endpointOf
+type breakers struct {
+	conf *config.CircuitBreaker
+	sync.Mutex
+	endpoints map[string]*breaker
+}
+
+func newBreakers(conf *config.CircuitBreaker) *breakers {
+	return &breakers{conf: conf, endpoints: make(map[string]*breaker)}
+}
+
+// get returns the breaker of the endpoint of path, nil if b is
+func (b *breakers) get(path string) *breaker {
+	if b == nil {
+		return nil
+	}
+	endpoint := endpointOf(path)
+	b.Lock()
+	defer b.Unlock()
+	br, ok := b.endpoints[endpoint]
+	if !ok {
+		br = &breaker{failures: b.conf.Failures, openTimeout: time.Duration(b.conf.OpenTimeout)}
+		b.endpoints[endpoint] = br
+	}
+	return br
+}
+
+// collect sends the state of the breakers
+func (b *breakers) collect(ch chan<- prometheus.Metric) {
+	b.Lock()
+	endpoints := make([]string, 0, len(b.endpoints))
+	for endpoint := range b.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	b.Unlock()
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		ch <- prometheus.MustNewConstMetric(circuitBreakerStateDesc, prometheus.GaugeValue, float64(b.get(endpoint).current()), endpoint)
+	}
+}
+
+// breaker opens after failures consecutive failed requests, and fails the requests fast for openTimeout.
+// Then it's half-open, and lets a single trial request through, which closes it if succeeded, or opens it again
+type breaker struct {
+	failures    int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failed   int
+	openedAt time.Time
+	// trying is set while the trial request of the half-open breaker is in flight
+	trying bool
+}
+
+// allow returns errCircuitOpen if the request mustn't be made, and whether it's the trial request of the half-open breaker
+func (b *breaker) allow() (trial bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.state = breakerHalfOpen
+	}
+	switch b.state {
+	case breakerOpen:
+		return false, errCircuitOpen
+	case breakerHalfOpen:
+		if b.trying {
+			return false, errCircuitOpen
+		}
+		b.trying = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// done records the outcome of a request allowed by allow
+func (b *breaker) done(trial bool, outcome breakerOutcome) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		// only the trial request tells whether the endpoint recovered
+		if !trial {
+			return
+		}
+		b.trying = false
+		switch outcome {
+		case requestSucceeded:
+			b.state, b.failed = breakerClosed, 0
+		case requestFailed:
+			b.state, b.openedAt = breakerOpen, time.Now()
+		}
+		return
+	}
+
+	switch outcome {
+	case requestSucceeded:
+		b.failed = 0
+	case requestFailed:
+		b.failed++
+		if b.state == breakerClosed && b.failed >= b.failures {
+			b.state, b.openedAt = breakerOpen, time.Now()
+		}
+	}
+}
+
+func (b *breaker) current() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// outcomeOf tells whether a request failed because of the endpoint, which are the requests not answered in time
+// and the server errors. The client errors tell the endpoint is up
+func outcomeOf(ctx context.Context, statusCode int, err error) breakerOutcome {
+	switch {
+	case err == nil:
+		return requestSucceeded
+	case errors.Is(ctx.Err(), context.Canceled):
+		return requestAborted
+	case statusCode == 0 || statusCode >= 500:
+		return requestFailed
+	}
+	return requestSucceeded
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/common/model"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	r := newRequester(&config.Metrics{
+		Scheme:         "http",
+		Target:         strings.TrimPrefix(server.URL, "http://"),
+		CircuitBreaker: &config.CircuitBreaker{Failures: 3, OpenTimeout: model.Duration(100 * time.Millisecond)},
+	})
+	for i := 0; i < 5; i++ {
+		r.callHTTPGet(context.Background(), "/api/v5/rules/rule_1/metrics")
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Expected the circuit to open after 3 failures, got %d requests", requests.Load())
+	}
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/rules"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("Expected the circuit of the endpoint to be open, got %v", err)
+	}
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); errors.Is(err, errCircuitOpen) {
+		t.Error("Expected the circuit of other endpoints to be closed")
+	}
+	if state := r.breakers.get("/api/v5/rules").current(); state != breakerOpen {
+		t.Errorf("Expected the breaker to be open, got %d", state)
+	}
+
+	// the trial request fails, and opens the circuit again
+	time.Sleep(100 * time.Millisecond)
+	requests.Store(0)
+	r.callHTTPGet(context.Background(), "/api/v5/rules")
+	r.callHTTPGet(context.Background(), "/api/v5/rules")
+	if requests.Load() != 1 {
+		t.Errorf("Expected a single trial request, got %d", requests.Load())
+	}
+
+	// the trial request succeeds, and closes the circuit
+	time.Sleep(100 * time.Millisecond)
+	down.Store(false)
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/rules"); err != nil {
+		t.Fatal(err)
+	}
+	if state := r.breakers.get("/api/v5/rules").current(); state != breakerClosed {
+		t.Errorf("Expected the breaker to be closed, got %d", state)
+	}
+}
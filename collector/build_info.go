@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// NewBuildInfoCollector returns the collector of emqx_exporter_build_info, whose labels tell the build of the exporter,
+// like the one of versioncollector plus the build date, so that the versions running across a fleet can be queried
+func NewBuildInfoCollector() prometheus.Collector {
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: "emqx_exporter",
+			Name:      "build_info",
+			Help:      "A metric with a constant '1' value labeled by version, revision, branch, goversion from which emqx_exporter was built, and the goos, goarch and builddate of the build.",
+			ConstLabels: prometheus.Labels{
+				"version":   version.Version,
+				"revision":  version.GetRevision(),
+				"branch":    version.Branch,
+				"goversion": version.GoVersion,
+				"goos":      version.GoOS,
+				"goarch":    version.GoArch,
+				"tags":      version.GetTags(),
+				"builddate": version.BuildDate,
+			},
+		},
+		func() float64 { return 1 },
+	)
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newCacheHitCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "emqx_exporter",
+		Name:      "cache_hit_total",
+		Help:      "Total number of collections served from the cache of the collectors.",
+	}, []string{"collector"})
+}
+
+// cachedCollector serves the metrics collected by next for ttl. The overlapping scrapes wait for the one collecting,
+// and are served its metrics, rather than collecting again. Failed collections are not cached
+type cachedCollector struct {
+	next Collector
+	ttl  time.Duration
+	hits prometheus.Counter
+	// lock is held while collecting, it's a channel so that waiting for it can be aborted
+	lock    chan struct{}
+	metrics []prometheus.Metric
+	err     error
+	expires time.Time
+}
+
+func newCachedCollector(next Collector, ttl time.Duration, hits prometheus.Counter) *cachedCollector {
+	return &cachedCollector{next: next, ttl: ttl, hits: hits, lock: make(chan struct{}, 1)}
+}
+
+// Update implements the Collector interface
+func (c *cachedCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	select {
+	case c.lock <- struct{}{}:
+		defer func() { <-c.lock }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if time.Now().Before(c.expires) {
+		c.hits.Inc()
+	} else if err := c.collect(ctx); err != nil {
+		return err
+	}
+	for _, m := range c.metrics {
+		ch <- m
+	}
+	return c.err
+}
+
+// collect runs next, and caches its metrics unless it failed
+func (c *cachedCollector) collect(ctx context.Context) error {
+	collected, err := collectAll(ctx, c.next)
+	if err != nil && !IsNoDataError(err) {
+		return err
+	}
+	c.metrics, c.err, c.expires = collected, err, time.Now().Add(c.ttl)
+	return nil
+}
@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func drain(c Collector) (int, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Update(context.Background(), ch)
+		close(ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+	return count, <-done
+}
+
+func TestCachedCollector(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test_ok", "ok", nil, nil)
+	var calls atomic.Int32
+	var fail atomic.Bool
+	next := testCollector(func(ch chan<- prometheus.Metric) error {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		if fail.Load() {
+			return errors.New("api unavailable")
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1)
+		return nil
+	})
+	hits := prometheus.NewCounter(prometheus.CounterOpts{Name: "hits"})
+	c := newCachedCollector(next, time.Hour, hits)
+
+	// overlapping scrapes are served by one collection
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if count, err := drain(c); count != 1 || err != nil {
+				t.Errorf("Expected the cached metric, got %d, %v", count, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 || testutil.ToFloat64(hits) != 2 {
+		t.Errorf("Expected 1 collection and 2 cache hits, got %d and %v", calls.Load(), testutil.ToFloat64(hits))
+	}
+
+	// failures are not cached
+	c = newCachedCollector(next, time.Hour, hits)
+	fail.Store(true)
+	if _, err := drain(c); err == nil {
+		t.Error("Expected the collection to fail")
+	}
+	fail.Store(false)
+	if count, err := drain(c); count != 1 || err != nil {
+		t.Errorf("Expected to collect again after the failure, got %d, %v", count, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 collections, got %d", calls.Load())
+	}
+}
@@ -2,12 +2,15 @@ package collector
 
 import (
 	"context"
-	"emqx-exporter/config"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/emqx/emqx-exporter/config"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -24,31 +27,142 @@ const (
 )
 
 type emqxClientInterface interface {
-	getLicense() (*LicenseInfo, error)
-	getClusterStatus() (ClusterStatus, error)
-	getBrokerMetrics() (*Broker, error)
-	getDataBridge() ([]DataBridge, error)
-	getRuleEngineMetrics() ([]RuleEngine, error)
-	getAuthenticationMetrics() ([]DataSource, []Authentication, error)
-	getAuthorizationMetrics() ([]DataSource, []Authorization, error)
+	getLicense(ctx context.Context) (*LicenseInfo, error)
+	getClusterStatus(ctx context.Context) (ClusterStatus, error)
+	getBrokerMetrics(ctx context.Context) (*Broker, error)
+	getDataBridge(ctx context.Context) ([]DataBridge, error)
+	getRuleEngineMetrics(ctx context.Context) ([]RuleEngine, error)
+	getAuthenticationMetrics(ctx context.Context) ([]DataSource, []Authentication, error)
+	getAuthorizationMetrics(ctx context.Context) ([]DataSource, []Authorization, error)
+	getNamespaceMetrics(ctx context.Context, namespaces []string) ([]Namespace, error)
+	getListenerMetrics(ctx context.Context) ([]Listener, error)
+	getAuthorizationCache(ctx context.Context) (*AuthorizationCache, error)
+	getGatewayMetrics(ctx context.Context) ([]Gateway, error)
+	getExHookMetrics(ctx context.Context) ([]ExHook, error)
+	getRetainerMetrics(ctx context.Context) (*Retainer, error)
+	getAlarms(ctx context.Context) ([]Alarm, error)
+	getNodes(ctx context.Context) ([]Node, error)
+	getClientBuckets(ctx context.Context, buckets *clientBuckets) ([]ClientBucketCount, error)
 }
 
 type client struct {
 	sync.RWMutex
 	emqxClient emqxClientInterface
+	requester  *requester
+	metrics    *config.Metrics
+	// detected is closed once emqxClient is set
+	detected chan struct{}
+	// ctx is done once the cluster is closed, which stops the detection and the background collectors
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Cluster is an EMQX cluster scraped by the exporter
+type Cluster struct {
+	// name is config.Metrics.Name, which is required for config.Config.Clusters only
+	name      string
+	client    *client
+	collector *EMQXCollector
+}
+
+// NewCluster returns a Cluster which detects the version of the EMQX API in the background,
+// and collects the collectors owned by shard. It's closed to stop the goroutines it runs
+func NewCluster(metrics *config.Metrics, shard Shard, logger log.Logger) (*Cluster, error) {
+	if metrics.Name != "" {
+		logger = log.With(logger, "cluster", metrics.Name)
+	}
+	client := newClient(metrics, logger)
+	nc, err := NewEMQXCollector(client, shard, logger)
+	if err != nil {
+		client.cancel()
+		return nil, fmt.Errorf("couldn't create collector: %w", err)
+	}
+	return &Cluster{name: metrics.Name, client: client, collector: nc}, nil
+}
+
+// New validates metrics and fills its defaults like the config file, and registers the collectors of its EMQX cluster
+// to reg, labeled by `cluster` if metrics is named. It's how the cluster is collected when embedded into another
+// program, like an agent serving its own registry. The version of the EMQX API is detected in the background,
+// which the returned Cluster can wait for. The Cluster is closed once it's no longer collected
+func New(metrics *config.Metrics, reg prometheus.Registerer, logger log.Logger) (*Cluster, error) {
+	if err := metrics.Complete(); err != nil {
+		return nil, err
+	}
+	c, err := NewCluster(metrics, Shard{}, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.register(context.Background(), reg); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("couldn't register collector: %w", err)
+	}
+	return c, nil
+}
+
+// Gatherer returns a gatherer which collects the metrics of the cluster on behalf of ctx,
+// labeled by `cluster` if the cluster is named
+func (c *Cluster) Gatherer(ctx context.Context) prometheus.Gatherer {
+	registry := prometheus.NewRegistry()
+	if err := c.register(ctx, registry); err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// register registers the collector of the cluster collecting on behalf of ctx to reg, with the derived metrics and
+// the aggregations of the metrics handler, labeled by `cluster` if the cluster is named
+func (c *Cluster) register(ctx context.Context, reg prometheus.Registerer) error {
+	if c.name != "" {
+		reg = prometheus.WrapRegistererWith(prometheus.Labels{"cluster": c.name}, reg)
+	}
+	return reg.Register(gatheredCollector{c.collector.withContext(ctx)})
+}
+
+// WaitDetected waits until the version of the EMQX API is detected, or ctx is done
+func (c *Cluster) WaitDetected(ctx context.Context) error {
+	select {
+	case <-c.client.detected:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no EMQX API has been reached yet: %w", ctx.Err())
+	}
+}
+
+// Close stops the detection of the version of the EMQX API and the background collectors of the cluster.
+// The collectors registered keep being collected on demand, so they're unregistered along with closing the cluster
+func (c *Cluster) Close() {
+	c.client.cancel()
+}
+
+// Check returns an error if the EMQX API of the cluster isn't reachable right now
+func (c *Cluster) Check(ctx context.Context) error {
+	c.client.RLock()
+	defer c.client.RUnlock()
+	client := c.client.emqxClient
+	if client == nil {
+		return errors.New("no EMQX API has been reached yet")
+	}
+	_, err := client.getClusterStatus(ctx)
+	return err
 }
 
 func newClient(metrics *config.Metrics, logger log.Logger) *client {
-	c := &client{emqxClient: nil}
+	requester := newRequester(metrics)
+	c := &client{emqxClient: nil, requester: requester, metrics: metrics, detected: make(chan struct{})}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	nodeName := newNodeNameNormalizer(metrics.NodeName)
+	nodeFilter := newNodeFilter(metrics.NodesInclude, metrics.NodesExclude)
 
 	go func() {
-		requester := newRequester(metrics)
 		for {
 			client4 := &client4x{
-				requester: requester,
+				requester:  requester,
+				nodeName:   nodeName,
+				nodeFilter: nodeFilter,
 			}
-			if _, err := client4.getClusterStatus(); err == nil {
-				c.emqxClient = client4
+			if _, err := client4.getClusterStatus(c.ctx); err == nil {
+				c.setEMQXClient(client4)
 				level.Info(logger).Log("msg", "client4x client created")
 				return
 			} else {
@@ -56,10 +170,12 @@ func newClient(metrics *config.Metrics, logger log.Logger) *client {
 			}
 
 			client5 := &client5x{
-				requester: requester,
+				requester:  requester,
+				nodeName:   nodeName,
+				nodeFilter: nodeFilter,
 			}
-			if _, err := client5.getClusterStatus(); err == nil {
-				c.emqxClient = client5
+			if _, err := client5.getClusterStatus(c.ctx); err == nil {
+				c.setEMQXClient(client5)
 				level.Info(logger).Log("msg", "client5x client created")
 				return
 			} else {
@@ -68,10 +184,29 @@ func newClient(metrics *config.Metrics, logger log.Logger) *client {
 
 			level.Error(logger).Log("msg", "Couldn't create scraper client, will retry it after 5 seconds", "err", "no scraper node found")
 			select {
-			case <-context.Background().Done():
+			case <-c.ctx.Done():
+				return
 			case <-time.After(5 * time.Second):
 			}
 		}
 	}()
 	return c
 }
+
+func (c *client) setEMQXClient(emqxClient emqxClientInterface) {
+	c.Lock()
+	c.emqxClient = emqxClient
+	c.Unlock()
+	close(c.detected)
+}
+
+// FollowLeader makes the cluster collected only while isLeader returns true, the standby replicas of a leader election
+// serve `emqx_exporter_is_leader 0` only
+func (c *Cluster) FollowLeader(isLeader func() bool) {
+	c.collector.leadership.follow(isLeader)
+}
+
+// GuardMemory makes the heaviest collectors of the cluster disabled while guard is degraded
+func (c *Cluster) GuardMemory(guard *MemoryGuard) {
+	c.collector.degradation.follow(guard)
+}
@@ -1,20 +1,25 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
+
+	jsoniter "github.com/json-iterator/go"
 )
 
 var _ emqxClientInterface = &client4x{}
 
 type client4x struct {
-	edition   edition
-	requester *requester
+	edition    edition
+	requester  *requester
+	nodeName   *nodeNameNormalizer
+	nodeFilter *nodeFilter
 }
 
-func (n *client4x) getLicense() (lic *LicenseInfo, err error) {
+func (n *client4x) getLicense(ctx context.Context) (lic *LicenseInfo, err error) {
 	if n.edition == openSource {
 		return
 	}
@@ -26,7 +31,7 @@ func (n *client4x) getLicense() (lic *LicenseInfo, err error) {
 		}
 		Code int
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v4/license", &resp)
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v4/license", &resp)
 	if err != nil {
 		return
 	}
@@ -37,14 +42,20 @@ func (n *client4x) getLicense() (lic *LicenseInfo, err error) {
 		return
 	}
 
+	// the license limits the connections of the whole cluster, whichever nodes are selected
+	stats, err := n.getNodeValues(ctx, "stats")
+	if err != nil {
+		return
+	}
 	lic = &LicenseInfo{
 		MaxClientLimit: resp.Data.MaxConnections,
 		Expiration:     expiryAt.UnixMilli(),
+		SessionsUsed:   sumNodeValues(stats, "connections.count"),
 	}
 	return
 }
 
-func (n *client4x) getClusterStatus() (cluster ClusterStatus, err error) {
+func (n *client4x) getClusterStatus(ctx context.Context) (cluster ClusterStatus, err error) {
 	resp := struct {
 		Data []struct {
 			Version     string
@@ -59,7 +70,7 @@ func (n *client4x) getClusterStatus() (cluster ClusterStatus, err error) {
 		}
 		Code int
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v4/nodes", &resp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v4/nodes", &resp)
 	if err != nil {
 		return
 	}
@@ -69,6 +80,7 @@ func (n *client4x) getClusterStatus() (cluster ClusterStatus, err error) {
 	}
 
 	cluster.Status = unhealthy
+	cluster.Nodes = newNodeCounts()
 	cluster.NodeUptime = make(map[string]int64)
 	cluster.NodeMaxFDs = make(map[string]int)
 	cluster.CPULoads = make(map[string]CPULoad)
@@ -77,7 +89,13 @@ func (n *client4x) getClusterStatus() (cluster ClusterStatus, err error) {
 		if data.NodeStatus == "Running" {
 			cluster.Status = healthy
 		}
-		nodeName := cutNodeName(data.Node)
+		// the nodes filtered out still count, as the status of the cluster
+		cluster.Nodes[strings.ToLower(data.NodeStatus)]++
+		// a stopped node, like one which left the cluster, has no series rather than the values it had last
+		if !n.nodeFilter.match(data.Node) || data.NodeStatus != "Running" {
+			continue
+		}
+		nodeName := n.nodeName.normalize(data.Node)
 		cluster.NodeUptime[nodeName] = parseUptimeFor4x(data.Uptime)
 		cluster.NodeMaxFDs[nodeName] = data.MaxFds
 
@@ -90,7 +108,7 @@ func (n *client4x) getClusterStatus() (cluster ClusterStatus, err error) {
 	return
 }
 
-func (n *client4x) getBrokerMetrics() (metrics *Broker, err error) {
+func (n *client4x) getBrokerMetrics(ctx context.Context) (metrics *Broker, err error) {
 	resp := struct {
 		Data struct {
 			Sent     int64 `json:"sent"`
@@ -98,7 +116,7 @@ func (n *client4x) getBrokerMetrics() (metrics *Broker, err error) {
 		}
 		Code int
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v4/monitor/current_metrics", &resp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v4/monitor/current_metrics", &resp)
 	if err != nil {
 		return
 	}
@@ -110,43 +128,49 @@ func (n *client4x) getBrokerMetrics() (metrics *Broker, err error) {
 	return
 }
 
-func (n *client4x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
-	resp := struct {
-		Data []struct {
+func (n *client4x) getRuleEngineMetrics(ctx context.Context) (metrics []RuleEngine, err error) {
+	type ruleData struct {
+		Metrics []struct {
+			Node        string  `json:"node"`
+			SpeedMax    float64 `json:"speed_max"`
+			SpeedLast5m float64 `json:"speed_last5m"`
+			Speed       float64 `json:"speed"`
+			Matched     int64   `json:"matched"`
+			Passed      int64   `json:"passed"`
+			NoResult    int64   `json:"no_result"`
+			Exception   int64   `json:"exception"`
+			Failed      int64   `json:"failed"`
+		}
+		Actions []struct {
 			Metrics []struct {
-				Node        string  `json:"node"`
-				SpeedMax    float64 `json:"speed_max"`
-				SpeedLast5m float64 `json:"speed_last5m"`
-				Speed       float64 `json:"speed"`
-				Matched     int64   `json:"matched"`
-				Passed      int64   `json:"passed"`
-				NoResult    int64   `json:"no_result"`
-				Exception   int64   `json:"exception"`
-				Failed      int64   `json:"failed"`
+				Node    string `json:"node"`
+				Taken   int64  `json:"taken"`
+				Success int64  `json:"success"`
+				Failed  int64  `json:"failed"`
 			}
-			Actions []struct {
-				Metrics []struct {
-					Node    string `json:"node"`
-					Taken   int64  `json:"taken"`
-					Success int64  `json:"success"`
-					Failed  int64  `json:"failed"`
-				}
+		}
+		ID      string `json:"id"`
+		Enabled bool
+	}
+	rules, err := fetchPages(ctx, n.requester, "rules", func(ctx context.Context, page, limit int) ([]ruleData, int, error) {
+		resp := struct {
+			Data []ruleData
+			Meta struct {
+				Count int
 			}
-			ID      string `json:"id"`
-			Enabled bool
+			Code int
+		}{}
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v4/rules?_page=%d&_limit=%d", page, limit), &resp)
+		if err == nil && resp.Code != 0 {
+			err = fmt.Errorf("get err from rules api: %d", resp.Code)
 		}
-		Code int
-	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v4/rules?_limit=10000", &resp)
+		return resp.Data, resp.Meta.Count, err
+	})
 	if err != nil {
 		return
 	}
-	if resp.Code != 0 {
-		err = fmt.Errorf("get err from rules api: %d", resp.Code)
-		return
-	}
 
-	for _, rule := range resp.Data {
+	for _, rule := range rules {
 		if !rule.Enabled {
 			continue
 		}
@@ -165,8 +189,11 @@ func (n *client4x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
 			}
 		}
 		for _, m := range rule.Metrics {
+			if !n.nodeFilter.match(m.Node) {
+				continue
+			}
 			re := RuleEngine{
-				NodeName: cutNodeName(m.Node),
+				NodeName: n.nodeName.normalize(m.Node),
 				RuleID:   rule.ID,
 				//ResStatus:           unknown,
 				TopicHitCount:      m.Matched,
@@ -186,7 +213,7 @@ func (n *client4x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
 	return
 }
 
-func (n *client4x) getDataBridge() (bridges []DataBridge, err error) {
+func (n *client4x) getDataBridge(ctx context.Context) (bridges []DataBridge, err error) {
 	resp := struct {
 		Data []struct {
 			ID     string `json:"id"`
@@ -195,7 +222,7 @@ func (n *client4x) getDataBridge() (bridges []DataBridge, err error) {
 		}
 		Code int
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v4/resources", &resp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v4/resources", &resp)
 	if err != nil {
 		return
 	}
@@ -213,14 +240,210 @@ func (n *client4x) getDataBridge() (bridges []DataBridge, err error) {
 	return
 }
 
-func (n *client4x) getAuthenticationMetrics() ([]DataSource, []Authentication, error) {
+func (n *client4x) getAuthenticationMetrics(ctx context.Context) ([]DataSource, []Authentication, error) {
 	return nil, nil, nil
 }
 
-func (n *client4x) getAuthorizationMetrics() ([]DataSource, []Authorization, error) {
+func (n *client4x) getAuthorizationMetrics(ctx context.Context) ([]DataSource, []Authorization, error) {
 	return nil, nil, nil
 }
 
+func (n *client4x) getNamespaceMetrics(ctx context.Context, namespaces []string) ([]Namespace, error) {
+	return nil, nil
+}
+
+func (n *client4x) getListenerMetrics(ctx context.Context) (listeners []Listener, err error) {
+	resp := struct {
+		Data []struct {
+			Node      string
+			Listeners []struct {
+				Protocol      string
+				Identifier    string
+				ShutdownCount shutdownCount `json:"shutdown_count"`
+			}
+		}
+		Code int
+	}{}
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v4/listeners", &resp)
+	if err != nil {
+		return
+	}
+	if resp.Code != 0 {
+		err = fmt.Errorf("get err from listeners api: %d", resp.Code)
+		return
+	}
+
+	for _, data := range resp.Data {
+		if !n.nodeFilter.match(data.Node) {
+			continue
+		}
+		for _, l := range data.Listeners {
+			// like mqtt:ssl, mqtt:wss and https
+			if !strings.Contains(l.Protocol, "ssl") && !strings.Contains(l.Protocol, "wss") && !strings.Contains(l.Protocol, "https") {
+				continue
+			}
+			listeners = append(listeners, Listener{NodeName: n.nodeName.normalize(data.Node), ID: l.Identifier, ShutdownCount: l.ShutdownCount})
+		}
+	}
+	return
+}
+
+func (n *client4x) getGatewayMetrics(ctx context.Context) ([]Gateway, error) {
+	return nil, nil
+}
+
+func (n *client4x) getExHookMetrics(ctx context.Context) ([]ExHook, error) {
+	return nil, nil
+}
+
+func (n *client4x) getRetainerMetrics(ctx context.Context) (retainer *Retainer, err error) {
+	stats, err := n.getNodeStats(ctx)
+	if err != nil {
+		return
+	}
+	metrics, err := n.getNodeMetrics(ctx)
+	if err != nil {
+		return
+	}
+	// the settings of the retainer plugin aren't exposed
+	return &Retainer{Nodes: retainerStats(stats, metrics)}, nil
+}
+
+func (n *client4x) getAlarms(ctx context.Context) (alarms []Alarm, err error) {
+	resp := struct {
+		Data []struct {
+			Node   string
+			Alarms []struct {
+				Name      string
+				Activated bool
+			}
+		}
+		Code int
+	}{}
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v4/alarms", &resp)
+	if err != nil {
+		return
+	}
+	if resp.Code != 0 {
+		err = fmt.Errorf("get err from alarms api: %d", resp.Code)
+		return
+	}
+
+	var nodes []string
+	for _, data := range resp.Data {
+		if n.nodeFilter.match(data.Node) {
+			nodes = append(nodes, n.nodeName.normalize(data.Node))
+		}
+	}
+	counter := newAlarmCounter(nodes)
+	for _, data := range resp.Data {
+		if !n.nodeFilter.match(data.Node) {
+			continue
+		}
+		for _, alarm := range data.Alarms {
+			counter.add(n.nodeName.normalize(data.Node), alarm.Name, alarm.Activated)
+		}
+	}
+	return counter.alarms(), nil
+}
+
+// getClientBuckets pages through all clients one page after another, and counts the connected ones by buckets.
+// The clients aren't kept, only counted as their pages are decoded
+func (n *client4x) getClientBuckets(ctx context.Context, buckets *clientBuckets) ([]ClientBucketCount, error) {
+	err := countPages(ctx, "clients", n.requester.listPageSize(), func(ctx context.Context, page, limit int) (int, *bool, error) {
+		meta := struct {
+			HasNext *bool `json:"hasnext"`
+		}{}
+		code := 0
+		count, err := n.requester.callHTTPGetList(ctx, fmt.Sprintf("/api/v4/clients?_page=%d&_limit=%d", page, limit), "data", func(iter *jsoniter.Iterator) {
+			var c clientData
+			iter.ReadVal(&c)
+			if c.Connected && n.nodeFilter.match(c.Node) {
+				buckets.add(n.nodeName.normalize(c.Node), c.ClientID)
+			}
+		}, map[string]interface{}{"meta": &meta, "code": &code})
+		if err == nil && code != 0 {
+			err = fmt.Errorf("get err from clients api: %d", code)
+		}
+		return count, meta.HasNext, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats, err := n.getNodeStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, 0, len(stats))
+	for node := range stats {
+		nodes = append(nodes, node)
+	}
+	buckets.nodes(nodes)
+	return buckets.buckets(), nil
+}
+
+// getNodes returns nothing, as the metrics of the VM are those of the node answering the prometheus plugin,
+// which isn't told, and the configuration isn't replicated by transactions
+func (n *client4x) getNodes(ctx context.Context) ([]Node, error) {
+	return nil, nil
+}
+
+// getNodeMetrics returns the metrics counted by each node selected, like client.acl.cache_hit, by node name
+func (n *client4x) getNodeMetrics(ctx context.Context) (map[string]map[string]float64, error) {
+	nodes, err := n.getNodeValues(ctx, "metrics")
+	if err != nil {
+		return nil, err
+	}
+	return nodeMetrics(nodes, n.nodeFilter, n.nodeName), nil
+}
+
+// getNodeStats returns the stats of each node selected, like retained.count, by node name
+func (n *client4x) getNodeStats(ctx context.Context) (map[string]map[string]float64, error) {
+	nodes, err := n.getNodeValues(ctx, "stats")
+	if err != nil {
+		return nil, err
+	}
+	return nodeMetrics(nodes, n.nodeFilter, n.nodeName), nil
+}
+
+// getNodeValues returns the values of all nodes of the API of resource, which are the field of the same name,
+// along with the name of their node as node
+func (n *client4x) getNodeValues(ctx context.Context, resource string) ([]map[string]any, error) {
+	resp := struct {
+		Data []map[string]any
+		Code int
+	}{}
+	if err := n.requester.callHTTPGetWithResp(ctx, "/api/v4/"+resource, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("get err from %s api: %d", resource, resp.Code)
+	}
+	nodes := make([]map[string]any, 0, len(resp.Data))
+	for _, data := range resp.Data {
+		values, _ := data[resource].(map[string]any)
+		if values == nil {
+			continue
+		}
+		values["node"] = data["node"]
+		nodes = append(nodes, values)
+	}
+	return nodes, nil
+}
+
+func (n *client4x) getAuthorizationCache(ctx context.Context) (cache *AuthorizationCache, err error) {
+	metrics, err := n.getNodeMetrics(ctx)
+	if err != nil {
+		return
+	}
+	// the ACL cache settings aren't exposed, and its misses aren't counted
+	cache = &AuthorizationCache{}
+	for node, m := range metrics {
+		cache.Nodes = append(cache.Nodes, AuthorizationCacheStats{NodeName: node, Hits: m["client.acl.cache_hit"]})
+	}
+	return
+}
+
 // parse uptime to second, exp: "2 days, 19 hours, 41 minutes, 47 seconds"
 func parseUptimeFor4x(uptime string) int64 {
 	times := strings.Split(uptime, ", ")
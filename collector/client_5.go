@@ -1,19 +1,28 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/common/model"
 )
 
 var _ emqxClientInterface = &client5x{}
 
 type client5x struct {
-	edition   edition
-	requester *requester
+	edition    edition
+	requester  *requester
+	nodeName   *nodeNameNormalizer
+	nodeFilter *nodeFilter
 }
 
-func (n *client5x) getLicense() (lic *LicenseInfo, err error) {
+func (n *client5x) getLicense(ctx context.Context) (lic *LicenseInfo, err error) {
 	if n.edition == openSource {
 		return
 	}
@@ -22,7 +31,7 @@ func (n *client5x) getLicense() (lic *LicenseInfo, err error) {
 		MaxConnections int64  `json:"max_connections"`
 		ExpiryAt       string `json:"expiry_at"`
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v5/license", &resp)
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/license", &resp)
 	if err != nil {
 		return
 	}
@@ -33,14 +42,20 @@ func (n *client5x) getLicense() (lic *LicenseInfo, err error) {
 		return
 	}
 
+	// the license limits the live connections of the whole cluster, whichever nodes are selected
+	stats, err := n.getAllNodeStats(ctx)
+	if err != nil {
+		return
+	}
 	lic = &LicenseInfo{
 		MaxClientLimit: resp.MaxConnections,
 		Expiration:     expiryAt.UnixMilli(),
+		SessionsUsed:   sumNodeValues(stats, "live_connections.count", "connections.count"),
 	}
 	return
 }
 
-func (n *client5x) getClusterStatus() (cluster ClusterStatus, err error) {
+func (n *client5x) getClusterStatus(ctx context.Context) (cluster ClusterStatus, err error) {
 	resp := []struct {
 		Version     string
 		Uptime      int64
@@ -53,12 +68,13 @@ func (n *client5x) getClusterStatus() (cluster ClusterStatus, err error) {
 		Load5       any `json:"load5"`
 		Load15      any `json:"load15"`
 	}{{}}
-	err = n.requester.callHTTPGetWithResp("/api/v5/nodes", &resp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/nodes", &resp)
 	if err != nil {
 		return
 	}
 
 	cluster.Status = unhealthy
+	cluster.Nodes = newNodeCounts()
 	cluster.NodeUptime = make(map[string]int64)
 	cluster.NodeMaxFDs = make(map[string]int)
 	cluster.CPULoads = make(map[string]CPULoad)
@@ -67,7 +83,18 @@ func (n *client5x) getClusterStatus() (cluster ClusterStatus, err error) {
 		if data.NodeStatus == "running" {
 			cluster.Status = healthy
 		}
-		nodeName := cutNodeName(data.Node)
+		// the nodes filtered out still count, as the status of the cluster
+		cluster.Nodes[strings.ToLower(data.NodeStatus)]++
+		if data.Edition == "Opensource" {
+			n.edition = openSource
+		} else {
+			n.edition = enterprise
+		}
+		// a stopped node, like one which left the cluster, has no series rather than the values it had last
+		if !n.nodeFilter.match(data.Node) || data.NodeStatus != "running" {
+			continue
+		}
+		nodeName := n.nodeName.normalize(data.Node)
 		cluster.NodeUptime[nodeName] = data.Uptime / 1000
 		cluster.NodeMaxFDs[nodeName] = data.MaxFds
 
@@ -83,22 +110,16 @@ func (n *client5x) getClusterStatus() (cluster ClusterStatus, err error) {
 			cpuLoad.Load15, _ = strconv.ParseFloat(data.Load15.(string), 64)
 		}
 		cluster.CPULoads[nodeName] = cpuLoad
-
-		if data.Edition == "Opensource" {
-			n.edition = openSource
-		} else {
-			n.edition = enterprise
-		}
 	}
 	return
 }
 
-func (n *client5x) getBrokerMetrics() (metrics *Broker, err error) {
+func (n *client5x) getBrokerMetrics(ctx context.Context) (metrics *Broker, err error) {
 	resp := struct {
 		SentMsgRate     int64 `json:"sent_msg_rate"`
 		ReceivedMsgRate int64 `json:"received_msg_rate"`
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v5/monitor_current", &resp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/monitor_current", &resp)
 	if err != nil {
 		return
 	}
@@ -110,24 +131,36 @@ func (n *client5x) getBrokerMetrics() (metrics *Broker, err error) {
 	return
 }
 
-func (n *client5x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
-	resp := struct {
-		Data []struct {
-			ID     string `json:"id"`
-			Name   string
-			Enable bool
-		}
-	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v5/rules", &resp)
+func (n *client5x) getRuleEngineMetrics(ctx context.Context) (metrics []RuleEngine, err error) {
+	type ruleData struct {
+		ID     string `json:"id"`
+		Name   string
+		Enable bool
+	}
+	rules, err := fetchPages(ctx, n.requester, "rules", func(ctx context.Context, page, limit int) ([]ruleData, int, error) {
+		resp := struct {
+			Data []ruleData
+			Meta struct {
+				Count int
+			}
+		}{}
+		err := n.requester.callHTTPGetSlowWithResp(ctx, fmt.Sprintf("/api/v5/rules?page=%d&limit=%d", page, limit), &resp)
+		return resp.Data, resp.Meta.Count, err
+	})
 	if err != nil {
 		return
 	}
 
-	for _, rule := range resp.Data {
-		if !rule.Enable {
-			continue
+	var ruleIDs []string
+	for _, rule := range rules {
+		if rule.Enable {
+			ruleIDs = append(ruleIDs, rule.ID)
 		}
+	}
 
+	perRule := make([][]RuleEngine, len(ruleIDs))
+	err = forEach(ctx, len(ruleIDs), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		ruleID := ruleIDs[i]
 		metricsResp := struct {
 			NodeMetrics []struct {
 				Node    string
@@ -146,15 +179,18 @@ func (n *client5x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
 				}
 			} `json:"node_metrics"`
 		}{}
-		err = n.requester.callHTTPGetWithResp(fmt.Sprintf("/api/v5/rules/%s/metrics", rule.ID), &metricsResp)
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/rules/%s/metrics", ruleID), &metricsResp)
 		if err != nil {
-			return
+			return err
 		}
 
 		for _, node := range metricsResp.NodeMetrics {
-			metrics = append(metrics, RuleEngine{
-				NodeName:           cutNodeName(node.Node),
-				RuleID:             rule.ID,
+			if !n.nodeFilter.match(node.Node) {
+				continue
+			}
+			perRule[i] = append(perRule[i], RuleEngine{
+				NodeName:           n.nodeName.normalize(node.Node),
+				RuleID:             ruleID,
 				TopicHitCount:      node.Metrics.Matched,
 				ExecPassCount:      node.Metrics.Passed,
 				ExecFailureCount:   node.Metrics.Failed,
@@ -169,23 +205,31 @@ func (n *client5x) getRuleEngineMetrics() (metrics []RuleEngine, err error) {
 				ActionExecTimeCost: nil,
 			})
 		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, m := range perRule {
+		metrics = append(metrics, m...)
 	}
 	return
 }
 
-func (n *client5x) getDataBridge() (bridges []DataBridge, err error) {
+func (n *client5x) getDataBridge(ctx context.Context) (bridges []DataBridge, err error) {
 	bridgesResp := []struct {
 		Name   string
 		Type   string
 		Status string
 	}{{}}
-	err = n.requester.callHTTPGetWithResp("/api/v5/bridges", &bridgesResp)
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/bridges", &bridgesResp)
 	if err != nil {
 		return
 	}
 
 	bridges = make([]DataBridge, len(bridgesResp))
-	for i, data := range bridgesResp {
+	err = forEach(ctx, len(bridgesResp), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		data := bridgesResp[i]
 		enabled := unhealthy
 		if data.Status == "connected" {
 			enabled = healthy
@@ -203,41 +247,51 @@ func (n *client5x) getDataBridge() (bridges []DataBridge, err error) {
 				Dropped    int64
 			}
 		}{}
-		err = n.requester.callHTTPGetWithResp(fmt.Sprintf("/api/v5/bridges/%s:%s/metrics", data.Type, data.Name), &metricsResp)
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/bridges/%s:%s/metrics", data.Type, data.Name), &metricsResp)
 		if err != nil {
-			return
+			return err
 		}
 		bridges[i].Queuing = metricsResp.Metrics.Queuing
 		bridges[i].RateLast5m = metricsResp.Metrics.RateLast5m
 		bridges[i].RateMax = metricsResp.Metrics.RateMax
 		bridges[i].Failed = metricsResp.Metrics.Failed
 		bridges[i].Dropped = metricsResp.Metrics.Dropped
-	}
+		return nil
+	})
 	return
 }
 
-func (n *client5x) getAuthenticationMetrics() (dataSources []DataSource, metrics []Authentication, err error) {
+func (n *client5x) getAuthenticationMetrics(ctx context.Context) (dataSources []DataSource, metrics []Authentication, err error) {
 	resp := []struct {
 		ID      string `json:"id"`
 		Backend string
 		Enable  bool
 	}{{}}
-	err = n.requester.callHTTPGetWithResp("/api/v5/authentication", &resp)
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/authentication", &resp)
 	if err != nil {
 		return
 	}
 
-	for _, plugin := range resp {
-		if !plugin.Enable {
-			continue
+	var plugins []int
+	for i, plugin := range resp {
+		if plugin.Enable {
+			plugins = append(plugins, i)
 		}
+	}
 
+	perPlugin := make([]struct {
+		ds      DataSource
+		metrics []Authentication
+	}, len(plugins))
+	err = forEach(ctx, len(plugins), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		plugin := resp[plugins[i]]
 		status := struct {
 			NodeMetrics []struct {
 				Metrics struct {
 					Total      int64
 					Success    int64
 					Failed     int64
+					Nomatch    int64
 					Rate       float64
 					RateLast5m float64 `json:"rate_last5m"`
 					RateMax    float64 `json:"rate_max"`
@@ -246,55 +300,74 @@ func (n *client5x) getAuthenticationMetrics() (dataSources []DataSource, metrics
 			} `json:"node_metrics"`
 			Status string
 		}{}
-		err = n.requester.callHTTPGetWithResp(fmt.Sprintf("/api/v5/authentication/%s/status", plugin.ID), &status)
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/authentication/%s/status", plugin.ID), &status)
 		if err != nil {
-			return
+			return err
 		}
 
-		ds := DataSource{
+		perPlugin[i].ds = DataSource{
 			ResType: plugin.Backend,
 			Status:  unhealthy,
 		}
 		if status.Status == "connected" {
-			ds.Status = healthy
+			perPlugin[i].ds.Status = healthy
 		}
-		dataSources = append(dataSources, ds)
 
 		for _, node := range status.NodeMetrics {
+			if !n.nodeFilter.match(node.Node) {
+				continue
+			}
 			m := Authentication{
-				NodeName:       cutNodeName(node.Node),
+				NodeName:       n.nodeName.normalize(node.Node),
 				ResType:        plugin.Backend,
 				Total:          node.Metrics.Total,
 				AllowCount:     node.Metrics.Success,
 				DenyCount:      node.Metrics.Failed,
+				IgnoreCount:    node.Metrics.Nomatch,
 				ExecRate:       node.Metrics.Rate,
 				ExecLast5mRate: node.Metrics.RateLast5m,
 				ExecMaxRate:    node.Metrics.RateMax,
 				ExecTimeCost:   nil,
 			}
-			metrics = append(metrics, m)
+			perPlugin[i].metrics = append(perPlugin[i].metrics, m)
 		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, p := range perPlugin {
+		dataSources = append(dataSources, p.ds)
+		metrics = append(metrics, p.metrics...)
 	}
 	return
 }
 
-func (n *client5x) getAuthorizationMetrics() (dataSources []DataSource, metrics []Authorization, err error) {
+func (n *client5x) getAuthorizationMetrics(ctx context.Context) (dataSources []DataSource, metrics []Authorization, err error) {
 	resp := struct {
 		Sources []struct {
 			Type   string
 			Enable bool
 		}
 	}{}
-	err = n.requester.callHTTPGetWithResp("/api/v5/authorization/sources", &resp)
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/authorization/sources", &resp)
 	if err != nil {
 		return
 	}
 
-	for _, plugin := range resp.Sources {
-		if !plugin.Enable {
-			continue
+	var plugins []int
+	for i, plugin := range resp.Sources {
+		if plugin.Enable {
+			plugins = append(plugins, i)
 		}
+	}
 
+	perPlugin := make([]struct {
+		ds      DataSource
+		metrics []Authorization
+	}, len(plugins))
+	err = forEach(ctx, len(plugins), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		plugin := resp.Sources[plugins[i]]
 		status := struct {
 			NodeMetrics []struct {
 				Metrics struct {
@@ -309,23 +382,25 @@ func (n *client5x) getAuthorizationMetrics() (dataSources []DataSource, metrics
 			} `json:"node_metrics"`
 			Status string
 		}{}
-		err = n.requester.callHTTPGetWithResp(fmt.Sprintf("/api/v5/authorization/sources/%s/status", plugin.Type), &status)
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/authorization/sources/%s/status", plugin.Type), &status)
 		if err != nil {
-			return
+			return err
 		}
 
-		ds := DataSource{
+		perPlugin[i].ds = DataSource{
 			ResType: plugin.Type,
 			Status:  unhealthy,
 		}
 		if status.Status == "connected" {
-			ds.Status = healthy
+			perPlugin[i].ds.Status = healthy
 		}
-		dataSources = append(dataSources, ds)
 
 		for _, node := range status.NodeMetrics {
+			if !n.nodeFilter.match(node.Node) {
+				continue
+			}
 			m := Authorization{
-				NodeName:       cutNodeName(node.Node),
+				NodeName:       n.nodeName.normalize(node.Node),
 				ResType:        plugin.Type,
 				Total:          node.Metrics.Total,
 				AllowCount:     node.Metrics.Allow,
@@ -335,8 +410,451 @@ func (n *client5x) getAuthorizationMetrics() (dataSources []DataSource, metrics
 				ExecMaxRate:    node.Metrics.RateMax,
 				ExecTimeCost:   nil,
 			}
-			metrics = append(metrics, m)
+			perPlugin[i].metrics = append(perPlugin[i].metrics, m)
 		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, p := range perPlugin {
+		dataSources = append(dataSources, p.ds)
+		metrics = append(metrics, p.metrics...)
+	}
+	return
+}
+
+func (n *client5x) getNamespaceMetrics(ctx context.Context, namespaces []string) (metrics []Namespace, err error) {
+	if n.edition == openSource {
+		return
+	}
+
+	selected := namespaces
+	for _, ns := range namespaces {
+		if ns == "*" {
+			selected, err = n.listNamespaces(ctx)
+			if err != nil {
+				return
+			}
+			break
+		}
+	}
+
+	// a failing namespace doesn't discard the others, which are collected along with its error
+	fetched := make([]*Namespace, len(selected))
+	errs := make([]error, len(selected))
+	err = forEach(ctx, len(selected), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		resp := struct {
+			Count int64
+		}{}
+		if err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/mt/ns/%s/client_count", url.PathEscape(selected[i])), &resp); err != nil {
+			errs[i] = fmt.Errorf("namespace %q: %w", selected[i], err)
+			return nil
+		}
+		fetched[i] = &Namespace{
+			Name:        selected[i],
+			ClientCount: resp.Count,
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, ns := range fetched {
+		if ns != nil {
+			metrics = append(metrics, *ns)
+		}
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// listNamespaces pages through all namespaces known to the cluster, the pages are fetched one at a time
+// since each of them starts after the last namespace of the previous one
+func (n *client5x) listNamespaces(ctx context.Context) (namespaces []string, err error) {
+	limit := n.requester.pageSize
+	lastNs := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(limit))
+		if lastNs != "" {
+			query.Set("last_ns", lastNs)
+		}
+		var page []string
+		err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/mt/ns_list?"+query.Encode(), &page)
+		if err != nil {
+			return
+		}
+		countPage(ctx, "ns_list")
+		namespaces = append(namespaces, page...)
+		if len(page) < limit {
+			return
+		}
+		lastNs = page[len(page)-1]
+	}
+}
+
+func (n *client5x) getListenerMetrics(ctx context.Context) (listeners []Listener, err error) {
+	resp := []struct {
+		ID         string       `json:"id"`
+		Type       string       `json:"type"`
+		NodeStatus nodeStatuses `json:"node_status"`
+	}{}
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/listeners", &resp)
+	if err != nil {
+		return
+	}
+
+	for _, l := range resp {
+		if l.Type != "ssl" && l.Type != "wss" {
+			continue
+		}
+		for node, status := range l.NodeStatus {
+			if !n.nodeFilter.match(node) {
+				continue
+			}
+			listeners = append(listeners, Listener{NodeName: n.nodeName.normalize(node), ID: l.ID, ShutdownCount: status.ShutdownCount})
+		}
+	}
+	return
+}
+
+func (n *client5x) getAlarms(ctx context.Context) (alarms []Alarm, err error) {
+	type alarmData struct {
+		Node string
+		Name string
+	}
+	// the alarms active and deactivated are kept apart, the latter being the history of the alarms
+	fetch := func(activated bool) ([]alarmData, error) {
+		return fetchPages(ctx, n.requester, "alarms", func(ctx context.Context, page, limit int) ([]alarmData, int, error) {
+			resp := struct {
+				Data []alarmData
+				Meta struct {
+					Count int
+				}
+			}{}
+			err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/alarms?activated=%t&page=%d&limit=%d", activated, page, limit), &resp)
+			return resp.Data, resp.Meta.Count, err
+		})
+	}
+	active, err := fetch(true)
+	if err != nil {
+		return
+	}
+	deactivated, err := fetch(false)
+	if err != nil {
+		return
+	}
+	stats, err := n.getNodeStats(ctx)
+	if err != nil {
+		return
+	}
+
+	nodes := make([]string, 0, len(stats))
+	for node := range stats {
+		nodes = append(nodes, node)
+	}
+	counter := newAlarmCounter(nodes)
+	for _, alarm := range active {
+		if n.nodeFilter.match(alarm.Node) {
+			counter.add(n.nodeName.normalize(alarm.Node), alarm.Name, true)
+		}
+	}
+	for _, alarm := range deactivated {
+		if n.nodeFilter.match(alarm.Node) {
+			counter.add(n.nodeName.normalize(alarm.Node), alarm.Name, false)
+		}
+	}
+	return counter.alarms(), nil
+}
+
+// getClientBuckets pages through all clients one page after another, and counts the connected ones by buckets.
+// The clients aren't kept, only counted as their pages are decoded
+func (n *client5x) getClientBuckets(ctx context.Context, buckets *clientBuckets) ([]ClientBucketCount, error) {
+	err := countPages(ctx, "clients", n.requester.listPageSize(), func(ctx context.Context, page, limit int) (int, *bool, error) {
+		meta := struct {
+			HasNext *bool `json:"hasnext"`
+		}{}
+		count, err := n.requester.callHTTPGetList(ctx, fmt.Sprintf("/api/v5/clients?page=%d&limit=%d", page, limit), "data", func(iter *jsoniter.Iterator) {
+			var c clientData
+			iter.ReadVal(&c)
+			if c.Connected && n.nodeFilter.match(c.Node) {
+				buckets.add(n.nodeName.normalize(c.Node), c.ClientID)
+			}
+		}, map[string]interface{}{"meta": &meta})
+		return count, meta.HasNext, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats, err := n.getNodeStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, 0, len(stats))
+	for node := range stats {
+		nodes = append(nodes, node)
+	}
+	buckets.nodes(nodes)
+	return buckets.buckets(), nil
+}
+
+func (n *client5x) getNodes(ctx context.Context) (nodes []Node, err error) {
+	resp := map[string]any{}
+	err = n.requester.callHTTPGetWithResp(ctx, "/api/v5/prometheus/stats?mode=all_nodes_unaggregated", &resp)
+	if err != nil {
+		return
+	}
+
+	// the values are grouped, like the metrics of the VM, and listed by node since EMQX 5.4. Before they're those of
+	// the node answering, which isn't told so they're skipped
+	byNode := make(map[string]map[string]any)
+	for _, group := range resp {
+		items, _ := group.([]any)
+		for _, item := range items {
+			values, _ := item.(map[string]any)
+			node, _ := values["node"].(string)
+			if node == "" {
+				continue
+			}
+			if byNode[node] == nil {
+				byNode[node] = make(map[string]any, len(values))
+			}
+			for k, v := range values {
+				byNode[node][k] = v
+			}
+		}
+	}
+	all := make([]map[string]any, 0, len(byNode))
+	maxTxID := 0.0
+	for _, values := range byNode {
+		all = append(all, values)
+		if txID, ok := values["emqx_conf_sync_txid"].(float64); ok && txID > maxTxID {
+			maxTxID = txID
+		}
+	}
+
+	for node, m := range nodeMetrics(all, n.nodeFilter, n.nodeName) {
+		nm := Node{NodeName: node}
+		if runQueue, ok := m["emqx_vm_run_queue"]; ok {
+			nm.RunQueue = &runQueue
+		}
+		if txID, ok := m["emqx_conf_sync_txid"]; ok {
+			nm.ClusterRPC = &ClusterRPC{TxID: txID, Lag: maxTxID - txID}
+		}
+		nodes = append(nodes, nm)
+	}
+	return
+}
+
+// getNodeMetrics returns the metrics counted by each node selected, like authorization.cache_hit, by node name
+func (n *client5x) getNodeMetrics(ctx context.Context) (map[string]map[string]float64, error) {
+	resp := []map[string]any{}
+	if err := n.requester.callHTTPGetWithResp(ctx, "/api/v5/metrics?aggregate=false", &resp); err != nil {
+		return nil, err
+	}
+	return nodeMetrics(resp, n.nodeFilter, n.nodeName), nil
+}
+
+// getNodeStats returns the stats of each node selected, like retained.count, by node name
+func (n *client5x) getNodeStats(ctx context.Context) (map[string]map[string]float64, error) {
+	nodes, err := n.getAllNodeStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nodeMetrics(nodes, n.nodeFilter, n.nodeName), nil
+}
+
+// getAllNodeStats returns the stats of all nodes, along with the name of their node as node
+func (n *client5x) getAllNodeStats(ctx context.Context) ([]map[string]any, error) {
+	resp := []map[string]any{}
+	if err := n.requester.callHTTPGetWithResp(ctx, "/api/v5/stats?aggregate=false", &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (n *client5x) getAuthorizationCache(ctx context.Context) (cache *AuthorizationCache, err error) {
+	settings := struct {
+		Cache struct {
+			Enable  bool
+			MaxSize int64 `json:"max_size"`
+			TTL     string
+		}
+	}{}
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/authorization/settings", &settings)
+	if err != nil {
+		return
+	}
+	metrics, err := n.getNodeMetrics(ctx)
+	if err != nil {
+		return
+	}
+
+	cache = &AuthorizationCache{
+		Settings:     &AuthorizationCacheSettings{Enabled: settings.Cache.Enable, MaxSize: settings.Cache.MaxSize},
+		CountsMisses: true,
+	}
+	if ttl, err := model.ParseDuration(settings.Cache.TTL); err == nil {
+		cache.Settings.TTL = time.Duration(ttl).Seconds()
+	}
+	for node, m := range metrics {
+		cache.Nodes = append(cache.Nodes, AuthorizationCacheStats{NodeName: node, Hits: m["authorization.cache_hit"], Misses: m["authorization.cache_miss"]})
+	}
+	return
+}
+
+func (n *client5x) getGatewayMetrics(ctx context.Context) (gateways []Gateway, err error) {
+	resp := []struct {
+		Name           string
+		Status         string
+		MaxConnections int64 `json:"max_connections"`
+	}{}
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/gateways", &resp)
+	if err != nil {
+		return
+	}
+
+	var loaded []int
+	for i, gw := range resp {
+		// the gateways not enabled are listed as unloaded
+		if gw.Status != "unloaded" {
+			loaded = append(loaded, i)
+		}
+	}
+	gateways = make([]Gateway, len(loaded))
+	err = forEach(ctx, len(loaded), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		gw := resp[loaded[i]]
+		listeners := []struct {
+			ID         string       `json:"id"`
+			Running    bool         `json:"running"`
+			NodeStatus nodeStatuses `json:"node_status"`
+		}{}
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/gateways/%s/listeners", url.PathEscape(gw.Name)), &listeners)
+		if err != nil {
+			return err
+		}
+
+		gateways[i] = Gateway{
+			Name:           gw.Name,
+			Status:         unhealthy,
+			MaxConnections: gw.MaxConnections,
+			Connections:    make(map[string]int64),
+			Listeners:      make(map[string]int, len(listeners)),
+		}
+		if gw.Status == "running" {
+			gateways[i].Status = healthy
+		}
+		for _, l := range listeners {
+			gateways[i].Listeners[l.ID] = unhealthy
+			if l.Running {
+				gateways[i].Listeners[l.ID] = healthy
+			}
+			for node, status := range l.NodeStatus {
+				if !n.nodeFilter.match(node) {
+					continue
+				}
+				gateways[i].Connections[n.nodeName.normalize(node)] += status.CurrentConnections
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (n *client5x) getExHookMetrics(ctx context.Context) (servers []ExHook, err error) {
+	resp := []struct {
+		Name           string
+		Enable         bool
+		Status         string
+		RequestTimeout string `json:"request_timeout"`
+	}{}
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/exhooks", &resp)
+	if err != nil {
+		return
+	}
+
+	var enabled []int
+	for i, s := range resp {
+		if s.Enable {
+			enabled = append(enabled, i)
+		}
+	}
+	servers = make([]ExHook, len(enabled))
+	err = forEach(ctx, len(enabled), n.requester.parallelism(), func(ctx context.Context, i int) error {
+		s := resp[enabled[i]]
+		hooks := []struct {
+			Name        string
+			NodeMetrics []struct {
+				Node    string
+				Metrics struct {
+					Succeed int64
+					Failed  int64
+					Rate    float64
+				}
+			} `json:"node_metrics"`
+		}{}
+		err := n.requester.callHTTPGetWithResp(ctx, fmt.Sprintf("/api/v5/exhooks/%s/hooks", url.PathEscape(s.Name)), &hooks)
+		if err != nil {
+			return err
+		}
+
+		servers[i] = ExHook{Name: s.Name, Status: unhealthy}
+		if s.Status == "connected" {
+			servers[i].Status = healthy
+		}
+		if timeout, err := model.ParseDuration(s.RequestTimeout); err == nil {
+			servers[i].RequestTimeout = time.Duration(timeout).Seconds()
+		}
+		for _, h := range hooks {
+			for _, node := range h.NodeMetrics {
+				if !n.nodeFilter.match(node.Node) {
+					continue
+				}
+				servers[i].Hooks = append(servers[i].Hooks, ExHookHook{
+					Name:     h.Name,
+					NodeName: n.nodeName.normalize(node.Node),
+					Succeed:  node.Metrics.Succeed,
+					Failed:   node.Metrics.Failed,
+					Rate:     node.Metrics.Rate,
+				})
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (n *client5x) getRetainerMetrics(ctx context.Context) (retainer *Retainer, err error) {
+	settings := struct {
+		Enable            bool
+		MsgExpiryInterval string `json:"msg_expiry_interval"`
+		MsgClearInterval  string `json:"msg_clear_interval"`
+		Backend           struct {
+			MaxRetainedMessages int64 `json:"max_retained_messages"`
+		}
+	}{}
+	err = n.requester.callHTTPGetSlowWithResp(ctx, "/api/v5/mqtt/retainer", &settings)
+	if err != nil {
+		return
+	}
+	stats, err := n.getNodeStats(ctx)
+	if err != nil {
+		return
+	}
+	metrics, err := n.getNodeMetrics(ctx)
+	if err != nil {
+		return
+	}
+
+	retainer = &Retainer{
+		Settings: &RetainerSettings{Enabled: settings.Enable, MaxRetainedMessages: settings.Backend.MaxRetainedMessages},
+		Nodes:    retainerStats(stats, metrics),
+	}
+	if expiry, err := model.ParseDuration(settings.MsgExpiryInterval); err == nil {
+		retainer.Settings.MessageExpiryInterval = time.Duration(expiry).Seconds()
+	}
+	if clear, err := model.ParseDuration(settings.MsgClearInterval); err == nil {
+		retainer.Settings.ClearInterval = time.Duration(clear).Seconds()
 	}
 	return
 }
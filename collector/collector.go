@@ -12,13 +12,20 @@
 // limitations under the License.
 
 // Package collector includes all individual collectors to gather and export emqx metrics.
+//
+// It can be embedded into another program, which registers the collectors of an EMQX cluster to its own registry
+// with New and a config.Metrics built in code, rather than running the exporter as a separate process.
 package collector
 
 import (
+	"context"
 	"errors"
-	"sync"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
@@ -50,69 +57,392 @@ func registerCollector(collector string, factory func(client *client) (Collector
 	factories[collector] = factory
 }
 
+// Names returns the sorted names of the collectors, which the `collect[]` query parameter selects
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for n := range factories {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // EMQXCollector implements the prometheus.Collector interface.
 type EMQXCollector struct {
 	Collectors map[string]Collector
 	logger     log.Logger
+	// durations keeps the collector durations across scrapes, with exemplars linking to the traced scrapes
+	durations *prometheus.HistogramVec
+	// failures counts the failed and timed out collections of the collectors across scrapes
+	failures *prometheus.CounterVec
+	// cacheHits counts the collections served from the cache of the collectors, nil if none is cached
+	cacheHits *prometheus.CounterVec
+	// breakers are the circuit breakers of the EMQX API endpoints, nil if disabled
+	breakers *breakers
+	// retries counts the retried requests to the EMQX API, nil if disabled
+	retries *prometheus.CounterVec
+	// shared counts the requests to the EMQX API which shared their responses, nil without a requester
+	shared prometheus.Counter
+	// api measures the requests to the EMQX API, nil without a requester
+	api *apiTelemetry
+	// leadership tells whether the replica collects, it's shared with the background collectors
+	leadership *leadership
+	// degradation disables the heaviest collectors while the memory runs short, it's shared with the background collectors
+	degradation *degradation
+	// elsewhere are the collectors of other shards, which are skipped if selected
+	elsewhere map[string]struct{}
+	// derived are the metrics computed from the collected ones on each scrape
+	derived []*derivedMetric
+	// aggregation tells how the series of the nodes are served by collector, nil if they're served per node
+	aggregation *aggregationModes
+	// budget bounds the requests of a scrape along with the scrape timeout, 0 if unbounded
+	budget time.Duration
+	// ctx is the context of the scrape being collected
+	ctx context.Context
 }
 
-// NewEMQXCollector creates a new EMQXCollector.
-func NewEMQXCollector(client *client, logger log.Logger) (*EMQXCollector, error) {
+// NewEMQXCollector creates a new EMQXCollector, which runs the collectors of the cluster owned by shard only.
+func NewEMQXCollector(client *client, shard Shard, logger log.Logger) (*EMQXCollector, error) {
+	var cluster string
+	if client != nil && client.metrics != nil {
+		cluster = client.metrics.Name
+	}
 	collectors := make(map[string]Collector)
+	elsewhere := make(map[string]struct{})
 	for key, factory := range factories {
+		if !shard.owns(cluster, key) {
+			elsewhere[key] = struct{}{}
+			continue
+		}
 		collector, err := factory(client)
 		if err != nil {
 			return nil, err
 		}
 		collectors[key] = collector
 	}
-	return &EMQXCollector{Collectors: collectors, logger: logger}, nil
+	if client != nil && client.metrics != nil {
+		for _, plugin := range client.metrics.Plugins {
+			key := PluginPrefix + plugin.Name
+			if !shard.owns(cluster, key) {
+				elsewhere[key] = struct{}{}
+				continue
+			}
+			collectors[key] = newPluginCollector(plugin, client.metrics)
+		}
+	}
+	nc := &EMQXCollector{Collectors: collectors, logger: logger, durations: newDurationHistogram(), failures: newFailureCounter(), ctx: context.Background(), leadership: &leadership{}, degradation: &degradation{}, elsewhere: elsewhere}
+	for name := range collectors {
+		// exported from the start, for the rate of the first error to be seen
+		nc.failures.WithLabelValues(name)
+	}
+	if client != nil && client.requester != nil {
+		nc.breakers = client.requester.breakers
+		nc.retries = client.requester.retries
+		nc.shared = client.requester.shared
+		nc.api = client.requester.telemetry
+	}
+	if client != nil && client.metrics != nil && client.metrics.Timeouts != nil {
+		nc.budget = time.Duration(client.metrics.Timeouts.Budget)
+	}
+	if client != nil && client.metrics != nil && len(client.metrics.Derived) > 0 {
+		var err error
+		if nc.derived, err = newDerivedMetrics(client.metrics.Derived); err != nil {
+			return nil, err
+		}
+	}
+	if client != nil && client.metrics != nil && client.metrics.Aggregation != nil {
+		if err := nc.aggregate(client.metrics.Aggregation); err != nil {
+			return nil, err
+		}
+	}
+	if client != nil && client.metrics != nil && client.metrics.Cache != nil {
+		if err := nc.cache(client.metrics.Cache); err != nil {
+			return nil, err
+		}
+	}
+	if client != nil && client.metrics != nil && client.metrics.Background != nil {
+		if err := nc.background(client.ctx, client.metrics.Background); err != nil {
+			return nil, err
+		}
+	}
+	return nc, nil
+}
+
+// background runs the collectors in the background on the intervals of conf, until ctx is done
+func (n *EMQXCollector) background(ctx context.Context, conf *config.Background) error {
+	for name := range conf.Collectors {
+		if !n.known(name) {
+			return fmt.Errorf("unknown collector %q of background.collectors", name)
+		}
+	}
+	for name, c := range n.Collectors {
+		interval, ok := conf.Collectors[name]
+		if !ok {
+			interval = conf.Interval
+		}
+		n.Collectors[name] = newBackgroundCollector(ctx, name, c, time.Duration(interval), conf.Timestamps, n.leadership, n.degradation, n.logger)
+	}
+	return nil
+}
+
+// known returns whether name is a collector of this shard or of another one
+func (n *EMQXCollector) known(name string) bool {
+	_, ok := n.Collectors[name]
+	_, elsewhere := n.elsewhere[name]
+	return ok || elsewhere
+}
+
+// cache wraps the collectors whose TTL is set by conf with a cache
+func (n *EMQXCollector) cache(conf *config.Cache) error {
+	for name := range conf.Collectors {
+		if !n.known(name) {
+			return fmt.Errorf("unknown collector %q of cache.collectors", name)
+		}
+	}
+	n.cacheHits = newCacheHitCounter()
+	for name, c := range n.Collectors {
+		ttl, ok := conf.Collectors[name]
+		if !ok {
+			ttl = conf.TTL
+		}
+		if ttl > 0 {
+			n.Collectors[name] = newCachedCollector(c, time.Duration(ttl), n.cacheHits.WithLabelValues(name))
+		}
+	}
+	return nil
+}
+
+func newFailureCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "emqx_exporter",
+		Subsystem: "collector",
+		Name:      "errors_total",
+		Help:      "Total number of collections which failed or timed out, by collector.",
+	}, []string{"collector"})
+}
+
+func newDurationHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "emqx_exporter",
+		Subsystem: "collector",
+		Name:      "duration_seconds",
+		Help:      "Histogram of how long the collectors took to collect in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"collector"})
+}
+
+// withBudget returns ctx bound by the budget of the requests of a scrape, if any
+func (n *EMQXCollector) withBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if n == nil || n.budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, n.budget)
+}
+
+// withContext returns a shallow copy of the collector, which collects on behalf of the scrape carried by ctx.
+func (n EMQXCollector) withContext(ctx context.Context) EMQXCollector {
+	n.ctx = ctx
+	return n
+}
+
+// filter returns a shallow copy of the collector, which only runs the collectors of the given names.
+// The collectors of other shards are skipped.
+func (n EMQXCollector) filter(names []string) (EMQXCollector, error) {
+	collectors := make(map[string]Collector, len(names))
+	for _, name := range names {
+		if _, ok := n.elsewhere[name]; ok {
+			continue
+		}
+		c, ok := n.Collectors[name]
+		if !ok {
+			return n, fmt.Errorf("missing collector: %s", name)
+		}
+		collectors[name] = c
+	}
+	n.Collectors = collectors
+	return n, nil
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n EMQXCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	n.durations.Describe(ch)
+	n.failures.Describe(ch)
+	if n.cacheHits != nil {
+		n.cacheHits.Describe(ch)
+	}
+	if n.breakers != nil {
+		ch <- circuitBreakerStateDesc
+	}
+	if n.retries != nil {
+		n.retries.Describe(ch)
+	}
+	if n.shared != nil {
+		n.shared.Describe(ch)
+	}
+	if n.api != nil {
+		n.api.describe(ch)
+	}
+	ch <- isLeaderDesc
+	if n.degradation.guarded() {
+		ch <- collectorDegradedDesc
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
+// If the scrape context is done before all collectors finished, the metrics collected so far are served,
+// and the unfinished collectors are reported as failed.
+// The standby replicas of a leader election don't collect, and the collectors disabled by the memory guard are skipped.
+// The scrape context is bound by the budget of the requests of a scrape, if any.
 func (n EMQXCollector) Collect(ch chan<- prometheus.Metric) {
-	wg := sync.WaitGroup{}
-	defer wg.Wait()
+	if n.leadership.following() {
+		if !n.leadership.leading() {
+			ch <- prometheus.MustNewConstMetric(isLeaderDesc, prometheus.GaugeValue, 0)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(isLeaderDesc, prometheus.GaugeValue, 1)
+	}
+
+	var cancel context.CancelFunc
+	n.ctx, cancel = n.withBudget(n.ctx)
+	defer cancel()
+	begin := time.Now()
+	metrics := make(chan prometheus.Metric)
+	finished := make(chan string)
+	pending := make(map[string]struct{}, len(n.Collectors))
 	for name, c := range n.Collectors {
-		wg.Add(1)
+		if n.degradation.guarded() {
+			if n.degradation.skipped(name) {
+				ch <- prometheus.MustNewConstMetric(collectorDegradedDesc, prometheus.GaugeValue, 1, name)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(collectorDegradedDesc, prometheus.GaugeValue, 0, name)
+		}
+		pending[name] = struct{}{}
 		go func(name string, c Collector) {
-			defer wg.Done()
-			execute(name, c, ch, n.logger)
+			n.execute(name, c, metrics)
+			finished <- name
 		}(name, c)
 	}
+
+	for len(pending) > 0 {
+		select {
+		case m := <-metrics:
+			ch <- m
+		case name := <-finished:
+			delete(pending, name)
+		case <-n.ctx.Done():
+			duration := time.Since(begin)
+			for name := range pending {
+				level.Warn(n.logger).Log("msg", "collector timed out", "collector", name, "duration_seconds", duration.Seconds(), "err", n.ctx.Err())
+				ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
+				ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, name)
+				n.failures.WithLabelValues(name).Inc()
+			}
+			go discard(metrics, finished, len(pending))
+			pending = nil
+		}
+	}
+	n.durations.Collect(ch)
+	n.failures.Collect(ch)
+	if n.cacheHits != nil {
+		n.cacheHits.Collect(ch)
+	}
+	if n.breakers != nil {
+		n.breakers.collect(ch)
+	}
+	if n.retries != nil {
+		n.retries.Collect(ch)
+	}
+	if n.shared != nil {
+		n.shared.Collect(ch)
+	}
+	if n.api != nil {
+		n.api.collect(ch)
+	}
+}
+
+// discard drops the metrics of the collectors still running after the scrape is done, until count of them finished
+func discard(metrics <-chan prometheus.Metric, finished <-chan string, count int) {
+	for count > 0 {
+		select {
+		case <-metrics:
+		case <-finished:
+			count--
+		}
+	}
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+func (n EMQXCollector) execute(name string, c Collector, ch chan<- prometheus.Metric) {
+	ctx, span := tracing.Start(n.ctx, "collect")
+	span.SetAttributes("collector", name)
 	begin := time.Now()
-	err := c.Update(ch)
+	err := n.degradation.update(ctx, name, c, ch)
 	duration := time.Since(begin)
+	span.End(err)
 	var success float64
 
 	if err != nil {
+		logger := log.With(n.logger, "collector", name, "duration_seconds", duration.Seconds())
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			logger = log.With(logger, "endpoint", reqErr.endpoint)
+		}
 		if IsNoDataError(err) {
-			level.Debug(logger).Log("msg", "collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+			level.Debug(logger).Log("msg", "collector returned no data", "err", err)
+		} else if n.ctx.Err() != nil {
+			// the scrape timed out or the scraper went away, which is logged once by Collect
+			level.Debug(logger).Log("msg", "collector aborted", "err", err)
 		} else {
-			level.Error(logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+			level.Error(logger).Log("msg", "collector failed", "err", err)
+			n.failures.WithLabelValues(name).Inc()
 		}
 		success = 0
 	} else {
-		level.Debug(logger).Log("msg", "collector succeeded", "name", name, "duration_seconds", duration.Seconds())
+		level.Debug(n.logger).Log("msg", "collector succeeded", "collector", name, "duration_seconds", duration.Seconds())
 		success = 1
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+
+	observer := n.durations.WithLabelValues(name)
+	if exemplar := tracing.Exemplar(n.ctx); exemplar != nil {
+		observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration.Seconds(), exemplar)
+	} else {
+		observer.Observe(duration.Seconds())
+	}
+}
+
+// update turns a panic of the collector into an error, so a failing collector doesn't take down the others
+func update(ctx context.Context, c Collector, ch chan<- prometheus.Metric) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collector panicked: %v", r)
+		}
+	}()
+	return c.Update(ctx, ch)
+}
+
+// collectAll runs the collector, and returns the metrics it collected
+func collectAll(ctx context.Context, c Collector) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- update(ctx, c, ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics, <-done
 }
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
 	// Get new metrics and expose them via prometheus registry.
-	Update(ch chan<- prometheus.Metric) error
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
 }
 
 // ErrNoData indicates the collector found no data to collect, but had no other error.
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AlarmSubsystem = "alarm"
+)
+
+const (
+	alarmActive      = "active"
+	alarmActivations = "activations"
+)
+
+// watermarkAlarms are the alarms of the memory and CPU watermarks, which are collected for every node even if never
+// activated, so that their alerts are evaluated rather than absent
+var watermarkAlarms = []string{"high_system_memory_usage", "high_process_memory_usage", "high_cpu_usage", "too_many_processes"}
+
+func init() {
+	registerCollector(AlarmSubsystem, NewAlarmCollector)
+}
+
+type alarmCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewAlarmCollector returns a new collector for the alarms of the nodes
+func NewAlarmCollector(client *client) (Collector, error) {
+	collector := &alarmCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   alarmActive,
+			help:   "The count of active alarms",
+			labels: []string{"node", "alarm"},
+		},
+		{
+			name:   alarmActivations,
+			help:   "The count of activations of the alarm kept in the alarm history, including the active ones",
+			labels: []string{"node", "alarm"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				AlarmSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the alarms.
+func (c *alarmCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	alarms, err := doGetAlarms(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range alarms {
+		ch <- prometheus.MustNewConstMetric(c.desc[alarmActive], prometheus.GaugeValue, float64(a.Active), a.NodeName, a.Name)
+		ch <- prometheus.MustNewConstMetric(c.desc[alarmActivations], prometheus.GaugeValue, float64(a.Activations), a.NodeName, a.Name)
+	}
+	return nil
+}
+
+// Alarm counts the alarms of a name on a node.
+// The alarms of a resource, like conn_congestion/<clientid>/<username>, are counted by the name before the resource
+type Alarm struct {
+	NodeName string
+	Name     string
+	Active   int
+	// Activations are the alarms active or deactivated kept in the alarm history, which is bounded by the broker
+	Activations int
+}
+
+// alarmCounter counts the alarms by node and name
+type alarmCounter map[[2]string]*Alarm
+
+// newAlarmCounter returns an alarmCounter with the watermark alarms of nodes at 0
+func newAlarmCounter(nodes []string) alarmCounter {
+	counter := alarmCounter{}
+	for _, node := range nodes {
+		for _, name := range watermarkAlarms {
+			counter.alarm(node, name)
+		}
+	}
+	return counter
+}
+
+func (a alarmCounter) alarm(node, name string) *Alarm {
+	name, _, _ = strings.Cut(name, "/")
+	key := [2]string{node, name}
+	if a[key] == nil {
+		a[key] = &Alarm{NodeName: node, Name: name}
+	}
+	return a[key]
+}
+
+// add counts an alarm of name activated on node, which is active if not deactivated yet
+func (a alarmCounter) add(node, name string, active bool) {
+	alarm := a.alarm(node, name)
+	alarm.Activations++
+	if active {
+		alarm.Active++
+	}
+}
+
+// alarms returns the alarms counted, ordered by node and name
+func (a alarmCounter) alarms() []Alarm {
+	alarms := make([]Alarm, 0, len(a))
+	for _, alarm := range a {
+		alarms = append(alarms, *alarm)
+	}
+	sort.Slice(alarms, func(i, j int) bool {
+		if alarms[i].NodeName != alarms[j].NodeName {
+			return alarms[i].NodeName < alarms[j].NodeName
+		}
+		return alarms[i].Name < alarms[j].Name
+	})
+	return alarms
+}
+
+func doGetAlarms(ctx context.Context, c *client) (alarms []Alarm, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	alarms, err = client.getAlarms(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect alarms failed. %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAlarmCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/alarms":
+			w.Write([]byte(`{"code": 0, "data": [
+				{"node": "emqx@emqx-0", "alarms": [
+					{"name": "high_system_memory_usage", "activated": true},
+					{"name": "high_system_memory_usage", "activated": false},
+					{"name": "conn_congestion/client1/user1", "activated": false}
+				]},
+				{"node": "emqx@emqx-1", "alarms": []}
+			]}`))
+		case "/api/v5/alarms":
+			if r.URL.Query().Get("activated") == "true" {
+				w.Write([]byte(`{"data": [{"node": "emqx@emqx-0", "name": "high_system_memory_usage"}], "meta": {"page": 1, "limit": 100, "count": 1}}`))
+				return
+			}
+			w.Write([]byte(`{"data": [
+				{"node": "emqx@emqx-0", "name": "high_system_memory_usage"},
+				{"node": "emqx@emqx-0", "name": "conn_congestion/client1/user1"}
+			], "meta": {"page": 1, "limit": 100, "count": 2}}`))
+		case "/api/v5/stats":
+			w.Write([]byte(`[{"node": "emqx@emqx-0"}, {"node": "emqx@emqx-1"}]`))
+		}
+	}))
+	defer server.Close()
+
+	expected := `
+# HELP emqx_alarm_activations The count of activations of the alarm kept in the alarm history, including the active ones
+# TYPE emqx_alarm_activations gauge
+emqx_alarm_activations{alarm="conn_congestion",node="emqx-0"} 1
+emqx_alarm_activations{alarm="high_cpu_usage",node="emqx-0"} 0
+emqx_alarm_activations{alarm="high_process_memory_usage",node="emqx-0"} 0
+emqx_alarm_activations{alarm="high_system_memory_usage",node="emqx-0"} 2
+emqx_alarm_activations{alarm="too_many_processes",node="emqx-0"} 0
+# HELP emqx_alarm_active The count of active alarms
+# TYPE emqx_alarm_active gauge
+emqx_alarm_active{alarm="conn_congestion",node="emqx-0"} 0
+emqx_alarm_active{alarm="high_cpu_usage",node="emqx-0"} 0
+emqx_alarm_active{alarm="high_process_memory_usage",node="emqx-0"} 0
+emqx_alarm_active{alarm="high_system_memory_usage",node="emqx-0"} 1
+emqx_alarm_active{alarm="too_many_processes",node="emqx-0"} 0
+`
+	for name, c := range map[string]emqxClientInterface{
+		"4.x": newTestClient4x(server, "emqx@emqx-0", ""),
+		"5.x": newTestClient5x(server, "emqx@emqx-0", ""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewAlarmCollector(&client{emqxClient: c})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	APICertSubsystem = "api_cert"
+)
+
+const (
+	apiCertExpiration    = "expiration_time"
+	apiCertRemainingDays = "remaining_days"
+)
+
+func init() {
+	registerCollector(APICertSubsystem, NewAPICertCollector)
+}
+
+type apiCertCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewAPICertCollector returns a new collector for the certificate of the EMQX dashboard API
+func NewAPICertCollector(client *client) (Collector, error) {
+	collector := &apiCertCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name string
+		help string
+	}{
+		{
+			name: apiCertExpiration,
+			help: "The expiration time of the certificate presented by the EMQX API server",
+		},
+		{
+			name: apiCertRemainingDays,
+			help: "The remaining days of the certificate presented by the EMQX API server before expiring",
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				APICertSubsystem,
+				m.name,
+			),
+			m.help,
+			nil,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the API server certificate info.
+func (c *apiCertCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	notAfter := c.client.requester.certNotAfter.Load()
+	// no TLS handshake has happened yet, or the API is served over plain http
+	if notAfter == 0 {
+		return nil
+	}
+
+	remaining := time.Until(time.Unix(notAfter, 0)).Hours() / 24
+	remaining, _ = strconv.ParseFloat(fmt.Sprintf("%.1f", remaining), 64)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.desc[apiCertExpiration],
+		prometheus.GaugeValue, float64(notAfter*1000),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.desc[apiCertRemainingDays],
+		prometheus.GaugeValue, remaining,
+	)
+	return nil
+}
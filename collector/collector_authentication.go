@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -28,6 +29,7 @@ const (
 	authenticationTotal          = "total"
 	authenticationAllowCount     = "allow_count"
 	authenticationDenyCount      = "deny_count"
+	authenticationFailureCount   = "failure_count"
 	authenticationExecRate       = "exec_rate"
 	authenticationExecLast5mRate = "exec_last5m_rate"
 	authenticationExecMaxRate    = "exec_max_rate"
@@ -75,6 +77,11 @@ func NewAuthenticationCollector(client *client) (Collector, error) {
 			help:   "The count of denied authentication",
 			labels: []string{"node", "resource"},
 		},
+		{
+			name:   authenticationFailureCount,
+			help:   "The count of failed authentication by reason, denied for bad credentials, or ignored for a client unknown to the resource or a resource error",
+			labels: []string{"node", "resource", "reason"},
+		},
 		{
 			name:   authenticationExecRate,
 			help:   "The rate of authentication exec",
@@ -113,8 +120,8 @@ func NewAuthenticationCollector(client *client) (Collector, error) {
 }
 
 // Update implements the Collector interface and will collect authentication metrics.
-func (c *authenticationCollector) Update(ch chan<- prometheus.Metric) error {
-	dataSources, metrics, err := doGetAuthenticationMetrics(c.client)
+func (c *authenticationCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	dataSources, metrics, err := doGetAuthenticationMetrics(ctx, c.client)
 	if err != nil {
 		return err
 	}
@@ -129,6 +136,7 @@ func (c *authenticationCollector) Update(ch chan<- prometheus.Metric) error {
 
 	for i := range metrics {
 		metric := &metrics[i]
+		labels := newLabelPairs(c.desc[authenticationTotal], metric.NodeName, metric.ResType)
 		bucket, err := getBucket(metric.ExecTimeCost)
 		if err != nil {
 			return err
@@ -139,30 +147,14 @@ func (c *authenticationCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(metric.ExecTimeCost["sum"]),
 			bucket, metric.NodeName, metric.ResType)
 
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationTotal],
-			prometheus.CounterValue, float64(metric.Total), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationAllowCount],
-			prometheus.CounterValue, float64(metric.AllowCount), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationDenyCount],
-			prometheus.CounterValue, float64(metric.DenyCount), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationExecRate],
-			prometheus.GaugeValue, metric.ExecRate, metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationExecLast5mRate],
-			prometheus.GaugeValue, metric.ExecLast5mRate, metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authenticationExecMaxRate],
-			prometheus.GaugeValue, metric.ExecMaxRate, metric.NodeName, metric.ResType,
-		)
+		ch <- labels.constMetric(c.desc[authenticationTotal], prometheus.CounterValue, float64(metric.Total))
+		ch <- labels.constMetric(c.desc[authenticationAllowCount], prometheus.CounterValue, float64(metric.AllowCount))
+		ch <- labels.constMetric(c.desc[authenticationDenyCount], prometheus.CounterValue, float64(metric.DenyCount))
+		ch <- prometheus.MustNewConstMetric(c.desc[authenticationFailureCount], prometheus.CounterValue, float64(metric.DenyCount), metric.NodeName, metric.ResType, "denied")
+		ch <- prometheus.MustNewConstMetric(c.desc[authenticationFailureCount], prometheus.CounterValue, float64(metric.IgnoreCount), metric.NodeName, metric.ResType, "ignored")
+		ch <- labels.constMetric(c.desc[authenticationExecRate], prometheus.GaugeValue, metric.ExecRate)
+		ch <- labels.constMetric(c.desc[authenticationExecLast5mRate], prometheus.GaugeValue, metric.ExecLast5mRate)
+		ch <- labels.constMetric(c.desc[authenticationExecMaxRate], prometheus.GaugeValue, metric.ExecMaxRate)
 
 	}
 	return nil
@@ -179,6 +171,9 @@ type Authentication struct {
 	ExecLast5mRate float64
 	ExecMaxRate    float64
 	ExecTimeCost   map[string]uint64
+	// IgnoreCount counts the clients the resource couldn't authenticate, as it doesn't know them or failed,
+	// which are passed to the next resource of the chain
+	IgnoreCount int64
 }
 
 type DataSource struct {
@@ -186,15 +181,15 @@ type DataSource struct {
 	Status  int
 }
 
-func doGetAuthenticationMetrics(c *client) (dataSources []DataSource, auths []Authentication, err error) {
-	c.Lock()
-	defer c.Unlock()
+func doGetAuthenticationMetrics(ctx context.Context, c *client) (dataSources []DataSource, auths []Authentication, err error) {
+	c.RLock()
+	defer c.RUnlock()
 
 	client := c.emqxClient
 	if client == nil {
 		return
 	}
-	dataSources, auths, err = client.getAuthenticationMetrics()
+	dataSources, auths, err = client.getAuthenticationMetrics(ctx)
 	if err != nil {
 		err = fmt.Errorf("collect authentication metrics failed. %w", err)
 		return
@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAuthenticationFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/authentication":
+			w.Write([]byte(`[{"id": "password_based:redis", "backend": "redis", "enable": true}]`))
+		case "/api/v5/authentication/password_based:redis/status":
+			w.Write([]byte(`{"status": "connected", "node_metrics": [
+				{"node": "emqx@emqx-0", "metrics": {"total": 10, "success": 5, "failed": 3, "nomatch": 2}}
+			]}`))
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewAuthenticationCollector(&client{emqxClient: newTestClient5x(server, "", "")})
+	expected := `
+# HELP emqx_authentication_failure_count The count of failed authentication by reason, denied for bad credentials, or ignored for a client unknown to the resource or a resource error
+# TYPE emqx_authentication_failure_count counter
+emqx_authentication_failure_count{node="emqx-0",reason="denied",resource="redis"} 3
+emqx_authentication_failure_count{node="emqx-0",reason="ignored",resource="redis"} 2
+`
+	if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected), "emqx_authentication_failure_count"); err != nil {
+		t.Error(err)
+	}
+}
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -113,8 +114,8 @@ func NewAuthorizationCollector(client *client) (Collector, error) {
 }
 
 // Update implements the Collector interface and will collect authorization metrics.
-func (c *AuthorizationCollector) Update(ch chan<- prometheus.Metric) error {
-	dataSources, metrics, err := doGetAuthorizationMetrics(c.client)
+func (c *AuthorizationCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	dataSources, metrics, err := doGetAuthorizationMetrics(ctx, c.client)
 	if err != nil {
 		return err
 	}
@@ -129,6 +130,7 @@ func (c *AuthorizationCollector) Update(ch chan<- prometheus.Metric) error {
 
 	for i := range metrics {
 		metric := &metrics[i]
+		labels := newLabelPairs(c.desc[authorizationTotal], metric.NodeName, metric.ResType)
 		bucket, err := getBucket(metric.ExecTimeCost)
 		if err != nil {
 			return err
@@ -139,30 +141,12 @@ func (c *AuthorizationCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(metric.ExecTimeCost["sum"]),
 			bucket, metric.NodeName, metric.ResType)
 
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationTotal],
-			prometheus.CounterValue, float64(metric.Total), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationAllowCount],
-			prometheus.CounterValue, float64(metric.AllowCount), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationDenyCount],
-			prometheus.CounterValue, float64(metric.DenyCount), metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationExecRate],
-			prometheus.GaugeValue, metric.ExecRate, metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationExecLast5mRate],
-			prometheus.GaugeValue, metric.ExecLast5mRate, metric.NodeName, metric.ResType,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[authorizationExecMaxRate],
-			prometheus.GaugeValue, metric.ExecMaxRate, metric.NodeName, metric.ResType,
-		)
+		ch <- labels.constMetric(c.desc[authorizationTotal], prometheus.CounterValue, float64(metric.Total))
+		ch <- labels.constMetric(c.desc[authorizationAllowCount], prometheus.CounterValue, float64(metric.AllowCount))
+		ch <- labels.constMetric(c.desc[authorizationDenyCount], prometheus.CounterValue, float64(metric.DenyCount))
+		ch <- labels.constMetric(c.desc[authorizationExecRate], prometheus.GaugeValue, metric.ExecRate)
+		ch <- labels.constMetric(c.desc[authorizationExecLast5mRate], prometheus.GaugeValue, metric.ExecLast5mRate)
+		ch <- labels.constMetric(c.desc[authorizationExecMaxRate], prometheus.GaugeValue, metric.ExecMaxRate)
 
 	}
 	return nil
@@ -181,14 +165,14 @@ type Authorization struct {
 	ExecTimeCost   map[string]uint64
 }
 
-func doGetAuthorizationMetrics(c *client) (dataSources []DataSource, auths []Authorization, err error) {
-	c.Lock()
-	defer c.Unlock()
+func doGetAuthorizationMetrics(ctx context.Context, c *client) (dataSources []DataSource, auths []Authorization, err error) {
+	c.RLock()
+	defer c.RUnlock()
 	client := c.emqxClient
 	if client == nil {
 		return
 	}
-	dataSources, auths, err = client.getAuthorizationMetrics()
+	dataSources, auths, err = client.getAuthorizationMetrics(ctx)
 	if err != nil {
 		err = fmt.Errorf("collect authorization metrics failed. %w", err)
 		return
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AuthorizationCacheSubsystem = "authorization_cache"
+)
+
+const (
+	authorizationCacheHits    = "hits"
+	authorizationCacheMisses  = "misses"
+	authorizationCacheEnabled = "enabled"
+	authorizationCacheMaxSize = "max_size"
+	authorizationCacheTTL     = "ttl_seconds"
+)
+
+func init() {
+	registerCollector(AuthorizationCacheSubsystem, NewAuthorizationCacheCollector)
+}
+
+type authorizationCacheCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewAuthorizationCacheCollector returns a new collector for the authorization cache, which the clients keep
+// of the results of the authorization sources
+func NewAuthorizationCacheCollector(client *client) (Collector, error) {
+	collector := &authorizationCacheCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   authorizationCacheHits,
+			help:   "The count of authorizations served from the cache of the clients",
+			labels: []string{"node"},
+		},
+		{
+			name:   authorizationCacheMisses,
+			help:   "The count of authorizations missing the cache of the clients, which are checked by the authorization sources",
+			labels: []string{"node"},
+		},
+		{
+			name: authorizationCacheEnabled,
+			help: "Whether the authorization cache is enabled",
+		},
+		{
+			name: authorizationCacheMaxSize,
+			help: "The max number of authorization results cached per client",
+		},
+		{
+			name: authorizationCacheTTL,
+			help: "How long an authorization result is cached in seconds",
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				AuthorizationCacheSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the authorization cache statistics.
+func (c *authorizationCacheCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	cache, err := doGetAuthorizationCache(ctx, c.client)
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		return nil
+	}
+
+	if s := cache.Settings; s != nil {
+		enabled := 0.0
+		if s.Enabled {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc[authorizationCacheEnabled], prometheus.GaugeValue, enabled)
+		ch <- prometheus.MustNewConstMetric(c.desc[authorizationCacheMaxSize], prometheus.GaugeValue, float64(s.MaxSize))
+		ch <- prometheus.MustNewConstMetric(c.desc[authorizationCacheTTL], prometheus.GaugeValue, s.TTL)
+	}
+	for _, node := range cache.Nodes {
+		ch <- prometheus.MustNewConstMetric(c.desc[authorizationCacheHits], prometheus.CounterValue, node.Hits, node.NodeName)
+		if cache.CountsMisses {
+			ch <- prometheus.MustNewConstMetric(c.desc[authorizationCacheMisses], prometheus.CounterValue, node.Misses, node.NodeName)
+		}
+	}
+	return nil
+}
+
+// AuthorizationCache is the authorization cache of a cluster. The cache is kept by each client, so its size
+// isn't exposed by EMQX but bounded by its settings
+type AuthorizationCache struct {
+	// Settings of the cache, nil if not exposed
+	Settings *AuthorizationCacheSettings
+	// CountsMisses tells whether the nodes count the cache misses
+	CountsMisses bool
+	Nodes        []AuthorizationCacheStats
+}
+
+type AuthorizationCacheSettings struct {
+	Enabled bool
+	MaxSize int64
+	// TTL in seconds
+	TTL float64
+}
+
+type AuthorizationCacheStats struct {
+	NodeName string
+	Hits     float64
+	Misses   float64
+}
+
+func doGetAuthorizationCache(ctx context.Context, c *client) (cache *AuthorizationCache, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	cache, err = client.getAuthorizationCache(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect authorization cache failed. %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAuthorizationCacheCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/metrics":
+			w.Write([]byte(`{"code": 0, "data": [{"node": "emqx@emqx-0", "metrics": {"client.acl.cache_hit": 7}}]}`))
+		case "/api/v5/metrics":
+			w.Write([]byte(`[
+				{"node": "emqx@emqx-0", "authorization.cache_hit": 90, "authorization.cache_miss": 10},
+				{"node": "emqx@emqx-1", "authorization.cache_hit": 80, "authorization.cache_miss": 20}
+			]`))
+		case "/api/v5/authorization/settings":
+			w.Write([]byte(`{"no_match": "allow", "cache": {"enable": true, "max_size": 32, "ttl": "1m"}}`))
+		}
+	}))
+	defer server.Close()
+
+	for name, test := range map[string]struct {
+		client   emqxClientInterface
+		expected string
+	}{
+		"4.x": {
+			client: newTestClient4x(server, "", ""),
+			expected: `
+# HELP emqx_authorization_cache_hits The count of authorizations served from the cache of the clients
+# TYPE emqx_authorization_cache_hits counter
+emqx_authorization_cache_hits{node="emqx-0"} 7
+`,
+		},
+		"5.x": {
+			client: newTestClient5x(server, "emqx@emqx-0", ""),
+			expected: `
+# HELP emqx_authorization_cache_enabled Whether the authorization cache is enabled
+# TYPE emqx_authorization_cache_enabled gauge
+emqx_authorization_cache_enabled 1
+# HELP emqx_authorization_cache_hits The count of authorizations served from the cache of the clients
+# TYPE emqx_authorization_cache_hits counter
+emqx_authorization_cache_hits{node="emqx-0"} 90
+# HELP emqx_authorization_cache_max_size The max number of authorization results cached per client
+# TYPE emqx_authorization_cache_max_size gauge
+emqx_authorization_cache_max_size 32
+# HELP emqx_authorization_cache_misses The count of authorizations missing the cache of the clients, which are checked by the authorization sources
+# TYPE emqx_authorization_cache_misses counter
+emqx_authorization_cache_misses{node="emqx-0"} 10
+# HELP emqx_authorization_cache_ttl_seconds How long an authorization result is cached in seconds
+# TYPE emqx_authorization_cache_ttl_seconds gauge
+emqx_authorization_cache_ttl_seconds 60
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewAuthorizationCacheCollector(&client{emqxClient: test.client})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(test.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
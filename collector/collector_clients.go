@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ClientsSubsystem = "clients"
+)
+
+const (
+	clientsConnections = "connections"
+)
+
+func init() {
+	registerCollector(ClientsSubsystem, NewClientsCollector)
+}
+
+type clientsCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+
+	// counts are those of the last paging through the clients, which is done once per slow refresh interval
+	sync.Mutex
+	counts  []ClientBucketCount
+	expires time.Time
+}
+
+// NewClientsCollector returns a new collector for the connections of the clients by buckets of their client IDs
+func NewClientsCollector(client *client) (Collector, error) {
+	collector := &clientsCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   clientsConnections,
+			help:   "The count of connected clients whose client ID matches the bucket",
+			labels: []string{"node", "bucket"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				ClientsSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the connections of the client buckets.
+func (c *clientsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	counts, err := c.clientBuckets(ctx, ch)
+	if err != nil {
+		return err
+	}
+
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc[clientsConnections], prometheus.GaugeValue, float64(count.Connections), count.NodeName, count.Bucket)
+	}
+	return nil
+}
+
+// clientBuckets returns the counts of the client buckets, paging through the clients again only once the counts
+// are older than the slow refresh interval, as they're a request per thousand clients. The pages fetched are sent
+// to ch along
+func (c *clientsCollector) clientBuckets(ctx context.Context, ch chan<- prometheus.Metric) ([]ClientBucketCount, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.counts != nil && time.Now().Before(c.expires) {
+		return c.counts, nil
+	}
+
+	ctx, pages := withPageTally(ctx)
+	counts, err := doGetClientBuckets(ctx, c.client)
+	if err != nil {
+		return nil, err
+	}
+	pages.collect(ch)
+	if c.client.requester != nil {
+		c.counts, c.expires = counts, time.Now().Add(c.client.requester.slowRefresh)
+	}
+	return counts, nil
+}
+
+// ClientBucketCount counts the connected clients of a bucket on a node
+type ClientBucketCount struct {
+	NodeName    string
+	Bucket      string
+	Connections int64
+}
+
+// clientData is a client listed by the clients API, of the fields counted by clientBuckets
+type clientData struct {
+	ClientID  string `json:"clientid"`
+	Node      string `json:"node"`
+	Connected bool   `json:"connected"`
+}
+
+// clientBuckets counts the connected clients by node and the first bucket their client ID matches,
+// as the pages of the clients are decoded
+type clientBuckets struct {
+	names   []string
+	regexes []*regexp.Regexp
+	counts  map[[2]string]*ClientBucketCount
+}
+
+func newClientBuckets(buckets []config.ClientBucket) *clientBuckets {
+	b := &clientBuckets{counts: make(map[[2]string]*ClientBucketCount)}
+	for _, bucket := range buckets {
+		b.names = append(b.names, bucket.Name)
+		// the regexes are validated while loading config
+		b.regexes = append(b.regexes, regexp.MustCompile("^(?:"+bucket.ClientID+")$"))
+	}
+	return b
+}
+
+// nodes counts the buckets of nodes at 0, so that a node with no clients of a bucket, or none at all, is told apart
+// from a node not collected
+func (b *clientBuckets) nodes(nodes []string) {
+	for _, node := range nodes {
+		b.node(node)
+	}
+}
+
+func (b *clientBuckets) node(node string) {
+	if _, ok := b.counts[[2]string{node, b.names[0]}]; ok {
+		return
+	}
+	for _, name := range b.names {
+		b.counts[[2]string{node, name}] = &ClientBucketCount{NodeName: node, Bucket: name}
+	}
+}
+
+// add counts a client of clientID connected to node
+func (b *clientBuckets) add(node, clientID string) {
+	b.node(node)
+	for i, re := range b.regexes {
+		if re.MatchString(clientID) {
+			b.counts[[2]string{node, b.names[i]}].Connections++
+			return
+		}
+	}
+}
+
+// buckets returns the counts, ordered by node and bucket
+func (b *clientBuckets) buckets() []ClientBucketCount {
+	counts := make([]ClientBucketCount, 0, len(b.counts))
+	for _, count := range b.counts {
+		counts = append(counts, *count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].NodeName != counts[j].NodeName {
+			return counts[i].NodeName < counts[j].NodeName
+		}
+		return counts[i].Bucket < counts[j].Bucket
+	})
+	return counts
+}
+
+func doGetClientBuckets(ctx context.Context, c *client) (counts []ClientBucketCount, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil || len(c.metrics.ClientBuckets) == 0 {
+		return
+	}
+	counts, err = client.getClientBuckets(ctx, newClientBuckets(c.metrics.ClientBuckets))
+	if err != nil {
+		err = fmt.Errorf("collect client bucket metrics failed. %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+func TestClientsCollector(t *testing.T) {
+	const clients = `[
+		{"clientid": "sensor-1", "node": "emqx@emqx-0", "connected": true},
+		{"clientid": "sensor-2", "node": "emqx@emqx-0", "connected": true},
+		{"clientid": "sensor-3", "node": "emqx@emqx-0", "connected": false},
+		{"clientid": "gateway-1", "node": "emqx@emqx-1", "connected": true},
+		{"clientid": "app-sensor-1", "node": "emqx@emqx-1", "connected": true},
+		{"clientid": "sensor-4", "node": "emqx@emqx-2", "connected": true}
+	]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/clients":
+			w.Write([]byte(`{"code": 0, "data": ` + clients + `, "meta": {"page": 1, "limit": 100, "count": 6}}`))
+		case "/api/v5/clients":
+			w.Write([]byte(`{"data": ` + clients + `, "meta": {"page": 1, "limit": 100, "count": 6}}`))
+		// emqx-3 has no clients
+		case "/api/v4/stats":
+			w.Write([]byte(`{"code": 0, "data": [
+				{"node": "emqx@emqx-0", "stats": {"connections.count": 2}},
+				{"node": "emqx@emqx-1", "stats": {"connections.count": 2}},
+				{"node": "emqx@emqx-2", "stats": {"connections.count": 1}},
+				{"node": "emqx@emqx-3", "stats": {"connections.count": 0}}
+			]}`))
+		case "/api/v5/stats":
+			w.Write([]byte(`[{"node": "emqx@emqx-0"}, {"node": "emqx@emqx-1"}, {"node": "emqx@emqx-2"}, {"node": "emqx@emqx-3"}]`))
+		}
+	}))
+	defer server.Close()
+	metrics := &config.Metrics{
+		Scheme: "http",
+		Target: strings.TrimPrefix(server.URL, "http://"),
+		ClientBuckets: []config.ClientBucket{
+			{Name: "sensor", ClientID: "sensor-.*"},
+			{Name: "gateway", ClientID: "gateway-.*"},
+		},
+	}
+	r := newRequester(metrics)
+
+	expected := `
+# HELP emqx_clients_connections The count of connected clients whose client ID matches the bucket
+# TYPE emqx_clients_connections gauge
+emqx_clients_connections{bucket="gateway",node="emqx-0"} 0
+emqx_clients_connections{bucket="gateway",node="emqx-1"} 1
+emqx_clients_connections{bucket="sensor",node="emqx-0"} 2
+emqx_clients_connections{bucket="sensor",node="emqx-1"} 0
+emqx_clients_connections{bucket="gateway",node="emqx-3"} 0
+emqx_clients_connections{bucket="sensor",node="emqx-3"} 0
+`
+	filter := newNodeFilter("", "emqx@emqx-2")
+	for name, c := range map[string]emqxClientInterface{
+		"4.x": &client4x{requester: r, nodeName: newNodeNameNormalizer(nil), nodeFilter: filter},
+		"5.x": &client5x{requester: r, nodeName: newNodeNameNormalizer(nil), nodeFilter: filter},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewClientsCollector(&client{emqxClient: c, metrics: metrics})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected), "emqx_clients_connections"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestClientsCollectorSlowRefresh(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/clients":
+			atomic.AddInt32(&requests, 1)
+			// the count is left out, the page tells there's no next one
+			w.Write([]byte(`{"data": [{"clientid": "sensor-1", "node": "emqx@emqx-0", "connected": true}], "meta": {"page": 1, "limit": 100, "hasnext": false}}`))
+		case "/api/v5/stats":
+			w.Write([]byte(`[{"node": "emqx@emqx-0"}]`))
+		}
+	}))
+	defer server.Close()
+	metrics := &config.Metrics{
+		Scheme:              "http",
+		Target:              strings.TrimPrefix(server.URL, "http://"),
+		SlowRefreshInterval: model.Duration(time.Hour),
+		ClientBuckets:       []config.ClientBucket{{Name: "sensor", ClientID: "sensor-.*"}},
+	}
+	r := newRequester(metrics)
+	c, _ := NewClientsCollector(&client{
+		emqxClient: &client5x{requester: r, nodeName: newNodeNameNormalizer(nil), nodeFilter: newNodeFilter("", "")},
+		requester:  r,
+		metrics:    metrics,
+	})
+
+	expected := `
+# HELP emqx_clients_connections The count of connected clients whose client ID matches the bucket
+# TYPE emqx_clients_connections gauge
+emqx_clients_connections{bucket="sensor",node="emqx-0"} 1
+`
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected), "emqx_clients_connections"); err != nil {
+			t.Error(err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the clients paged through once per slow refresh interval, got %d requests", n)
+	}
+}
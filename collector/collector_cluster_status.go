@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,6 +26,7 @@ const (
 
 const (
 	clusterStatus = "status"
+	clusterNodes  = "nodes"
 	nodeUptime    = "node_uptime"
 	nodeMaxFDs    = "node_max_fds"
 	cpuLoad       = "cpu_load"
@@ -55,6 +57,11 @@ func NewClusterStatusCollector(client *client) (Collector, error) {
 			name: clusterStatus,
 			help: "The status of cluster",
 		},
+		{
+			name:   clusterNodes,
+			help:   "The number of nodes of the cluster by status, like running or stopped",
+			labels: []string{"status"},
+		},
 		{
 			name:   nodeUptime,
 			help:   "the node uptime",
@@ -88,8 +95,8 @@ func NewClusterStatusCollector(client *client) (Collector, error) {
 }
 
 // Update implements the Collector interface and will collect cluster status.
-func (c *clusterStatusCollector) Update(ch chan<- prometheus.Metric) error {
-	status, err := doGetClusterStatus(c.client)
+func (c *clusterStatusCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	status, err := doGetClusterStatus(ctx, c.client)
 	if err != nil {
 		return err
 	}
@@ -98,6 +105,12 @@ func (c *clusterStatusCollector) Update(ch chan<- prometheus.Metric) error {
 		c.desc[clusterStatus],
 		prometheus.GaugeValue, float64(status.Status),
 	)
+	for nodeStatus, count := range status.Nodes {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc[clusterNodes],
+			prometheus.GaugeValue, float64(count), nodeStatus,
+		)
+	}
 	for node, uptime := range status.NodeUptime {
 		ch <- prometheus.MustNewConstMetric(
 			c.desc[nodeUptime],
@@ -128,7 +141,9 @@ func (c *clusterStatusCollector) Update(ch chan<- prometheus.Metric) error {
 }
 
 type ClusterStatus struct {
-	Status     int
+	Status int
+	// Nodes counts all nodes of the cluster by their lowercase status, with running and stopped always present
+	Nodes      map[string]int
 	NodeUptime map[string]int64
 	NodeMaxFDs map[string]int
 	CPULoads   map[string]CPULoad
@@ -140,14 +155,19 @@ type CPULoad struct {
 	Load15 float64
 }
 
-func doGetClusterStatus(c *client) (status ClusterStatus, err error) {
-	c.Lock()
-	defer c.Unlock()
+// newNodeCounts returns the node counts of a cluster with none running or stopped
+func newNodeCounts() map[string]int {
+	return map[string]int{"running": 0, "stopped": 0}
+}
+
+func doGetClusterStatus(ctx context.Context, c *client) (status ClusterStatus, err error) {
+	c.RLock()
+	defer c.RUnlock()
 	client := c.emqxClient
 	if client == nil {
 		return
 	}
-	status, err = client.getClusterStatus()
+	status, err = client.getClusterStatus(ctx)
 	if err != nil {
 		err = fmt.Errorf("collect cluster status failed. %w", err)
 		return
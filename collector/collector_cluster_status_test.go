@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClusterNodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"node": "emqx@emqx-0", "node_status": "running", "uptime": 60000},
+			{"node": "emqx@emqx-1", "node_status": "running", "uptime": 60000},
+			{"node": "emqx@emqx-2", "node_status": "stopped"}
+		]`))
+	}))
+	defer server.Close()
+
+	c := newTestClient5x(server, "emqx@emqx-0", "")
+	status, err := c.getClusterStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nodes filtered out still count
+	if expected := map[string]int{"running": 2, "stopped": 1}; !reflect.DeepEqual(status.Nodes, expected) {
+		t.Errorf("Expected the nodes %v, got %v", expected, status.Nodes)
+	}
+	if len(status.NodeUptime) != 1 {
+		t.Errorf("Expected the uptime of the node selected only, got %v", status.NodeUptime)
+	}
+
+	c.nodeFilter = newNodeFilter("", "")
+	if status, err = c.getClusterStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := status.NodeUptime["emqx-2"]; ok || len(status.NodeUptime) != 2 {
+		t.Errorf("Expected no uptime of the node stopped, got %v", status.NodeUptime)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"node": "emqx@emqx-0", "node_status": "running"}]`))
+	})
+	if status, err = c.getClusterStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int{"running": 1, "stopped": 0}; !reflect.DeepEqual(status.Nodes, expected) {
+		t.Errorf("Expected no node stopped to be counted as 0, got %v", status.Nodes)
+	}
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ExHookSubsystem = "exhook"
+)
+
+const (
+	exhookStatus         = "status"
+	exhookRequestTimeout = "request_timeout_seconds"
+	exhookHookSucceed    = "hook_succeed"
+	exhookHookFailed     = "hook_failed"
+	exhookHookRate       = "hook_rate"
+)
+
+func init() {
+	registerCollector(ExHookSubsystem, NewExHookCollector)
+}
+
+type exhookCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewExHookCollector returns a new collector for the ExHook servers, the gRPC servers the hooks of EMQX are extended by
+func NewExHookCollector(client *client) (Collector, error) {
+	collector := &exhookCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   exhookStatus,
+			help:   "The status of ExHook server",
+			labels: []string{"server"},
+		},
+		{
+			name:   exhookRequestTimeout,
+			help:   "The timeout of the requests to the ExHook server in seconds",
+			labels: []string{"server"},
+		},
+		{
+			name:   exhookHookSucceed,
+			help:   "The count of succeeded calls of the hook to the ExHook server",
+			labels: []string{"server", "hook", "node"},
+		},
+		{
+			name:   exhookHookFailed,
+			help:   "The count of failed calls of the hook to the ExHook server, including the timed out ones",
+			labels: []string{"server", "hook", "node"},
+		},
+		{
+			name:   exhookHookRate,
+			help:   "The rate of the calls of the hook to the ExHook server",
+			labels: []string{"server", "hook", "node"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				ExHookSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the ExHook metrics.
+func (c *exhookCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	servers, err := doGetExHookMetrics(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	for i := range servers {
+		s := &servers[i]
+		ch <- prometheus.MustNewConstMetric(c.desc[exhookStatus], prometheus.GaugeValue, float64(s.Status), s.Name)
+		ch <- prometheus.MustNewConstMetric(c.desc[exhookRequestTimeout], prometheus.GaugeValue, s.RequestTimeout, s.Name)
+		for _, h := range s.Hooks {
+			ch <- prometheus.MustNewConstMetric(c.desc[exhookHookSucceed], prometheus.CounterValue, float64(h.Succeed), s.Name, h.Name, h.NodeName)
+			ch <- prometheus.MustNewConstMetric(c.desc[exhookHookFailed], prometheus.CounterValue, float64(h.Failed), s.Name, h.Name, h.NodeName)
+			ch <- prometheus.MustNewConstMetric(c.desc[exhookHookRate], prometheus.GaugeValue, h.Rate, s.Name, h.Name, h.NodeName)
+		}
+	}
+	return nil
+}
+
+// ExHook is an ExHook server enabled
+type ExHook struct {
+	Name   string
+	Status int
+	// RequestTimeout in seconds
+	RequestTimeout float64
+	Hooks          []ExHookHook
+}
+
+// ExHookHook is the metrics of a hook of an ExHook server on a node.
+// EMQX doesn't expose the latency of the calls, but counts those timed out as failed
+type ExHookHook struct {
+	Name     string
+	NodeName string
+	Succeed  int64
+	Failed   int64
+	Rate     float64
+}
+
+func doGetExHookMetrics(ctx context.Context, c *client) (servers []ExHook, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	servers, err = client.getExHookMetrics(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect exhook metrics failed. %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExHookCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/exhooks":
+			w.Write([]byte(`[
+				{"name": "default", "enable": true, "status": "connected", "request_timeout": "5s"},
+				{"name": "disabled", "enable": false, "status": "disconnected", "request_timeout": "5s"}
+			]`))
+		case "/api/v5/exhooks/default/hooks":
+			w.Write([]byte(`[{"name": "message.publish", "node_metrics": [
+				{"node": "emqx@emqx-0", "metrics": {"succeed": 100, "failed": 3, "rate": 1.5}}
+			]}]`))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewExHookCollector(&client{emqxClient: newTestClient5x(server, "", "")})
+	expected := `
+# HELP emqx_exhook_hook_failed The count of failed calls of the hook to the ExHook server, including the timed out ones
+# TYPE emqx_exhook_hook_failed counter
+emqx_exhook_hook_failed{hook="message.publish",node="emqx-0",server="default"} 3
+# HELP emqx_exhook_hook_rate The rate of the calls of the hook to the ExHook server
+# TYPE emqx_exhook_hook_rate gauge
+emqx_exhook_hook_rate{hook="message.publish",node="emqx-0",server="default"} 1.5
+# HELP emqx_exhook_hook_succeed The count of succeeded calls of the hook to the ExHook server
+# TYPE emqx_exhook_hook_succeed counter
+emqx_exhook_hook_succeed{hook="message.publish",node="emqx-0",server="default"} 100
+# HELP emqx_exhook_request_timeout_seconds The timeout of the requests to the ExHook server in seconds
+# TYPE emqx_exhook_request_timeout_seconds gauge
+emqx_exhook_request_timeout_seconds{server="default"} 5
+# HELP emqx_exhook_status The status of ExHook server
+# TYPE emqx_exhook_status gauge
+emqx_exhook_status{server="default"} 2
+`
+	if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
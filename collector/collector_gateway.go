@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GatewaySubsystem = "gateway"
+)
+
+const (
+	gatewayStatus         = "status"
+	gatewayConnections    = "connections"
+	gatewayMaxConnections = "max_connections"
+	gatewayListenerStatus = "listener_status"
+)
+
+func init() {
+	registerCollector(GatewaySubsystem, NewGatewayCollector)
+}
+
+type gatewayCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewGatewayCollector returns a new collector for the gateways, like LwM2M, CoAP and MQTT-SN
+func NewGatewayCollector(client *client) (Collector, error) {
+	collector := &gatewayCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   gatewayStatus,
+			help:   "The status of gateway",
+			labels: []string{"gateway"},
+		},
+		{
+			name:   gatewayConnections,
+			help:   "The count of clients connected to the gateway",
+			labels: []string{"gateway", "node"},
+		},
+		{
+			name:   gatewayMaxConnections,
+			help:   "The max count of clients connected to the gateway",
+			labels: []string{"gateway"},
+		},
+		{
+			name:   gatewayListenerStatus,
+			help:   "The status of gateway listener",
+			labels: []string{"gateway", "listener"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				GatewaySubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the gateway metrics.
+func (c *gatewayCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	gateways, err := doGetGatewayMetrics(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	for i := range gateways {
+		gw := &gateways[i]
+		ch <- prometheus.MustNewConstMetric(c.desc[gatewayStatus], prometheus.GaugeValue, float64(gw.Status), gw.Name)
+		ch <- prometheus.MustNewConstMetric(c.desc[gatewayMaxConnections], prometheus.GaugeValue, float64(gw.MaxConnections), gw.Name)
+		for node, connections := range gw.Connections {
+			ch <- prometheus.MustNewConstMetric(c.desc[gatewayConnections], prometheus.GaugeValue, float64(connections), gw.Name, node)
+		}
+		for listener, status := range gw.Listeners {
+			ch <- prometheus.MustNewConstMetric(c.desc[gatewayListenerStatus], prometheus.GaugeValue, float64(status), gw.Name, listener)
+		}
+	}
+	return nil
+}
+
+// Gateway is a gateway loaded on the cluster
+type Gateway struct {
+	Name           string
+	Status         int
+	MaxConnections int64
+	// Connections counts the clients connected to the listeners of the gateway by node
+	Connections map[string]int64
+	// Listeners are the statuses of the listeners by id
+	Listeners map[string]int
+}
+
+func doGetGatewayMetrics(ctx context.Context, c *client) (gateways []Gateway, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	gateways, err = client.getGatewayMetrics(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect gateway metrics failed. %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGatewayCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/gateways":
+			w.Write([]byte(`[
+				{"name": "coap", "status": "running", "max_connections": 1024},
+				{"name": "mqttsn", "status": "stopped", "max_connections": 512},
+				{"name": "lwm2m", "status": "unloaded"}
+			]`))
+		case "/api/v5/gateways/coap/listeners":
+			w.Write([]byte(`[
+				{"id": "coap:udp:default", "running": true, "node_status": [
+					{"node": "emqx@emqx-0", "status": {"running": true, "current_connections": 3}},
+					{"node": "emqx@emqx-1", "status": {"running": true, "current_connections": 4}}
+				]},
+				{"id": "coap:dtls:default", "running": true, "node_status": [
+					{"node": "emqx@emqx-0", "status": {"running": true, "current_connections": 2}}
+				]}
+			]`))
+		case "/api/v5/gateways/mqttsn/listeners":
+			w.Write([]byte(`[{"id": "mqttsn:udp:default", "running": false}]`))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewGatewayCollector(&client{emqxClient: newTestClient5x(server, "", "")})
+	expected := `
+# HELP emqx_gateway_connections The count of clients connected to the gateway
+# TYPE emqx_gateway_connections gauge
+emqx_gateway_connections{gateway="coap",node="emqx-0"} 5
+emqx_gateway_connections{gateway="coap",node="emqx-1"} 4
+# HELP emqx_gateway_listener_status The status of gateway listener
+# TYPE emqx_gateway_listener_status gauge
+emqx_gateway_listener_status{gateway="coap",listener="coap:dtls:default"} 2
+emqx_gateway_listener_status{gateway="coap",listener="coap:udp:default"} 2
+emqx_gateway_listener_status{gateway="mqttsn",listener="mqttsn:udp:default"} 1
+# HELP emqx_gateway_max_connections The max count of clients connected to the gateway
+# TYPE emqx_gateway_max_connections gauge
+emqx_gateway_max_connections{gateway="coap"} 1024
+emqx_gateway_max_connections{gateway="mqttsn"} 512
+# HELP emqx_gateway_status The status of gateway
+# TYPE emqx_gateway_status gauge
+emqx_gateway_status{gateway="coap"} 2
+emqx_gateway_status{gateway="mqttsn"} 1
+`
+	if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
@@ -27,6 +28,8 @@ const (
 
 const (
 	maxClientLimit    = "max_client_limit"
+	maxSessions       = "max_sessions"
+	sessionsUsed      = "sessions_used"
 	licenseExpiration = "expiration_time"
 	remainingDays     = "remaining_days"
 )
@@ -55,6 +58,14 @@ func NewLicenseCollector(client *client) (Collector, error) {
 			name: maxClientLimit,
 			help: "The client limit of license",
 		},
+		{
+			name: maxSessions,
+			help: "The max sessions of license, like max_client_limit",
+		},
+		{
+			name: sessionsUsed,
+			help: "The sessions of the cluster counted against the max sessions of license",
+		},
 		{
 			name: licenseExpiration,
 			help: "The expiration time of license",
@@ -81,8 +92,8 @@ func NewLicenseCollector(client *client) (Collector, error) {
 }
 
 // Update implements the Collector interface and will collect license info.
-func (c *licenseCollector) Update(ch chan<- prometheus.Metric) error {
-	lic, err := doGetLicense(c.client)
+func (c *licenseCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	lic, err := doGetLicense(ctx, c.client)
 	if err != nil {
 		return err
 	}
@@ -95,6 +106,14 @@ func (c *licenseCollector) Update(ch chan<- prometheus.Metric) error {
 		c.desc[maxClientLimit],
 		prometheus.GaugeValue, float64(lic.MaxClientLimit),
 	)
+	ch <- prometheus.MustNewConstMetric(
+		c.desc[maxSessions],
+		prometheus.GaugeValue, float64(lic.MaxClientLimit),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.desc[sessionsUsed],
+		prometheus.GaugeValue, lic.SessionsUsed,
+	)
 	ch <- prometheus.MustNewConstMetric(
 		c.desc[licenseExpiration],
 		prometheus.GaugeValue, float64(lic.Expiration),
@@ -111,16 +130,18 @@ type LicenseInfo struct {
 	MaxClientLimit int64
 	Expiration     int64
 	RemainingDays  float64
+	// SessionsUsed are the connections of the whole cluster, which the license limits
+	SessionsUsed float64
 }
 
-func doGetLicense(c *client) (lic *LicenseInfo, err error) {
-	c.Lock()
-	defer c.Unlock()
+func doGetLicense(ctx context.Context, c *client) (lic *LicenseInfo, err error) {
+	c.RLock()
+	defer c.RUnlock()
 	client := c.emqxClient
 	if client == nil {
 		return
 	}
-	lic, err = client.getLicense()
+	lic, err = client.getLicense(ctx)
 	if err != nil || lic == nil {
 		return
 	}
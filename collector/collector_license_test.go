@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLicenseCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/license":
+			w.Write([]byte(`{"code": 0, "data": {"max_connections": 100, "expiry_at": "2099-01-01 00:00:00"}}`))
+		case "/api/v4/stats":
+			w.Write([]byte(`{"code": 0, "data": [{"node": "emqx@emqx-0", "stats": {"connections.count": 30}}, {"node": "emqx@emqx-1", "stats": {"connections.count": 12}}]}`))
+		case "/api/v5/license":
+			w.Write([]byte(`{"max_connections": 1000, "expiry_at": "2099-01-01"}`))
+		case "/api/v5/stats":
+			w.Write([]byte(`[{"node": "emqx@emqx-0", "live_connections.count": 300, "connections.count": 310}, {"node": "emqx@emqx-1", "connections.count": 20}]`))
+		}
+	}))
+	defer server.Close()
+
+	expected := func(limit, used string) string {
+		return `
+# HELP emqx_license_max_client_limit The client limit of license
+# TYPE emqx_license_max_client_limit gauge
+emqx_license_max_client_limit ` + limit + `
+# HELP emqx_license_max_sessions The max sessions of license, like max_client_limit
+# TYPE emqx_license_max_sessions gauge
+emqx_license_max_sessions ` + limit + `
+# HELP emqx_license_sessions_used The sessions of the cluster counted against the max sessions of license
+# TYPE emqx_license_sessions_used gauge
+emqx_license_sessions_used ` + used + `
+`
+	}
+	// the sessions of the nodes not selected are counted too, as the license limits the whole cluster
+	v4, v5, openSource5x := newTestClient4x(server, "emqx-0", ""), newTestClient5x(server, "emqx-0", ""), newTestClient5x(server, "emqx-0", "")
+	v4.edition, v5.edition, openSource5x.edition = enterprise, enterprise, openSource
+	for name, test := range map[string]struct {
+		client   emqxClientInterface
+		expected string
+	}{
+		"4.x": {
+			client:   v4,
+			expected: expected("100", "42"),
+		},
+		"5.x": {
+			client:   v5,
+			expected: expected("1000", "320"),
+		},
+		"open source": {
+			client: openSource5x,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewLicenseCollector(&client{emqxClient: test.client})
+			err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(test.expected),
+				"emqx_license_max_client_limit", "emqx_license_max_sessions", "emqx_license_sessions_used")
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ListenerSubsystem = "listener"
+)
+
+const (
+	listenerTLSErrors = "tls_errors"
+)
+
+// tlsErrorRE matches the reasons the connections of a TLS listener were shut down for by an explicit TLS failure:
+// a failed handshake, a TLS alert or a certificate error, rather than by a TLS connection closed like `ssl_closed`
+var tlsErrorRE = regexp.MustCompile(`(?i)handshake|alert|cert|unknown_ca`)
+
+func init() {
+	registerCollector(ListenerSubsystem, NewListenerCollector)
+}
+
+type listenerCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewListenerCollector returns a new collector for the TLS errors of the listeners
+func NewListenerCollector(client *client) (Collector, error) {
+	collector := &listenerCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   listenerTLSErrors,
+			help:   "The connections of the TLS listener shut down by a TLS error, like a failed handshake or a bad certificate, by reason",
+			labels: []string{"node", "listener", "reason"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				ListenerSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the TLS errors of the listeners.
+func (c *listenerCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	listeners, err := doGetListenerMetrics(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range listeners {
+		for reason, count := range l.ShutdownCount {
+			if !tlsErrorRE.MatchString(reason) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.desc[listenerTLSErrors],
+				prometheus.CounterValue, float64(count), l.NodeName, l.ID, reason,
+			)
+		}
+	}
+	return nil
+}
+
+// Listener is a TLS listener of a node
+type Listener struct {
+	NodeName string
+	ID       string
+	// ShutdownCount counts the connections shut down by reason, as far as EMQX exposes them
+	ShutdownCount map[string]int64
+}
+
+// shutdownCount is the shutdown counts of a listener, which EMQX encodes as an empty array if there is none
+type shutdownCount map[string]int64
+
+func (s *shutdownCount) UnmarshalJSON(data []byte) error {
+	var counts map[string]int64
+	if err := json.Unmarshal(data, &counts); err == nil {
+		*s = counts
+		return nil
+	}
+	var empty []struct{}
+	if err := json.Unmarshal(data, &empty); err != nil || len(empty) != 0 {
+		return fmt.Errorf("unexpected shutdown count %s", data)
+	}
+	*s = nil
+	return nil
+}
+
+// nodeStatuses are the statuses of a listener by node, which EMQX encodes as a list of the nodes with their status,
+// or as an object of them by node
+type nodeStatuses map[string]listenerStatus
+
+type listenerStatus struct {
+	Running            bool
+	CurrentConnections int64         `json:"current_connections"`
+	ShutdownCount      shutdownCount `json:"shutdown_count"`
+}
+
+func (s *nodeStatuses) UnmarshalJSON(data []byte) error {
+	var list []struct {
+		Node   string
+		Status listenerStatus
+	}
+	if err := json.Unmarshal(data, &list); err == nil {
+		*s = make(nodeStatuses, len(list))
+		for _, node := range list {
+			(*s)[node.Node] = node.Status
+		}
+		return nil
+	}
+	var statuses map[string]listenerStatus
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return err
+	}
+	*s = statuses
+	return nil
+}
+
+func doGetListenerMetrics(ctx context.Context, c *client) (listeners []Listener, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	listeners, err = client.getListenerMetrics(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect listener metrics failed. %w", err)
+		return
+	}
+	return
+}
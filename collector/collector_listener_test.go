@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestListenerCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/listeners":
+			w.Write([]byte(`{"code": 0, "data": [{"node": "emqx@emqx-0", "listeners": [
+				{"protocol": "mqtt:tcp", "identifier": "mqtt:tcp:external", "shutdown_count": {"ssl_error": 1}},
+				{"protocol": "mqtt:ssl", "identifier": "mqtt:ssl:external", "shutdown_count": {"tls_alert": 3, "ssl_closed": 4, "closed": 10}},
+				{"protocol": "mqtt:wss", "identifier": "mqtt:wss:external", "shutdown_count": []}
+			]}]}`))
+		case "/api/v5/listeners":
+			w.Write([]byte(`[
+				{"id": "tcp:default", "type": "tcp", "node_status": {"emqx@emqx-0": {"shutdown_count": {"ssl_error": 1}}}},
+				{"id": "ssl:default", "type": "ssl", "node_status": {"emqx@emqx-0": {"shutdown_count": {"handshake_timeout": 2, "bad_certificate": 1}}, "emqx@emqx-1": {}}},
+				{"id": "wss:default", "type": "wss", "node_status": [{"node": "emqx@emqx-0", "status": {"running": true, "shutdown_count": {"ssl_closed": 1}}}]}
+			]`))
+		}
+	}))
+	defer server.Close()
+
+	// the TLS connections closed, like by ssl_closed, aren't TLS errors
+	for name, test := range map[string]struct {
+		client   emqxClientInterface
+		expected string
+	}{
+		"4.x": {
+			client: newTestClient4x(server, "", ""),
+			expected: `
+# HELP emqx_listener_tls_errors The connections of the TLS listener shut down by a TLS error, like a failed handshake or a bad certificate, by reason
+# TYPE emqx_listener_tls_errors counter
+emqx_listener_tls_errors{listener="mqtt:ssl:external",node="emqx-0",reason="tls_alert"} 3
+`,
+		},
+		"5.x": {
+			client: newTestClient5x(server, "", ""),
+			expected: `
+# HELP emqx_listener_tls_errors The connections of the TLS listener shut down by a TLS error, like a failed handshake or a bad certificate, by reason
+# TYPE emqx_listener_tls_errors counter
+emqx_listener_tls_errors{listener="ssl:default",node="emqx-0",reason="bad_certificate"} 1
+emqx_listener_tls_errors{listener="ssl:default",node="emqx-0",reason="handshake_timeout"} 2
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewListenerCollector(&client{emqxClient: test.client})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(test.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	NamespaceSubsystem = "namespace"
+)
+
+const (
+	namespaceClientCount = "client_count"
+)
+
+func init() {
+	registerCollector(NamespaceSubsystem, NewNamespaceCollector)
+}
+
+type namespaceCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewNamespaceCollector returns a new collector for the multi-tenancy namespaces
+func NewNamespaceCollector(client *client) (Collector, error) {
+	collector := &namespaceCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   namespaceClientCount,
+			help:   "The count of clients in the namespace",
+			labels: []string{"namespace"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				NamespaceSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect namespace metrics.
+func (c *namespaceCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ctx, pages := withPageTally(ctx)
+	// the namespaces collected are sent even if others failed
+	namespaces, err := doGetNamespaceMetrics(ctx, c.client)
+	pages.collect(ch)
+
+	for i := range namespaces {
+		ns := &namespaces[i]
+		ch <- prometheus.MustNewConstMetric(
+			c.desc[namespaceClientCount],
+			prometheus.GaugeValue, float64(ns.ClientCount), ns.Name,
+		)
+	}
+	return err
+}
+
+type Namespace struct {
+	Name        string
+	ClientCount int64
+}
+
+func doGetNamespaceMetrics(ctx context.Context, c *client) (namespaces []Namespace, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil || len(c.metrics.Namespaces) == 0 {
+		return
+	}
+	namespaces, err = client.getNamespaceMetrics(ctx, c.metrics.Namespaces)
+	if err != nil {
+		err = fmt.Errorf("collect namespace metrics failed. %w", err)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNamespaceCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/mt/ns_list":
+			// the namespaces are listed after last_ns, 2 per page
+			switch r.URL.Query().Get("last_ns") {
+			case "":
+				w.Write([]byte(`["tenant-a", "tenant-b"]`))
+			case "tenant-b":
+				w.Write([]byte(`["tenant-c"]`))
+			default:
+				w.Write([]byte(`[]`))
+			}
+		case "/api/v5/mt/ns/tenant-a/client_count":
+			w.Write([]byte(`{"count": 10}`))
+		case "/api/v5/mt/ns/tenant-b/client_count":
+			w.Write([]byte(`{"count": 0}`))
+		case "/api/v5/mt/ns/tenant-c/client_count":
+			w.Write([]byte(`{"count": 3}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for name, c := range map[string]struct {
+		namespaces []string
+		expected   string
+	}{
+		"listed": {
+			namespaces: []string{"tenant-a", "tenant-c"},
+			expected: `
+# HELP emqx_namespace_client_count The count of clients in the namespace
+# TYPE emqx_namespace_client_count gauge
+emqx_namespace_client_count{namespace="tenant-a"} 10
+emqx_namespace_client_count{namespace="tenant-c"} 3
+`,
+		},
+		"all": {
+			namespaces: []string{"*"},
+			expected: `
+# HELP emqx_namespace_client_count The count of clients in the namespace
+# TYPE emqx_namespace_client_count gauge
+emqx_namespace_client_count{namespace="tenant-a"} 10
+emqx_namespace_client_count{namespace="tenant-b"} 0
+emqx_namespace_client_count{namespace="tenant-c"} 3
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			metrics := &config.Metrics{
+				Scheme:     "http",
+				Target:     strings.TrimPrefix(server.URL, "http://"),
+				PageSize:   2,
+				Namespaces: c.namespaces,
+			}
+			client := &client{emqxClient: &client5x{edition: enterprise, requester: newRequester(metrics)}, metrics: metrics}
+			collector, _ := NewNamespaceCollector(client)
+			if err := testutil.CollectAndCompare(collectorFunc(collector), strings.NewReader(c.expected), "emqx_namespace_client_count"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// a failing namespace fails the collector, but doesn't discard the others
+	metrics := &config.Metrics{Scheme: "http", Target: strings.TrimPrefix(server.URL, "http://"), Namespaces: []string{"tenant-a", "tenant-x", "tenant-c"}}
+	collector, _ := NewNamespaceCollector(&client{emqxClient: &client5x{edition: enterprise, requester: newRequester(metrics)}, metrics: metrics})
+	collected, err := collectAll(context.Background(), collector)
+	if err == nil || !strings.Contains(err.Error(), `namespace "tenant-x"`) {
+		t.Errorf("Expected the error of the failing namespace, got %v", err)
+	}
+	if len(collected) != 2 {
+		t.Errorf("Expected the 2 namespaces collected, got %d metrics", len(collected))
+	}
+
+	// the namespaces are of EMQX Enterprise only
+	metrics = &config.Metrics{Scheme: "http", Target: strings.TrimPrefix(server.URL, "http://"), Namespaces: []string{"*"}}
+	collector, _ = NewNamespaceCollector(&client{emqxClient: &client5x{edition: openSource, requester: newRequester(metrics)}, metrics: metrics})
+	if n := testutil.CollectAndCount(collectorFunc(collector)); n != 0 {
+		t.Errorf("Expected no namespace of the open source edition, got %d metrics", n)
+	}
+}
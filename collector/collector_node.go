@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	NodeSubsystem = "node"
+)
+
+const (
+	nodeRunQueue       = "run_queue"
+	nodeClusterRPCTxID = "cluster_rpc_txid"
+	nodeClusterRPCLag  = "cluster_rpc_lag"
+)
+
+func init() {
+	registerCollector(NodeSubsystem, NewNodeCollector)
+}
+
+type nodeCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewNodeCollector returns a new collector for the Erlang VM of the nodes and their replication of the configuration
+func NewNodeCollector(client *client) (Collector, error) {
+	collector := &nodeCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   nodeRunQueue,
+			help:   "The count of Erlang processes ready to run and waiting for a scheduler, which grows with the CPU saturation of the broker",
+			labels: []string{"node"},
+		},
+		{
+			name:   nodeClusterRPCTxID,
+			help:   "The ID of the last transaction of the cluster configuration applied by the node",
+			labels: []string{"node"},
+		},
+		{
+			name:   nodeClusterRPCLag,
+			help:   "The transactions of the cluster configuration pending on the node, behind the node the furthest ahead",
+			labels: []string{"node"},
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				NodeSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the metrics of the nodes.
+func (c *nodeCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	nodes, err := doGetNodes(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.RunQueue != nil {
+			ch <- prometheus.MustNewConstMetric(c.desc[nodeRunQueue], prometheus.GaugeValue, *node.RunQueue, node.NodeName)
+		}
+		if node.ClusterRPC != nil {
+			ch <- prometheus.MustNewConstMetric(c.desc[nodeClusterRPCTxID], prometheus.GaugeValue, node.ClusterRPC.TxID, node.NodeName)
+			ch <- prometheus.MustNewConstMetric(c.desc[nodeClusterRPCLag], prometheus.GaugeValue, node.ClusterRPC.Lag, node.NodeName)
+		}
+	}
+	return nil
+}
+
+// Node is the Erlang VM of a node and its replication of the configuration, nil if not exposed
+type Node struct {
+	NodeName   string
+	RunQueue   *float64
+	ClusterRPC *ClusterRPC
+}
+
+// ClusterRPC is the replication of the configuration of a node by the cluster_rpc transactions
+type ClusterRPC struct {
+	TxID float64
+	// Lag are the transactions behind the node the furthest ahead, whether selected or not
+	Lag float64
+}
+
+func doGetNodes(ctx context.Context, c *client) (nodes []Node, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	nodes, err = client.getNodes(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect node metrics failed. %w", err)
+		return
+	}
+	return
+}
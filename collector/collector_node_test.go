@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNodeCollector(t *testing.T) {
+	// the lag is behind the node the furthest ahead, even if not selected
+	for name, test := range map[string]struct {
+		resp     string
+		expected string
+	}{
+		"by node": {
+			resp: `{
+				"metrics": [{"node": "emqx@emqx-0", "emqx_vm_run_queue": 3}, {"node": "emqx@emqx-1", "emqx_vm_run_queue": 0}, {"node": "emqx@emqx-2", "emqx_vm_run_queue": 1}],
+				"stats": [{"node": "emqx@emqx-0", "emqx_conf_sync_txid": 40}, {"node": "emqx@emqx-1", "emqx_conf_sync_txid": 38}, {"node": "emqx@emqx-2", "emqx_conf_sync_txid": 42}]
+			}`,
+			expected: `
+# HELP emqx_node_cluster_rpc_lag The transactions of the cluster configuration pending on the node, behind the node the furthest ahead
+# TYPE emqx_node_cluster_rpc_lag gauge
+emqx_node_cluster_rpc_lag{node="emqx-0"} 2
+emqx_node_cluster_rpc_lag{node="emqx-1"} 4
+# HELP emqx_node_cluster_rpc_txid The ID of the last transaction of the cluster configuration applied by the node
+# TYPE emqx_node_cluster_rpc_txid gauge
+emqx_node_cluster_rpc_txid{node="emqx-0"} 40
+emqx_node_cluster_rpc_txid{node="emqx-1"} 38
+# HELP emqx_node_run_queue The count of Erlang processes ready to run and waiting for a scheduler, which grows with the CPU saturation of the broker
+# TYPE emqx_node_run_queue gauge
+emqx_node_run_queue{node="emqx-0"} 3
+emqx_node_run_queue{node="emqx-1"} 0
+`,
+		},
+		"node answering": {
+			resp: `{"metrics": {"emqx_vm_run_queue": 3}, "stats": {"emqx_conf_sync_txid": 40}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/prometheus/stats" || r.Header.Get("Accept") != "application/json" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(test.resp))
+			}))
+			defer server.Close()
+
+			c, _ := NewNodeCollector(&client{emqxClient: newTestClient5x(server, "", "emqx@emqx-2")})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(test.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	RetainerSubsystem = "retainer"
+)
+
+const (
+	retainerMessages           = "messages"
+	retainerMessagesMax        = "messages_max"
+	retainerReceived           = "received"
+	retainerEnabled            = "enabled"
+	retainerMessageExpiry      = "message_expiry_interval_seconds"
+	retainerClearInterval      = "clear_interval_seconds"
+	retainerMaxRetainedMessage = "max_retained_messages"
+)
+
+func init() {
+	registerCollector(RetainerSubsystem, NewRetainerCollector)
+}
+
+type retainerCollector struct {
+	desc   map[string]*prometheus.Desc
+	client *client
+}
+
+// NewRetainerCollector returns a new collector for the retained messages
+func NewRetainerCollector(client *client) (Collector, error) {
+	collector := &retainerCollector{
+		desc:   make(map[string]*prometheus.Desc),
+		client: client,
+	}
+
+	metrics := []struct {
+		name   string
+		help   string
+		labels []string
+	}{
+		{
+			name:   retainerMessages,
+			help:   "The count of retained messages",
+			labels: []string{"node"},
+		},
+		{
+			name:   retainerMessagesMax,
+			help:   "The max count of retained messages ever stored",
+			labels: []string{"node"},
+		},
+		{
+			name:   retainerReceived,
+			help:   "The count of retained messages published",
+			labels: []string{"node"},
+		},
+		{
+			name: retainerEnabled,
+			help: "Whether the retainer is enabled",
+		},
+		{
+			name: retainerMessageExpiry,
+			help: "How long a retained message is kept without its own expiry interval in seconds, 0 for ever",
+		},
+		{
+			name: retainerClearInterval,
+			help: "The interval of clearing the expired retained messages in seconds, 0 for never",
+		},
+		{
+			name: retainerMaxRetainedMessage,
+			help: "The max count of retained messages stored, 0 for unlimited",
+		},
+	}
+
+	for _, m := range metrics {
+		collector.desc[m.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				RetainerSubsystem,
+				m.name,
+			),
+			m.help,
+			m.labels,
+			nil,
+		)
+	}
+	return collector, nil
+}
+
+// Update implements the Collector interface and will collect the retainer metrics.
+func (c *retainerCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	retainer, err := doGetRetainerMetrics(ctx, c.client)
+	if err != nil {
+		return err
+	}
+	if retainer == nil {
+		return nil
+	}
+
+	if s := retainer.Settings; s != nil {
+		enabled := 0.0
+		if s.Enabled {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerEnabled], prometheus.GaugeValue, enabled)
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerMessageExpiry], prometheus.GaugeValue, s.MessageExpiryInterval)
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerClearInterval], prometheus.GaugeValue, s.ClearInterval)
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerMaxRetainedMessage], prometheus.GaugeValue, float64(s.MaxRetainedMessages))
+	}
+	for _, node := range retainer.Nodes {
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerMessages], prometheus.GaugeValue, node.Messages, node.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerMessagesMax], prometheus.GaugeValue, node.MessagesMax, node.NodeName)
+		ch <- prometheus.MustNewConstMetric(c.desc[retainerReceived], prometheus.CounterValue, node.Received, node.NodeName)
+	}
+	return nil
+}
+
+// Retainer is the retained messages of a cluster.
+// EMQX doesn't count the retained messages dispatched to the subscribers and expired, so their expiry is told by the
+// count of retained messages staying bounded while new ones are received
+type Retainer struct {
+	// Settings of the retainer, nil if not exposed
+	Settings *RetainerSettings
+	Nodes    []RetainerStats
+}
+
+type RetainerSettings struct {
+	Enabled bool
+	// MessageExpiryInterval and ClearInterval in seconds
+	MessageExpiryInterval float64
+	ClearInterval         float64
+	MaxRetainedMessages   int64
+}
+
+type RetainerStats struct {
+	NodeName    string
+	Messages    float64
+	MessagesMax float64
+	Received    float64
+}
+
+// retainerStats returns the retainer stats of the nodes of both stats and metrics
+func retainerStats(stats, metrics map[string]map[string]float64) []RetainerStats {
+	nodes := make([]RetainerStats, 0, len(stats))
+	for node, s := range stats {
+		m, ok := metrics[node]
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, RetainerStats{
+			NodeName:    node,
+			Messages:    s["retained.count"],
+			MessagesMax: s["retained.max"],
+			Received:    m["messages.retained"],
+		})
+	}
+	return nodes
+}
+
+func doGetRetainerMetrics(ctx context.Context, c *client) (retainer *Retainer, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	client := c.emqxClient
+	if client == nil {
+		return
+	}
+	retainer, err = client.getRetainerMetrics(ctx)
+	if err != nil {
+		err = fmt.Errorf("collect retainer metrics failed. %w", err)
+		return
+	}
+	return
+}
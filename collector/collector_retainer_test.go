@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRetainerCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/stats":
+			w.Write([]byte(`{"code": 0, "data": [{"node": "emqx@emqx-0", "stats": {"retained.count": 3, "retained.max": 5}}]}`))
+		case "/api/v4/metrics":
+			w.Write([]byte(`{"code": 0, "data": [{"node": "emqx@emqx-0", "metrics": {"messages.retained": 8}}]}`))
+		case "/api/v5/stats":
+			w.Write([]byte(`[{"node": "emqx@emqx-0", "retained.count": 10, "retained.max": 12}]`))
+		case "/api/v5/metrics":
+			w.Write([]byte(`[{"node": "emqx@emqx-0", "messages.retained": 40}]`))
+		case "/api/v5/mqtt/retainer":
+			w.Write([]byte(`{"enable": true, "msg_expiry_interval": "1h", "msg_clear_interval": "0s", "backend": {"max_retained_messages": 1000}}`))
+		}
+	}))
+	defer server.Close()
+
+	nodes := func(messages, max, received string) string {
+		return `
+# HELP emqx_retainer_messages The count of retained messages
+# TYPE emqx_retainer_messages gauge
+emqx_retainer_messages{node="emqx-0"} ` + messages + `
+# HELP emqx_retainer_messages_max The max count of retained messages ever stored
+# TYPE emqx_retainer_messages_max gauge
+emqx_retainer_messages_max{node="emqx-0"} ` + max + `
+# HELP emqx_retainer_received The count of retained messages published
+# TYPE emqx_retainer_received counter
+emqx_retainer_received{node="emqx-0"} ` + received + `
+`
+	}
+	for name, test := range map[string]struct {
+		client   emqxClientInterface
+		expected string
+	}{
+		"4.x": {
+			client:   newTestClient4x(server, "", ""),
+			expected: nodes("3", "5", "8"),
+		},
+		"5.x": {
+			client: newTestClient5x(server, "", ""),
+			expected: nodes("10", "12", "40") + `
+# HELP emqx_retainer_clear_interval_seconds The interval of clearing the expired retained messages in seconds, 0 for never
+# TYPE emqx_retainer_clear_interval_seconds gauge
+emqx_retainer_clear_interval_seconds 0
+# HELP emqx_retainer_enabled Whether the retainer is enabled
+# TYPE emqx_retainer_enabled gauge
+emqx_retainer_enabled 1
+# HELP emqx_retainer_max_retained_messages The max count of retained messages stored, 0 for unlimited
+# TYPE emqx_retainer_max_retained_messages gauge
+emqx_retainer_max_retained_messages 1000
+# HELP emqx_retainer_message_expiry_interval_seconds How long a retained message is kept without its own expiry interval in seconds, 0 for ever
+# TYPE emqx_retainer_message_expiry_interval_seconds gauge
+emqx_retainer_message_expiry_interval_seconds 3600
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := NewRetainerCollector(&client{emqxClient: test.client})
+			if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(test.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -174,14 +175,17 @@ func NewRuleEngineCollector(client *client) (Collector, error) {
 }
 
 // Update implements the Collector interface and will collect rule engine metrics.
-func (c *ruleEngineCollector) Update(ch chan<- prometheus.Metric) error {
-	bridges, metrics, err := doGetRuleEngineMetrics(c.client)
+func (c *ruleEngineCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ctx, pages := withPageTally(ctx)
+	bridges, metrics, err := doGetRuleEngineMetrics(ctx, c.client)
 	if err != nil {
 		return err
 	}
+	pages.collect(ch)
 
 	for i := range metrics {
 		metric := &metrics[i]
+		labels := newLabelPairs(c.desc[ruleTopicHitCount], metric.NodeName, metric.RuleID)
 		bucket, err := getBucket(metric.ActionExecTimeCost)
 		if err != nil {
 			return err
@@ -192,77 +196,27 @@ func (c *ruleEngineCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(metric.ActionExecTimeCost["sum"]),
 			bucket, metric.NodeName, metric.RuleID)
 
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleTopicHitCount],
-			prometheus.CounterValue, float64(metric.TopicHitCount), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecPassCount],
-			prometheus.CounterValue, float64(metric.ExecPassCount), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecFailureCount],
-			prometheus.CounterValue, float64(metric.ExecFailureCount), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecExceptionCount],
-			prometheus.CounterValue, float64(metric.ExecExceptionCount), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleNoResultCount],
-			prometheus.CounterValue, float64(metric.NoResultCount), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecRate],
-			prometheus.GaugeValue, metric.ExecRate, metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecLast5mRate],
-			prometheus.GaugeValue, metric.ExecLast5mRate, metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleExecMaxRate],
-			prometheus.GaugeValue, metric.ExecMaxRate, metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleActionTotal],
-			prometheus.CounterValue, float64(metric.ActionTotal), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleActionSuccess],
-			prometheus.CounterValue, float64(metric.ActionSuccess), metric.NodeName, metric.RuleID,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[ruleActionFailed],
-			prometheus.CounterValue, float64(metric.ActionFailed), metric.NodeName, metric.RuleID,
-		)
+		ch <- labels.constMetric(c.desc[ruleTopicHitCount], prometheus.CounterValue, float64(metric.TopicHitCount))
+		ch <- labels.constMetric(c.desc[ruleExecPassCount], prometheus.CounterValue, float64(metric.ExecPassCount))
+		ch <- labels.constMetric(c.desc[ruleExecFailureCount], prometheus.CounterValue, float64(metric.ExecFailureCount))
+		ch <- labels.constMetric(c.desc[ruleExecExceptionCount], prometheus.CounterValue, float64(metric.ExecExceptionCount))
+		ch <- labels.constMetric(c.desc[ruleNoResultCount], prometheus.CounterValue, float64(metric.NoResultCount))
+		ch <- labels.constMetric(c.desc[ruleExecRate], prometheus.GaugeValue, metric.ExecRate)
+		ch <- labels.constMetric(c.desc[ruleExecLast5mRate], prometheus.GaugeValue, metric.ExecLast5mRate)
+		ch <- labels.constMetric(c.desc[ruleExecMaxRate], prometheus.GaugeValue, metric.ExecMaxRate)
+		ch <- labels.constMetric(c.desc[ruleActionTotal], prometheus.CounterValue, float64(metric.ActionTotal))
+		ch <- labels.constMetric(c.desc[ruleActionSuccess], prometheus.CounterValue, float64(metric.ActionSuccess))
+		ch <- labels.constMetric(c.desc[ruleActionFailed], prometheus.CounterValue, float64(metric.ActionFailed))
 	}
 
 	for i := range bridges {
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeResStatus],
-			prometheus.GaugeValue, float64(bridges[i].Status), bridges[i].Type, bridges[i].Name,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeQueuing],
-			prometheus.GaugeValue, float64(bridges[i].Queuing), bridges[i].Type, bridges[i].Name,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeLast5mRate],
-			prometheus.GaugeValue, bridges[i].RateLast5m, bridges[i].Type, bridges[i].Name,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeRateMax],
-			prometheus.GaugeValue, bridges[i].RateMax, bridges[i].Type, bridges[i].Name,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeFailed],
-			prometheus.CounterValue, float64(bridges[i].Failed), bridges[i].Type, bridges[i].Name,
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.desc[bridgeDropped],
-			prometheus.CounterValue, float64(bridges[i].Dropped), bridges[i].Type, bridges[i].Name,
-		)
+		labels := newLabelPairs(c.desc[bridgeResStatus], bridges[i].Type, bridges[i].Name)
+		ch <- labels.constMetric(c.desc[bridgeResStatus], prometheus.GaugeValue, float64(bridges[i].Status))
+		ch <- labels.constMetric(c.desc[bridgeQueuing], prometheus.GaugeValue, float64(bridges[i].Queuing))
+		ch <- labels.constMetric(c.desc[bridgeLast5mRate], prometheus.GaugeValue, bridges[i].RateLast5m)
+		ch <- labels.constMetric(c.desc[bridgeRateMax], prometheus.GaugeValue, bridges[i].RateMax)
+		ch <- labels.constMetric(c.desc[bridgeFailed], prometheus.CounterValue, float64(bridges[i].Failed))
+		ch <- labels.constMetric(c.desc[bridgeDropped], prometheus.CounterValue, float64(bridges[i].Dropped))
 	}
 	return nil
 }
@@ -300,19 +254,19 @@ type RuleEngine struct {
 	ActionExecTimeCost map[string]uint64
 }
 
-func doGetRuleEngineMetrics(c *client) (bridges []DataBridge, res []RuleEngine, err error) {
-	c.Lock()
-	defer c.Unlock()
+func doGetRuleEngineMetrics(ctx context.Context, c *client) (bridges []DataBridge, res []RuleEngine, err error) {
+	c.RLock()
+	defer c.RUnlock()
 	client := c.emqxClient
 	if client == nil {
 		return
 	}
-	bridges, err = client.getDataBridge()
+	bridges, err = client.getDataBridge(ctx)
 	if err != nil {
 		err = fmt.Errorf("collect rule engine data bridge failed. %w", err)
 		return
 	}
-	res, err = client.getRuleEngineMetrics()
+	res, err = client.getRuleEngineMetrics(ctx)
 	if err != nil {
 		err = fmt.Errorf("collect rule engine metrics failed. %w", err)
 		return
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testCollector func(ch chan<- prometheus.Metric) error
+
+func (f testCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	return f(ch)
+}
+
+func TestCollectorErrorIsolation(t *testing.T) {
+	okDesc := prometheus.NewDesc("emqx_test_ok", "ok", nil, nil)
+	nc := EMQXCollector{
+		Collectors: map[string]Collector{
+			"ok": testCollector(func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(okDesc, prometheus.GaugeValue, 1)
+				return nil
+			}),
+			"failed": testCollector(func(ch chan<- prometheus.Metric) error {
+				return errors.New("api unavailable")
+			}),
+			"panicked": testCollector(func(ch chan<- prometheus.Metric) error {
+				var m map[string]int
+				m["boom"]++
+				return nil
+			}),
+		},
+		logger:    log.NewNopLogger(),
+		durations: newDurationHistogram(),
+		failures:  newFailureCounter(),
+		ctx:       context.Background(),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nc)
+	count, err := testutil.GatherAndCount(registry, "emqx_test_ok")
+	if err != nil || count != 1 {
+		t.Fatalf("Expected the metric of the healthy collector, got %d, %v", count, err)
+	}
+
+	expected := map[string]float64{"ok": 1, "failed": 0, "panicked": 0}
+	families, _ := registry.Gather()
+	for _, family := range families {
+		if family.GetName() != "emqx_scrape_collector_success" {
+			continue
+		}
+		for _, m := range family.Metric {
+			name := m.Label[0].GetValue()
+			if m.Gauge.GetValue() != expected[name] {
+				t.Errorf("Expected collector %s success to be %v, got %v", name, expected[name], m.Gauge.GetValue())
+			}
+		}
+	}
+	// gathered twice
+	for name, success := range expected {
+		if errors := testutil.ToFloat64(nc.failures.WithLabelValues(name)); errors != 2*(1-success) {
+			t.Errorf("Expected collector %s to have %v errors, got %v", name, 2*(1-success), errors)
+		}
+	}
+}
+
+func TestCollectorFilter(t *testing.T) {
+	noop := testCollector(func(ch chan<- prometheus.Metric) error { return nil })
+	nc := EMQXCollector{Collectors: map[string]Collector{"cluster": noop, "rule": noop, "license": noop}}
+
+	filtered, err := nc.filter([]string{"rule", "cluster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Collectors) != 2 || filtered.Collectors["rule"] == nil || filtered.Collectors["cluster"] == nil {
+		t.Errorf("Expected the collectors rule and cluster, got %v", filtered.Collectors)
+	}
+	if len(nc.Collectors) != 3 {
+		t.Errorf("Expected the original collector to be unchanged, got %v", nc.Collectors)
+	}
+
+	if _, err := nc.filter([]string{"unknown"}); err == nil {
+		t.Error("Expected an error for an unknown collector")
+	}
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	okDesc := prometheus.NewDesc("emqx_test_ok", "ok", nil, nil)
+	release := make(chan struct{})
+	defer close(release)
+	for name, tc := range map[string]struct {
+		timeout time.Duration
+		budget  time.Duration
+	}{
+		"scrape timeout": {timeout: 100 * time.Millisecond},
+		"budget":         {budget: 100 * time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			nc := EMQXCollector{
+				Collectors: map[string]Collector{
+					"ok": testCollector(func(ch chan<- prometheus.Metric) error {
+						ch <- prometheus.MustNewConstMetric(okDesc, prometheus.GaugeValue, 1)
+						return nil
+					}),
+					"slow": testCollector(func(ch chan<- prometheus.Metric) error {
+						<-release
+						ch <- prometheus.MustNewConstMetric(okDesc, prometheus.GaugeValue, 1)
+						return nil
+					}),
+				},
+				logger:    log.NewNopLogger(),
+				durations: newDurationHistogram(),
+				failures:  newFailureCounter(),
+				budget:    tc.budget,
+				ctx:       ctx,
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(nc)
+			// gather once, the scrape context is done afterwards
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]float64{"ok": 1, "slow": 0}
+			for _, family := range families {
+				if family.GetName() == "emqx_test_ok" && len(family.Metric) != 1 {
+					t.Errorf("Expected the metric of the finished collector only, got %d", len(family.Metric))
+				}
+				if family.GetName() != "emqx_scrape_collector_success" {
+					continue
+				}
+				for _, m := range family.Metric {
+					name := m.Label[0].GetValue()
+					if m.Gauge.GetValue() != expected[name] {
+						t.Errorf("Expected collector %s success to be %v, got %v", name, expected[name], m.Gauge.GetValue())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCollectorLeadership(t *testing.T) {
+	okDesc := prometheus.NewDesc("emqx_test_ok", "ok", nil, nil)
+	nc := EMQXCollector{
+		Collectors: map[string]Collector{
+			"ok": testCollector(func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(okDesc, prometheus.GaugeValue, 1)
+				return nil
+			}),
+		},
+		logger:     log.NewNopLogger(),
+		durations:  newDurationHistogram(),
+		failures:   newFailureCounter(),
+		ctx:        context.Background(),
+		leadership: &leadership{},
+	}
+	var leader atomic.Bool
+	nc.leadership.follow(leader.Load)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nc)
+	for _, leading := range []bool{false, true} {
+		leader.Store(leading)
+		expected := 0.0
+		if leading {
+			expected = 1
+		}
+		if count, _ := testutil.GatherAndCount(registry, "emqx_test_ok"); count != int(expected) {
+			t.Errorf("Expected %v metrics collected while leading: %v, got %d", expected, leading, count)
+		}
+		families, _ := registry.Gather()
+		for _, family := range families {
+			if family.GetName() == "emqx_exporter_is_leader" && family.Metric[0].Gauge.GetValue() != expected {
+				t.Errorf("Expected emqx_exporter_is_leader %v, got %v", expected, family.Metric[0].Gauge.GetValue())
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New(&config.Metrics{Target: "127.0.0.1:1"}, reg, log.NewNopLogger()); err == nil || err.Error() != "metrics.api_key is required" {
+		t.Errorf("Expected the api_key to be required, got %v", err)
+	}
+
+	metrics := &config.Metrics{Name: "a", Target: "127.0.0.1:1", APIKey: "key", APISecret: "secret"}
+	a, err := New(metrics, reg, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if metrics.Scheme != "http" {
+		t.Errorf("Expected the defaults of the config file to be filled, got scheme %q", metrics.Scheme)
+	}
+	b, err := New(&config.Metrics{Name: "b", Target: "127.0.0.1:1", APIKey: "key", APISecret: "secret"}, reg, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Expected the clusters of other names to be registered along, got %v", err)
+	}
+	defer b.Close()
+	if _, err := New(metrics, reg, log.NewNopLogger()); err == nil {
+		t.Error("Expected an error registering the same cluster twice")
+	}
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labelPairs are the label pairs shared by a set of metrics, like all metrics of a rule on a node.
+// prometheus.MustNewConstMetric makes them for every metric, which dominates the allocations of a scrape of large clusters
+type labelPairs []*dto.LabelPair
+
+// newLabelPairs makes the label pairs of desc, which fit all descs of the same variable labels and no const labels
+func newLabelPairs(desc *prometheus.Desc, labelValues ...string) labelPairs {
+	return prometheus.MakeLabelPairs(desc, labelValues)
+}
+
+// constMetric is prometheus.MustNewConstMetric with the label pairs of l
+func (l labelPairs) constMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	return &sharedLabelsMetric{desc: desc, valueType: valueType, value: value, labels: l}
+}
+
+type sharedLabelsMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     float64
+	labels    labelPairs
+}
+
+// Desc implements prometheus.Metric
+func (m *sharedLabelsMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements prometheus.Metric. The capacity of the labels is capped, so that appending to them,
+// as prometheus.WrapRegistererWith does, copies them rather than writing over the labels of other metrics
+func (m *sharedLabelsMetric) Write(out *dto.Metric) error {
+	out.Label = m.labels[:len(m.labels):len(m.labels)]
+	switch m.valueType {
+	case prometheus.CounterValue:
+		out.Counter = &dto.Counter{Value: &m.value}
+	case prometheus.GaugeValue:
+		out.Gauge = &dto.Gauge{Value: &m.value}
+	case prometheus.UntypedValue:
+		out.Untyped = &dto.Untyped{Value: &m.value}
+	default:
+		return fmt.Errorf("encountered unknown type %v", m.valueType)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSharedLabelsMetric(t *testing.T) {
+	total := prometheus.NewDesc("emqx_test_total", "total", []string{"node", "rule"}, nil)
+	rate := prometheus.NewDesc("emqx_test_rate", "rate", []string{"node", "rule"}, nil)
+	labels := newLabelPairs(total, "emqx-0", "rule_0")
+
+	registry := prometheus.NewRegistry()
+	// the wrapping label is appended to the labels of each metric, which mustn't change the shared ones
+	prometheus.WrapRegistererWith(prometheus.Labels{"cluster": "east"}, registry).MustRegister(testCollectorAdapter{
+		collector: testCollector(func(ch chan<- prometheus.Metric) error {
+			ch <- labels.constMetric(total, prometheus.CounterValue, 3)
+			ch <- labels.constMetric(rate, prometheus.GaugeValue, 1.5)
+			return nil
+		}),
+		descs: []*prometheus.Desc{total, rate},
+	})
+
+	expected := `
+# HELP emqx_test_rate rate
+# TYPE emqx_test_rate gauge
+emqx_test_rate{cluster="east",node="emqx-0",rule="rule_0"} 1.5
+# HELP emqx_test_total total
+# TYPE emqx_test_total counter
+emqx_test_total{cluster="east",node="emqx-0",rule="rule_0"} 3
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	if len(labels) != 2 {
+		t.Errorf("Expected the shared labels to be unchanged, got %v", labels)
+	}
+}
+
+// testCollectorAdapter registers a Collector with the given descs
+type testCollectorAdapter struct {
+	collector Collector
+	descs     []*prometheus.Desc
+}
+
+func (a testCollectorAdapter) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range a.descs {
+		ch <- d
+	}
+}
+
+func (a testCollectorAdapter) Collect(ch chan<- prometheus.Metric) {
+	a.collector.Update(context.Background(), ch)
+}
+
+// fakeEMQXClient serves the rule engine metrics of rules rules on nodes nodes
+type fakeEMQXClient struct {
+	emqxClientInterface
+	rules []RuleEngine
+}
+
+func newFakeEMQXClient(rules, nodes int) *fakeEMQXClient {
+	f := &fakeEMQXClient{}
+	for r := 0; r < rules; r++ {
+		for n := 0; n < nodes; n++ {
+			f.rules = append(f.rules, RuleEngine{NodeName: fmt.Sprintf("emqx-%d", n), RuleID: fmt.Sprintf("rule_%d", r), TopicHitCount: int64(r)})
+		}
+	}
+	return f
+}
+
+func (f *fakeEMQXClient) getDataBridge(ctx context.Context) ([]DataBridge, error) {
+	return nil, nil
+}
+
+func (f *fakeEMQXClient) getRuleEngineMetrics(ctx context.Context) ([]RuleEngine, error) {
+	return f.rules, nil
+}
+
+func BenchmarkRuleEngineCollector(b *testing.B) {
+	c, _ := NewRuleEngineCollector(&client{emqxClient: newFakeEMQXClient(500, 7)})
+	nc := EMQXCollector{
+		Collectors: map[string]Collector{"rule": c},
+		logger:     log.NewNopLogger(),
+		durations:  newDurationHistogram(),
+		failures:   newFailureCounter(),
+		ctx:        context.Background(),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nc)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := registry.Gather(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/derived"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// derivedMetric is a gauge computed from the metrics gathered from a cluster on each scrape
+type derivedMetric struct {
+	name string
+	help string
+	expr derived.Expr
+}
+
+func newDerivedMetrics(conf []config.Derived) ([]*derivedMetric, error) {
+	metrics := make([]*derivedMetric, 0, len(conf))
+	for _, d := range conf {
+		expr, err := derived.Parse(d.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", d.Name, err)
+		}
+		help := d.Help
+		if help == "" {
+			help = "Derived from " + d.Expr
+		}
+		metrics = append(metrics, &derivedMetric{name: d.Name, help: help, expr: expr})
+	}
+	return metrics, nil
+}
+
+// derivedGatherer appends the derived metrics to the families gathered by g. They're computed from the metrics
+// gathered even if some collectors failed, and have no samples if none of their inputs is gathered
+type derivedGatherer struct {
+	g       prometheus.Gatherer
+	derived []*derivedMetric
+}
+
+func (d derivedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := d.g.Gather()
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	var errs []error
+	for _, m := range d.derived {
+		if _, ok := byName[m.name]; ok {
+			errs = append(errs, fmt.Errorf("derived metric %s: a collected metric has the same name", m.name))
+			continue
+		}
+		v := m.expr.Eval(byName)
+		// a constant isn't told apart by cluster
+		if v.Scalar || len(v.Samples) == 0 {
+			continue
+		}
+		family := &dto.MetricFamily{Name: proto.String(m.name), Help: proto.String(m.help), Type: dto.MetricType_GAUGE.Enum()}
+		for _, s := range v.Samples {
+			family.Metric = append(family.Metric, s.Metric())
+		}
+		sort.Slice(family.Metric, func(i, j int) bool {
+			return labelsKey(family.Metric[i].Label) < labelsKey(family.Metric[j].Label)
+		})
+		families = append(families, family)
+	}
+	// sorted by name like the families gathered by a registry
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	if len(errs) > 0 {
+		err = errors.Join(append([]error{err}, errs...)...)
+	}
+	return families, err
+}
+
+// withDerived returns g with the derived metrics of the collector appended, or g if it has none
+func (n EMQXCollector) withDerived(g prometheus.Gatherer) prometheus.Gatherer {
+	if len(n.derived) == 0 {
+		return g
+	}
+	return derivedGatherer{g: g, derived: n.derived}
+}
+
+func labelsKey(labels []*dto.LabelPair) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.GetName())
+		b.WriteByte(0)
+		b.WriteString(l.GetValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDerivedMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	hits := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_rule_topic_hit_count"}, []string{"node", "rule"})
+	failures := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_rule_exec_failure_count"}, []string{"node", "rule"})
+	limit := prometheus.NewGauge(prometheus.GaugeOpts{Name: "emqx_license_max_client_limit"})
+	uptime := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_cluster_node_uptime"}, []string{"node"})
+	registry.MustRegister(hits, failures, limit, uptime)
+	hits.WithLabelValues("emqx-0", "r1").Set(100)
+	hits.WithLabelValues("emqx-1", "r1").Set(300)
+	hits.WithLabelValues("emqx-0", "r2").Set(0)
+	failures.WithLabelValues("emqx-0", "r1").Set(10)
+	failures.WithLabelValues("emqx-1", "r1").Set(30)
+	failures.WithLabelValues("emqx-0", "r2").Set(0)
+	limit.Set(1000)
+	uptime.WithLabelValues("emqx-0").Set(60)
+	uptime.WithLabelValues("emqx-1").Set(120)
+
+	derived, err := newDerivedMetrics([]config.Derived{
+		{Name: "emqx_rule_failure_ratio", Help: "Ratio of the failed executions of a rule", Expr: "sum by (rule) (emqx_rule_exec_failure_count) / sum by (rule) (emqx_rule_topic_hit_count)"},
+		{Name: "emqx_rule_hit_license_ratio", Expr: "emqx_rule_topic_hit_count / emqx_license_max_client_limit * 100"},
+		{Name: "emqx_cluster_nodes", Expr: "count(emqx_cluster_node_uptime)"},
+		{Name: "emqx_cluster_node_uptime_minutes", Expr: "-(-emqx_cluster_node_uptime) / (30 + 30)"},
+		{Name: "emqx_missing", Expr: "emqx_not_collected / 2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP emqx_cluster_node_uptime_minutes Derived from -(-emqx_cluster_node_uptime) / (30 + 30)
+# TYPE emqx_cluster_node_uptime_minutes gauge
+emqx_cluster_node_uptime_minutes{node="emqx-0"} 1
+emqx_cluster_node_uptime_minutes{node="emqx-1"} 2
+# HELP emqx_cluster_nodes Derived from count(emqx_cluster_node_uptime)
+# TYPE emqx_cluster_nodes gauge
+emqx_cluster_nodes 2
+# HELP emqx_rule_failure_ratio Ratio of the failed executions of a rule
+# TYPE emqx_rule_failure_ratio gauge
+emqx_rule_failure_ratio{rule="r1"} 0.1
+# HELP emqx_rule_hit_license_ratio Derived from emqx_rule_topic_hit_count / emqx_license_max_client_limit * 100
+# TYPE emqx_rule_hit_license_ratio gauge
+emqx_rule_hit_license_ratio{node="emqx-0",rule="r1"} 10
+emqx_rule_hit_license_ratio{node="emqx-0",rule="r2"} 0
+emqx_rule_hit_license_ratio{node="emqx-1",rule="r1"} 30
+`
+	g := EMQXCollector{derived: derived}.withDerived(registry)
+	if err = testutil.GatherAndCompare(g, strings.NewReader(expected),
+		"emqx_rule_failure_ratio", "emqx_rule_hit_license_ratio", "emqx_cluster_nodes", "emqx_cluster_node_uptime_minutes", "emqx_missing"); err != nil {
+		t.Error(err)
+	}
+
+	// the samples are matched by cluster when the clusters are gathered together
+	labeled := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(prometheus.Labels{"cluster": "a"}, labeled).MustRegister(uptime, limit)
+	derived, _ = newDerivedMetrics([]config.Derived{{Name: "emqx_nodes_per_license", Expr: "count(emqx_cluster_node_uptime) / emqx_license_max_client_limit"}})
+	expected = `
+# HELP emqx_nodes_per_license Derived from count(emqx_cluster_node_uptime) / emqx_license_max_client_limit
+# TYPE emqx_nodes_per_license gauge
+emqx_nodes_per_license{cluster="a"} 0.002
+`
+	if err = testutil.GatherAndCompare(EMQXCollector{derived: derived}.withDerived(labeled), strings.NewReader(expected), "emqx_nodes_per_license"); err != nil {
+		t.Error(err)
+	}
+
+	derived, _ = newDerivedMetrics([]config.Derived{{Name: "emqx_license_max_client_limit", Expr: "emqx_license_max_client_limit * 2"}})
+	if _, err = (EMQXCollector{derived: derived}.withDerived(registry)).Gather(); err == nil || !strings.Contains(err.Error(), "a collected metric has the same name") {
+		t.Errorf("Expected a derived metric clashing with a collected one to fail, got %v", err)
+	}
+
+}
@@ -0,0 +1,35 @@
+package collector_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// An agent serves the metrics of an EMQX cluster along with its own
+func ExampleNew() {
+	reg := prometheus.NewRegistry()
+	cluster, err := collector.New(&config.Metrics{
+		Name:      "production",
+		Target:    "emqx:18083",
+		APIKey:    "some_api_key",
+		APISecret: "some_api_secret",
+	}, reg, log.NewLogfmtLogger(os.Stderr))
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = cluster.WaitDetected(ctx); err != nil {
+		panic(err)
+	}
+	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+}
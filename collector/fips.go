@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FIPSModule returns the FIPS 140 validated module the cryptography of the exporter runs in, which is `boringcrypto`
+// for a build with GOEXPERIMENT=boringcrypto, and `go` for the Go Cryptographic Module enabled by GODEBUG=fips140=on.
+// It's empty if the exporter doesn't run in FIPS mode
+func FIPSModule() string {
+	return fipsModule()
+}
+
+// NewFIPSCollector returns the collector of emqx_exporter_fips_mode, which tells whether the exporter runs in FIPS mode,
+// in which TLS is restricted to the FIPS approved versions, cipher suites and curves for both the probes and the EMQX API
+func NewFIPSCollector() prometheus.Collector {
+	module := fipsModule()
+	value := 0.0
+	if module != "" {
+		value = 1
+	}
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   "emqx_exporter",
+			Name:        "fips_mode",
+			Help:        "Whether the exporter runs in FIPS mode, labeled by the FIPS 140 validated module, boringcrypto or go.",
+			ConstLabels: prometheus.Labels{"module": module},
+		},
+		func() float64 { return value },
+	)
+}
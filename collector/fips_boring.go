@@ -0,0 +1,14 @@
+//go:build boringcrypto
+
+package collector
+
+import (
+	"crypto/boring"
+)
+
+func fipsModule() string {
+	if boring.Enabled() {
+		return "boringcrypto"
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+//go:build !boringcrypto && go1.24
+
+package collector
+
+import (
+	"crypto/fips140"
+)
+
+func fipsModule() string {
+	if fips140.Enabled() {
+		return "go"
+	}
+	return ""
+}
@@ -0,0 +1,8 @@
+//go:build !boringcrypto && !go1.24
+
+package collector
+
+// fipsModule is empty, as the Go Cryptographic Module needs Go 1.24
+func fipsModule() string {
+	return ""
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatheredCollector collects the metrics of n as the metrics handler serves them, with the derived metrics and the
+// aggregations, for the registries the collector is registered to rather than served by the metrics handler
+type gatheredCollector struct {
+	n EMQXCollector
+}
+
+// Describe implements prometheus.Collector
+func (c gatheredCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.n.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c gatheredCollector) Collect(ch chan<- prometheus.Metric) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c.n)
+	families, err := c.n.gathered(registry).Gather()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewInvalidDesc(err), err)
+	}
+	for _, family := range families {
+		descs := make(map[string]*prometheus.Desc)
+		for _, m := range family.Metric {
+			names := make([]string, len(m.Label))
+			for i, l := range m.Label {
+				names[i] = l.GetName()
+			}
+			key := strings.Join(names, ",")
+			desc, ok := descs[key]
+			if !ok {
+				desc = prometheus.NewDesc(family.GetName(), family.GetHelp(), names, nil)
+				descs[key] = desc
+			}
+			ch <- gatheredMetric{desc: desc, metric: m}
+		}
+	}
+}
+
+// gatheredMetric is a metric gathered as dto, which is written as it is
+type gatheredMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+// Desc implements prometheus.Metric
+func (m gatheredMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements prometheus.Metric. The capacity of the labels is capped like sharedLabelsMetric
+func (m gatheredMetric) Write(out *dto.Metric) error {
+	out.Label = m.metric.Label[:len(m.metric.Label):len(m.metric.Label)]
+	out.Counter = m.metric.Counter
+	out.Gauge = m.metric.Gauge
+	out.Untyped = m.metric.Untyped
+	out.Summary = m.metric.Summary
+	out.Histogram = m.metric.Histogram
+	out.TimestampMs = m.metric.TimestampMs
+	return nil
+}
@@ -1,76 +1,143 @@
 package collector
 
 import (
-	"emqx-exporter/config"
-
+	"fmt"
 	stdlog "log"
 	"net/http"
-	"sort"
 
+	"github.com/emqx/emqx-exporter/middleware"
+	"github.com/emqx/emqx-exporter/tracing"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/prometheus/common/version"
 )
 
-func NewHandler(disableExporterMetrics bool, maxRequests int, metrics *config.Metrics, logger log.Logger) http.Handler {
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(version.NewCollector("emqx_exporter"))
+// HandlerOpts specifies options how to serve metrics via an http.Handler
+type HandlerOpts struct {
+	// DisableExporterMetrics excludes metrics about the exporter itself (promhttp_*, process_*, go_*)
+	DisableExporterMetrics bool
+	// DisableGoMetrics and DisableProcessMetrics exclude the go_* and process_* metrics about the exporter only
+	DisableGoMetrics      bool
+	DisableProcessMetrics bool
+	// GoRuntimeMetrics adds all the metrics of runtime/metrics to the go_* metrics
+	GoRuntimeMetrics bool
+	// ExporterMetricsPrefix is prepended to the names of the go_* and process_* metrics, to tell them from those of other processes
+	ExporterMetricsPrefix string
+	// MaxRequests is the maximum number of parallel scrape requests, beyond which they are rejected with status 503, 0 means no limit
+	MaxRequests int
+	// EnableOpenMetricsCreatedSamples exposes the `_created` series of counters, histograms and summaries
+	// if the OpenMetrics format is negotiated
+	EnableOpenMetricsCreatedSamples bool
+}
+
+// handler gathers the metrics of every scrape with a registry of its own,
+// so that the collectors know on behalf of which scrape they collect
+type handler struct {
+	opts HandlerOpts
+	// collectors of the clusters by name, the default cluster is named ""
+	collectors map[string]*EMQXCollector
+	// exporterMetricsRegistry is a separate registry for the metrics about the exporter itself
+	exporterMetricsRegistry *prometheus.Registry
+	logger                  log.Logger
+}
+
+// NewHandler returns a handler serving the metrics of the clusters, the one to scrape is selected by
+// the `cluster` query parameter, and the default cluster is named "".
+// The `collect[]` query parameter, repeated for several ones, selects the collectors to run, all by default.
+func NewHandler(opts HandlerOpts, clusters map[string]*Cluster, logger log.Logger) http.Handler {
+	h := &handler{
+		opts:       opts,
+		collectors: make(map[string]*EMQXCollector, len(clusters)),
+		logger:     logger,
+	}
 
-	if metrics == nil {
+	if len(clusters) == 0 {
 		level.Info(logger).Log("msg", "No metrics configured, skipping cluster metrics")
-	} else {
-		emqxCluster := newClient(metrics, logger)
-		nc, err := NewEMQXCollector(emqxCluster, logger)
-		if err != nil {
-			level.Debug(logger).Log("msg", "Couldn't create collector", "err", err)
-			panic("Couldn't create collector")
-		}
+	}
+	for name, cluster := range clusters {
+		h.collectors[name] = cluster.collector
+	}
 
+	if len(h.collectors) > 0 {
 		level.Info(logger).Log("msg", "Enabled collectors")
-		collectors := make([]string, 0, len(nc.Collectors))
-		for n := range nc.Collectors {
-			collectors = append(collectors, n)
-		}
-		sort.Strings(collectors)
-		for _, c := range collectors {
+		for _, c := range Names() {
 			level.Info(logger).Log("collector", c)
 		}
-		registry.MustRegister(nc)
 	}
 
-	var h http.Handler
-	if disableExporterMetrics {
+	if opts.DisableExporterMetrics {
 		level.Info(logger).Log("msg", "Excluding metrics about the exporter itself")
-		h = promhttp.HandlerFor(
-			registry,
-			promhttp.HandlerOpts{
-				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(logger)), "", 0),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: maxRequests,
-			})
-	} else {
-		level.Info(logger).Log("msg", "Including metrics about the exporter itself")
-		exporterMetricsRegistry := prometheus.NewRegistry()
-		exporterMetricsRegistry.MustRegister(
-			promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}),
-			promcollectors.NewGoCollector(),
-		)
+		return middleware.MaxInFlight(h, opts.MaxRequests)
+	}
+
+	level.Info(logger).Log("msg", "Including metrics about the exporter itself")
+	h.exporterMetricsRegistry = prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWithPrefix(opts.ExporterMetricsPrefix, h.exporterMetricsRegistry)
+	if !opts.DisableProcessMetrics {
+		registerer.MustRegister(promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}))
+	}
+	if !opts.DisableGoMetrics {
+		if opts.GoRuntimeMetrics {
+			registerer.MustRegister(promcollectors.NewGoCollector(promcollectors.WithGoCollectorRuntimeMetrics(promcollectors.MetricsAll)))
+		} else {
+			registerer.MustRegister(promcollectors.NewGoCollector())
+		}
+	}
+	return promhttp.InstrumentMetricHandler(
+		h.exporterMetricsRegistry, middleware.MaxInFlight(h, opts.MaxRequests),
+	)
+}
 
-		h = promhttp.HandlerFor(
-			prometheus.Gatherers{exporterMetricsRegistry, registry},
-			promhttp.HandlerOpts{
-				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(logger)), "", 0),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: maxRequests,
-				Registry:            exporterMetricsRegistry,
-			})
-		h = promhttp.InstrumentMetricHandler(
-			exporterMetricsRegistry, h,
-		)
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("cluster")
+	nc, ok := h.collectors[name]
+	if !ok && name != "" {
+		http.Error(w, fmt.Sprintf("Unknown cluster %q", name), http.StatusBadRequest)
+		level.Debug(h.logger).Log("msg", "Unknown cluster", "cluster", name)
+		return
 	}
 
-	return h
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewBuildInfoCollector(), NewFIPSCollector())
+	if nc != nil {
+		ctx, span := tracing.Start(tracing.FromRequest(r), "scrape")
+		span.SetAttributes("cluster", name)
+		defer span.End(nil)
+		c := nc.withContext(ctx)
+		if filters := r.URL.Query()["collect[]"]; len(filters) > 0 {
+			level.Debug(h.logger).Log("msg", "collect query", "filters", fmt.Sprint(filters))
+			var err error
+			if c, err = c.filter(filters); err != nil {
+				http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s", err), http.StatusBadRequest)
+				level.Warn(h.logger).Log("msg", "Couldn't create filtered metrics handler", "err", err)
+				return
+			}
+		}
+		registry.MustRegister(c)
+	}
+
+	var gatherer prometheus.Gatherer = registry
+	if nc != nil {
+		gatherer = nc.gathered(registry)
+	}
+	opts := promhttp.HandlerOpts{
+		ErrorLog:          stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: true,
+		// compressed by the middleware
+		DisableCompression: true,
+	}
+	if h.exporterMetricsRegistry != nil {
+		gatherer = prometheus.Gatherers{h.exporterMetricsRegistry, gatherer}
+		opts.Registry = h.exporterMetricsRegistry
+	}
+
+	var next http.Handler = promhttp.HandlerFor(gatherer, opts)
+	if h.opts.EnableOpenMetricsCreatedSamples {
+		next = newCreatedSamplesHandler(gatherer, next, h.logger)
+	}
+	next.ServeHTTP(w, r)
 }
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestHandlerExporterMetrics(t *testing.T) {
+	for _, c := range []struct {
+		opts              HandlerOpts
+		present, excluded []string
+	}{
+		{HandlerOpts{}, []string{"\ngo_goroutines ", "\npromhttp_", "\nemqx_exporter_build_info{branch=\"\",builddate=\"\","}, []string{"\ngo_sched_goroutines_goroutines "}},
+		{HandlerOpts{DisableGoMetrics: true}, []string{"\npromhttp_"}, []string{"\ngo_goroutines "}},
+		{HandlerOpts{GoRuntimeMetrics: true}, []string{"\ngo_sched_goroutines_goroutines "}, nil},
+		{HandlerOpts{DisableProcessMetrics: true, ExporterMetricsPrefix: "emqx_exporter_"}, []string{"\nemqx_exporter_go_goroutines "}, []string{"\ngo_goroutines ", "process_"}},
+	} {
+		h := NewHandler(c.opts, nil, log.NewNopLogger())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := io.ReadAll(w.Body)
+		for _, name := range c.present {
+			if !strings.Contains(string(body), name) {
+				t.Errorf("Expected %q with %+v", strings.TrimSpace(name), c.opts)
+			}
+		}
+		for _, name := range c.excluded {
+			if strings.Contains(string(body), name) {
+				t.Errorf("Expected no %q with %+v", strings.TrimSpace(name), c.opts)
+			}
+		}
+	}
+}
@@ -37,7 +37,10 @@ func SanitizeMetricName(metricName string) string {
 }
 
 func getBucket(data map[string]uint64) (map[float64]uint64, error) {
-	buckets := make(map[float64]uint64)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	buckets := make(map[float64]uint64, len(data))
 	for k, v := range data {
 		if k == "sum" || k == "count" {
 			continue
@@ -14,9 +14,29 @@
 package collector
 
 import (
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
 )
 
+// newTestRequester returns a requester of the EMQX API served by server
+func newTestRequester(server *httptest.Server) *requester {
+	return newRequester(&config.Metrics{Scheme: "http", Target: strings.TrimPrefix(server.URL, "http://")})
+}
+
+// newTestClient4x returns a 4.x client of the EMQX API served by server, which collects the nodes matching include
+// but not exclude, all of them if both are empty
+func newTestClient4x(server *httptest.Server, include, exclude string) *client4x {
+	return &client4x{requester: newTestRequester(server), nodeName: newNodeNameNormalizer(nil), nodeFilter: newNodeFilter(include, exclude)}
+}
+
+// newTestClient5x returns a 5.x client like newTestClient4x
+func newTestClient5x(server *httptest.Server, include, exclude string) *client5x {
+	return &client5x{requester: newTestRequester(server), nodeName: newNodeNameNormalizer(nil), nodeFilter: newNodeFilter(include, exclude)}
+}
+
 func TestSanitizeMetricName(t *testing.T) {
 	testcases := map[string]string{
 		"":                             "",
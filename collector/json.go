@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// JSONMetrics is the response of the JSON metrics API
+type JSONMetrics struct {
+	// Cluster is the name of the cluster, "" for the default one
+	Cluster string `json:"cluster,omitempty"`
+	// Timestamp of the collection in milliseconds
+	Timestamp int64 `json:"timestamp"`
+	// Leader is whether the replica collects the cluster, given only with leader election. A replica not leading
+	// serves no collectors, like the metrics handler
+	Leader     *bool                    `json:"leader,omitempty"`
+	Collectors map[string]JSONCollector `json:"collectors"`
+}
+
+// JSONCollector holds the metrics collected by a collector
+type JSONCollector struct {
+	Success bool `json:"success"`
+	// Degraded is whether the collector is disabled to relieve the memory of the exporter, like
+	// emqx_exporter_collector_degraded
+	Degraded bool         `json:"degraded,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Metrics  []JSONSample `json:"metrics"`
+}
+
+// JSONSample is a sample of a metric, histograms and summaries are given by their `_sum` and `_count`
+type JSONSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+type jsonHandler struct {
+	collectors map[string]*EMQXCollector
+	logger     log.Logger
+}
+
+// NewJSONHandler returns a handler serving the metrics of the clusters as JSON, grouped by collector.
+// Like the metrics handler, the cluster is selected by the `cluster` query parameter,
+// and the collectors by the `collect[]` query parameter
+func NewJSONHandler(clusters map[string]*Cluster, logger log.Logger) http.Handler {
+	h := &jsonHandler{collectors: make(map[string]*EMQXCollector, len(clusters)), logger: logger}
+	for name, cluster := range clusters {
+		h.collectors[name] = cluster.collector
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *jsonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("cluster")
+	nc, ok := h.collectors[name]
+	if !ok && name != "" {
+		http.Error(w, fmt.Sprintf("Unknown cluster %q", name), http.StatusBadRequest)
+		level.Debug(h.logger).Log("msg", "Unknown cluster", "cluster", name)
+		return
+	}
+
+	resp := JSONMetrics{
+		Cluster:    name,
+		Timestamp:  time.Now().UnixMilli(),
+		Collectors: map[string]JSONCollector{},
+	}
+	var collectors map[string]Collector
+	if nc != nil {
+		c := *nc
+		if filters := r.URL.Query()["collect[]"]; len(filters) > 0 {
+			var err error
+			if c, err = c.filter(filters); err != nil {
+				http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s", err), http.StatusBadRequest)
+				level.Warn(h.logger).Log("msg", "Couldn't create filtered metrics handler", "err", err)
+				return
+			}
+		}
+		collectors = c.Collectors
+		if c.leadership.following() {
+			leading := c.leadership.leading()
+			resp.Leader = &leading
+			if !leading {
+				collectors = nil
+			}
+		}
+	}
+
+	ctx, span := tracing.Start(tracing.FromRequest(r), "scrape")
+	span.SetAttributes("cluster", name)
+	defer span.End(nil)
+	ctx, cancel := nc.withBudget(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	wg := sync.WaitGroup{}
+	for collectorName, collector := range collectors {
+		if nc.degradation.skipped(collectorName) {
+			resp.Collectors[collectorName] = JSONCollector{Degraded: true, Error: "disabled to relieve the memory of the exporter", Metrics: []JSONSample{}}
+			continue
+		}
+		wg.Add(1)
+		go func(collectorName string, collector Collector) {
+			defer wg.Done()
+			ctx, span := tracing.Start(ctx, "collect")
+			span.SetAttributes("collector", collectorName)
+			result := collectJSON(ctx, nc, collectorName, collector)
+			if !result.Success {
+				span.End(errors.New(result.Error))
+			} else {
+				span.End(nil)
+			}
+			if !result.Success {
+				level.Debug(h.logger).Log("msg", "collector failed", "collector", collectorName, "err", result.Error)
+			}
+			mu.Lock()
+			resp.Collectors[collectorName] = result
+			mu.Unlock()
+		}(collectorName, collector)
+	}
+	wg.Wait()
+
+	b, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// collectJSON runs the collector of name once, accounting its series to the degradation of nc like a scrape does,
+// and returns its samples, sorted by name and labels
+func collectJSON(ctx context.Context, nc *EMQXCollector, name string, c Collector) JSONCollector {
+	var updateErr error
+	registry := prometheus.NewRegistry()
+	// an unchecked collector, as the collector doesn't describe its metrics
+	registry.MustRegister(jsonCollectorFunc(func(ch chan<- prometheus.Metric) {
+		updateErr = nc.degradation.update(ctx, name, c, ch)
+	}))
+	families, err := nc.gathered(registry).Gather()
+	if updateErr != nil {
+		err = updateErr
+	}
+
+	result := JSONCollector{Success: err == nil, Metrics: []JSONSample{}}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			labels := make(map[string]string, len(m.Label))
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName(), labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName(), labels, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName(), labels, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName()+"_sum", labels, m.GetSummary().GetSampleSum())
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName()+"_count", labels, float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName()+"_sum", labels, m.GetHistogram().GetSampleSum())
+				result.Metrics = appendJSONSample(result.Metrics, family.GetName()+"_count", labels, float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	// the families and their metrics are sorted by the registry, but not the _sum and _count
+	sort.SliceStable(result.Metrics, func(i, j int) bool { return result.Metrics[i].Name < result.Metrics[j].Name })
+	return result
+}
+
+// appendJSONSample appends the sample, unless its value can't be represented in JSON
+func appendJSONSample(samples []JSONSample, name string, labels map[string]string, value float64) []JSONSample {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return samples
+	}
+	return append(samples, JSONSample{Name: name, Labels: labels, Value: value})
+}
+
+type jsonCollectorFunc func(ch chan<- prometheus.Metric)
+
+func (f jsonCollectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f jsonCollectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestJSONHandler(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test_connections", "connections", []string{"node"}, nil)
+	nc := &EMQXCollector{
+		Collectors: map[string]Collector{
+			"ok": testCollector(func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 2, "emqx@node2")
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "emqx@node1")
+				return nil
+			}),
+			"failed": testCollector(func(ch chan<- prometheus.Metric) error {
+				return errors.New("api unavailable")
+			}),
+		},
+		logger: log.NewNopLogger(),
+	}
+	h := NewJSONHandler(map[string]*Cluster{"": {collector: nc}}, log.NewNopLogger())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp JSONMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	ok := resp.Collectors["ok"]
+	if !ok.Success || len(ok.Metrics) != 2 {
+		t.Fatalf("Expected 2 metrics of the collector ok, got %+v", ok)
+	}
+	if ok.Metrics[0].Labels["node"] != "emqx@node1" || ok.Metrics[0].Value != 1 || ok.Metrics[0].Name != "emqx_test_connections" {
+		t.Errorf("Expected the metrics sorted by labels, got %+v", ok.Metrics)
+	}
+	if failed := resp.Collectors["failed"]; failed.Success || failed.Error == "" {
+		t.Errorf("Expected the collector failed to report its error, got %+v", failed)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?collect[]=ok", nil))
+	resp = JSONMetrics{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Collectors) != 1 {
+		t.Errorf("Expected the collector ok only, got %+v", resp.Collectors)
+	}
+
+	for _, query := range []string{"?cluster=unknown", "?collect[]=unknown"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestJSONHandlerLeadership(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test_connections", "connections", nil, nil)
+	nc := &EMQXCollector{
+		Collectors: map[string]Collector{
+			"ok": testCollector(func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1)
+				return nil
+			}),
+		},
+		leadership: &leadership{},
+		logger:     log.NewNopLogger(),
+	}
+	var leader atomic.Bool
+	nc.leadership.follow(leader.Load)
+	h := NewJSONHandler(map[string]*Cluster{"": {collector: nc}}, log.NewNopLogger())
+
+	for _, leading := range []bool{false, true} {
+		leader.Store(leading)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+		var resp JSONMetrics
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Leader == nil || *resp.Leader != leading {
+			t.Errorf("Expected leader %t, got %v", leading, resp.Leader)
+		}
+		if _, ok := resp.Collectors["ok"]; ok != leading {
+			t.Errorf("Expected the collector ok to be run %t while leader %t, got %+v", leading, leading, resp.Collectors)
+		}
+	}
+}
+
+func TestJSONHandlerDegradation(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test", "test", []string{"collector", "i"}, nil)
+	series := func(name string, n int) Collector {
+		return testCollector(func(ch chan<- prometheus.Metric) error {
+			for i := 0; i < n; i++ {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, name, strconv.Itoa(i))
+			}
+			return nil
+		})
+	}
+	nc := &EMQXCollector{
+		Collectors:  map[string]Collector{"heavy": series("heavy", 10), "light": series("light", 1)},
+		logger:      log.NewNopLogger(),
+		degradation: &degradation{},
+	}
+	g := NewMemoryGuard(1000, 1)
+	g.usage = func() uint64 { return 1000 }
+	nc.degradation.follow(g)
+	h := NewJSONHandler(map[string]*Cluster{"": {collector: nc}}, log.NewNopLogger())
+	get := func() JSONMetrics {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+		var resp JSONMetrics
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// the series collected through the JSON API are accounted like those of a scrape
+	if resp := get(); len(resp.Collectors["heavy"].Metrics) != 10 || resp.Collectors["heavy"].Degraded {
+		t.Errorf("Expected the collector heavy to run before degrading, got %+v", resp.Collectors["heavy"])
+	}
+	g.check(log.NewNopLogger())
+	resp := get()
+	if heavy := resp.Collectors["heavy"]; !heavy.Degraded || heavy.Success || len(heavy.Metrics) != 0 {
+		t.Errorf("Expected the collector heavy to be disabled, got %+v", heavy)
+	}
+	if light := resp.Collectors["light"]; light.Degraded || !light.Success || len(light.Metrics) != 1 {
+		t.Errorf("Expected the collector light to run, got %+v", light)
+	}
+}
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var isLeaderDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("emqx_exporter", "", "is_leader"),
+	"Whether the exporter replica is the leader, which is the only one collecting the clusters if leader election is enabled.",
+	nil,
+	nil,
+)
+
+// leadership tells whether the clusters are collected, which is always the case unless a leader election is followed
+type leadership struct {
+	isLeader atomic.Pointer[func() bool]
+}
+
+func (l *leadership) follow(isLeader func() bool) {
+	l.isLeader.Store(&isLeader)
+}
+
+// leading returns whether the replica collects, it does if l is nil
+func (l *leadership) leading() bool {
+	if l == nil {
+		return true
+	}
+	if isLeader := l.isLeader.Load(); isLeader != nil {
+		return (*isLeader)()
+	}
+	return true
+}
+
+// following returns whether a leader election is followed
+func (l *leadership) following() bool {
+	return l != nil && l.isLeader.Load() != nil
+}
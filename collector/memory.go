@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"context"
+	"runtime/metrics"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var collectorDegradedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("emqx_exporter", "collector", "degraded"),
+	"Whether a collector is disabled to relieve the memory of the exporter, which runs short of its soft limit.",
+	[]string{"collector"},
+	nil,
+)
+
+// MemoryGuard tells whether the memory used by the exporter is beyond its soft limit, as accounted by the Go runtime
+// for its memory limit, which includes the results cached by the collectors
+type MemoryGuard struct {
+	soft uint64
+	// usage returns the memory used, it's replaced by the tests
+	usage    func() uint64
+	degraded atomic.Bool
+}
+
+// NewMemoryGuard returns a guard of the soft limit of ratio times limit bytes
+func NewMemoryGuard(limit int64, ratio float64) *MemoryGuard {
+	return &MemoryGuard{soft: uint64(float64(limit) * ratio), usage: memoryUsage}
+}
+
+// memoryUsage returns the memory mapped by the Go runtime and not released to the OS, which the memory limit applies to
+func memoryUsage() uint64 {
+	samples := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// Run checks the memory usage on every interval until ctx is done.
+// The guard degrades beyond the soft limit, and recovers once the usage is below 90% of it
+func (g *MemoryGuard) Run(ctx context.Context, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		g.check(logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *MemoryGuard) check(logger log.Logger) {
+	usage := g.usage()
+	switch {
+	case !g.degraded.Load() && usage >= g.soft:
+		g.degraded.Store(true)
+		level.Warn(logger).Log("msg", "Memory beyond the soft limit, disabling the heaviest collectors", "usage_bytes", usage, "soft_limit_bytes", g.soft)
+	case g.degraded.Load() && usage < g.soft/10*9:
+		g.degraded.Store(false)
+		level.Info(logger).Log("msg", "Memory back below the soft limit, enabling all collectors", "usage_bytes", usage, "soft_limit_bytes", g.soft)
+	}
+}
+
+// Degraded returns whether the memory usage is beyond the soft limit, it isn't if g is nil
+func (g *MemoryGuard) Degraded() bool {
+	return g != nil && g.degraded.Load()
+}
+
+// degradation disables the heaviest collectors of a cluster while its memory guard is degraded.
+// The weight of a collector is the number of series it collected last
+type degradation struct {
+	guard   atomic.Pointer[MemoryGuard]
+	mu      sync.Mutex
+	weights map[string]int
+}
+
+func (d *degradation) follow(guard *MemoryGuard) {
+	d.guard.Store(guard)
+}
+
+// guarded returns whether a memory guard is followed
+func (d *degradation) guarded() bool {
+	return d != nil && d.guard.Load() != nil
+}
+
+// skipped returns whether the collector of name is disabled, which the heaviest collectors accounting for half the
+// series of the cluster are while degraded
+func (d *degradation) skipped(name string) bool {
+	if !d.guarded() || !d.guard.Load().Degraded() {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.weights))
+	total := 0
+	for n, weight := range d.weights {
+		names = append(names, n)
+		total += weight
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if d.weights[names[i]] != d.weights[names[j]] {
+			return d.weights[names[i]] > d.weights[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for skipped, i := 0, 0; i < len(names) && skipped*2 < total; i++ {
+		if names[i] == name {
+			return true
+		}
+		skipped += d.weights[names[i]]
+	}
+	return false
+}
+
+// update runs c, and weighs it by the series it sends to ch if a memory guard is followed
+func (d *degradation) update(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric) error {
+	if !d.guarded() {
+		return update(ctx, c, ch)
+	}
+	counted := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- update(ctx, c, counted)
+		close(counted)
+	}()
+	series := 0
+	for m := range counted {
+		ch <- m
+		series++
+	}
+
+	d.mu.Lock()
+	if d.weights == nil {
+		d.weights = make(map[string]int)
+	}
+	d.weights[name] = series
+	d.mu.Unlock()
+	return <-done
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	var usage uint64
+	g := NewMemoryGuard(1000, 0.9)
+	g.usage = func() uint64 { return usage }
+
+	for _, step := range []struct {
+		usage    uint64
+		degraded bool
+	}{
+		{500, false},
+		{900, true},
+		// recovering below 90% of the soft limit only
+		{850, true},
+		{800, false},
+		{899, false},
+	} {
+		usage = step.usage
+		g.check(log.NewNopLogger())
+		if g.Degraded() != step.degraded {
+			t.Errorf("Expected degraded %v at %d bytes used, got %v", step.degraded, step.usage, g.Degraded())
+		}
+	}
+
+	if (*MemoryGuard)(nil).Degraded() {
+		t.Error("Expected no guard not to be degraded")
+	}
+}
+
+func TestCollectorDegradation(t *testing.T) {
+	desc := prometheus.NewDesc("emqx_test", "test", []string{"collector", "i"}, nil)
+	series := func(name string, n int) Collector {
+		return testCollector(func(ch chan<- prometheus.Metric) error {
+			for i := 0; i < n; i++ {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, name, strconv.Itoa(i))
+			}
+			return nil
+		})
+	}
+	nc := EMQXCollector{
+		Collectors:  map[string]Collector{"heavy": series("heavy", 10), "medium": series("medium", 5), "light": series("light", 1)},
+		logger:      log.NewNopLogger(),
+		durations:   newDurationHistogram(),
+		failures:    newFailureCounter(),
+		ctx:         context.Background(),
+		degradation: &degradation{},
+	}
+	g := NewMemoryGuard(1000, 1)
+	g.usage = func() uint64 { return 1000 }
+	nc.degradation.follow(g)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nc)
+	if count, _ := testutil.GatherAndCount(registry, "emqx_test"); count != 16 {
+		t.Errorf("Expected all collectors to run before degrading, got %d metrics", count)
+	}
+
+	g.check(log.NewNopLogger())
+	if count, _ := testutil.GatherAndCount(registry, "emqx_test"); count != 6 {
+		t.Errorf("Expected the heaviest collector to be disabled, got %d metrics", count)
+	}
+	families, _ := registry.Gather()
+	for _, family := range families {
+		if family.GetName() != "emqx_exporter_collector_degraded" {
+			continue
+		}
+		for _, m := range family.Metric {
+			expected := 0.0
+			if m.Label[0].GetValue() == "heavy" {
+				expected = 1
+			}
+			if m.Gauge.GetValue() != expected {
+				t.Errorf("Expected collector %s degraded %v, got %v", m.Label[0].GetValue(), expected, m.Gauge.GetValue())
+			}
+		}
+	}
+}
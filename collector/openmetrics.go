@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"net/http"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// createdSamplesHandler serves the OpenMetrics format with the `_created` series, which promhttp doesn't support.
+// Requests negotiating other formats are passed to the next handler
+type createdSamplesHandler struct {
+	gatherer prometheus.Gatherer
+	next     http.Handler
+	logger   log.Logger
+}
+
+func newCreatedSamplesHandler(gatherer prometheus.Gatherer, next http.Handler, logger log.Logger) http.Handler {
+	return &createdSamplesHandler{
+		gatherer: gatherer,
+		next:     next,
+		logger:   logger,
+	}
+}
+
+func (h *createdSamplesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format.FormatType() != expfmt.TypeOpenMetrics {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	mfs, err := h.gatherer.Gather()
+	if err != nil {
+		// continue on error, like the promhttp handler does
+		level.Error(h.logger).Log("msg", "Error gathering metrics", "err", err)
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(w, format, expfmt.WithCreatedLines())
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			level.Error(h.logger).Log("msg", "Error encoding metric family", "family", mf.GetName(), "err", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			level.Error(h.logger).Log("msg", "Error encoding EOF", "err", err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCreatedSamplesHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "emqx_test_total", Help: "A test counter"})
+	registry.MustRegister(counter)
+	counter.Inc()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	h := newCreatedSamplesHandler(registry, next, log.NewNopLogger())
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Expected the OpenMetrics format, got %q", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{"emqx_test_total 1", "emqx_test_created ", "# EOF"} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in:\n%s", line, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Body.String() != "next" {
+		t.Errorf("Expected the text format to be served by the next handler, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var apiPagesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("emqx_exporter", "api", "pages"),
+	"Number of pages of the paginated EMQX API endpoints fetched by the last collection.",
+	[]string{"endpoint"},
+	nil,
+)
+
+type pageTallyKey struct{}
+
+// pageTally counts the pages fetched by a collection, by endpoint
+type pageTally struct {
+	sync.Mutex
+	pages map[string]int
+}
+
+// withPageTally returns a context counting the pages fetched on behalf of it
+func withPageTally(ctx context.Context) (context.Context, *pageTally) {
+	tally := &pageTally{pages: make(map[string]int)}
+	return context.WithValue(ctx, pageTallyKey{}, tally), tally
+}
+
+// countPage counts a page of endpoint fetched on behalf of ctx, if it has a tally
+func countPage(ctx context.Context, endpoint string) {
+	tally, ok := ctx.Value(pageTallyKey{}).(*pageTally)
+	if !ok {
+		return
+	}
+	tally.Lock()
+	tally.pages[endpoint]++
+	tally.Unlock()
+}
+
+// collect sends the page counts of the endpoints paged through
+func (t *pageTally) collect(ch chan<- prometheus.Metric) {
+	t.Lock()
+	defer t.Unlock()
+	endpoints := make([]string, 0, len(t.pages))
+	for endpoint := range t.pages {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		ch <- prometheus.MustNewConstMetric(apiPagesDesc, prometheus.GaugeValue, float64(t.pages[endpoint]), endpoint)
+	}
+}
+
+// maxListPageSize bounds the pages of the list endpoints, like the clients, whose pages are only streamed through
+// but still held in memory one at a time per request, whatever page_size is
+const maxListPageSize = 1000
+
+// fetchPages fetches all pages of a page-numbered endpoint, and returns their items in order.
+// fetch gets the given page, starting from 1, of limit items, and the total count of items.
+// The first page is fetched alone to learn the count, and the others at most r.maxConcurrentPages at once
+func fetchPages[T any](ctx context.Context, r *requester, endpoint string,
+	fetch func(ctx context.Context, page, limit int) (items []T, count int, err error)) ([]T, error) {
+	items, count, err := fetch(ctx, 1, r.pageSize)
+	if err != nil {
+		return nil, err
+	}
+	countPage(ctx, endpoint)
+	if len(items) < r.pageSize || count <= r.pageSize {
+		return items, nil
+	}
+
+	rest := make([][]T, (count-1)/r.pageSize)
+	err = forEach(ctx, len(rest), r.maxConcurrentPages, func(ctx context.Context, i int) error {
+		page, _, err := fetch(ctx, i+2, r.pageSize)
+		if err != nil {
+			return err
+		}
+		countPage(ctx, endpoint)
+		rest[i] = page
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range rest {
+		items = append(items, page...)
+	}
+	return items, nil
+}
+
+// countPages pages through a page-numbered endpoint one page after another, for the live lists whose items are only
+// counted as each page is decoded, like the clients. fetch gets the given page, starting from 1, of limit items, and
+// returns the number of items and the hasnext of the page, nil if the page doesn't tell. The pages end at hasnext
+// false or a short page, rather than at a count which changes as the items come and go while paging
+func countPages(ctx context.Context, endpoint string, pageSize int,
+	fetch func(ctx context.Context, page, limit int) (n int, hasNext *bool, err error)) error {
+	for page := 1; ; page++ {
+		n, hasNext, err := fetch(ctx, page, pageSize)
+		if err != nil {
+			return err
+		}
+		countPage(ctx, endpoint)
+		if n < pageSize || (hasNext != nil && !*hasNext) {
+			return nil
+		}
+	}
+}
+
+// listPageSize is the page size of the list endpoints, which is r.pageSize up to maxListPageSize
+func (r *requester) listPageSize() int {
+	if r.pageSize > maxListPageSize {
+		return maxListPageSize
+	}
+	return r.pageSize
+}
+
+// decodeList decodes the JSON object of a page item by item, calling item with the iterator at each element of its
+// array field items rather than unmarshalling the whole page. The other fields are unmarshalled into fields by name,
+// or skipped. It returns the number of items
+func decodeList(data []byte, items string, item func(iter *jsoniter.Iterator), fields map[string]interface{}) (int, error) {
+	iter := jsoniter.ConfigCompatibleWithStandardLibrary.BorrowIterator(data)
+	defer jsoniter.ConfigCompatibleWithStandardLibrary.ReturnIterator(iter)
+	n := 0
+	iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+		if field == items {
+			iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+				item(iter)
+				n++
+				return iter.Error == nil
+			})
+		} else if v, ok := fields[field]; ok {
+			iter.ReadVal(v)
+		} else {
+			iter.Skip()
+		}
+		return iter.Error == nil
+	})
+	if iter.Error != nil && iter.Error != io.EOF {
+		return n, iter.Error
+	}
+	return n, nil
+}
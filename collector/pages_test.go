@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFetchPages(t *testing.T) {
+	r := newRequester(&config.Metrics{PageSize: 10, MaxConcurrentPages: 2})
+	ctx, tally := withPageTally(context.Background())
+
+	const count = 35
+	items, err := fetchPages(ctx, r, "rules", func(ctx context.Context, page, limit int) ([]int, int, error) {
+		var items []int
+		for i := (page - 1) * limit; i < page*limit && i < count; i++ {
+			items = append(items, i)
+		}
+		return items, count, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != count {
+		t.Fatalf("Expected %d items, got %d", count, len(items))
+	}
+	for i, item := range items {
+		if item != i {
+			t.Fatalf("Expected the items in order, got %v", items)
+		}
+	}
+
+	ch := make(chan prometheus.Metric, 1)
+	tally.collect(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Gauge.GetValue() != 4 || m.Label[0].GetValue() != "rules" {
+		t.Errorf("Expected 4 pages of rules, got %v of %s", m.Gauge.GetValue(), m.Label[0].GetValue())
+	}
+}
+
+func TestCountPages(t *testing.T) {
+	yes, no := true, false
+	for _, test := range []struct {
+		name    string
+		hasNext func(page int) *bool
+		count   int
+		pages   int
+	}{
+		// a page of 10 items is full, but tells it's the last one
+		{"hasnext", func(page int) *bool { return map[bool]*bool{true: &no, false: &yes}[page == 2] }, 35, 2},
+		// without hasnext nor any count, the pages end at the short one
+		{"short page", func(page int) *bool { return nil }, 35, 4},
+		{"full pages", func(page int) *bool { return nil }, 30, 4},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, tally := withPageTally(context.Background())
+			var pages []int
+			err := countPages(ctx, "clients", 10, func(ctx context.Context, page, limit int) (int, *bool, error) {
+				pages = append(pages, page)
+				n := test.count - (page-1)*limit
+				if n > limit {
+					n = limit
+				} else if n < 0 {
+					n = 0
+				}
+				return n, test.hasNext(page), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != test.pages || tally.pages["clients"] != test.pages {
+				t.Errorf("Expected %d pages fetched one after another, got %v", test.pages, pages)
+			}
+			for i, page := range pages {
+				if page != i+1 {
+					t.Errorf("Expected the pages in order, got %v", pages)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+	data := []byte(`{"code": 0, "data": [{"clientid": "c1", "connected": true, "keepalive": 60}, {"clientid": "c2", "node": "emqx@emqx-0"}], "meta": {"page": 1, "count": 10}, "other": [1, 2]}`)
+	var ids []string
+	meta := struct{ Count int }{}
+	code := -1
+	n, err := decodeList(data, "data", func(iter *jsoniter.Iterator) {
+		var c clientData
+		iter.ReadVal(&c)
+		ids = append(ids, c.ClientID)
+	}, map[string]interface{}{"meta": &meta, "code": &code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || strings.Join(ids, ",") != "c1,c2" || meta.Count != 10 || code != 0 {
+		t.Errorf("Expected the 2 clients, the count 10 and code 0, got %d %v %d %d", n, ids, meta.Count, code)
+	}
+
+	if _, err = decodeList([]byte(`{"data": [{"clientid": "c1"}, `), "data", func(iter *jsoniter.Iterator) {
+		iter.Skip()
+	}, nil); err == nil {
+		t.Error("Expected an error of a truncated page")
+	}
+
+	r := newRequester(&config.Metrics{PageSize: 5000})
+	if size := r.listPageSize(); size != maxListPageSize {
+		t.Errorf("Expected the page size of the lists to be bounded by %d, got %d", maxListPageSize, size)
+	}
+}
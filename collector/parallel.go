@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach calls f for 0 to n-1 with at most limit of the calls running at once.
+// The first error cancels the context of the calls not started yet, and is returned
+func forEach(ctx context.Context, n, limit int, f func(ctx context.Context, i int) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := f(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	started := 0
+feed:
+	for ; started < n; started++ {
+		select {
+		case indexes <- started:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if firstErr == nil && started < n {
+		// the parent context is done before all calls started
+		return ctx.Err()
+	}
+	return firstErr
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	results := make([]int, 20)
+	err := forEach(context.Background(), len(results), 4, func(ctx context.Context, i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		results[i] = i * i
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning.Load() > 4 {
+		t.Errorf("Expected at most 4 calls running at once, got %d", maxRunning.Load())
+	}
+	if maxRunning.Load() < 2 {
+		t.Errorf("Expected the calls to run concurrently, got %d at most", maxRunning.Load())
+	}
+	for i, r := range results {
+		if r != i*i {
+			t.Errorf("Expected result %d to be %d, got %d", i, i*i, r)
+		}
+	}
+}
+
+func TestForEachError(t *testing.T) {
+	failed := errors.New("api unavailable")
+	var calls atomic.Int32
+	err := forEach(context.Background(), 100, 2, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i == 3 {
+			return failed
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+			return nil
+		}
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("Expected the error of the failed call, got %v", err)
+	}
+	if calls.Load() == 100 {
+		t.Error("Expected the calls after the failure to be skipped")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := forEach(ctx, 10, 2, func(ctx context.Context, i int) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the error of the done context, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// PluginPrefix prefixes the collector names of the plugins, which keeps them apart from the built-in collectors
+const PluginPrefix = "plugin_"
+
+// maxPluginOutput bounds the metrics read from a plugin, whose collection fails if it writes more
+const maxPluginOutput = 16 << 20
+
+var errPluginOutput = errors.New("output too large")
+
+// limitedWriter fails the writes beyond n bytes, or drops them if truncate is set
+type limitedWriter struct {
+	w        io.Writer
+	n        int
+	truncate bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		if !l.truncate {
+			return 0, errPluginOutput
+		}
+		l.w.Write(p[:l.n])
+		l.n = 0
+		return len(p), nil
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+// pluginCollector runs the command of a plugin, and collects the metrics it writes to its stdout
+type pluginCollector struct {
+	plugin config.Plugin
+	env    []string
+}
+
+func newPluginCollector(plugin config.Plugin, metrics *config.Metrics) *pluginCollector {
+	env := append(os.Environ(),
+		"EMQX_API_URL="+metrics.Scheme+"://"+metrics.Target,
+		"EMQX_API_KEY="+metrics.APIKey,
+		"EMQX_API_SECRET="+string(metrics.APISecret),
+		"EMQX_CLUSTER="+metrics.Name,
+	)
+	for k, v := range plugin.Env {
+		env = append(env, k+"="+string(v))
+	}
+	return &pluginCollector{plugin: plugin, env: env}
+}
+
+func (c *pluginCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.plugin.Timeout))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.plugin.Command[0], c.plugin.Command[1:]...)
+	cmd.Env = c.env
+	// the children of the command keeping its output open don't hold the collection
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedWriter{w: &stdout, n: maxPluginOutput}
+	cmd.Stderr = &limitedWriter{w: &stderr, n: 4096, truncate: true}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return fmt.Errorf("plugin %s: %w", c.plugin.Name, err)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&stdout)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", c.plugin.Name, err)
+	}
+	if len(families) == 0 {
+		return ErrNoData
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			metric, err := pluginMetric(family, m)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %s: %w", c.plugin.Name, family.GetName(), err)
+			}
+			ch <- metric
+		}
+	}
+	return nil
+}
+
+// pluginMetric converts a metric parsed from the output of a plugin
+func pluginMetric(family *dto.MetricFamily, m *dto.Metric) (prometheus.Metric, error) {
+	names := make([]string, 0, len(m.Label))
+	values := make([]string, 0, len(m.Label))
+	for _, label := range m.Label {
+		// the clusters are told apart by the exporter
+		if label.GetName() == "cluster" {
+			return nil, errors.New("the cluster label is reserved")
+		}
+		names = append(names, label.GetName())
+		values = append(values, label.GetValue())
+	}
+	desc := prometheus.NewDesc(family.GetName(), family.GetHelp(), names, nil)
+
+	var metric prometheus.Metric
+	var err error
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, m.GetCounter().GetValue(), values...)
+	case dto.MetricType_GAUGE:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, m.GetGauge().GetValue(), values...)
+	case dto.MetricType_UNTYPED:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, m.GetUntyped().GetValue(), values...)
+	case dto.MetricType_SUMMARY:
+		quantiles := make(map[float64]float64, len(m.GetSummary().GetQuantile()))
+		for _, q := range m.GetSummary().GetQuantile() {
+			quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		metric, err = prometheus.NewConstSummary(desc, m.GetSummary().GetSampleCount(), m.GetSummary().GetSampleSum(), quantiles, values...)
+	case dto.MetricType_HISTOGRAM:
+		buckets := make(map[float64]uint64, len(m.GetHistogram().GetBucket()))
+		for _, b := range m.GetHistogram().GetBucket() {
+			// the +Inf bucket is the sample count
+			if !math.IsInf(b.GetUpperBound(), 1) {
+				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+			}
+		}
+		metric, err = prometheus.NewConstHistogram(desc, m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum(), buckets, values...)
+	default:
+		return nil, fmt.Errorf("unsupported metric type %s", family.GetType())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.TimestampMs != nil {
+		metric = prometheus.NewMetricWithTimestamp(time.UnixMilli(m.GetTimestampMs()), metric)
+	}
+	return metric, nil
+}
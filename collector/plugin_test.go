@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+func TestPluginCollector(t *testing.T) {
+	metrics := &config.Metrics{Name: "production", Target: "emqx:18083", Scheme: "http", APIKey: "key", APISecret: "secret"}
+	plugin := func(script string) *pluginCollector {
+		return newPluginCollector(config.Plugin{
+			Name:    "kpi",
+			Command: []string{"sh", "-c", script},
+			Env:     map[string]config.Secret{"KPI_RULE": "rule_1"},
+			Timeout: model.Duration(time.Second),
+		}, metrics)
+	}
+
+	c := plugin(`cat <<EOF
+# HELP company_rule_kpi KPI of a company rule
+# TYPE company_rule_kpi gauge
+company_rule_kpi{rule="$KPI_RULE",api="$EMQX_API_URL",key="$EMQX_API_KEY",secret="$EMQX_API_SECRET"} 0.5
+# TYPE company_rule_latency_seconds histogram
+company_rule_latency_seconds_bucket{le="0.1"} 1
+company_rule_latency_seconds_bucket{le="+Inf"} 2
+company_rule_latency_seconds_sum 0.6
+company_rule_latency_seconds_count 2
+EOF`)
+	expected := `
+# HELP company_rule_kpi KPI of a company rule
+# TYPE company_rule_kpi gauge
+company_rule_kpi{api="http://emqx:18083",key="key",rule="rule_1",secret="secret"} 0.5
+# HELP company_rule_latency_seconds
+# TYPE company_rule_latency_seconds histogram
+company_rule_latency_seconds_bucket{le="0.1"} 1
+company_rule_latency_seconds_bucket{le="+Inf"} 2
+company_rule_latency_seconds_sum 0.6
+company_rule_latency_seconds_count 2
+`
+	if err := testutil.CollectAndCompare(collectorFunc(c), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		script, err string
+	}{
+		{"echo failed to reach the rule API >&2; exit 3", "plugin kpi: exit status 3: failed to reach the rule API"},
+		{"sleep 5", "plugin kpi: context deadline exceeded"},
+		{"echo 'not metrics'", "plugin kpi: text format parsing error"},
+		{`echo 'company_rule_kpi{cluster="other"} 1'`, "plugin kpi: company_rule_kpi: the cluster label is reserved"},
+		{"true", ErrNoData.Error()},
+	} {
+		begin := time.Now()
+		if _, err := drain(plugin(tc.script)); err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("Expected %q running %q, got %v", tc.err, tc.script, err)
+		}
+		if elapsed := time.Since(begin); elapsed > 3*time.Second {
+			t.Errorf("Expected %q to be killed after the timeout, took %s", tc.script, elapsed)
+		}
+	}
+}
+
+// collectorFunc adapts a Collector to a prometheus.Collector for the tests
+func collectorFunc(c Collector) prometheus.Collector {
+	return testPrometheusCollector{c}
+}
+
+type testPrometheusCollector struct {
+	c Collector
+}
+
+func (t testPrometheusCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (t testPrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	t.c.Update(context.Background(), ch)
+}
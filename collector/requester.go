@@ -1,54 +1,346 @@
 package collector
 
 import (
-	"emqx-exporter/config"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/valyala/fasthttp"
+	"golang.org/x/sync/singleflight"
 )
 
 type requester struct {
 	client *fasthttp.Client
 	uri    *fasthttp.URI
+	// certNotAfter is the expiry of the certificate last presented by the API server, in unix seconds
+	certNotAfter atomic.Int64
+	// slots bounds the concurrent requests to the API server by config.Metrics.Parallelism
+	slots chan struct{}
+	// pageSize and maxConcurrentPages are config.Metrics.PageSize and config.Metrics.MaxConcurrentPages
+	pageSize           int
+	maxConcurrentPages int
+	// slowRefresh is config.Metrics.SlowRefreshInterval, for which the responses of slow-changing endpoints are reused
+	slowRefresh time.Duration
+	slowMu      sync.Mutex
+	slow        map[string]slowResponse
+	// breakers of the endpoints, nil unless config.Metrics.CircuitBreaker is set
+	breakers *breakers
+	// retry is config.Metrics.Retry, and retries counts the retried requests by endpoint, both nil if disabled
+	retry   *config.Retry
+	retries *prometheus.CounterVec
+	// timeouts is config.Metrics.Timeouts, nil for the requests to be bound to defaultRequestTimeout
+	timeouts *config.Timeouts
+	// flights coalesce the identical requests in flight at once, like those of two Prometheus replicas scraping together
+	flights singleflight.Group
+	shared  prometheus.Counter
+	// telemetry measures the requests made to the API server
+	telemetry *apiTelemetry
+}
+
+// requestError is an error of a request to the endpoint of the EMQX API, which is logged along with the error
+type requestError struct {
+	endpoint string
+	err      error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// defaultRequestTimeout bounds each request to the EMQX API unless config.Metrics.Timeouts is set
+const defaultRequestTimeout = 5 * time.Second
+
+type slowResponse struct {
+	data    []byte
+	expires time.Time
 }
 
 func newRequester(metrics *config.Metrics) *requester {
 	uri := &fasthttp.URI{}
 	uri.SetUsername(metrics.APIKey)
-	uri.SetPassword(metrics.APISecret)
+	uri.SetPassword(string(metrics.APISecret))
 	uri.SetScheme(metrics.Scheme)
 	uri.SetHost(metrics.Target)
 
-	return &requester{
-		uri: uri,
-		client: &fasthttp.Client{
-			Name:                "EMQX-Exporter", //User-Agent
-			MaxConnsPerHost:     5,
-			MaxIdleConnDuration: 30 * time.Second,
-			ReadTimeout:         5 * time.Second,
-			WriteTimeout:        5 * time.Second,
-			MaxConnWaitTimeout:  5 * time.Second,
-			TLSConfig:           metrics.TLSClientConfig.ToTLSConfig(),
-		},
+	parallelism := metrics.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	r := &requester{uri: uri, slots: make(chan struct{}, parallelism), pageSize: metrics.PageSize, maxConcurrentPages: metrics.MaxConcurrentPages, telemetry: newAPITelemetry()}
+	r.shared = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "emqx_exporter",
+		Subsystem: "api",
+		Name:      "shared_requests_total",
+		Help:      "Total number of requests to the EMQX API whose response was shared by identical requests made at the same time.",
+	})
+	if r.pageSize <= 0 {
+		r.pageSize = 1000
+	}
+	if r.maxConcurrentPages <= 0 {
+		r.maxConcurrentPages = 1
+	}
+	r.slowRefresh = time.Duration(metrics.SlowRefreshInterval)
+	r.slow = make(map[string]slowResponse)
+	if metrics.CircuitBreaker != nil {
+		r.breakers = newBreakers(metrics.CircuitBreaker)
+	}
+	r.timeouts = metrics.Timeouts
+	if metrics.Retry != nil {
+		r.retry = metrics.Retry
+		r.retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "emqx_exporter",
+			Subsystem: "api",
+			Name:      "retries_total",
+			Help:      "Total number of retried requests to the EMQX API endpoints.",
+		}, []string{"endpoint"})
 	}
+
+	tlsConfig := metrics.TLSClientConfig.ToTLSConfig()
+	if tlsConfig == nil && metrics.Scheme == "https" {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig != nil {
+		// resume the TLS sessions of closed connections rather than doing full handshakes,
+		// a session is only cached once its handshake passed the verification of tlsConfig
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) > 0 {
+				r.certNotAfter.Store(cs.PeerCertificates[0].NotAfter.Unix())
+			}
+			return nil
+		}
+	}
+
+	// leave room for the connections of abandoned requests, which are only closed by their deadlines
+	maxConns := 5
+	if parallelism > maxConns {
+		maxConns = parallelism
+	}
+	idleTimeout := 30 * time.Second
+	if pool := metrics.ConnectionPool; pool != nil {
+		if pool.MaxConns > 0 {
+			maxConns = pool.MaxConns
+		}
+		if pool.IdleTimeout > 0 {
+			idleTimeout = time.Duration(pool.IdleTimeout)
+		}
+	}
+	r.client = &fasthttp.Client{
+		Name:                "EMQX-Exporter", //User-Agent
+		MaxConnsPerHost:     maxConns,
+		MaxIdleConnDuration: idleTimeout,
+		// the requests are bound by the timeouts of their endpoints instead of read and write timeouts
+		MaxConnWaitTimeout: 5 * time.Second,
+		TLSConfig:          tlsConfig,
+	}
+	return r
 }
 
-func (r *requester) callHTTPGet(requestURI string) (data []byte, statusCode int, err error) {
-	req := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(req)
+// parallelism is the maximum number of concurrent requests to the API server
+func (r *requester) parallelism() int {
+	return cap(r.slots)
+}
 
+// timeout returns the timeout of each request to endpoint
+func (r *requester) timeout(endpoint string) time.Duration {
+	if r.timeouts == nil {
+		return defaultRequestTimeout
+	}
+	if timeout, ok := r.timeouts.Endpoints[endpoint]; ok {
+		return time.Duration(timeout)
+	}
+	return time.Duration(r.timeouts.Request)
+}
+
+// endpointOf returns the endpoint of the API path, which is its first three segments like `/api/v5/rules`,
+// so that the requests to the sub-paths of an endpoint, like the metrics of each rule, are accounted together
+func endpointOf(path string) string {
+	if parts := strings.SplitN(path, "/", 5); len(parts) == 5 {
+		return strings.Join(parts[:4], "/")
+	}
+	return path
+}
+
+type flightResult struct {
+	data       []byte
+	statusCode int
+}
+
+// callHTTPGet requests requestURI, or waits for the identical request in flight and shares its response.
+// The shared request outlives the callers giving up, up to the deadline of the one which made it
+func (r *requester) callHTTPGet(ctx context.Context, requestURI string) (data []byte, statusCode int, err error) {
+	flight := r.flights.DoChan(requestURI, func() (interface{}, error) {
+		flightCtx, cancel := detach(ctx)
+		defer cancel()
+		data, statusCode, err := r.callHTTPGetWithRetries(flightCtx, requestURI)
+		return flightResult{data: data, statusCode: statusCode}, err
+	})
+	select {
+	case res := <-flight:
+		if res.Shared {
+			r.shared.Inc()
+		}
+		result := res.Val.(flightResult)
+		return result.data, result.statusCode, res.Err
+	case <-ctx.Done():
+		err = fmt.Errorf("request %s aborted. %w", requestURI, ctx.Err())
+		return
+	}
+}
+
+// detach returns a context which isn't canceled along with ctx, but has the same deadline
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := tracing.Inherit(context.Background(), ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+// callHTTPGetWithRetries requests requestURI, and retries on the transient failures as configured by r.retry
+func (r *requester) callHTTPGetWithRetries(ctx context.Context, requestURI string) (data []byte, statusCode int, err error) {
+	for attempt := 0; ; attempt++ {
+		data, statusCode, err = r.callHTTPGetOnce(ctx, requestURI)
+		if err == nil || r.retry == nil || attempt >= r.retry.Attempts || !r.retryable(ctx, statusCode, err) {
+			return
+		}
+
+		timer := time.NewTimer(backoff(attempt, time.Duration(r.retry.BaseDelay), time.Duration(r.retry.MaxDelay)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		path, _, _ := strings.Cut(requestURI, "?")
+		r.retries.WithLabelValues(endpointOf(path)).Inc()
+	}
+}
+
+// retryable tells whether a failed request may succeed if retried, which are the requests failed by the transport
+// and those answered by the status codes of r.retry
+func (r *requester) retryable(ctx context.Context, statusCode int, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, errCircuitOpen) {
+		return false
+	}
+	if statusCode == 0 {
+		return true
+	}
+	for _, code := range r.retry.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry of the given attempt, starting from 0. It doubles from base with each
+// attempt up to maxDelay, and up to half of it is taken off at random, so that the retries of concurrent requests spread out
+func backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempt < 32 && base<<attempt < maxDelay {
+		delay = base << attempt
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (r *requester) callHTTPGetOnce(ctx context.Context, requestURI string) (data []byte, statusCode int, err error) {
+	path, query, _ := strings.Cut(requestURI, "?")
+	ctx, span := tracing.Start(ctx, "GET "+endpointOf(path))
+	span.SetAttributes("http.request.method", http.MethodGet, "url.path", path)
+	defer func() {
+		if statusCode != 0 {
+			span.SetAttributes("http.response.status_code", statusCode)
+		}
+		span.End(err)
+		if err != nil {
+			err = &requestError{endpoint: endpointOf(path), err: err}
+		}
+	}()
+	if err = ctx.Err(); err != nil {
+		err = fmt.Errorf("request %s aborted. %w", requestURI, err)
+		return
+	}
+
+	breaker := r.breakers.get(path)
+	trial, err := breaker.allow()
+	if err != nil {
+		err = fmt.Errorf("request %s rejected. %w", requestURI, err)
+		return
+	}
+	requested := false
+	defer func() {
+		outcome := requestAborted
+		if requested {
+			outcome = outcomeOf(ctx, statusCode, err)
+		}
+		breaker.done(trial, outcome)
+	}()
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		err = fmt.Errorf("request %s aborted. %w", requestURI, ctx.Err())
+		return
+	}
+	requested = true
+	begin := time.Now()
+	// the timeout of the endpoint starts once the request is let through, not while it waits for its slot.
+	// Timing out fails the request rather than aborting it as the end of ctx does
+	reqCtx, cancel := context.WithTimeout(ctx, r.timeout(endpointOf(path)))
+	defer cancel()
+
+	req := fasthttp.AcquireRequest()
 	req.SetURI(r.uri)
-	req.URI().SetPath(requestURI)
+	req.URI().SetPath(path)
+	req.URI().SetQueryString(query)
 	req.Header.SetMethod(http.MethodGet)
+	// the endpoints serving several formats, like the prometheus stats, answer in JSON as the others
+	req.Header.Set("Accept", "application/json")
 
 	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
 
-	err = r.client.Do(req, resp)
+	// fasthttp doesn't take a context, so the request runs aside to be abandoned once reqCtx is done,
+	// and its connection is closed by the deadline of reqCtx
+	deadline, _ := reqCtx.Deadline()
+	done := make(chan error, 1)
+	go func() {
+		done <- r.client.DoDeadline(req, resp, deadline)
+	}()
+	select {
+	case err = <-done:
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		if err != nil {
+			r.telemetry.observe(endpointOf(path), 0, time.Since(begin), 0)
+		} else {
+			r.telemetry.observe(endpointOf(path), resp.StatusCode(), time.Since(begin), len(resp.Body()))
+		}
+	case <-reqCtx.Done():
+		go func() {
+			<-done
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(resp)
+		}()
+		err = fmt.Errorf("request %s aborted. %w", requestURI, reqCtx.Err())
+		return
+	}
 	if err != nil {
 		err = fmt.Errorf("request %s failed. %w", req.URI().String(), err)
 		return
@@ -61,7 +353,8 @@ func (r *requester) callHTTPGet(requestURI string) (data []byte, statusCode int,
 		return
 	}
 
-	data = resp.Body()
+	// resp goes back to its pool on return, and data with it unless copied
+	data = append([]byte(nil), resp.Body()...)
 	if len(data) == 0 {
 		err = fmt.Errorf("get nothing from api %s", req.URI().String())
 		return
@@ -95,8 +388,8 @@ func (r *requester) callHTTPGet(requestURI string) (data []byte, statusCode int,
 	return
 }
 
-func (r *requester) callHTTPGetWithResp(requestURI string, respData interface{}) (err error) {
-	data, _, err := r.callHTTPGet(requestURI)
+func (r *requester) callHTTPGetWithResp(ctx context.Context, requestURI string, respData interface{}) (err error) {
+	data, _, err := r.callHTTPGet(ctx, requestURI)
 	if err != nil {
 		return
 	}
@@ -108,3 +401,48 @@ func (r *requester) callHTTPGetWithResp(requestURI string, respData interface{})
 	}
 	return
 }
+
+// callHTTPGetList is callHTTPGetWithResp for a page of a list endpoint, whose array field items is decoded item by item
+// by decodeList. It returns the number of items
+func (r *requester) callHTTPGetList(ctx context.Context, requestURI string, items string, item func(iter *jsoniter.Iterator), fields map[string]interface{}) (n int, err error) {
+	data, _, err := r.callHTTPGet(ctx, requestURI)
+	if err != nil {
+		return
+	}
+
+	n, err = decodeList(data, items, item, fields)
+	if err != nil {
+		err = fmt.Errorf("unmarshal api resp failed: %s, %s", requestURI, err.Error())
+		return
+	}
+	return
+}
+
+// callHTTPGetSlowWithResp is callHTTPGetWithResp for the endpoints whose data rarely changes, like the license.
+// Their responses are reused for r.slowRefresh rather than requested on every collection
+func (r *requester) callHTTPGetSlowWithResp(ctx context.Context, requestURI string, respData interface{}) (err error) {
+	if r.slowRefresh <= 0 {
+		return r.callHTTPGetWithResp(ctx, requestURI, respData)
+	}
+
+	r.slowMu.Lock()
+	cached, ok := r.slow[requestURI]
+	r.slowMu.Unlock()
+	if !ok || time.Now().After(cached.expires) {
+		cached.data, _, err = r.callHTTPGet(ctx, requestURI)
+		if err != nil {
+			return
+		}
+		cached.expires = time.Now().Add(r.slowRefresh)
+		r.slowMu.Lock()
+		r.slow[requestURI] = cached
+		r.slowMu.Unlock()
+	}
+
+	err = jsoniter.Unmarshal(cached.data, respData)
+	if err != nil {
+		err = fmt.Errorf("unmarshal api resp failed: %s, %s", requestURI, err.Error())
+		return
+	}
+	return
+}
@@ -0,0 +1,281 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+func TestCallHTTPGetAbortedByContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	r := newRequester(&config.Metrics{Scheme: "http", Target: strings.TrimPrefix(server.URL, "http://")})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	begin := time.Now()
+	_, _, err := r.callHTTPGet(ctx, "/api/v5/nodes")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the request to be canceled, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Expected the request to be aborted right after the cancellation, took %s", elapsed)
+	}
+}
+
+func TestCallHTTPGetEndpointTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	r := newRequester(&config.Metrics{
+		Scheme: "http",
+		Target: strings.TrimPrefix(server.URL, "http://"),
+		Timeouts: &config.Timeouts{
+			Request:   model.Duration(time.Second),
+			Endpoints: map[string]model.Duration{"/api/v5/clients": model.Duration(50 * time.Millisecond)},
+		},
+	})
+	begin := time.Now()
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/clients?page=2"); err == nil {
+		t.Error("Expected the request to the clients to time out")
+	}
+	if elapsed := time.Since(begin); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the request to the clients to time out after 50ms, took %s", elapsed)
+	}
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); err != nil {
+		t.Errorf("Expected the request to the nodes to succeed within 1s, got %v", err)
+	}
+}
+
+func TestCallHTTPGetReusesConnections(t *testing.T) {
+	var conns, resumed atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS.DidResume {
+			resumed.Add(1)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	r := newRequester(&config.Metrics{
+		Scheme:          "https",
+		Target:          strings.TrimPrefix(server.URL, "https://"),
+		TLSClientConfig: &config.TLSClientConfig{InsecureSkipVerify: true},
+	})
+	for i := 0; i < 3; i++ {
+		if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conns.Load() != 1 {
+		t.Errorf("Expected the connection to be kept alive, got %d connections", conns.Load())
+	}
+
+	server.CloseClientConnections()
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Load() != 1 {
+		t.Errorf("Expected the TLS session to be resumed by the new connection, got %d resumptions", resumed.Load())
+	}
+}
+
+func TestCallHTTPGetSlowWithResp(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"max_connections": 100}`))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		refresh  time.Duration
+		expected int32
+	}{{0, 3}, {time.Hour, 1}} {
+		requests.Store(0)
+		r := newRequester(&config.Metrics{
+			Scheme:              "http",
+			Target:              strings.TrimPrefix(server.URL, "http://"),
+			SlowRefreshInterval: model.Duration(tc.refresh),
+		})
+		for i := 0; i < 3; i++ {
+			resp := struct {
+				MaxConnections int64 `json:"max_connections"`
+			}{}
+			if err := r.callHTTPGetSlowWithResp(context.Background(), "/api/v5/license", &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.MaxConnections != 100 {
+				t.Errorf("Expected max_connections 100, got %d", resp.MaxConnections)
+			}
+		}
+		if requests.Load() != tc.expected {
+			t.Errorf("Expected %d requests with the refresh interval %s, got %d", tc.expected, tc.refresh, requests.Load())
+		}
+	}
+}
+
+func TestCallHTTPGetRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch {
+		case r.URL.Path == "/api/v5/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case n == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	r := newRequester(&config.Metrics{
+		Scheme: "http",
+		Target: strings.TrimPrefix(server.URL, "http://"),
+		Retry: &config.Retry{
+			Attempts:    2,
+			BaseDelay:   model.Duration(time.Millisecond),
+			MaxDelay:    model.Duration(10 * time.Millisecond),
+			StatusCodes: []int{http.StatusBadGateway},
+		},
+	})
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); err != nil {
+		t.Fatalf("Expected the request to succeed once retried, got %v", err)
+	}
+	if retries := testutil.ToFloat64(r.retries.WithLabelValues("/api/v5/nodes")); retries != 1 {
+		t.Errorf("Expected 1 retry, got %v", retries)
+	}
+
+	requests.Store(0)
+	if _, statusCode, _ := r.callHTTPGet(context.Background(), "/api/v5/missing"); statusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", statusCode)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected no retry of a non-retryable status, got %d requests", requests.Load())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, maxDelay := 100*time.Millisecond, time.Second
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 10; i++ {
+			if delay := backoff(attempt, base, maxDelay); delay < expected/2 || delay > expected {
+				t.Errorf("Expected the delay of attempt %d within [%s, %s], got %s", attempt, expected/2, expected, delay)
+			}
+		}
+	}
+	if delay := backoff(100, base, maxDelay); delay > maxDelay {
+		t.Errorf("Expected the delay to be bound by %s, got %s", maxDelay, delay)
+	}
+}
+
+func TestCallHTTPGetShared(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	r := newRequester(&config.Metrics{Scheme: "http", Target: strings.TrimPrefix(server.URL, "http://")})
+	// the caller making the request gives up, which doesn't abort it for the other
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := r.callHTTPGet(ctx, "/api/v5/nodes")
+		first <- err
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes")
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the first caller to be canceled, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected a single request, got %d", requests.Load())
+	}
+	if shared := testutil.ToFloat64(r.shared); shared != 1 {
+		t.Errorf("Expected the response to be shared once, got %v", shared)
+	}
+}
+
+func TestCallHTTPGetTelemetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v5/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"node":"emqx@127.0.0.1"}`))
+	}))
+	target := strings.TrimPrefix(server.URL, "http://")
+
+	r := newRequester(&config.Metrics{Scheme: "http", Target: target})
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/nodes"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reqErr *requestError
+	if _, _, err := r.callHTTPGet(context.Background(), "/api/v5/missing"); !errors.As(err, &reqErr) || reqErr.endpoint != "/api/v5/missing" {
+		t.Errorf("Expected an error of the endpoint /api/v5/missing, got %v", err)
+	}
+	server.Close()
+	r.callHTTPGet(context.Background(), "/api/v5/nodes")
+
+	for _, c := range []struct {
+		endpoint, code string
+		expected       float64
+	}{
+		{"/api/v5/nodes", "200", 2},
+		{"/api/v5/missing", "404", 1},
+		{"/api/v5/nodes", "error", 1},
+	} {
+		if requests := testutil.ToFloat64(r.telemetry.requests.WithLabelValues(c.endpoint, c.code)); requests != c.expected {
+			t.Errorf("Expected %v requests to %s with code %s, got %v", c.expected, c.endpoint, c.code, requests)
+		}
+	}
+	if bytes := testutil.ToFloat64(r.telemetry.bytes.WithLabelValues("/api/v5/nodes")); bytes != 2*float64(len(`{"node":"emqx@127.0.0.1"}`)) {
+		t.Errorf("Expected the bytes of 2 responses, got %v", bytes)
+	}
+	if count := testutil.CollectAndCount(r.telemetry.durations); count != 2 {
+		t.Errorf("Expected the durations of 2 endpoints, got %d", count)
+	}
+}
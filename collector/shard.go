@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Shard is the share of the collection of a replica of the exporter, when the collection is spread over
+// Total replicas. The collectors of every cluster are assigned to the shards by the hash of the cluster name and
+// the collector name, so the replicas agree on it without coordination. The zero Shard collects everything
+type Shard struct {
+	// Index is the shard of the replica, from 0 to Total-1
+	Index int
+	Total int
+}
+
+// Validate returns an error if the shard isn't one of the total shards
+func (s Shard) Validate() error {
+	if s.Total < 1 {
+		return fmt.Errorf("total shards must be at least 1, got %d", s.Total)
+	}
+	if s.Index < 0 || s.Index >= s.Total {
+		return fmt.Errorf("shard must be between 0 and %d, got %d", s.Total-1, s.Index)
+	}
+	return nil
+}
+
+// owns returns whether the collector of the cluster is collected by the shard
+func (s Shard) owns(cluster, collector string) bool {
+	if s.Total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(cluster))
+	h.Write([]byte{0})
+	h.Write([]byte(collector))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestShard(t *testing.T) {
+	if err := (Shard{Index: 3, Total: 3}).Validate(); err == nil {
+		t.Error("Expected an error for a shard beyond the total shards")
+	}
+	if err := (Shard{}).Validate(); err == nil {
+		t.Error("Expected an error for no total shards")
+	}
+
+	owned := make([]int, 3)
+	for _, cluster := range []string{"", "site1", "site2", "site3"} {
+		for collector := range factories {
+			if !(Shard{}).owns(cluster, collector) {
+				t.Errorf("Expected the zero shard to own collector %s of cluster %q", collector, cluster)
+			}
+			owners := 0
+			for i := range owned {
+				if (Shard{Index: i, Total: len(owned)}).owns(cluster, collector) {
+					owners++
+					owned[i]++
+				}
+			}
+			if owners != 1 {
+				t.Errorf("Expected collector %s of cluster %q to be owned by 1 shard, got %d", collector, cluster, owners)
+			}
+		}
+	}
+	for i, n := range owned {
+		if n == 0 {
+			t.Errorf("Expected shard %d to own some collectors", i)
+		}
+	}
+}
+
+func TestCollectorFilterSharded(t *testing.T) {
+	noop := testCollector(func(ch chan<- prometheus.Metric) error { return nil })
+	nc := EMQXCollector{Collectors: map[string]Collector{"cluster": noop}, elsewhere: map[string]struct{}{"rule": {}}}
+
+	filtered, err := nc.filter([]string{"rule", "cluster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Collectors) != 1 || filtered.Collectors["cluster"] == nil {
+		t.Errorf("Expected the collector of this shard only, got %v", filtered.Collectors)
+	}
+}
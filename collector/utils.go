@@ -2,19 +2,121 @@ package collector
 
 import (
 	"net/netip"
+	"regexp"
 	"strings"
+
+	"github.com/emqx/emqx-exporter/config"
 )
 
-func cutNodeName(nodeName string) string {
-	slice := strings.Split(nodeName, "@")
-	if len(slice) != 2 {
-		return nodeName
+// nodeNameNormalizer transforms EMQX node names, like emqx@emqx-0.emqx-headless.default.svc, into label values
+type nodeNameNormalizer struct {
+	keepPrefix  bool
+	keepDomain  bool
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func newNodeNameNormalizer(conf *config.NodeName) *nodeNameNormalizer {
+	n := &nodeNameNormalizer{}
+	if conf == nil {
+		return n
+	}
+	n.keepPrefix = conf.KeepPrefix
+	n.keepDomain = conf.KeepDomain
+	if conf.Regex != "" {
+		// the regex is validated while loading config, and anchored like the prometheus relabel config
+		n.regex = regexp.MustCompile("^(?:" + conf.Regex + ")$")
+		n.replacement = conf.Replacement
 	}
+	return n
+}
 
-	if ip, err := netip.ParseAddr(slice[1]); err == nil {
+func (n *nodeNameNormalizer) normalize(nodeName string) string {
+	name := nodeName
+	if slice := strings.Split(nodeName, "@"); len(slice) == 2 {
+		host := slice[1]
+		if !n.keepDomain {
+			host = cutDomain(host)
+		}
+		if n.keepPrefix {
+			name = slice[0] + "@" + host
+		} else {
+			name = host
+		}
+	}
+	if n.regex != nil && n.regex.MatchString(name) {
+		name = n.regex.ReplaceAllString(name, n.replacement)
+	}
+	return name
+}
+
+func cutDomain(host string) string {
+	if ip, err := netip.ParseAddr(host); err == nil {
 		return ip.String()
-	} else if pos := strings.IndexRune(slice[1], '.'); pos != 0 {
-		return slice[1][:pos]
+	} else if pos := strings.IndexRune(host, '.'); pos > 0 {
+		return host[:pos]
+	}
+	return host
+}
+
+// nodeFilter selects nodes by matching their full EMQX node name against the include and exclude regexes
+type nodeFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newNodeFilter(include, exclude string) *nodeFilter {
+	f := &nodeFilter{}
+	// the regexes are validated while loading config
+	if include != "" {
+		f.include = regexp.MustCompile("^(?:" + include + ")$")
+	}
+	if exclude != "" {
+		f.exclude = regexp.MustCompile("^(?:" + exclude + ")$")
+	}
+	return f
+}
+
+func (f *nodeFilter) match(nodeName string) bool {
+	if f.include != nil && !f.include.MatchString(nodeName) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(nodeName) {
+		return false
+	}
+	return true
+}
+
+// sumNodeValues sums the first of keys each node has
+func sumNodeValues(nodes []map[string]any, keys ...string) float64 {
+	sum := 0.0
+	for _, node := range nodes {
+		for _, key := range keys {
+			if v, ok := node[key].(float64); ok {
+				sum += v
+				break
+			}
+		}
+	}
+	return sum
+}
+
+// nodeMetrics returns the numeric metrics of the nodes selected by filter, which carry their name as node,
+// by the node name normalized
+func nodeMetrics(nodes []map[string]any, filter *nodeFilter, normalizer *nodeNameNormalizer) map[string]map[string]float64 {
+	metrics := make(map[string]map[string]float64, len(nodes))
+	for _, node := range nodes {
+		name, _ := node["node"].(string)
+		if name == "" || !filter.match(name) {
+			continue
+		}
+		m := make(map[string]float64, len(node))
+		for k, v := range node {
+			if f, ok := v.(float64); ok {
+				m[k] = f
+			}
+		}
+		metrics[normalizer.normalize(name)] = m
 	}
-	return slice[1]
+	return metrics
 }
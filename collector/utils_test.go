@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+func TestNodeNameNormalize(t *testing.T) {
+	testcases := []struct {
+		conf     *config.NodeName
+		nodeName string
+		expected string
+	}{
+		{nil, "emqx@emqx-0.emqx-headless.default.svc", "emqx-0"},
+		{nil, "emqx@10.0.0.1", "10.0.0.1"},
+		{nil, "emqx@localhost", "localhost"},
+		{nil, "localhost", "localhost"},
+		{&config.NodeName{KeepPrefix: true}, "emqx@emqx-0.emqx-headless", "emqx@emqx-0"},
+		{&config.NodeName{KeepDomain: true}, "emqx@emqx-0.emqx-headless", "emqx-0.emqx-headless"},
+		{&config.NodeName{Regex: `emqx-core-[a-z0-9]+-(\d+)`, Replacement: "core-$1"}, "emqx@emqx-core-6d8f-2.svc", "core-2"},
+		{&config.NodeName{Regex: `core`, Replacement: "x"}, "emqx@emqx-core-0", "emqx-core-0"},
+	}
+
+	for _, tc := range testcases {
+		got := newNodeNameNormalizer(tc.conf).normalize(tc.nodeName)
+		if tc.expected != got {
+			t.Errorf("Expected '%s' but got '%s' for '%s'", tc.expected, got, tc.nodeName)
+		}
+	}
+}
+
+func TestNodeFilter(t *testing.T) {
+	testcases := []struct {
+		include, exclude string
+		nodeName         string
+		expected         bool
+	}{
+		{"", "", "emqx@emqx-0", true},
+		{"emqx@emqx-core-.*", "", "emqx@emqx-core-0", true},
+		{"emqx@emqx-core-.*", "", "emqx@emqx-replicant-0", false},
+		// the regexes match the whole name
+		{"emqx-core", "", "emqx@emqx-core-0", false},
+		{"", "emqx@emqx-replicant-.*", "emqx@emqx-replicant-0", false},
+		{"", "emqx@emqx-replicant-.*", "emqx@emqx-core-0", true},
+		{"emqx@emqx-.*", "emqx@emqx-core-1", "emqx@emqx-core-1", false},
+		{"emqx@emqx-.*", "emqx@emqx-core-1", "emqx@emqx-core-0", true},
+	}
+
+	for _, tc := range testcases {
+		if got := newNodeFilter(tc.include, tc.exclude).match(tc.nodeName); got != tc.expected {
+			t.Errorf("Expected %v for '%s' with include '%s' and exclude '%s'", tc.expected, tc.nodeName, tc.include, tc.exclude)
+		}
+	}
+}
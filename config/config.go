@@ -1,40 +1,540 @@
 package config
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/emqx/emqx-exporter/internal/derived"
+	"github.com/emqx/emqx-exporter/spiffe"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
 
 	yaml "gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Metrics *Metrics `yaml:"metrics,omitempty"`
-	Probes  []Probe  `yaml:"probes,omitempty"`
+	// Clusters are scraped via `/metrics?cluster=<name>`, while Metrics is scraped via `/metrics`
+	Clusters []Metrics `yaml:"clusters,omitempty"`
+	Probes   []Probe   `yaml:"probes,omitempty"`
+	// ProbeDefaults are inherited by the probes which don't set them
+	ProbeDefaults *ProbeDefaults `yaml:"probe_defaults,omitempty"`
+	// ProbeSchedule runs the probes on an interval aside from the `/probe` requests, which are served the last results
+	ProbeSchedule *ProbeSchedule `yaml:"probe_schedule,omitempty"`
+	// RemoteWrite pushes the metrics of all clusters and probes to a Prometheus remote write endpoint
+	RemoteWrite *RemoteWrite `yaml:"remote_write,omitempty"`
+	// OTLP pushes the metrics of all clusters and probes to an OpenTelemetry collector
+	OTLP *OTLP `yaml:"otlp,omitempty"`
+	// Tracing exports the spans of the scrapes and probes to an OpenTelemetry collector
+	Tracing *Tracing `yaml:"tracing,omitempty"`
+	// Pushgateway receives the metrics of all clusters and probes in the one-shot mode of `--once`
+	Pushgateway *Pushgateway `yaml:"pushgateway,omitempty"`
+	// StatsD pushes the metrics of all clusters and probes to a DogStatsD server like the Datadog agent
+	StatsD *StatsD `yaml:"statsd,omitempty"`
+	// InfluxDB receives the metrics of all clusters and probes in the line protocol
+	InfluxDB *InfluxDB `yaml:"influxdb,omitempty"`
+	// Graphite receives the metrics of all clusters and probes in the plaintext protocol
+	Graphite *Graphite `yaml:"graphite,omitempty"`
+	// MQTTPublish publishes a summary of the probe results and the cluster health to an MQTT topic
+	MQTTPublish *MQTTPublish `yaml:"mqtt_publish,omitempty"`
 }
 
 type Metrics struct {
+	// Name identifies a cluster of Config.Clusters
+	Name            string           `yaml:"name,omitempty"`
 	APIKey          string           `yaml:"api_key"`
-	APISecret       string           `yaml:"api_secret"`
+	APISecret       Secret           `yaml:"api_secret"`
 	Target          string           `yaml:"target"`
 	Scheme          string           `yaml:"scheme,omitempty"`
 	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+	// Namespaces lists the multi-tenancy namespaces to collect, "*" selects all of them.
+	// Namespace metrics are not collected if it's empty
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// NodeName defines how node names are transformed into the `node` label
+	NodeName *NodeName `yaml:"node_name,omitempty"`
+	// NodesInclude and NodesExclude are regexes matched against the full node name, like `emqx@10.0.0.1`,
+	// metrics of a node are collected only if it matches NodesInclude and doesn't match NodesExclude
+	NodesInclude string `yaml:"nodes_include,omitempty"`
+	NodesExclude string `yaml:"nodes_exclude,omitempty"`
+	// Cache keeps the collected metrics for a while, to be served to the overlapping scrapes
+	Cache *Cache `yaml:"cache,omitempty"`
+	// Background collects the metrics on intervals of its own rather than on scrapes
+	Background *Background `yaml:"background,omitempty"`
+	// Parallelism is the maximum number of concurrent requests to the EMQX API, 4 by default
+	Parallelism int `yaml:"parallelism,omitempty"`
+	// PageSize is the number of items requested per page of the paginated endpoints, 1000 by default
+	PageSize int `yaml:"page_size,omitempty"`
+	// MaxConcurrentPages is the maximum number of pages of an endpoint fetched at once, 4 by default.
+	// The requests are bound by Parallelism as well
+	MaxConcurrentPages int `yaml:"max_concurrent_pages,omitempty"`
+	// SlowRefreshInterval is how long the responses of the endpoints whose data rarely changes, like the license
+	// and the rule definitions, and the counts of the client buckets, are reused rather than requested again.
+	// 0, the default, requests them on every collection
+	SlowRefreshInterval model.Duration `yaml:"slow_refresh_interval,omitempty"`
+	// ConnectionPool tunes the connections to the EMQX API kept open across scrapes
+	ConnectionPool *ConnectionPool `yaml:"connection_pool,omitempty"`
+	// CircuitBreaker fails the requests to an endpoint of the EMQX API fast while it's down
+	CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker,omitempty"`
+	// Retry retries the requests to the EMQX API failed by transient errors
+	Retry *Retry `yaml:"retry,omitempty"`
+	// Timeouts bound the requests to the EMQX API by endpoint, and all those of a scrape
+	Timeouts *Timeouts `yaml:"timeouts,omitempty"`
+	// Plugins are external collectors of the cluster, like the KPIs of company-specific rules
+	Plugins []Plugin `yaml:"plugins,omitempty"`
+	// Derived are metrics computed from the collected ones on each scrape
+	Derived []Derived `yaml:"derived,omitempty"`
+	// Aggregation serves the series of the nodes summed up across the cluster, rather than or along with per node
+	Aggregation *Aggregation `yaml:"aggregation,omitempty"`
+	// ClientBuckets count the connections of the clients by buckets of their client IDs, each client in the first
+	// bucket it matches. They're not counted if it's empty, as it pages through all clients
+	ClientBuckets []ClientBucket `yaml:"client_buckets,omitempty"`
+}
+
+// ClientBucket is a segment of the fleet whose connections are counted, like the sensors
+type ClientBucket struct {
+	// Name is the `bucket` label of the count
+	Name string `yaml:"name"`
+	// ClientID is a regex matched against the full client ID, like `sensor-.*`
+	ClientID string `yaml:"clientid"`
+}
+
+// The modes of Aggregation
+const (
+	AggregateNode    = "node"
+	AggregateCluster = "cluster"
+	AggregateBoth    = "both"
+)
+
+// Aggregation tells how the series labeled by `node` are served on each scrape: per node (`node`), summed up or maxed
+// across the nodes of the cluster under names prefixed by `emqx_cluster_` rather than `emqx_` (`cluster`), or both (`both`).
+// So cluster-level SLOs don't need to aggregate the series of every node in Prometheus
+type Aggregation struct {
+	// Mode of all collectors, `node` by default
+	Mode string `yaml:"mode,omitempty"`
+	// Collectors overrides the mode of the given collectors, like `rule: both`
+	Collectors map[string]string `yaml:"collectors,omitempty"`
+}
+
+// Derived is a gauge computed from the metrics collected from the cluster on each scrape, like a ratio which would
+// otherwise need a recording rule in every Prometheus. Expr is an arithmetic expression of the metric names
+// with +, -, * and /, and the aggregations sum, min, max, avg and count, like `sum by (rule) (emqx_rule_exec_failure_count)`
+type Derived struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help,omitempty"`
+	Expr string `yaml:"expr"`
+}
+
+// Plugin is an external collector, a command run on each collection which writes metrics in the Prometheus text
+// format to its stdout. It's the collector `plugin_<name>`, which is selected, cached and run in the background like
+// the built-in ones, and given the EMQX API of the cluster by the environment variables EMQX_API_URL, EMQX_API_KEY,
+// EMQX_API_SECRET and EMQX_CLUSTER
+type Plugin struct {
+	// Name of the plugin, made of letters, digits and underscores
+	Name string `yaml:"name"`
+	// Command is the executable and its arguments, run without a shell
+	Command []string `yaml:"command"`
+	// Env are environment variables set for the command along with the ones of the exporter
+	Env map[string]Secret `yaml:"env,omitempty"`
+	// Timeout kills the command, 10s by default. It's bound by the scrape timeout as well
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+}
+
+// Retry retries the requests failed by the transport, or answered by one of StatusCodes, with an exponential backoff.
+// The retries are bound by the scrape timeout
+type Retry struct {
+	// Attempts is the maximum number of retries of a request, 2 by default
+	Attempts int `yaml:"attempts,omitempty"`
+	// BaseDelay is the delay before the first retry, which doubles with each of the others, 100ms by default
+	BaseDelay model.Duration `yaml:"base_delay,omitempty"`
+	// MaxDelay bounds the delay before a retry, 2s by default
+	MaxDelay model.Duration `yaml:"max_delay,omitempty"`
+	// StatusCodes are the retryable status codes, 502, 503 and 504 by default
+	StatusCodes []int `yaml:"status_codes,omitempty"`
+}
+
+// Timeouts bound the requests to the EMQX API, so that a slow endpoint, like the list of the clients of a large cluster,
+// doesn't take the time of the others. Without them, each request is bound to 5s
+type Timeouts struct {
+	// Request bounds each request to the EMQX API, 5s by default
+	Request model.Duration `yaml:"request,omitempty"`
+	// Endpoints overrides Request for the given endpoints, like `/api/v5/clients: 10s`
+	Endpoints map[string]model.Duration `yaml:"endpoints,omitempty"`
+	// Budget bounds all the requests of a scrape, along with the scrape timeout. 0, the default, leaves them bound by the scrape timeout only
+	Budget model.Duration `yaml:"budget,omitempty"`
+}
+
+// CircuitBreaker opens the circuit of an endpoint of the EMQX API after a number of consecutive failures, which are
+// the requests timing out and the server errors. The requests to it fail right away then, until a trial request succeeds
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failures opening the circuit, 5 by default
+	Failures int `yaml:"failures,omitempty"`
+	// OpenTimeout is how long the circuit stays open before a trial request is let through, 30s by default
+	OpenTimeout model.Duration `yaml:"open_timeout,omitempty"`
+}
+
+// ConnectionPool tunes the keep-alive connections to the EMQX API, which are reused by the requests of all collectors and scrapes
+type ConnectionPool struct {
+	// MaxConns is the maximum number of connections open at once, the larger of 5 and parallelism by default
+	MaxConns int `yaml:"max_conns,omitempty"`
+	// IdleTimeout closes the connections idle for longer, 30s by default
+	IdleTimeout model.Duration `yaml:"idle_timeout,omitempty"`
+}
+
+// Cache keeps the metrics of each collector for a TTL, and serves them to the scrapes meanwhile,
+// so that several Prometheus replicas scraping the exporter don't multiply the load on the EMQX API
+type Cache struct {
+	// TTL of the metrics of all collectors, 0 disables caching
+	TTL model.Duration `yaml:"ttl,omitempty"`
+	// Collectors overrides the TTL of the given collectors, like `rule: 60s`
+	Collectors map[string]model.Duration `yaml:"collectors,omitempty"`
+}
+
+// NodeName transforms node names like `emqx@emqx-0.emqx-headless.default.svc.cluster.local`.
+// By default, both the `emqx@` prefix and the domain are stripped, which gives `emqx-0`
+type NodeName struct {
+	// KeepPrefix keeps the `emqx@` part of the node name
+	KeepPrefix bool `yaml:"keep_prefix,omitempty"`
+	// KeepDomain keeps the domain part of the node host
+	KeepDomain bool `yaml:"keep_domain,omitempty"`
+	// Regex is matched against the whole node name after stripping, and replaced by Replacement if matched
+	Regex       string `yaml:"regex,omitempty"`
+	Replacement string `yaml:"replacement,omitempty"`
 }
 
 type Probe struct {
+	// Name of the probe, like `eu-prod-tls-listener`, is exported as the `name` label of its metrics along with the target
+	Name            string           `yaml:"name,omitempty"`
 	Target          string           `yaml:"target"`
 	Scheme          string           `yaml:"scheme,omitempty"`
 	ClientID        string           `yaml:"client_id,omitempty"`
 	Username        string           `yaml:"username,omitempty"`
-	Password        string           `yaml:"password,omitempty"`
+	Password        Secret           `yaml:"password,omitempty"`
 	Topic           string           `yaml:"topic,omitempty"`
 	QoS             byte             `yaml:"qos,omitempty"`
 	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+	// AssignClientID connects the probe with an empty client ID for the broker to assign one, which is told by
+	// the CONNACK of an MQTT 5 connection made aside. It's exclusive with ClientID
+	AssignClientID bool `yaml:"assign_client_id,omitempty"`
+	// ExpectAssignedClientID fails the probe if the broker doesn't tell an assigned client ID
+	ExpectAssignedClientID bool `yaml:"expect_assigned_client_id,omitempty"`
+	// CleanStart is the Clean Session flag of the probe client, true by default. If false, the broker keeps the
+	// session of the client, which is resumed when it reconnects
+	CleanStart *bool `yaml:"clean_start,omitempty"`
+	// SessionExpiryInterval has the probe also connect over MQTT 5 with CleanStart and this Session Expiry Interval,
+	// to export the connect latency and whether the session was resumed
+	SessionExpiryInterval model.Duration `yaml:"session_expiry_interval,omitempty"`
+	// ReceiveMaximum has the probe also check the broker doesn't send more QoS 1 messages unacknowledged than this
+	// Receive Maximum of an MQTT 5 subscriber, to which twice as many messages are published
+	ReceiveMaximum uint16 `yaml:"receive_maximum,omitempty"`
+	// Timeout bounds each probe of the target, besides the timeout of the scrape or of the probe schedule
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+	// ColdConnect has each probe connect a client of its own with a full TLS handshake, to measure the cold connects.
+	// Otherwise the probe client stays connected across the probes, and the connections resume the earlier TLS sessions
+	ColdConnect bool `yaml:"cold_connect,omitempty"`
+}
+
+// ProbeDefaults are the settings shared by the probes, like the TLS config of a fleet of listeners.
+// A probe inherits each of them it doesn't set
+type ProbeDefaults struct {
+	Scheme          string           `yaml:"scheme,omitempty"`
+	Username        string           `yaml:"username,omitempty"`
+	Password        Secret           `yaml:"password,omitempty"`
+	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+	Timeout         model.Duration   `yaml:"timeout,omitempty"`
+}
+
+// apply fills the settings p doesn't set with the defaults
+func (d *ProbeDefaults) apply(p *Probe) {
+	if p.Scheme == "" {
+		p.Scheme = d.Scheme
+	}
+	if p.Username == "" {
+		p.Username = d.Username
+	}
+	if p.Password == "" {
+		p.Password = d.Password
+	}
+	if p.TLSClientConfig == nil && d.TLSClientConfig != nil {
+		// each probe loads its own copy
+		tlsConfig := *d.TLSClientConfig
+		p.TLSClientConfig = &tlsConfig
+	}
+	if p.Timeout == 0 {
+		p.Timeout = d.Timeout
+	}
+}
+
+// ProbeSchedule runs every probe on an interval, decoupled from the `/probe` requests, which are served the results of
+// the last probe with their age. So a hung MQTT connect never blocks a request
+type ProbeSchedule struct {
+	// Interval of running all probes, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of each probe, the interval by default. A probe still running on the next interval isn't started again
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+}
+
+// Background runs each collector on an interval, decoupled from the scrapes, which are served the metrics it collected last
+// with the timestamp of the collection. So slow EMQX APIs never block a scrape
+type Background struct {
+	// Interval of running all collectors, 30s by default. Each collection is bound by its interval
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Collectors overrides the interval of the given collectors, like `rule: 60s`
+	Collectors map[string]model.Duration `yaml:"collectors,omitempty"`
+	// Timestamps serves the metrics with the timestamp of their collection. So Prometheus records when they were
+	// gathered, rather than the same values on each scrape while the EMQX API is down. It's off by default, as
+	// Prometheus doesn't mark the series with timestamps stale once they're missing from a scrape
+	Timestamps bool `yaml:"timestamps,omitempty"`
+}
+
+// RemoteWrite pushes the metrics on an interval via the Prometheus remote write protocol, e.g. to Mimir or Thanos
+type RemoteWrite struct {
+	URL string `yaml:"url"`
+	// Interval of collecting and pushing the metrics, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of each push request, 10s by default
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+	// ExternalLabels are added to all pushed series, e.g. to tell the sites apart
+	ExternalLabels map[string]string `yaml:"external_labels,omitempty"`
+	BasicAuth      *BasicAuth        `yaml:"basic_auth,omitempty"`
+	BearerToken    Secret            `yaml:"bearer_token,omitempty"`
+	// Headers are added to each push request, e.g. X-Scope-OrgID of Mimir
+	Headers         map[string]Secret `yaml:"headers,omitempty"`
+	TLSClientConfig *TLSClientConfig  `yaml:"tls_config,omitempty"`
+	// MaxRetries of a failed push request, 3 by default
+	MaxRetries int `yaml:"max_retries,omitempty"`
+	// MaxPendingPushes is the number of failed pushes kept in memory to retry on the next interval, 10 by default
+	MaxPendingPushes int `yaml:"max_pending_pushes,omitempty"`
+	// StalenessMarkers pushes a staleness marker for each series of the last push missing from the next one, like of a node
+	// which left the cluster, so it's not queried at its last value for the lookback delta of Prometheus
+	StalenessMarkers bool `yaml:"staleness_markers,omitempty"`
+}
+
+// OTLP pushes the metrics on an interval via the OpenTelemetry protocol
+type OTLP struct {
+	// Endpoint is the URL of the collector, like `http://otel-collector:4318` for http/protobuf,
+	// or `http://otel-collector:4317` for grpc
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is either "http/protobuf" or "grpc", "http/protobuf" by default
+	Protocol string `yaml:"protocol,omitempty"`
+	// Interval of collecting and pushing the metrics, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of each export request, 10s by default
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+	// Headers are added to each export request, e.g. an API key
+	Headers map[string]Secret `yaml:"headers,omitempty"`
+	// ResourceAttributes are added to the resources of all metrics,
+	// besides `service.name` and the `cluster` and `node` taken from the labels
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"`
+	TLSClientConfig    *TLSClientConfig  `yaml:"tls_config,omitempty"`
+	// MaxRetries of a failed export request, 3 by default
+	MaxRetries int `yaml:"max_retries,omitempty"`
+}
+
+// Tracing exports the spans of the scrapes, the collectors, the EMQX API requests and the probe phases
+// via OTLP over HTTP with protobuf
+type Tracing struct {
+	// Endpoint is the URL of the collector, like `http://otel-collector:4318`, whose path is `/v1/traces` by default
+	Endpoint string `yaml:"endpoint"`
+	// SamplingRatio of the traces started by the exporter, from 0 to 1, 1 by default.
+	// The traces of the requests with a `traceparent` header are sampled as their header tells
+	SamplingRatio *float64 `yaml:"sampling_ratio,omitempty"`
+	// Timeout of each export request, 10s by default
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+	// Headers are added to each export request, e.g. an API key
+	Headers map[string]Secret `yaml:"headers,omitempty"`
+	// ResourceAttributes are added to the resource of the spans, besides `service.name` and `service.version`
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"`
+	TLSClientConfig    *TLSClientConfig  `yaml:"tls_config,omitempty"`
+}
+
+// TracingFromEnv returns the tracing config of the OpenTelemetry environment variables
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_RESOURCE_ATTRIBUTES, OTEL_SERVICE_NAME and OTEL_TRACES_SAMPLER_ARG, or nil if no endpoint is set
+func TracingFromEnv(getenv func(string) string) (*Tracing, error) {
+	t := &Tracing{Endpoint: getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")}
+	if t.Endpoint == "" {
+		endpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			return nil, nil
+		}
+		// the generic endpoint is the base URL of all signals
+		t.Endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	for name, value := range parseEnvPairs(getenv("OTEL_EXPORTER_OTLP_HEADERS")) {
+		if t.Headers == nil {
+			t.Headers = make(map[string]Secret)
+		}
+		t.Headers[name] = Secret(value)
+	}
+	t.ResourceAttributes = parseEnvPairs(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		if t.ResourceAttributes == nil {
+			t.ResourceAttributes = make(map[string]string)
+		}
+		t.ResourceAttributes["service.name"] = name
+	}
+	if arg := getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG %q is not a number", arg)
+		}
+		t.SamplingRatio = &ratio
+	}
+	if err := t.complete("environment"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseEnvPairs parses the pairs like `key1=value1,key2=value2` of the OpenTelemetry environment variables
+func parseEnvPairs(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs[strings.TrimSpace(key)] = value
+	}
+	return pairs
+}
+
+// complete validates the tracing config at the field of the config file, and fills the defaults
+func (t *Tracing) complete(field string) (err error) {
+	u, err := url.Parse(t.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.endpoint %q is not a valid http(s) URL", field, t.Endpoint)
+	}
+	if t.SamplingRatio == nil {
+		ratio := 1.0
+		t.SamplingRatio = &ratio
+	}
+	if *t.SamplingRatio < 0 || *t.SamplingRatio > 1 {
+		return fmt.Errorf("%s.sampling_ratio %v is not between 0 and 1", field, *t.SamplingRatio)
+	}
+	if t.TLSClientConfig != nil {
+		if err = t.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
+		}
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = model.Duration(10 * time.Second)
+	}
+	return nil
+}
+
+// Pushgateway is a Prometheus Pushgateway, which keeps the metrics pushed by short-lived runs
+type Pushgateway struct {
+	URL string `yaml:"url"`
+	// Job is the job label of the pushed metrics, "emqx-exporter" by default
+	Job string `yaml:"job,omitempty"`
+	// GroupingLabels identify the pushed metrics besides the job, like `instance`,
+	// and replace the metrics pushed with the same ones before
+	GroupingLabels map[string]string `yaml:"grouping_labels,omitempty"`
+	// Timeout of the whole one-shot run, including reaching the clusters, collecting and pushing, 30s by default
+	Timeout         model.Duration   `yaml:"timeout,omitempty"`
+	BasicAuth       *BasicAuth       `yaml:"basic_auth,omitempty"`
+	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+}
+
+// StatsD pushes the metrics on an interval as DogStatsD datagrams
+type StatsD struct {
+	// Address is `host:port` over UDP, or `unix:///path/to/socket` over a Unix datagram socket
+	Address string `yaml:"address"`
+	// Interval of collecting and pushing the metrics, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Prefix is prepended to all metric names, like `emqx.`
+	Prefix string `yaml:"prefix,omitempty"`
+	// Tags are added to all metrics, like `env:prod`
+	Tags []string `yaml:"tags,omitempty"`
+	// MaxPacketSize of a datagram, 1432 bytes over UDP and 8192 bytes over a Unix socket by default
+	MaxPacketSize int `yaml:"max_packet_size,omitempty"`
+}
+
+// InfluxDB writes the metrics on an interval in the InfluxDB line protocol
+type InfluxDB struct {
+	// URL of the InfluxDB server, like `http://influxdb:8086`
+	URL string `yaml:"url"`
+	// Version of the write API, 1 writes to /write, 2 writes to /api/v2/write, 2 by default
+	Version int `yaml:"version,omitempty"`
+	// Database and RetentionPolicy to write to with version 1
+	Database        string `yaml:"database,omitempty"`
+	RetentionPolicy string `yaml:"retention_policy,omitempty"`
+	// BasicAuth authenticates with version 1
+	BasicAuth *BasicAuth `yaml:"basic_auth,omitempty"`
+	// Org and Bucket to write to with version 2
+	Org    string `yaml:"org,omitempty"`
+	Bucket string `yaml:"bucket,omitempty"`
+	// Token authenticates with version 2
+	Token Secret `yaml:"token,omitempty"`
+	// Interval of collecting and writing the metrics, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of each write request, 10s by default
+	Timeout         model.Duration   `yaml:"timeout,omitempty"`
+	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+	// MaxRetries of a failed write request, 3 by default
+	MaxRetries int `yaml:"max_retries,omitempty"`
+}
+
+// Graphite sends the metrics on an interval in the Graphite plaintext protocol over TCP
+type Graphite struct {
+	// Address is the `host:port` of the plaintext protocol, usually port 2003
+	Address string `yaml:"address"`
+	// Prefix is prepended to all metric paths, like `emqx.site1.`
+	Prefix string `yaml:"prefix,omitempty"`
+	// Tagged sends the labels as tags, supported since Graphite 1.1, instead of as components of the path
+	Tagged bool `yaml:"tagged,omitempty"`
+	// Interval of collecting and sending the metrics, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of connecting and sending, 10s by default
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+}
+
+// MQTTPublish publishes a JSON summary of the probe results and the cluster health on an interval,
+// so that MQTT-native systems and the rules of EMQX can react to it
+type MQTTPublish struct {
+	// Target is the `host:port` of the broker
+	Target string `yaml:"target"`
+	// Scheme is "tcp" by default, or "ssl" if tls_config is set
+	Scheme   string `yaml:"scheme,omitempty"`
+	ClientID string `yaml:"client_id,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password Secret `yaml:"password,omitempty"`
+	// Topic of the summary, "emqx-exporter/health" by default
+	Topic  string `yaml:"topic,omitempty"`
+	QoS    byte   `yaml:"qos,omitempty"`
+	Retain bool   `yaml:"retain,omitempty"`
+	// Interval of collecting and publishing the summary, 30s by default
+	Interval model.Duration `yaml:"interval,omitempty"`
+	// Timeout of connecting and publishing, 10s by default
+	Timeout         model.Duration   `yaml:"timeout,omitempty"`
+	TLSClientConfig *TLSClientConfig `yaml:"tls_config,omitempty"`
+}
+
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
 }
 
 type TLSClientConfig struct {
@@ -53,10 +553,28 @@ type TLSClientConfig struct {
 	CertData []byte `yaml:"cert_data,omitempty"`
 	// KeyData holds PEM-encoded bytes (typically read from a client certificate key file).
 	// KeyData takes precedence over KeyFile
-	KeyData []byte `yaml:"key_data,omitempty"`
+	KeyData Secret `yaml:"key_data,omitempty"`
 	// CAData holds PEM-encoded bytes (typically read from a root certificates bundle).
 	// CAData takes precedence over CAFile
 	CAData []byte `yaml:"ca_data,omitempty"`
+
+	// PinnedSHA256 holds base64-encoded SHA-256 digests of the server's SubjectPublicKeyInfo.
+	// If set, a certificate of the verified chain must match one of them, or the certificate of the server itself
+	// if InsecureSkipVerify is set
+	PinnedSHA256 []string `yaml:"pinned_sha256,omitempty"`
+
+	// SPIFFE presents the X.509 SVID fetched from the SPIFFE Workload API as the client certificate, instead of CertData
+	SPIFFE *SPIFFE `yaml:"spiffe,omitempty"`
+}
+
+// SPIFFE selects the X.509 SVID of the exporter fetched from the SPIFFE Workload API, like the one of the SPIRE agent,
+// which is kept up to date as it's rotated
+type SPIFFE struct {
+	// EndpointSocket is the address of the Workload API, like `unix:///run/spire/sockets/agent.sock`,
+	// $SPIFFE_ENDPOINT_SOCKET by default
+	EndpointSocket string `yaml:"endpoint_socket,omitempty"`
+	// ID selects the SVID of the SPIFFE ID, like `spiffe://example.org/emqx-exporter`, the first one by default
+	ID string `yaml:"id,omitempty"`
 }
 
 type SafeConfig struct {
@@ -82,7 +600,6 @@ func NewSafeConfig(reg prometheus.Registerer) *SafeConfig {
 }
 
 func (sc *SafeConfig) ReloadConfig(confFile string) (err error) {
-	var c = &Config{}
 	defer func() {
 		if err != nil {
 			sc.configReloadSuccess.Set(0)
@@ -92,98 +609,682 @@ func (sc *SafeConfig) ReloadConfig(confFile string) (err error) {
 		}
 	}()
 
+	c, err := LoadConfig(confFile)
+	if err != nil {
+		return err
+	}
+
+	sc.Lock()
+	sc.C = c
+	sc.Unlock()
+
+	return nil
+}
+
+// LoadConfig parses and validates the config file, and fills the defaults
+func LoadConfig(confFile string) (c *Config, err error) {
+	c = &Config{}
 	yamlReader, err := os.Open(confFile)
 	if err != nil {
-		return fmt.Errorf("error reading config file: %s", err)
+		return nil, fmt.Errorf("error reading config file: %s", err)
 	}
 	defer yamlReader.Close()
 	decoder := yaml.NewDecoder(yamlReader)
 	decoder.KnownFields(true)
 
 	if err = decoder.Decode(c); err != nil {
-		return fmt.Errorf("error parsing config file: %s", err)
+		return nil, fmt.Errorf("error parsing config file: %s", err)
 	}
 
 	if c.Metrics != nil {
-		if c.Metrics.APIKey == "" {
-			return fmt.Errorf("metrics.api_key is required")
+		if err = c.Metrics.complete("metrics"); err != nil {
+			return nil, err
 		}
-		if c.Metrics.APISecret == "" {
-			return fmt.Errorf("metrics.api_secret is required")
+	}
+
+	names := make(map[string]bool, len(c.Clusters))
+	for index := range c.Clusters {
+		cluster := &c.Clusters[index]
+		field := fmt.Sprintf("clusters[%d]", index)
+		if cluster.Name == "" {
+			return nil, fmt.Errorf("%s.name is required", field)
 		}
-		if c.Metrics.Target == "" {
-			return fmt.Errorf("metrics.target is required")
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("%s.name %q is duplicated", field, cluster.Name)
 		}
-		if c.Metrics.TLSClientConfig != nil {
-			if c.Metrics.Scheme == "" {
-				c.Metrics.Scheme = "https"
-			}
-			if c.Metrics.TLSClientConfig.CAData, err = dataFromSliceOrFile(c.Metrics.TLSClientConfig.CAData, c.Metrics.TLSClientConfig.CAFile); err != nil {
-				return fmt.Errorf("metrics.ssl_config.ca_data: %s", err)
-			}
-			if c.Metrics.TLSClientConfig.CertData, err = dataFromSliceOrFile(c.Metrics.TLSClientConfig.CertData, c.Metrics.TLSClientConfig.CertFile); err != nil {
-				return fmt.Errorf("metrics.ssl_config.cert_data: %s", err)
-			}
-			if c.Metrics.TLSClientConfig.KeyData, err = dataFromSliceOrFile(c.Metrics.TLSClientConfig.KeyData, c.Metrics.TLSClientConfig.KeyFile); err != nil {
-				return fmt.Errorf("metrics.ssl_config.key_data: %s", err)
-			}
+		names[cluster.Name] = true
+		if err = cluster.complete(field); err != nil {
+			return nil, err
+		}
+	}
+
+	// the probes are told apart by their targets, by the /probe requests and by the clients kept across the probes
+	targets := make(map[string]bool, len(c.Probes))
+	for index := range c.Probes {
+		field := fmt.Sprintf("probes[%d]", index)
+		if targets[c.Probes[index].Target] {
+			return nil, fmt.Errorf("%s.target %q is duplicated", field, c.Probes[index].Target)
+		}
+		targets[c.Probes[index].Target] = true
+		if c.ProbeDefaults != nil {
+			c.ProbeDefaults.apply(&c.Probes[index])
+		}
+		if err = c.Probes[index].complete(field, index); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.RemoteWrite != nil {
+		if err = c.RemoteWrite.complete("remote_write"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.OTLP != nil {
+		if err = c.OTLP.complete("otlp"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Tracing != nil {
+		if err = c.Tracing.complete("tracing"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Pushgateway != nil {
+		if err = c.Pushgateway.complete("pushgateway"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.StatsD != nil {
+		if err = c.StatsD.complete("statsd"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.InfluxDB != nil {
+		if err = c.InfluxDB.complete("influxdb"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Graphite != nil {
+		if err = c.Graphite.complete("graphite"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MQTTPublish != nil {
+		if err = c.MQTTPublish.complete("mqtt_publish"); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ProbeSchedule != nil {
+		if c.ProbeSchedule.Interval <= 0 {
+			c.ProbeSchedule.Interval = model.Duration(30 * time.Second)
+		}
+		if c.ProbeSchedule.Timeout <= 0 {
+			c.ProbeSchedule.Timeout = c.ProbeSchedule.Interval
+		}
+	}
+
+	return c, nil
+}
+
+// complete validates the MQTT publish config at the field of the config file, and fills the defaults
+func (m *MQTTPublish) complete(field string) (err error) {
+	if m.Target == "" {
+		return fmt.Errorf("%s.target is required", field)
+	}
+	if m.QoS > 2 {
+		return fmt.Errorf("%s.qos %d is not 0, 1 or 2", field, m.QoS)
+	}
+	if m.TLSClientConfig != nil {
+		if m.Scheme == "" {
+			m.Scheme = "ssl"
+		}
+		if err = m.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
+		}
+	}
+	if m.Scheme == "" {
+		m.Scheme = "tcp"
+	}
+	if m.ClientID == "" {
+		m.ClientID = "emqx_exporter_publisher"
+	}
+	if m.Topic == "" {
+		m.Topic = "emqx-exporter/health"
+	}
+	if m.Interval <= 0 {
+		m.Interval = model.Duration(30 * time.Second)
+	}
+	if m.Timeout <= 0 {
+		m.Timeout = model.Duration(10 * time.Second)
+	}
+	return nil
+}
+
+// complete validates the Graphite config at the field of the config file, and fills the defaults
+func (g *Graphite) complete(field string) error {
+	if _, _, err := net.SplitHostPort(g.Address); err != nil {
+		return fmt.Errorf("%s.address %q is not host:port: %s", field, g.Address, err)
+	}
+	if g.Interval <= 0 {
+		g.Interval = model.Duration(30 * time.Second)
+	}
+	if g.Timeout <= 0 {
+		g.Timeout = model.Duration(10 * time.Second)
+	}
+	return nil
+}
+
+// complete validates the InfluxDB config at the field of the config file, and fills the defaults
+func (i *InfluxDB) complete(field string) (err error) {
+	u, err := url.Parse(i.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.url %q is not a valid http(s) URL", field, i.URL)
+	}
+	switch i.Version {
+	case 0, 2:
+		i.Version = 2
+		if i.Org == "" || i.Bucket == "" {
+			return fmt.Errorf("%s: org and bucket are required by version 2", field)
+		}
+	case 1:
+		if i.Database == "" {
+			return fmt.Errorf("%s.database is required by version 1", field)
+		}
+	default:
+		return fmt.Errorf("%s.version %d is neither 1 nor 2", field, i.Version)
+	}
+	if i.TLSClientConfig != nil {
+		if err = i.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
+		}
+	}
+	if i.Interval <= 0 {
+		i.Interval = model.Duration(30 * time.Second)
+	}
+	if i.Timeout <= 0 {
+		i.Timeout = model.Duration(10 * time.Second)
+	}
+	if i.MaxRetries <= 0 {
+		i.MaxRetries = 3
+	}
+	return nil
+}
+
+// complete validates the StatsD config at the field of the config file, and fills the defaults
+func (s *StatsD) complete(field string) error {
+	if s.Address == "" {
+		return fmt.Errorf("%s.address is required", field)
+	}
+	if strings.HasPrefix(s.Address, "unix://") {
+		if s.MaxPacketSize <= 0 {
+			s.MaxPacketSize = 8192
+		}
+	} else {
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			return fmt.Errorf("%s.address %q is neither host:port nor unix:///path: %s", field, s.Address, err)
+		}
+		if s.MaxPacketSize <= 0 {
+			s.MaxPacketSize = 1432
+		}
+	}
+	if s.Interval <= 0 {
+		s.Interval = model.Duration(30 * time.Second)
+	}
+	return nil
+}
+
+// complete validates the pushgateway config at the field of the config file, and fills the defaults
+func (p *Pushgateway) complete(field string) (err error) {
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.url %q is not a valid http(s) URL", field, p.URL)
+	}
+	if p.Job == "" {
+		p.Job = "emqx-exporter"
+	}
+	if p.TLSClientConfig != nil {
+		if err = p.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
+		}
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = model.Duration(30 * time.Second)
+	}
+	return nil
+}
+
+// complete validates the OTLP config at the field of the config file, and fills the defaults
+func (o *OTLP) complete(field string) (err error) {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.endpoint %q is not a valid http(s) URL", field, o.Endpoint)
+	}
+	switch o.Protocol {
+	case "":
+		o.Protocol = "http/protobuf"
+	case "http/protobuf", "grpc":
+	default:
+		return fmt.Errorf("%s.protocol %q is neither http/protobuf nor grpc", field, o.Protocol)
+	}
+	if o.TLSClientConfig != nil {
+		if err = o.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
+		}
+	}
+	if o.Interval <= 0 {
+		o.Interval = model.Duration(30 * time.Second)
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = model.Duration(10 * time.Second)
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 3
+	}
+	return nil
+}
+
+// complete validates the remote write config at the field of the config file, and fills the defaults
+func (rw *RemoteWrite) complete(field string) (err error) {
+	u, err := url.Parse(rw.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.url %q is not a valid http(s) URL", field, rw.URL)
+	}
+	if rw.BasicAuth != nil && rw.BearerToken != "" {
+		return fmt.Errorf("%s: at most one of basic_auth and bearer_token may be set", field)
+	}
+	if rw.TLSClientConfig != nil {
+		if err = rw.TLSClientConfig.load(field + ".tls_config"); err != nil {
+			return err
 		}
-		if c.Metrics.Scheme == "" {
-			c.Metrics.Scheme = "http"
+	}
+	if rw.Interval <= 0 {
+		rw.Interval = model.Duration(30 * time.Second)
+	}
+	if rw.Timeout <= 0 {
+		rw.Timeout = model.Duration(10 * time.Second)
+	}
+	if rw.MaxRetries <= 0 {
+		rw.MaxRetries = 3
+	}
+	if rw.MaxPendingPushes <= 0 {
+		rw.MaxPendingPushes = 10
+	}
+	return nil
+}
+
+// Complete validates the metrics config and fills the defaults, like the config file does.
+// It's needed by the configs built in code rather than loaded, when the collectors are embedded into another program
+func (m *Metrics) Complete() error {
+	return m.complete("metrics")
+}
+
+// Complete validates the probe config and fills the defaults, like the config file does for the probe at index,
+// which tells the default client IDs and topics of the probes apart
+func (p *Probe) Complete(index int) error {
+	return p.complete(fmt.Sprintf("probes[%d]", index), index)
+}
+
+// complete validates the probe config at the field of the config file, and fills the defaults
+func (p *Probe) complete(field string, index int) error {
+	if p.Target == "" {
+		return fmt.Errorf("%s.target is required", field)
+	}
+	if p.TLSClientConfig != nil {
+		if p.Scheme == "" {
+			p.Scheme = "ssl"
 		}
+		if err := p.TLSClientConfig.load(field + ".ssl_config"); err != nil {
+			return err
+		}
+	}
+	if p.Scheme == "" {
+		p.Scheme = "tcp"
 	}
+	if p.AssignClientID && p.ClientID != "" {
+		return fmt.Errorf("%s: at most one of client_id and assign_client_id may be set", field)
+	}
+	if p.ExpectAssignedClientID && !p.AssignClientID {
+		return fmt.Errorf("%s.expect_assigned_client_id requires assign_client_id", field)
+	}
+	if p.ClientID == "" && !p.AssignClientID {
+		p.ClientID = "emqx_exporter_probe_" + fmt.Sprintf("%d", index)
+	}
+	if p.CleanStart == nil {
+		cleanStart := true
+		p.CleanStart = &cleanStart
+	}
+	if p.SessionExpiryInterval != 0 {
+		// a session is only resumed by the same client ID
+		if p.AssignClientID {
+			return fmt.Errorf("%s: at most one of assign_client_id and session_expiry_interval may be set", field)
+		}
+		if p.SessionExpiryInterval < model.Duration(time.Second) || time.Duration(p.SessionExpiryInterval)/time.Second > math.MaxUint32 {
+			return fmt.Errorf("%s.session_expiry_interval must be in [1s, %ds]", field, uint32(math.MaxUint32))
+		}
+	}
+	if p.Topic == "" {
+		p.Topic = "emqx-exporter-probe-" + fmt.Sprintf("%d", index)
+	}
+	if p.ReceiveMaximum > maxProbeReceiveMaximum {
+		return fmt.Errorf("%s.receive_maximum must be at most %d", field, maxProbeReceiveMaximum)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("%s.timeout must not be negative", field)
+	}
+	return nil
+}
+
+// maxProbeReceiveMaximum bounds the messages of the flow control check of a probe
+const maxProbeReceiveMaximum = 1000
 
-	for index, probe := range c.Probes {
-		if probe.Target == "" {
-			return fmt.Errorf("probes[%d].target is required", index)
+// complete validates the metrics config at the field of the config file, and fills the defaults
+func (m *Metrics) complete(field string) (err error) {
+	if m.APIKey == "" {
+		return fmt.Errorf("%s.api_key is required", field)
+	}
+	if m.APISecret == "" {
+		return fmt.Errorf("%s.api_secret is required", field)
+	}
+	if m.Target == "" {
+		return fmt.Errorf("%s.target is required", field)
+	}
+	if m.TLSClientConfig != nil {
+		if m.Scheme == "" {
+			m.Scheme = "https"
+		}
+		if err = m.TLSClientConfig.load(field + ".ssl_config"); err != nil {
+			return err
+		}
+	}
+	if m.Scheme == "" {
+		m.Scheme = "http"
+	}
+	if m.NodeName != nil && m.NodeName.Regex != "" {
+		if _, err = regexp.Compile(m.NodeName.Regex); err != nil {
+			return fmt.Errorf("%s.node_name.regex: %s", field, err)
 		}
-		if probe.TLSClientConfig != nil {
-			if probe.Scheme == "" {
-				probe.Scheme = "ssl"
+	}
+	if _, err = regexp.Compile(m.NodesInclude); err != nil {
+		return fmt.Errorf("%s.nodes_include: %s", field, err)
+	}
+	if _, err = regexp.Compile(m.NodesExclude); err != nil {
+		return fmt.Errorf("%s.nodes_exclude: %s", field, err)
+	}
+	if m.Parallelism < 0 {
+		return fmt.Errorf("%s.parallelism must not be negative", field)
+	}
+	if m.Parallelism == 0 {
+		m.Parallelism = 4
+	}
+	if m.SlowRefreshInterval < 0 {
+		return fmt.Errorf("%s.slow_refresh_interval must not be negative", field)
+	}
+	if m.PageSize < 0 || m.MaxConcurrentPages < 0 {
+		return fmt.Errorf("%s: page_size and max_concurrent_pages must not be negative", field)
+	}
+	if m.PageSize == 0 {
+		m.PageSize = 1000
+	}
+	if m.MaxConcurrentPages == 0 {
+		m.MaxConcurrentPages = 4
+	}
+	if m.CircuitBreaker != nil {
+		if m.CircuitBreaker.Failures < 0 || m.CircuitBreaker.OpenTimeout < 0 {
+			return fmt.Errorf("%s.circuit_breaker: failures and open_timeout must not be negative", field)
+		}
+		if m.CircuitBreaker.Failures == 0 {
+			m.CircuitBreaker.Failures = 5
+		}
+		if m.CircuitBreaker.OpenTimeout == 0 {
+			m.CircuitBreaker.OpenTimeout = model.Duration(30 * time.Second)
+		}
+	}
+	if m.Retry != nil {
+		if m.Retry.Attempts < 0 || m.Retry.BaseDelay < 0 || m.Retry.MaxDelay < 0 {
+			return fmt.Errorf("%s.retry: attempts, base_delay and max_delay must not be negative", field)
+		}
+		if m.Retry.Attempts == 0 {
+			m.Retry.Attempts = 2
+		}
+		if m.Retry.BaseDelay == 0 {
+			m.Retry.BaseDelay = model.Duration(100 * time.Millisecond)
+		}
+		if m.Retry.MaxDelay == 0 {
+			m.Retry.MaxDelay = model.Duration(2 * time.Second)
+		}
+		if m.Retry.MaxDelay < m.Retry.BaseDelay {
+			return fmt.Errorf("%s.retry.max_delay must not be less than base_delay", field)
+		}
+		if len(m.Retry.StatusCodes) == 0 {
+			m.Retry.StatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+		}
+	}
+	if m.Timeouts != nil {
+		if m.Timeouts.Request < 0 || m.Timeouts.Budget < 0 {
+			return fmt.Errorf("%s.timeouts: request and budget must not be negative", field)
+		}
+		if m.Timeouts.Request == 0 {
+			m.Timeouts.Request = model.Duration(5 * time.Second)
+		}
+		for endpoint, timeout := range m.Timeouts.Endpoints {
+			if !strings.HasPrefix(endpoint, "/api/") {
+				return fmt.Errorf("%s.timeouts.endpoints: %q isn't an endpoint of the EMQX API like /api/v5/clients", field, endpoint)
 			}
-			if probe.TLSClientConfig.CAData, err = dataFromSliceOrFile(probe.TLSClientConfig.CAData, probe.TLSClientConfig.CAFile); err != nil {
-				return fmt.Errorf("probes[%d].ssl_config.ca_data: %s", index, err)
+			if timeout <= 0 {
+				return fmt.Errorf("%s.timeouts.endpoints.%s: timeout must be positive", field, endpoint)
 			}
-			if probe.TLSClientConfig.CertData, err = dataFromSliceOrFile(probe.TLSClientConfig.CertData, probe.TLSClientConfig.CertFile); err != nil {
-				return fmt.Errorf("probes[%d].ssl_config.cert_data: %s", index, err)
+		}
+	}
+	if m.ConnectionPool != nil {
+		if m.ConnectionPool.MaxConns < 0 || m.ConnectionPool.IdleTimeout < 0 {
+			return fmt.Errorf("%s.connection_pool: max_conns and idle_timeout must not be negative", field)
+		}
+		if m.ConnectionPool.MaxConns > 0 && m.ConnectionPool.MaxConns < m.Parallelism {
+			return fmt.Errorf("%s.connection_pool.max_conns must be at least parallelism %d", field, m.Parallelism)
+		}
+	}
+	if m.Background != nil {
+		if m.Cache != nil {
+			return fmt.Errorf("%s: at most one of cache and background may be set", field)
+		}
+		if m.Background.Interval <= 0 {
+			m.Background.Interval = model.Duration(30 * time.Second)
+		}
+		for name, interval := range m.Background.Collectors {
+			if interval <= 0 {
+				return fmt.Errorf("%s.background.collectors.%s: interval must be positive", field, name)
 			}
-			if probe.TLSClientConfig.KeyData, err = dataFromSliceOrFile(probe.TLSClientConfig.KeyData, probe.TLSClientConfig.KeyFile); err != nil {
-				return fmt.Errorf("probes[%d].ssl_config.key_data: %s", index, err)
+		}
+	}
+	plugins := make(map[string]bool, len(m.Plugins))
+	for i := range m.Plugins {
+		plugin := &m.Plugins[i]
+		pluginField := fmt.Sprintf("%s.plugins[%d]", field, i)
+		if !pluginNameRE.MatchString(plugin.Name) {
+			return fmt.Errorf("%s.name %q must be made of letters, digits and underscores", pluginField, plugin.Name)
+		}
+		if plugins[plugin.Name] {
+			return fmt.Errorf("%s.name %q is duplicated", pluginField, plugin.Name)
+		}
+		plugins[plugin.Name] = true
+		if len(plugin.Command) == 0 || plugin.Command[0] == "" {
+			return fmt.Errorf("%s.command is required", pluginField)
+		}
+		if plugin.Timeout < 0 {
+			return fmt.Errorf("%s.timeout must not be negative", pluginField)
+		}
+		if plugin.Timeout == 0 {
+			plugin.Timeout = model.Duration(10 * time.Second)
+		}
+	}
+	if m.Aggregation != nil {
+		if m.Aggregation.Mode == "" {
+			m.Aggregation.Mode = AggregateNode
+		}
+		if !validAggregation(m.Aggregation.Mode) {
+			return fmt.Errorf("%s.aggregation.mode %q must be one of node, cluster and both", field, m.Aggregation.Mode)
+		}
+		for name, mode := range m.Aggregation.Collectors {
+			if !validAggregation(mode) {
+				return fmt.Errorf("%s.aggregation.collectors.%s %q must be one of node, cluster and both", field, name, mode)
 			}
 		}
-		if probe.Scheme == "" {
-			probe.Scheme = "tcp"
+	}
+	buckets := make(map[string]bool, len(m.ClientBuckets))
+	for i, b := range m.ClientBuckets {
+		bucketField := fmt.Sprintf("%s.client_buckets[%d]", field, i)
+		if b.Name == "" {
+			return fmt.Errorf("%s.name is required", bucketField)
+		}
+		if buckets[b.Name] {
+			return fmt.Errorf("%s.name %q is duplicated", bucketField, b.Name)
 		}
-		if probe.ClientID == "" {
-			probe.ClientID = "emqx_exporter_probe_" + fmt.Sprintf("%d", index)
+		buckets[b.Name] = true
+		if _, err = regexp.Compile(b.ClientID); err != nil {
+			return fmt.Errorf("%s.clientid: %s", bucketField, err)
 		}
-		if probe.Topic == "" {
-			probe.Topic = "emqx-exporter-probe-" + fmt.Sprintf("%d", index)
+	}
+	names := make(map[string]bool, len(m.Derived))
+	for i, d := range m.Derived {
+		derivedField := fmt.Sprintf("%s.derived[%d]", field, i)
+		if !model.IsValidMetricName(model.LabelValue(d.Name)) {
+			return fmt.Errorf("%s.name %q is not a valid metric name", derivedField, d.Name)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("%s.name %q is duplicated", derivedField, d.Name)
+		}
+		names[d.Name] = true
+		if d.Expr == "" {
+			return fmt.Errorf("%s.expr is required", derivedField)
+		}
+		if _, err = derived.Parse(d.Expr); err != nil {
+			return fmt.Errorf("%s.expr: %s", derivedField, err)
 		}
-		c.Probes[index] = probe
 	}
+	return nil
+}
 
-	sc.Lock()
-	sc.C = c
-	sc.Unlock()
+var pluginNameRE = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
 
-	return nil
+func validAggregation(mode string) bool {
+	return mode == AggregateNode || mode == AggregateCluster || mode == AggregateBoth
 }
 
 func (conf *TLSClientConfig) ToTLSConfig() *tls.Config {
 	if conf == nil {
 		return nil
 	}
-	certpool := x509.NewCertPool()
-	certpool.AppendCertsFromPEM(conf.CAData)
-	clientKeyPair, _ := tls.X509KeyPair(conf.CertData, conf.KeyData)
-	return &tls.Config{
+	// fall back to the system trust store only if no CA bundle is given
+	var certpool *x509.CertPool
+	if len(conf.CAData) > 0 {
+		certpool = x509.NewCertPool()
+		certpool.AppendCertsFromPEM(conf.CAData)
+	}
+	clientKeyPair, _ := tls.X509KeyPair(conf.CertData, []byte(conf.KeyData))
+	tlsConfig := &tls.Config{
 		InsecureSkipVerify: conf.InsecureSkipVerify,
 		RootCAs:            certpool,
 		Certificates:       []tls.Certificate{clientKeyPair},
 		ClientAuth:         tls.NoClientCert,
 		ClientCAs:          nil,
 	}
+	if conf.SPIFFE != nil {
+		// the endpoint is validated by load
+		if source, err := spiffe.SourceOf(conf.SPIFFE.EndpointSocket); err == nil {
+			tlsConfig.GetClientCertificate = source.ClientCertificate(conf.SPIFFE.ID)
+		}
+	}
+	if len(conf.PinnedSHA256) > 0 {
+		pins := conf.PinnedSHA256
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			return verifyPinnedSHA256(rawCerts, verifiedChains, pins)
+		}
+	}
+	return tlsConfig
+}
+
+// load reads the PEM files of the TLS config at the field of the config file, and validates it
+func (conf *TLSClientConfig) load(field string) (err error) {
+	if conf.CAData, err = dataFromSliceOrFile(conf.CAData, conf.CAFile); err != nil {
+		return fmt.Errorf("%s.ca_data: %s", field, err)
+	}
+	if conf.CertData, err = dataFromSliceOrFile(conf.CertData, conf.CertFile); err != nil {
+		return fmt.Errorf("%s.cert_data: %s", field, err)
+	}
+	keyData, err := dataFromSliceOrFile([]byte(conf.KeyData), conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("%s.key_data: %s", field, err)
+	}
+	conf.KeyData = Secret(keyData)
+	if conf.SPIFFE != nil {
+		if len(conf.CertData) > 0 || conf.KeyData != "" {
+			return fmt.Errorf("%s: at most one of spiffe and the client certificate may be set", field)
+		}
+		if conf.SPIFFE.EndpointSocket == "" {
+			conf.SPIFFE.EndpointSocket = os.Getenv(spiffe.EnvEndpointSocket)
+		}
+		if conf.SPIFFE.EndpointSocket == "" {
+			return fmt.Errorf("%s.spiffe.endpoint_socket is required, unless $%s is set", field, spiffe.EnvEndpointSocket)
+		}
+		if _, _, err = spiffe.ParseEndpoint(conf.SPIFFE.EndpointSocket); err != nil {
+			return fmt.Errorf("%s.spiffe.endpoint_socket: %s", field, err)
+		}
+	}
+	if err = conf.validate(); err != nil {
+		return fmt.Errorf("%s: %s", field, err)
+	}
+	return nil
+}
+
+func (conf *TLSClientConfig) validate() error {
+	if len(conf.CAData) > 0 && !x509.NewCertPool().AppendCertsFromPEM(conf.CAData) {
+		return fmt.Errorf("ca_data: no valid PEM certificate found")
+	}
+	for _, pin := range conf.PinnedSHA256 {
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil {
+			return fmt.Errorf("pinned_sha256: %q is not base64 encoded: %s", pin, err)
+		}
+		if len(digest) != sha256.Size {
+			return fmt.Errorf("pinned_sha256: %q is not a SHA-256 digest", pin)
+		}
+	}
+	return nil
+}
+
+// verifyPinnedSHA256 succeeds if a certificate of the verified chains has a public key matching one of the pins.
+// Without verified chains, as with InsecureSkipVerify, only the certificate of the server itself is matched, since
+// the other certificates presented may be anyone's
+func verifyPinnedSHA256(rawCerts [][]byte, verifiedChains [][]*x509.Certificate, pins []string) error {
+	var certs []*x509.Certificate
+	for _, chain := range verifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	for _, cert := range certs {
+		digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		encoded := base64.StdEncoding.EncodeToString(digest[:])
+		for _, pin := range pins {
+			if pin == encoded {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no certificate of the server matches the pinned public keys")
 }
 
 // dataFromSliceOrFile returns data from the slice (if non-empty), or from the file,
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestVerifyPinnedSHA256(t *testing.T) {
+	data, err := os.ReadFile("example/certs/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(digest[:])
+
+	if err := verifyPinnedSHA256([][]byte{block.Bytes}, nil, []string{pin}); err != nil {
+		t.Errorf("Expected pin %s to match, got %s", pin, err)
+	}
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if err := verifyPinnedSHA256([][]byte{block.Bytes}, nil, []string{other}); err == nil {
+		t.Errorf("Expected pin %s not to match", other)
+	}
+
+	conf := &TLSClientConfig{PinnedSHA256: []string{"not-base64"}}
+	if err := conf.validate(); err == nil {
+		t.Errorf("Expected invalid pin to be rejected")
+	}
+}
+
+// newTestCert returns a certificate of a new key for localhost, signed by parent, or self-signed without parent
+func newTestCert(t *testing.T, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, key.Public(), signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func pinOf(cert tls.Certificate) string {
+	digest := sha256.Sum256(cert.Leaf.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func TestPinnedSHA256Handshake(t *testing.T) {
+	ca := newTestCert(t, nil)
+	leaf := newTestCert(t, &ca)
+	pinned := newTestCert(t, nil)
+	// the server presents the pinned certificate after its own, which doesn't match
+	served := tls.Certificate{Certificate: [][]byte{leaf.Certificate[0], pinned.Certificate[0]}, PrivateKey: leaf.PrivateKey}
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]})
+
+	handshake := func(conf *TLSClientConfig) error {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			defer server.Close()
+			tls.Server(server, &tls.Config{Certificates: []tls.Certificate{served}}).Handshake()
+		}()
+		tlsConfig := conf.ToTLSConfig()
+		tlsConfig.ServerName = "localhost"
+		return tls.Client(client, tlsConfig).Handshake()
+	}
+
+	for _, test := range []struct {
+		name string
+		conf *TLSClientConfig
+		ok   bool
+	}{
+		{"appended pin", &TLSClientConfig{CAData: caData, PinnedSHA256: []string{pinOf(pinned)}}, false},
+		{"appended pin without verification", &TLSClientConfig{InsecureSkipVerify: true, PinnedSHA256: []string{pinOf(pinned)}}, false},
+		{"server pin", &TLSClientConfig{CAData: caData, PinnedSHA256: []string{pinOf(leaf)}}, true},
+		{"server pin without verification", &TLSClientConfig{InsecureSkipVerify: true, PinnedSHA256: []string{pinOf(leaf)}}, true},
+		{"CA pin", &TLSClientConfig{CAData: caData, PinnedSHA256: []string{pinOf(ca)}}, true},
+		{"CA pin without verification", &TLSClientConfig{InsecureSkipVerify: true, PinnedSHA256: []string{pinOf(ca)}}, false},
+	} {
+		if err := handshake(test.conf); (err == nil) != test.ok {
+			t.Errorf("%s: expected the handshake to succeed %t, got %v", test.name, test.ok, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := &Config{
+		Metrics:     &Metrics{APIKey: "key", APISecret: "secret", Target: "127.0.0.1:18083", Plugins: []Plugin{{Name: "kpi", Command: []string{"kpi"}, Env: map[string]Secret{"DB_PASSWORD": "password"}}}},
+		Probes:      []Probe{{Target: "127.0.0.1:1883", Password: "password"}, {Target: "127.0.0.1:1884"}},
+		RemoteWrite: &RemoteWrite{URL: "http://mimir/api/v1/push", BasicAuth: &BasicAuth{Username: "user", Password: "password"}, Headers: map[string]Secret{"X-Scope-OrgID": "tenant"}},
+		InfluxDB:    &InfluxDB{URL: "http://influxdb:8086", Token: "token", TLSClientConfig: &TLSClientConfig{KeyData: "key"}},
+	}
+	r, err := c.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Metrics.APIKey != "key" || r.Metrics.APISecret != secretMask || r.Metrics.Plugins[0].Env["DB_PASSWORD"] != secretMask {
+		t.Errorf("Expected the API secret and the plugin environment only to be masked, got %+v", r.Metrics)
+	}
+	if r.Probes[0].Password != secretMask || r.Probes[1].Password != "" {
+		t.Errorf("Expected the set passwords only to be masked, got %+v", r.Probes)
+	}
+	if r.RemoteWrite.BasicAuth.Username != "user" || r.RemoteWrite.BasicAuth.Password != secretMask || r.RemoteWrite.Headers["X-Scope-OrgID"] != secretMask {
+		t.Errorf("Expected the password and headers to be masked, got %+v", r.RemoteWrite)
+	}
+	if r.InfluxDB.Token != secretMask || string(r.InfluxDB.TLSClientConfig.KeyData) != secretMask {
+		t.Errorf("Expected the token and TLS key to be masked, got %+v", r.InfluxDB)
+	}
+	if c.Metrics.APISecret != "secret" || c.RemoteWrite.Headers["X-Scope-OrgID"] != "tenant" || string(c.InfluxDB.TLSClientConfig.KeyData) != "key" {
+		t.Error("Expected the original config to be unchanged")
+	}
+}
+
+func TestTracingFromEnv(t *testing.T) {
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://otel-collector:4318/",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "Authorization=Bearer%20token, X-Scope-OrgID = tenant",
+		"OTEL_RESOURCE_ATTRIBUTES":    "deployment.environment=prod",
+		"OTEL_SERVICE_NAME":           "emqx-exporter-eu",
+		"OTEL_TRACES_SAMPLER_ARG":     "0.25",
+	}
+	c, err := TracingFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Endpoint != "http://otel-collector:4318/v1/traces" || *c.SamplingRatio != 0.25 {
+		t.Errorf("Expected the traces endpoint and sampling ratio of the environment, got %+v", c)
+	}
+	if c.Headers["Authorization"] != "Bearer token" || c.Headers["X-Scope-OrgID"] != "tenant" {
+		t.Errorf("Expected the unescaped headers, got %v", c.Headers)
+	}
+	if c.ResourceAttributes["service.name"] != "emqx-exporter-eu" || c.ResourceAttributes["deployment.environment"] != "prod" {
+		t.Errorf("Expected the resource attributes and service name, got %v", c.ResourceAttributes)
+	}
+
+	env["OTEL_TRACES_SAMPLER_ARG"] = "2"
+	if _, err = TracingFromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Error("Expected an error for a sampling ratio above 1")
+	}
+
+	if c, err = TracingFromEnv(func(string) string { return "" }); c != nil || err != nil {
+		t.Errorf("Expected no tracing without an endpoint, got %+v, %v", c, err)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	m := &Metrics{APIKey: "key", APISecret: "secret", TLSClientConfig: &TLSClientConfig{KeyData: "pem"}}
+	y, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		fmt.Sprintf("%v %+v %s %q %#v", m.APISecret, *m, m.APISecret, m.APISecret, *m),
+		fmt.Errorf("connecting with %v: %w", *m.TLSClientConfig, os.ErrDeadlineExceeded).Error(),
+		string(y),
+		// JSON escapes the brackets of the mask
+		strings.NewReplacer(`\u003c`, "<", `\u003e`, ">").Replace(string(j)),
+	} {
+		if strings.Contains(s, "secret\"") || strings.Contains(s, " secret") || strings.Contains(s, "pem") || !strings.Contains(s, secretMask) {
+			t.Errorf("Expected the secrets to be masked in %s", s)
+		}
+	}
+	if Secret("").String() != "" {
+		t.Error("Expected an empty secret to stay empty")
+	}
+
+	MarshalSecretValue = true
+	defer func() { MarshalSecretValue = false }()
+	if y, _ = yaml.Marshal(m); !strings.Contains(string(y), "api_secret: secret") {
+		t.Errorf("Expected the secret to be marshalled with MarshalSecretValue, got %s", y)
+	}
+}
+
+func TestProbeDefaults(t *testing.T) {
+	file := t.TempDir() + "/config.yaml"
+	err := os.WriteFile(file, []byte(`
+probe_defaults:
+  scheme: ssl
+  username: probe
+  password: secret
+  tls_config:
+    insecure_skip_verify: true
+  timeout: 5s
+probes:
+  - target: emqx-0:8883
+  - target: emqx-1:1883
+    scheme: tcp
+    username: other
+    timeout: 2s
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inherited := c.Probes[0]
+	if inherited.Scheme != "ssl" || inherited.Username != "probe" || inherited.Password != "secret" ||
+		inherited.TLSClientConfig == nil || !inherited.TLSClientConfig.InsecureSkipVerify || inherited.Timeout != model.Duration(5*time.Second) {
+		t.Errorf("Expected the probe to inherit the defaults, got %+v", inherited)
+	}
+	overridden := c.Probes[1]
+	if overridden.Scheme != "tcp" || overridden.Username != "other" || overridden.Password != "secret" || overridden.Timeout != model.Duration(2*time.Second) {
+		t.Errorf("Expected the probe to override the defaults it sets, got %+v", overridden)
+	}
+	if inherited.TLSClientConfig == overridden.TLSClientConfig || inherited.TLSClientConfig == c.ProbeDefaults.TLSClientConfig {
+		t.Error("Expected each probe to have its own copy of the TLS config")
+	}
+
+	r, err := c.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ProbeDefaults.Password != secretMask {
+		t.Errorf("Expected the password of the defaults to be masked, got %q", r.ProbeDefaults.Password)
+	}
+}
+
+func TestSPIFFE(t *testing.T) {
+	t.Setenv("SPIFFE_ENDPOINT_SOCKET", "unix:///run/spire/sockets/agent.sock")
+	conf := &TLSClientConfig{SPIFFE: &SPIFFE{}}
+	if err := conf.load("tls_config"); err != nil {
+		t.Fatal(err)
+	}
+	if conf.SPIFFE.EndpointSocket != "unix:///run/spire/sockets/agent.sock" {
+		t.Errorf("Expected the endpoint socket of the environment, got %q", conf.SPIFFE.EndpointSocket)
+	}
+	if tlsConfig := conf.ToTLSConfig(); tlsConfig.GetClientCertificate == nil {
+		t.Error("Expected the client certificate to be fetched from the Workload API")
+	}
+
+	for _, conf := range []*TLSClientConfig{
+		{SPIFFE: &SPIFFE{EndpointSocket: "/run/spire/sockets/agent.sock"}},
+		{SPIFFE: &SPIFFE{}, CertData: []byte("pem"), KeyData: "pem"},
+	} {
+		if err := conf.load("tls_config"); err == nil {
+			t.Errorf("Expected %+v to be invalid", *conf)
+		}
+	}
+}
+
+func TestBackgroundDefaults(t *testing.T) {
+	file := t.TempDir() + "/config.yaml"
+	err := os.WriteFile(file, []byte(`
+metrics:
+  target: emqx:18083
+  api_key: key
+  api_secret: secret
+  background: {}
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := c.Metrics.Background; b.Interval != model.Duration(30*time.Second) || b.Timestamps {
+		t.Errorf("Expected the metrics collected every 30s without timestamps by default, got %+v", b)
+	}
+}
+
+func TestDuplicatedProbeTargets(t *testing.T) {
+	file := t.TempDir() + "/config.yaml"
+	err := os.WriteFile(file, []byte(`
+probes:
+  - name: qos0
+    target: emqx-0:1883
+  - name: qos1
+    target: emqx-0:1883
+    qos: 1
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadConfig(file); err == nil || err.Error() != `probes[1].target "emqx-0:1883" is duplicated` {
+		t.Errorf("Expected the probes of the same target to be rejected, got %v", err)
+	}
+}
+
+func TestDerivedExpr(t *testing.T) {
+	for expr, msg := range map[string]string{
+		"sum by (rule) (emqx_rule_exec_failure_count) / 1e-6": "",
+		"emqx_rule_exec_failure_count %":                      `metrics.derived[0].expr: unexpected "%"`,
+	} {
+		m := &Metrics{Target: "emqx:18083", APIKey: "key", APISecret: "secret", Derived: []Derived{{Name: "emqx_test", Expr: expr}}}
+		if err := m.Complete(); msg == "" && err != nil || msg != "" && (err == nil || err.Error() != msg) {
+			t.Errorf("Expected %q completing %q, got %v", msg, expr, err)
+		}
+	}
+}
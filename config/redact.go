@@ -0,0 +1,108 @@
+package config
+
+import (
+	yaml "gopkg.in/yaml.v3"
+)
+
+// secretMask replaces the secrets in the redacted config
+const secretMask = "<secret>"
+
+// Redacted returns a deep copy of the config with the secrets masked, like the API secrets, the passwords,
+// the tokens, the values of the extra headers and of the plugin environments, and the TLS client keys, even if MarshalSecretValue is set
+func (c *Config) Redacted() (*Config, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	r := &Config{}
+	if err = yaml.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+
+	if r.Metrics != nil {
+		r.Metrics.redact()
+	}
+	for i := range r.Clusters {
+		r.Clusters[i].redact()
+	}
+	for i := range r.Probes {
+		maskSecret(&r.Probes[i].Password)
+		r.Probes[i].TLSClientConfig.redact()
+	}
+	if d := r.ProbeDefaults; d != nil {
+		maskSecret(&d.Password)
+		d.TLSClientConfig.redact()
+	}
+	if rw := r.RemoteWrite; rw != nil {
+		rw.BasicAuth.redact()
+		maskSecret(&rw.BearerToken)
+		maskValues(rw.Headers)
+		rw.TLSClientConfig.redact()
+	}
+	if o := r.OTLP; o != nil {
+		maskValues(o.Headers)
+		o.TLSClientConfig.redact()
+	}
+	if t := r.Tracing; t != nil {
+		maskValues(t.Headers)
+		t.TLSClientConfig.redact()
+	}
+	if p := r.Pushgateway; p != nil {
+		p.BasicAuth.redact()
+		p.TLSClientConfig.redact()
+	}
+	if i := r.InfluxDB; i != nil {
+		i.BasicAuth.redact()
+		maskSecret(&i.Token)
+		i.TLSClientConfig.redact()
+	}
+	if m := r.MQTTPublish; m != nil {
+		maskSecret(&m.Password)
+		m.TLSClientConfig.redact()
+	}
+	return r, nil
+}
+
+func (m *Metrics) redact() {
+	maskSecret(&m.APISecret)
+	m.TLSClientConfig.redact()
+	for i := range m.Plugins {
+		maskValues(m.Plugins[i].Env)
+	}
+}
+
+func (b *BasicAuth) redact() {
+	if b != nil {
+		maskSecret(&b.Password)
+	}
+}
+
+// redact masks the key, and drops the PEM data loaded from the files, which are given by the file names instead
+func (conf *TLSClientConfig) redact() {
+	if conf == nil {
+		return
+	}
+	if conf.CAFile != "" {
+		conf.CAData = nil
+	}
+	if conf.CertFile != "" {
+		conf.CertData = nil
+	}
+	if conf.KeyFile != "" {
+		conf.KeyData = ""
+	} else {
+		maskSecret(&conf.KeyData)
+	}
+}
+
+func maskSecret(s *Secret) {
+	if *s != "" {
+		*s = secretMask
+	}
+}
+
+func maskValues(m map[string]Secret) {
+	for k := range m {
+		m[k] = secretMask
+	}
+}
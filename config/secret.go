@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// MarshalSecretValue makes the secrets marshalled to YAML and JSON as they are rather than masked,
+// e.g. to write a config file which is read back
+var MarshalSecretValue = false
+
+// Secret is a credential of the config, like an API secret, a password, a token or a key.
+// It's masked wherever it's formatted, like in the log lines, the errors, the panics and the config dumps,
+// so only converting it to a string reveals it
+type Secret string
+
+// String masks the secret for the %v, %s and %q verbs and the loggers
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return secretMask
+}
+
+// GoString masks the secret for the %#v verb
+func (s Secret) GoString() string {
+	return "config.Secret(" + strconv.Quote(s.String()) + ")"
+}
+
+// MarshalYAML masks the secret unless MarshalSecretValue is set
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if MarshalSecretValue {
+		return string(s), nil
+	}
+	return s.String(), nil
+}
+
+// MarshalJSON masks the secret unless MarshalSecretValue is set, for the JSON loggers too
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if MarshalSecretValue {
+		return json.Marshal(string(s))
+	}
+	return json.Marshal(s.String())
+}
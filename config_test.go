@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConfigHandler(t *testing.T) {
+	sc := config.NewSafeConfig(prometheus.NewRegistry())
+	sc.C = &config.Config{Metrics: &config.Metrics{Target: "127.0.0.1:18083", APIKey: "some_api_key", APISecret: "some_api_secret"}}
+	w := httptest.NewRecorder()
+	configHandler(sc, log.NewNopLogger()).ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "some_api_secret") || !strings.Contains(body, "<secret>") {
+		t.Errorf("Expected the API secret to be masked, got:\n%s", body)
+	}
+	if !strings.Contains(body, "127.0.0.1:18083") {
+		t.Errorf("Expected the target, got:\n%s", body)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/prober"
+	"github.com/go-kit/log"
+)
+
+type doctorOptions struct {
+	config       string
+	timeout      time.Duration
+	maxClockSkew time.Duration
+}
+
+// addDoctorCommand adds the `doctor` command, which diagnoses the connectivity to the clusters and probe targets
+func addDoctorCommand(app *kingpin.Application) (*kingpin.CmdClause, *doctorOptions) {
+	opts := &doctorOptions{}
+	cmd := app.Command("doctor", "Check the DNS, TCP and TLS connectivity, the credentials, the API version and the clock skew of the clusters and probe targets of the config file, and print a report.")
+	cmd.Flag("config", "EMQX exporter configuration file, --config.file by default.").StringVar(&opts.config)
+	cmd.Flag("timeout", "Timeout of each check.").Default("10s").DurationVar(&opts.timeout)
+	cmd.Flag("max-clock-skew", "Clock skew with the EMQX API to warn at.").Default("5s").DurationVar(&opts.maxClockSkew)
+	return cmd, opts
+}
+
+// doctorReport writes the results of the checks, and remembers whether any failed
+type doctorReport struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *doctorReport) section(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, format+"\n", args...)
+}
+
+func (r *doctorReport) ok(check, format string, args ...interface{}) {
+	r.result("OK", check, format, args...)
+}
+
+func (r *doctorReport) warn(check, format string, args ...interface{}) {
+	r.result("WARN", check, format, args...)
+}
+
+func (r *doctorReport) skip(check, format string, args ...interface{}) {
+	r.result("SKIP", check, format, args...)
+}
+
+func (r *doctorReport) fail(check, format string, args ...interface{}) {
+	r.failed = true
+	r.result("FAIL", check, format, args...)
+}
+
+func (r *doctorReport) result(status, check, format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "  %-6s %-12s %s\n", "["+status+"]", check, fmt.Sprintf(format, args...))
+}
+
+// runDoctor checks the clusters and probe targets of the config, and returns 1 if any check failed
+func runDoctor(opts *doctorOptions, w io.Writer, logger log.Logger) int {
+	r := &doctorReport{w: w}
+	c, err := config.LoadConfig(opts.config)
+	if err != nil {
+		r.section("config %s", opts.config)
+		r.fail("config", "%s", err)
+		return 1
+	}
+
+	clusters := make(map[string]*config.Metrics, len(c.Clusters)+1)
+	if c.Metrics != nil {
+		clusters[""] = c.Metrics
+	}
+	for i := range c.Clusters {
+		clusters[c.Clusters[i].Name] = &c.Clusters[i]
+	}
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := clusters[name]
+		if name == "" {
+			r.section("metrics, EMQX API %s://%s", m.Scheme, m.Target)
+		} else {
+			r.section("cluster %q, EMQX API %s://%s", name, m.Scheme, m.Target)
+		}
+		if !doctorConnect(r, opts, m.Target, "18083", m.Scheme == "https", m.TLSClientConfig) {
+			continue
+		}
+		doctorAPI(r, opts, m)
+	}
+
+	for _, probe := range c.Probes {
+		r.section("probe %s://%s", probe.Scheme, probe.Target)
+		secure := probe.Scheme == "ssl" || probe.Scheme == "tls" || probe.Scheme == "mqtts" || probe.Scheme == "wss"
+		if !doctorConnect(r, opts, probe.Target, "1883", secure, probe.TLSClientConfig) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		start := time.Now()
+		if prober.ProbeMQTT(ctx, probe, logger) {
+			r.ok("mqtt", "connected, subscribed and received the message published to %s in %s", probe.Topic, time.Since(start).Round(time.Millisecond))
+		} else {
+			r.fail("mqtt", "the probe failed, check the credentials, the client ID and the ACL of the topic %s, or --log.level=debug", probe.Topic)
+		}
+		cancel()
+	}
+
+	if len(names) == 0 && len(c.Probes) == 0 {
+		r.section("config %s", opts.config)
+		r.warn("config", "no metrics, clusters or probes to check")
+	}
+	if r.failed {
+		return 1
+	}
+	return 0
+}
+
+// doctorConnect checks the DNS resolution and the TCP connection to target, and the TLS handshake if secure,
+// and returns whether they succeeded
+func doctorConnect(r *doctorReport, opts *doctorOptions, target, defaultPort string, secure bool, tlsConfig *config.TLSClientConfig) bool {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+		target = net.JoinHostPort(host, defaultPort)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	if net.ParseIP(host) != nil {
+		r.skip("dns", "%s is an IP address", host)
+	} else if addrs, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		r.fail("dns", "%s", err)
+		return false
+	} else {
+		r.ok("dns", "%s resolves to %v", host, addrs)
+	}
+
+	start := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	if err != nil {
+		r.fail("tcp", "%s, check the address, the port and the firewalls", err)
+		return false
+	}
+	r.ok("tcp", "connected to %s in %s", conn.RemoteAddr(), time.Since(start).Round(time.Millisecond))
+	defer conn.Close()
+
+	if !secure {
+		r.skip("tls", "plain text")
+		return true
+	}
+	conf := tlsConfig.ToTLSConfig()
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+	conf.ServerName = host
+	tlsConn := tls.Client(conn, conf)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		r.fail("tls", "%s, check tls_config", err)
+		return false
+	}
+	cert := tlsConn.ConnectionState().PeerCertificates[0]
+	remaining := time.Until(cert.NotAfter)
+	if conf.InsecureSkipVerify {
+		r.warn("tls", "the certificate of %s isn't verified, as insecure_skip_verify is set", cert.Subject.CommonName)
+	} else if remaining < 14*24*time.Hour {
+		r.warn("tls", "the certificate of %s expires in %.1f days", cert.Subject.CommonName, remaining.Hours()/24)
+	} else {
+		r.ok("tls", "the certificate of %s is trusted, and expires on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly))
+	}
+	return true
+}
+
+// doctorAPI checks the credentials and the version of the EMQX API of m, and the clock skew with it
+func doctorAPI(r *doctorReport, opts *doctorOptions, m *config.Metrics) {
+	client := &http.Client{Timeout: opts.timeout}
+	if m.TLSClientConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: m.TLSClientConfig.ToTLSConfig()}
+	}
+	// the API of EMQX 5 is tried first, the one of 4.x answers 404 to it
+	for _, api := range []string{"v5", "v4"} {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s/api/%s/nodes", m.Scheme, m.Target, api), nil)
+		if err != nil {
+			r.fail("api", "%s", err)
+			return
+		}
+		req.SetBasicAuth(m.APIKey, string(m.APISecret))
+		sent := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			r.fail("api", "%s", err)
+			return
+		}
+		received := time.Now()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound && api == "v5":
+			continue
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			r.fail("credentials", "%s, check api_key and api_secret, and that the API key is enabled", resp.Status)
+			return
+		case resp.StatusCode != http.StatusOK:
+			r.fail("api", "GET %s: %s", req.URL.Path, resp.Status)
+			return
+		}
+		r.ok("credentials", "accepted")
+		if version := nodeVersion(api, body); version != "" {
+			r.ok("api", "%s API of EMQX %s", api, version)
+		} else {
+			r.warn("api", "%s API, but no node version in the response of %s", api, req.URL.Path)
+		}
+		doctorClockSkew(r, opts, resp.Header.Get("Date"), sent, received)
+		return
+	}
+	r.fail("api", "neither the API of EMQX 5 nor of 4.x is served, check the target is the dashboard port, 18083 by default")
+}
+
+// nodeVersion returns the EMQX version of the first node in the response of /api/{v4,v5}/nodes
+func nodeVersion(api string, body []byte) string {
+	type node struct {
+		Version string `json:"version"`
+	}
+	var nodes []node
+	if api == "v4" {
+		resp := struct {
+			Data []node `json:"data"`
+		}{}
+		if json.Unmarshal(body, &resp) != nil {
+			return ""
+		}
+		nodes = resp.Data
+	} else if json.Unmarshal(body, &nodes) != nil {
+		return ""
+	}
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0].Version
+}
+
+// doctorClockSkew checks the Date of a response received between sent and received against the local clock
+func doctorClockSkew(r *doctorReport, opts *doctorOptions, date string, sent, received time.Time) {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		r.skip("clock", "no Date header in the response")
+		return
+	}
+	// the Date is truncated to the second, so the skew is only told beyond a second and the round trip
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := serverTime.Sub(local.Truncate(time.Second))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > opts.maxClockSkew {
+		r.warn("clock", "the clock of the EMQX node is %s off, the timestamps of the metrics and the license expiry may be wrong", skew.Round(time.Second))
+		return
+	}
+	r.ok("clock", "within %s of the EMQX node", opts.maxClockSkew)
+}
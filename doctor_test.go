@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestRunDoctor(t *testing.T) {
+	v5 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "key" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v5/nodes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"node":"emqx@127.0.0.1","version":"5.3.0"}]`))
+	}))
+	defer v5.Close()
+	v4 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/nodes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// a clock an hour ahead
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`{"code":0,"data":[{"node":"emqx@127.0.0.1","version":"4.4.19"}]}`))
+	}))
+	defer v4.Close()
+
+	testcases := []struct {
+		config   string
+		expected []string
+		code     int
+	}{
+		{
+			config:   "metrics:\n  target: " + v5.Listener.Addr().String() + "\n  api_key: key\n  api_secret: secret\n",
+			expected: []string{"[SKIP] dns", "[OK]   tcp", "[SKIP] tls", "[OK]   credentials", "[OK]   api          v5 API of EMQX 5.3.0", "[OK]   clock"},
+		},
+		{
+			config:   "metrics:\n  target: " + v5.Listener.Addr().String() + "\n  api_key: key\n  api_secret: wrong\n",
+			expected: []string{"[FAIL] credentials  401 Unauthorized"},
+			code:     1,
+		},
+		{
+			config:   "clusters:\n  - name: legacy\n    target: " + v4.Listener.Addr().String() + "\n    api_key: key\n    api_secret: secret\n",
+			expected: []string{"cluster \"legacy\"", "[OK]   api          v4 API of EMQX 4.4.19", "[WARN] clock        the clock of the EMQX node is 1h0m0s off"},
+		},
+	}
+
+	for _, tc := range testcases {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configFile, []byte(tc.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		code := runDoctor(&doctorOptions{config: configFile, timeout: 5 * time.Second, maxClockSkew: 5 * time.Second}, &out, log.NewNopLogger())
+		if code != tc.code {
+			t.Errorf("Expected exit code %d, got %d: %s", tc.code, code, out.String())
+		}
+		for _, line := range tc.expected {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("Expected %q in the report, got %s", line, out.String())
+			}
+		}
+	}
+}
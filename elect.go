@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/leader"
+	"github.com/go-kit/log"
+)
+
+// newElector returns the elector of the Kubernetes Lease or the lock file given, nil if neither is
+func newElector(lease, lockFile, identity string, leaseDuration time.Duration, logger log.Logger) (*leader.Elector, error) {
+	if lease != "" && lockFile != "" {
+		return nil, errors.New("at most one of --leader-election.lease and --leader-election.lock-file may be set")
+	}
+	if leaseDuration <= 0 {
+		return nil, errors.New("--leader-election.lease-duration must be positive")
+	}
+
+	var lock leader.Lock
+	switch {
+	case lease != "":
+		if identity == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("no --leader-election.identity given, and get hostname failed. %w", err)
+			}
+			identity = hostname
+		}
+		namespace, name, ok := strings.Cut(lease, "/")
+		if !ok {
+			namespace, name = "", lease
+		}
+		leaseLock, err := leader.NewLeaseLock(namespace, name, identity, leaseDuration)
+		if err != nil {
+			return nil, err
+		}
+		lock = leaseLock
+	case lockFile != "":
+		fileLock, err := leader.NewFileLock(lockFile)
+		if err != nil {
+			return nil, err
+		}
+		lock = fileLock
+	default:
+		return nil, nil
+	}
+	return leader.NewElector(lock, leaseDuration/3, log.With(logger, "component", "leader")), nil
+}
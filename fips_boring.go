@@ -0,0 +1,6 @@
+//go:build boringcrypto
+
+package main
+
+// restrict the TLS of the probes, the EMQX API and the endpoints to the FIPS approved settings
+import _ "crypto/tls/fipsonly"
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// rulesOptions are the thresholds of the rules generated by `generate rules`
+type rulesOptions struct {
+	output               string
+	downFor              time.Duration
+	licenseUsage         float64
+	licenseRemainingDays float64
+	bridgeFor            time.Duration
+	probeFor             time.Duration
+	probeDuration        time.Duration
+	certRemainingDays    float64
+}
+
+// addGenerateCommands adds the `generate` commands, `generate rules` for now
+func addGenerateCommands(app *kingpin.Application) (*kingpin.CmdClause, *rulesOptions) {
+	opts := &rulesOptions{}
+	generate := app.Command("generate", "Generate files for the tools around the exporter.")
+	cmd := generate.Command("rules", "Generate the Prometheus alerting and recording rules of the metrics of the exporter.")
+	cmd.Flag("output", "File to write the rules to rather than stdout.").Short('o').StringVar(&opts.output)
+	cmd.Flag("down-for", "How long a cluster, one of its nodes or its API is down before alerting.").Default("1m").DurationVar(&opts.downFor)
+	cmd.Flag("license-usage", "Ratio of the connections to the license limit to alert at.").Default("0.9").Float64Var(&opts.licenseUsage)
+	cmd.Flag("license-remaining-days", "Days before the license expires to alert at.").Default("30").Float64Var(&opts.licenseRemainingDays)
+	cmd.Flag("bridge-for", "How long a bridge is disconnected or failing before alerting.").Default("5m").DurationVar(&opts.bridgeFor)
+	cmd.Flag("probe-for", "How long a probe is failing or slow before alerting.").Default("2m").DurationVar(&opts.probeFor)
+	cmd.Flag("probe-duration", "Duration of a probe to alert at.").Default("1s").DurationVar(&opts.probeDuration)
+	cmd.Flag("cert-remaining-days", "Days before the certificate of the EMQX API expires to alert at.").Default("14").Float64Var(&opts.certRemainingDays)
+	return cmd, opts
+}
+
+// ruleFile is a rule file of Prometheus
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         model.Duration    `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// runGenerateRules writes the rules of opts to their output, or to stdout
+func runGenerateRules(opts *rulesOptions, stdout io.Writer) int {
+	if opts.licenseUsage <= 0 || opts.licenseUsage > 1 {
+		fmt.Fprintf(os.Stderr, "--license-usage %v must be in (0, 1]\n", opts.licenseUsage)
+		return 1
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(generateRules(opts)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error marshalling rules:", err)
+		return 1
+	}
+	if opts.output == "" {
+		stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(opts.output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing rules:", err)
+		return 1
+	}
+	return 0
+}
+
+// generateRules returns the rules of the metrics of the exporter, whose clusters are told apart by the `cluster` label of the scrape configs
+func generateRules(opts *rulesOptions) *ruleFile {
+	warning := map[string]string{"severity": "warning"}
+	critical := map[string]string{"severity": "critical"}
+	return &ruleFile{Groups: []ruleGroup{
+		{
+			Name: "emqx-exporter.rules",
+			Rules: []rule{
+				{
+					Record: "cluster:emqx_license_usage:ratio",
+					Expr:   "emqx_license_sessions_used / (emqx_license_max_sessions > 0)",
+				},
+				{
+					Record: "target:emqx_mqtt_probe_success:avg5m",
+					Expr:   "avg_over_time(emqx_mqtt_probe_success[5m])",
+				},
+			},
+		},
+		{
+			Name: "emqx-exporter.alerts",
+			Rules: []rule{
+				{
+					Alert:       "EMQXClusterDown",
+					Expr:        "emqx_cluster_status != 2",
+					For:         model.Duration(opts.downFor),
+					Labels:      critical,
+					Annotations: annotations("No node of the EMQX cluster {{ $labels.cluster }} is running."),
+				},
+				{
+					Alert:       "EMQXNodeStopped",
+					Expr:        `emqx_cluster_nodes{status="stopped"} > 0`,
+					For:         model.Duration(opts.downFor),
+					Labels:      warning,
+					Annotations: annotations("{{ $value }} nodes of the EMQX cluster {{ $labels.cluster }} are stopped."),
+				},
+				{
+					Alert:       "EMQXConfigReplicationStuck",
+					Expr:        "emqx_node_cluster_rpc_lag > 0",
+					For:         model.Duration(5 * time.Minute),
+					Labels:      warning,
+					Annotations: annotations("The node {{ $labels.node }} of the EMQX cluster {{ $labels.cluster }} is {{ $value }} configuration transactions behind."),
+				},
+				{
+					Alert:       "EMQXAPIUnreachable",
+					Expr:        `emqx_scrape_collector_success{collector="cluster"} == 0`,
+					For:         model.Duration(opts.downFor),
+					Labels:      critical,
+					Annotations: annotations("The exporter can't reach the EMQX API of the cluster {{ $labels.cluster }}."),
+				},
+				{
+					Alert:       "EMQXLicenseNearQuota",
+					Expr:        fmt.Sprintf("cluster:emqx_license_usage:ratio >= %g", opts.licenseUsage),
+					For:         model.Duration(5 * time.Minute),
+					Labels:      warning,
+					Annotations: annotations("The EMQX cluster {{ $labels.cluster }} uses {{ $value | humanizePercentage }} of the connections of its license."),
+				},
+				{
+					Alert:       "EMQXLicenseExpiring",
+					Expr:        fmt.Sprintf("emqx_license_remaining_days < %g", opts.licenseRemainingDays),
+					Labels:      warning,
+					Annotations: annotations("The license of the EMQX cluster {{ $labels.cluster }} expires in {{ $value }} days."),
+				},
+				{
+					Alert:       "EMQXBridgeDisconnected",
+					Expr:        "emqx_rule_bridge_status != 2",
+					For:         model.Duration(opts.bridgeFor),
+					Labels:      critical,
+					Annotations: annotations("The bridge {{ $labels.type }}:{{ $labels.name }} of the EMQX cluster {{ $labels.cluster }} is disconnected."),
+				},
+				{
+					Alert:       "EMQXBridgeFailing",
+					Expr:        "increase(emqx_rule_bridge_failed[5m]) > 0 or increase(emqx_rule_bridge_dropped[5m]) > 0",
+					For:         model.Duration(opts.bridgeFor),
+					Labels:      warning,
+					Annotations: annotations("The bridge {{ $labels.type }}:{{ $labels.name }} of the EMQX cluster {{ $labels.cluster }} fails or drops messages."),
+				},
+				{
+					Alert:       "EMQXProbeFailing",
+					Expr:        "emqx_mqtt_probe_success == 0",
+					For:         model.Duration(opts.probeFor),
+					Labels:      critical,
+					Annotations: annotations("The MQTT probe of {{ $labels.target }} fails."),
+				},
+				{
+					Alert:       "EMQXProbeSlow",
+					Expr:        fmt.Sprintf("emqx_mqtt_probe_duration_seconds > %g", opts.probeDuration.Seconds()),
+					For:         model.Duration(opts.probeFor),
+					Labels:      warning,
+					Annotations: annotations("The MQTT probe of {{ $labels.target }} takes {{ $value | humanizeDuration }}."),
+				},
+				{
+					Alert:       "EMQXAPICertificateExpiring",
+					Expr:        fmt.Sprintf("emqx_api_cert_remaining_days < %g", opts.certRemainingDays),
+					Labels:      warning,
+					Annotations: annotations("The certificate of the EMQX API of the cluster {{ $labels.cluster }} expires in {{ $value }} days."),
+				},
+			},
+		},
+	}}
+}
+
+func annotations(summary string) map[string]string {
+	return map[string]string{"summary": summary}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestRunGenerateRules(t *testing.T) {
+	opts := &rulesOptions{
+		downFor:              time.Minute,
+		licenseUsage:         0.8,
+		licenseRemainingDays: 30,
+		bridgeFor:            5 * time.Minute,
+		probeFor:             2 * time.Minute,
+		probeDuration:        1500 * time.Millisecond,
+		certRemainingDays:    14,
+	}
+	var stdout bytes.Buffer
+	if code := runGenerateRules(opts, &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	rules := &ruleFile{}
+	if err := yaml.Unmarshal(stdout.Bytes(), rules); err != nil {
+		t.Fatalf("Expected valid YAML, got %s: %s", err, stdout.String())
+	}
+	exprs := make(map[string]string)
+	for _, group := range rules.Groups {
+		for _, r := range group.Rules {
+			exprs[r.Alert+r.Record] = r.Expr
+		}
+	}
+	for name, expr := range map[string]string{
+		"EMQXClusterDown":            "emqx_cluster_status != 2",
+		"EMQXNodeStopped":            `emqx_cluster_nodes{status="stopped"} > 0`,
+		"EMQXLicenseNearQuota":       "cluster:emqx_license_usage:ratio >= 0.8",
+		"EMQXConfigReplicationStuck": "emqx_node_cluster_rpc_lag > 0",
+		"EMQXBridgeDisconnected":     "emqx_rule_bridge_status != 2",
+		"EMQXProbeFailing":           "emqx_mqtt_probe_success == 0",
+		"EMQXProbeSlow":              "emqx_mqtt_probe_duration_seconds > 1.5",
+		"EMQXAPICertificateExpiring": "emqx_api_cert_remaining_days < 14",
+	} {
+		if exprs[name] != expr {
+			t.Errorf("Expected %q for %s, got %q", expr, name, exprs[name])
+		}
+	}
+	if !strings.Contains(stdout.String(), "\n        for: 2m\n") {
+		t.Errorf("Expected the rules indented by 2 with the for of --probe-for, got %s", stdout.String())
+	}
+
+	opts.licenseUsage = 90
+	if code := runGenerateRules(opts, &stdout); code != 1 {
+		t.Errorf("Expected exit code 1 for a license usage above 1, got %d", code)
+	}
+}
@@ -0,0 +1,444 @@
+// Package derived parses and evaluates the expressions of the derived metrics, which are validated as the config is
+// loaded and evaluated against the metrics gathered from a cluster on each scrape.
+package derived
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sample is a sample of an expression
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Value is the value of an expression, a scalar or the samples of a vector
+type Value struct {
+	Scalar  bool
+	Samples []Sample
+}
+
+// Expr is an expression evaluated against the metric families gathered, by name
+type Expr interface {
+	Eval(families map[string]*dto.MetricFamily) Value
+}
+
+type numberExpr float64
+
+func (e numberExpr) Eval(map[string]*dto.MetricFamily) Value {
+	return Value{Scalar: true, Samples: []Sample{{Value: float64(e)}}}
+}
+
+// metricExpr selects the samples of a metric, or the _sum and _count of a summary or a histogram
+type metricExpr string
+
+func (e metricExpr) Eval(families map[string]*dto.MetricFamily) Value {
+	name, suffix := string(e), ""
+	family, ok := families[name]
+	if !ok {
+		for _, s := range []string{"_sum", "_count"} {
+			if strings.HasSuffix(name, s) {
+				if family, ok = families[strings.TrimSuffix(name, s)]; ok {
+					suffix = s
+					break
+				}
+			}
+		}
+	}
+	var v Value
+	if !ok {
+		return v
+	}
+	for _, m := range family.Metric {
+		var value float64
+		switch {
+		case family.GetType() == dto.MetricType_COUNTER && suffix == "":
+			value = m.GetCounter().GetValue()
+		case family.GetType() == dto.MetricType_GAUGE && suffix == "":
+			value = m.GetGauge().GetValue()
+		case family.GetType() == dto.MetricType_UNTYPED && suffix == "":
+			value = m.GetUntyped().GetValue()
+		case family.GetType() == dto.MetricType_SUMMARY && suffix == "_sum":
+			value = m.GetSummary().GetSampleSum()
+		case family.GetType() == dto.MetricType_SUMMARY && suffix == "_count":
+			value = float64(m.GetSummary().GetSampleCount())
+		case family.GetType() == dto.MetricType_HISTOGRAM && suffix == "_sum":
+			value = m.GetHistogram().GetSampleSum()
+		case family.GetType() == dto.MetricType_HISTOGRAM && suffix == "_count":
+			value = float64(m.GetHistogram().GetSampleCount())
+		default:
+			return v
+		}
+		labels := make(map[string]string, len(m.Label))
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		v.Samples = append(v.Samples, Sample{Labels: labels, Value: value})
+	}
+	return v
+}
+
+// aggregateExpr aggregates the samples of a vector by the labels of by, and the `cluster` label, which keeps
+// the clusters apart when they're gathered together
+type aggregateExpr struct {
+	op   string
+	by   []string
+	expr Expr
+}
+
+func (e aggregateExpr) Eval(families map[string]*dto.MetricFamily) Value {
+	in := e.expr.Eval(families)
+	groups := make(map[string]*Sample)
+	counts := make(map[string]int)
+	var keys []string
+	for _, s := range in.Samples {
+		labels := make(map[string]string, len(e.by)+1)
+		for _, name := range append([]string{"cluster"}, e.by...) {
+			if value, ok := s.Labels[name]; ok {
+				labels[name] = value
+			}
+		}
+		key := mapKey(labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &Sample{Labels: labels, Value: s.Value}
+			groups[key] = g
+			keys = append(keys, key)
+		} else {
+			switch e.op {
+			case "sum", "avg":
+				g.Value += s.Value
+			case "min":
+				g.Value = math.Min(g.Value, s.Value)
+			case "max":
+				g.Value = math.Max(g.Value, s.Value)
+			}
+		}
+		counts[key]++
+	}
+	var v Value
+	for _, key := range keys {
+		g := groups[key]
+		switch e.op {
+		case "avg":
+			g.Value /= float64(counts[key])
+		case "count":
+			g.Value = float64(counts[key])
+		}
+		v.Samples = append(v.Samples, *g)
+	}
+	return v
+}
+
+// binaryExpr applies an arithmetic operator to the samples of both sides with the same labels.
+// A scalar, or a vector labeled by `cluster` at most like an aggregation, applies to every sample of its cluster
+// on the other side
+type binaryExpr struct {
+	op          byte
+	left, right Expr
+}
+
+func (e binaryExpr) Eval(families map[string]*dto.MetricFamily) Value {
+	left, right := e.left.Eval(families), e.right.Eval(families)
+	v := Value{Scalar: left.Scalar && right.Scalar}
+	add := func(labels map[string]string, l, r float64) {
+		if value, ok := applyOp(e.op, l, r); ok {
+			v.Samples = append(v.Samples, Sample{Labels: labels, Value: value})
+		}
+	}
+	switch {
+	case broadcast(right):
+		key := matchKey(right)
+		rights := indexSamples(right.Samples, key)
+		for _, l := range left.Samples {
+			if r, ok := rights[key(l.Labels)]; ok {
+				add(l.Labels, l.Value, r.Value)
+			}
+		}
+	case broadcast(left):
+		key := matchKey(left)
+		lefts := indexSamples(left.Samples, key)
+		for _, r := range right.Samples {
+			if l, ok := lefts[key(r.Labels)]; ok {
+				add(r.Labels, l.Value, r.Value)
+			}
+		}
+	default:
+		rights := indexSamples(right.Samples, mapKey)
+		for _, l := range left.Samples {
+			if r, ok := rights[mapKey(l.Labels)]; ok {
+				add(l.Labels, l.Value, r.Value)
+			}
+		}
+	}
+	return v
+}
+
+// applyOp returns the result of the operator, which is false for a division by zero. No sample is derived then
+// rather than an infinite ratio, like of a license not loaded yet
+func applyOp(op byte, l, r float64) (float64, bool) {
+	switch op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+// broadcast returns whether the samples of v apply to every sample of their cluster on the other side of an operator
+func broadcast(v Value) bool {
+	if v.Scalar {
+		return true
+	}
+	for _, s := range v.Samples {
+		for name := range s.Labels {
+			if name != "cluster" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchKey returns the key matching the samples of the broadcast side v with the other side
+func matchKey(v Value) func(map[string]string) string {
+	if v.Scalar {
+		return func(map[string]string) string { return "" }
+	}
+	return func(labels map[string]string) string { return labels["cluster"] }
+}
+
+func indexSamples(samples []Sample, key func(map[string]string) string) map[string]Sample {
+	index := make(map[string]Sample, len(samples))
+	for _, s := range samples {
+		index[key(s.Labels)] = s
+	}
+	return index
+}
+
+// Metric returns the sample as a gauge, labeled in the order of the label names
+func (s Sample) Metric() *dto.Metric {
+	metric := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(s.Value)}}
+	for _, name := range sortedKeys(s.Labels) {
+		metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(s.Labels[name])})
+	}
+	return metric
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mapKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, name := range sortedKeys(labels) {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// aggregations are the functions aggregating a vector
+var aggregations = map[string]bool{"sum": true, "min": true, "max": true, "avg": true, "count": true}
+
+// Parse parses an arithmetic expression of numbers and metric names with +, -, * and /,
+// parentheses, and the aggregations sum, min, max, avg and count with an optional `by (label, ...)`, like
+// `sum by (rule) (emqx_rule_exec_failure_count) / sum by (rule) (emqx_rule_topic_hit_count)`
+func Parse(s string) (Expr, error) {
+	p := &parser{tokens: tokenize(s)}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// tokenize splits s into names, numbers and the other characters, skipping the spaces.
+// A number may have an exponent, like 1e-6
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isDigit(s[i]) || r == '.':
+			j := i
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+				j++
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && isDigit(s[k]) {
+					for k < len(s) && isDigit(s[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == ':' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) expect(token string) error {
+	if p.peek() != token {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at the end", token)
+		}
+		return fmt.Errorf("expected %q, got %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) parseSum() (Expr, error) {
+	left, err := p.parseProduct()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		op := p.tokens[p.pos][0]
+		p.pos++
+		var right Expr
+		if right, err = p.parseProduct(); err == nil {
+			left = binaryExpr{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseProduct() (Expr, error) {
+	left, err := p.parseUnary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/") {
+		op := p.tokens[p.pos][0]
+		p.pos++
+		var right Expr
+		if right, err = p.parseUnary(); err == nil {
+			left = binaryExpr{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end of expression")
+	case token == "-":
+		p.pos++
+		expr, err := p.parseUnary()
+		return binaryExpr{op: '*', left: numberExpr(-1), right: expr}, err
+	case token == "(":
+		p.pos++
+		expr, err := p.parseSum()
+		if err == nil {
+			err = p.expect(")")
+		}
+		return expr, err
+	case aggregations[token]:
+		p.pos++
+		return p.parseAggregation(token)
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		p.pos++
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return numberExpr(f), nil
+	case token[0] == '_' || token[0] == ':' || unicode.IsLetter(rune(token[0])):
+		p.pos++
+		return metricExpr(token), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+// parseAggregation parses the arguments of the aggregation op, like `by (label) (expr)` or `(expr)`
+func (p *parser) parseAggregation(op string) (Expr, error) {
+	agg := aggregateExpr{op: op}
+	if p.peek() == "by" {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for p.peek() != ")" {
+			if len(agg.by) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			label := p.peek()
+			if label == "" || !(label[0] == '_' || unicode.IsLetter(rune(label[0]))) {
+				return nil, fmt.Errorf("expected a label name in by, got %q", label)
+			}
+			agg.by = append(agg.by, label)
+			p.pos++
+		}
+		p.pos++
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	agg.expr = expr
+	return agg, p.expect(")")
+}
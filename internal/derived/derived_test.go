@@ -0,0 +1,44 @@
+package derived
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParse(t *testing.T) {
+	for expr, msg := range map[string]string{
+		"":                    "unexpected end of expression",
+		"a +":                 "unexpected end of expression",
+		"(a":                  `expected ")" at the end`,
+		"a b":                 `unexpected "b"`,
+		"sum by rule (a)":     `expected "(", got "rule"`,
+		"sum by (rule,) (a)":  `expected a label name in by, got ")"`,
+		"a % 2":               `unexpected "%"`,
+		"1.2.3":               `invalid number "1.2.3"`,
+		"1e":                  `unexpected "e"`,
+		"max(a) / min(b) * 2": "",
+		"a / 1e-6":            "",
+		"2.5E+3 * a":          "",
+	} {
+		_, err := Parse(expr)
+		if msg == "" && err != nil || msg != "" && (err == nil || err.Error() != msg) {
+			t.Errorf("Expected %q parsing %q, got %v", msg, expr, err)
+		}
+	}
+
+	// the exponents are part of the numbers
+	expr, err := Parse("a * 1e-3 + 2E2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := map[string]*dto.MetricFamily{"a": {
+		Name:   proto.String("a"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1000)}}},
+	}}
+	if v := expr.Eval(families); len(v.Samples) != 1 || v.Samples[0].Value != 201 {
+		t.Errorf("Expected 1000 * 1e-3 + 2E2 = 201, got %+v", v.Samples)
+	}
+}
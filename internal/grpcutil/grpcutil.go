@@ -0,0 +1,86 @@
+// Package grpcutil holds the gRPC framing and transport over HTTP/2 shared by the OTLP exporter and the client of the
+// SPIFFE Workload API, which make unary and server streaming calls without the gRPC library.
+package grpcutil
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/net/http2"
+)
+
+// MaxMessageSize bounds the messages read, like the default receive limit of gRPC
+const MaxMessageSize = 4 << 20
+
+// NewTransport returns an HTTP/2 transport for gRPC calls over TLS of tlsConfig, or without TLS via HTTP/2 with prior
+// knowledge if tlsConfig is nil, whose connections are made by dial, or by a net.Dialer if nil
+func NewTransport(tlsConfig *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http2.Transport {
+	if tlsConfig != nil {
+		return &http2.Transport{TLSClientConfig: tlsConfig}
+	}
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+	}
+}
+
+// Frame prefixes the message by the compressed flag, unset, and its length
+func Frame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// ReadFrame reads the message of the next frame of r, io.EOF if there's none. The compressed messages are rejected,
+// as no compression is accepted by the calls, and so are those beyond maxSize
+func ReadFrame(r io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed gRPC message")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds the limit of %d bytes", size, maxSize)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// Status returns the status of the call of resp, whose body is read, from its trailers or from its headers if the
+// response has no message
+func Status(resp *http.Response) (code int, message string, err error) {
+	status := resp.Trailer.Get("Grpc-Status")
+	message = resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if code, err = strconv.Atoi(status); err != nil {
+		return 0, "", fmt.Errorf("invalid grpc-status %q", status)
+	}
+	message, _ = url.PathUnescape(message)
+	return code, message, nil
+}
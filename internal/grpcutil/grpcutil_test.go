@@ -0,0 +1,37 @@
+package grpcutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	r := bytes.NewReader(append(Frame([]byte("hello")), Frame(nil)...))
+	if message, err := ReadFrame(r, MaxMessageSize); err != nil || string(message) != "hello" {
+		t.Fatalf("Expected the message hello, got %q: %v", message, err)
+	}
+	if message, err := ReadFrame(r, MaxMessageSize); err != nil || len(message) != 0 {
+		t.Fatalf("Expected the empty message, got %q: %v", message, err)
+	}
+	if _, err := ReadFrame(r, MaxMessageSize); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF after the last frame, got %v", err)
+	}
+
+	compressed := Frame([]byte("hello"))
+	compressed[0] = 1
+	if _, err := ReadFrame(bytes.NewReader(compressed), MaxMessageSize); err == nil {
+		t.Error("Expected the compressed message to be rejected")
+	}
+	if _, err := ReadFrame(bytes.NewReader(Frame([]byte("hello"))), 4); err == nil {
+		t.Error("Expected the message beyond the limit to be rejected")
+	}
+	// the length is checked before the message is read
+	if _, err := ReadFrame(bytes.NewReader([]byte{0, 0xff, 0xff, 0xff, 0xff}), MaxMessageSize); err == nil {
+		t.Error("Expected the length beyond the limit to be rejected")
+	}
+	if _, err := ReadFrame(bytes.NewReader(Frame([]byte("hello"))[:7]), MaxMessageSize); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a truncated frame, got %v", err)
+	}
+}
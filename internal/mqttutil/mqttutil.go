@@ -0,0 +1,18 @@
+// Package mqttutil holds the helpers of the paho MQTT clients shared by the probes and the MQTT publisher.
+package mqttutil
+
+import (
+	"context"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// WaitToken waits for the token to complete, or for ctx to be done
+func WaitToken(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+// Package protoutil holds the helpers appending the fields of protobuf messages, shared by the OTLP exporters of the
+// metrics and the spans and by the remote write sink.
+package protoutil
+
+import "google.golang.org/protobuf/encoding/protowire"
+
+// AppendMessage appends the encoded message as the field
+func AppendMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// AppendBytes appends the bytes field
+func AppendBytes(b []byte, field protowire.Number, v []byte) []byte {
+	return AppendMessage(b, field, v)
+}
+
+// AppendString appends the string field
+func AppendString(b []byte, field protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// AppendFixed64 appends the fixed64 or double field, the latter given by math.Float64bits
+func AppendFixed64(b []byte, field protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+// AppendVarint appends the varint field
+func AppendVarint(b []byte, field protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// EncodeKeyValue encodes an OTLP KeyValue, whose AnyValue is a string, an int or a bool
+func EncodeKeyValue(key string, value interface{}) []byte {
+	var anyValue []byte
+	switch v := value.(type) {
+	case string:
+		anyValue = AppendString(nil, 1, v)
+	case bool:
+		var n uint64
+		if v {
+			n = 1
+		}
+		anyValue = AppendVarint(nil, 2, n)
+	case int:
+		anyValue = AppendVarint(nil, 3, uint64(v))
+	case int64:
+		anyValue = AppendVarint(nil, 3, uint64(v))
+	}
+	kv := AppendString(nil, 1, key)
+	return AppendMessage(kv, 2, anyValue)
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileLock is an exclusive flock(2) of a file, which the replicas share on a filesystem supporting it
+type FileLock struct {
+	path string
+	mu   sync.Mutex
+	// file is open while the lock is held
+	file *os.File
+}
+
+// NewFileLock returns a lock of the file at path, which is created if missing
+func NewFileLock(path string) (*FileLock, error) {
+	return &FileLock{path: path}, nil
+}
+
+// TryAcquire implements Lock
+func (l *FileLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("open lock file failed. %w", err)
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, fmt.Errorf("lock file failed. %w", err)
+	}
+	l.file = f
+	return true, nil
+}
+
+// Release implements Lock
+func (l *FileLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	// closing the file releases the lock
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
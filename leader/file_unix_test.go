@@ -0,0 +1,32 @@
+//go:build !windows
+
+package leader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	a, _ := NewFileLock(path)
+	b, _ := NewFileLock(path)
+	ctx := context.Background()
+
+	if held, err := a.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected a to acquire the lock, got %v, %v", held, err)
+	}
+	if held, err := b.TryAcquire(ctx); err != nil || held {
+		t.Fatalf("Expected b not to acquire the lock held by a, got %v, %v", held, err)
+	}
+	if held, _ := a.TryAcquire(ctx); !held {
+		t.Error("Expected a to keep the lock")
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := b.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected b to acquire the released lock, got %v, %v", held, err)
+	}
+}
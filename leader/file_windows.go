@@ -0,0 +1,24 @@
+package leader
+
+import (
+	"context"
+	"errors"
+)
+
+// FileLock isn't supported on Windows
+type FileLock struct{}
+
+// NewFileLock returns an error, file locks aren't supported on Windows
+func NewFileLock(path string) (*FileLock, error) {
+	return nil, errors.New("lock files are not supported on Windows")
+}
+
+// TryAcquire implements Lock
+func (l *FileLock) TryAcquire(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// Release implements Lock
+func (l *FileLock) Release(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,261 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// microTime is the format of metav1.MicroTime
+	microTime = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// LeaseLock is a coordination.k8s.io/v1 Lease, which the replicas running in a Kubernetes cluster share.
+// The service account of the replicas needs to be allowed to get, create and update it.
+// It's tried by a single goroutine at once, like the one of Elector.Run
+type LeaseLock struct {
+	client *http.Client
+	server string
+	// tokenFile is read on every request, as the projected service account tokens are rotated
+	tokenFile     string
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+
+	// observed is the spec of the lease last seen, and observedAt when it was seen changing on the local clock.
+	// The lease of another replica expires if it isn't seen renewed for its duration, like client-go does,
+	// rather than by its renew time, which was taken on the clock of that replica
+	observed   leaseSpec
+	observedAt time.Time
+}
+
+// NewLeaseLock returns a lock of the Lease namespace/name held by identity, which expires if not renewed for leaseDuration.
+// The Kubernetes API is reached with the service account of the pod, and namespace defaults to the one of the pod
+func NewLeaseLock(namespace, name, identity string, leaseDuration time.Duration) (*LeaseLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	tokenFile := serviceAccountDir + "/token"
+	if _, err := readToken(tokenFile); err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("read service account CA failed. %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate found in the service account CA")
+	}
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("read service account namespace failed. %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return newLeaseLock(client, "https://"+net.JoinHostPort(host, port), tokenFile, namespace, name, identity, leaseDuration), nil
+}
+
+func newLeaseLock(client *http.Client, server, tokenFile, namespace, name, identity string, leaseDuration time.Duration) *LeaseLock {
+	return &LeaseLock{
+		client:        client,
+		server:        server,
+		tokenFile:     tokenFile,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+	}
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// TryAcquire implements Lock. The lease is acquired if missing, held by nobody or expired, and renewed if held already.
+// A conflicting update of another replica at the same time tells the lease is held by it
+func (l *LeaseLock) TryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	current, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		created := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: l.name, Namespace: l.namespace},
+			Spec:       l.spec(now, now, 0),
+		}
+		return l.write(ctx, http.MethodPost, l.collectionURL(), &created)
+	}
+
+	spec := current.Spec
+	if spec != l.observed {
+		l.observed, l.observedAt = spec, now
+	}
+	if spec.HolderIdentity != "" && spec.HolderIdentity != l.identity {
+		expiry := l.observedAt.Add(time.Duration(spec.LeaseDurationSeconds) * time.Second)
+		if now.Before(expiry) {
+			return false, nil
+		}
+	}
+
+	acquired, transitions := now, spec.LeaseTransitions
+	if spec.HolderIdentity == l.identity {
+		if t, err := time.Parse(microTime, spec.AcquireTime); err == nil {
+			acquired = t
+		}
+	} else {
+		transitions++
+	}
+	current.Spec = l.spec(acquired, now, transitions)
+	return l.write(ctx, http.MethodPut, l.leaseURL(), current)
+}
+
+// Release implements Lock, it gives up the lease if held, which expires a second later
+func (l *LeaseLock) Release(ctx context.Context) error {
+	current, err := l.get(ctx)
+	if err != nil || current == nil || current.Spec.HolderIdentity != l.identity {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	_, err = l.write(ctx, http.MethodPut, l.leaseURL(), current)
+	return err
+}
+
+func (l *LeaseLock) spec(acquired, renewed time.Time, transitions int) leaseSpec {
+	duration := int(l.leaseDuration / time.Second)
+	if duration < 1 {
+		duration = 1
+	}
+	return leaseSpec{
+		HolderIdentity:       l.identity,
+		LeaseDurationSeconds: duration,
+		AcquireTime:          acquired.UTC().Format(microTime),
+		RenewTime:            renewed.UTC().Format(microTime),
+		LeaseTransitions:     transitions,
+	}
+}
+
+func (l *LeaseLock) collectionURL() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.server, l.namespace)
+}
+
+func (l *LeaseLock) leaseURL() string {
+	return l.collectionURL() + "/" + l.name
+}
+
+// get returns the lease, nil if it doesn't exist
+func (l *LeaseLock) get(ctx context.Context) (*lease, error) {
+	resp, err := l.do(ctx, http.MethodGet, l.leaseURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, unexpectedStatus(resp)
+	}
+	current := &lease{}
+	if err := json.NewDecoder(resp.Body).Decode(current); err != nil {
+		return nil, fmt.Errorf("decode lease failed. %w", err)
+	}
+	return current, nil
+}
+
+// write creates or updates the lease, and returns false if another replica did at the same time
+func (l *LeaseLock) write(ctx context.Context, method, url string, body *lease) (bool, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+	resp, err := l.do(ctx, method, url, data)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+	return false, unexpectedStatus(resp)
+}
+
+func (l *LeaseLock) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	token, err := readToken(l.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s lease failed. %w", method, err)
+	}
+	return resp, nil
+}
+
+// readToken reads the service account token of file
+func readToken(file string) (string, error) {
+	token, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read service account token failed. %w", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func unexpectedStatus(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s, %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(msg))
+}
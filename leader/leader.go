@@ -0,0 +1,67 @@
+// Package leader elects the leader among the replicas of the exporter, which is the only one collecting the clusters,
+// so that running several replicas for availability doesn't multiply the load on the EMQX API.
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Lock is held by a single replica at once
+type Lock interface {
+	// TryAcquire acquires or renews the lock, and returns whether it's held
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release lets another replica acquire the lock right away, if it's held
+	Release(ctx context.Context) error
+}
+
+// Elector keeps trying to acquire the lock, and is the leader while holding it
+type Elector struct {
+	lock        Lock
+	retryPeriod time.Duration
+	leader      atomic.Bool
+	logger      log.Logger
+}
+
+// NewElector returns an elector which tries to acquire or renew the lock every retryPeriod
+func NewElector(lock Lock, retryPeriod time.Duration, logger log.Logger) *Elector {
+	return &Elector{lock: lock, retryPeriod: retryPeriod, logger: logger}
+}
+
+// IsLeader returns whether the replica holds the lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run tries to acquire or renew the lock until ctx is done, then releases it if held.
+// A replica failing to renew the lock steps down, so that there's never more than one leader
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+	for {
+		held, err := e.lock.TryAcquire(ctx)
+		if err != nil {
+			level.Warn(e.logger).Log("msg", "Couldn't acquire the leader lock", "err", err)
+		}
+		if e.leader.Swap(held) != held {
+			level.Info(e.logger).Log("msg", "Leadership changed", "leader", held)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// the lock may have been acquired by the attempt aborted along with ctx
+			e.leader.Store(false)
+			releaseCtx, cancel := context.WithTimeout(context.Background(), e.retryPeriod)
+			if err := e.lock.Release(releaseCtx); err != nil {
+				level.Warn(e.logger).Log("msg", "Couldn't release the leader lock", "err", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// tokenFile returns a service account token file of token
+func tokenFile(t *testing.T, token string) string {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// fakeLeases serves a single lease like the Kubernetes API, rejecting the updates of stale resource versions
+func fakeLeases(t *testing.T) *httptest.Server {
+	var (
+		mu      sync.Mutex
+		current *lease
+		version int
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			if current == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(current)
+		case http.MethodPost, http.MethodPut:
+			written := &lease{}
+			if err := json.NewDecoder(r.Body).Decode(written); err != nil {
+				t.Error(err)
+			}
+			if (r.Method == http.MethodPost) != (current == nil) ||
+				(current != nil && written.Metadata.ResourceVersion != current.Metadata.ResourceVersion) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			version++
+			written.Metadata.ResourceVersion = strconv.Itoa(version)
+			current = written
+			json.NewEncoder(w).Encode(current)
+		}
+	}))
+}
+
+func TestLeaseLock(t *testing.T) {
+	server := fakeLeases(t)
+	defer server.Close()
+	token := tokenFile(t, "token")
+	a := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "a", time.Hour)
+	b := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "b", time.Hour)
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		lock     *LeaseLock
+		expected bool
+	}{{a, true}, {b, false}, {a, true}, {b, false}} {
+		held, err := step.lock.TryAcquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != step.expected {
+			t.Fatalf("Expected %s to hold the lease: %v, got %v", step.lock.identity, step.expected, held)
+		}
+	}
+
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := b.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected b to acquire the released lease, got %v, %v", held, err)
+	}
+	current, _ := b.get(ctx)
+	if current.Spec.LeaseTransitions != 1 {
+		t.Errorf("Expected 1 lease transition, got %d", current.Spec.LeaseTransitions)
+	}
+}
+
+func TestLeaseLockExpired(t *testing.T) {
+	server := fakeLeases(t)
+	defer server.Close()
+	token := tokenFile(t, "token")
+	a := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "a", time.Second)
+	b := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "b", time.Second)
+	ctx := context.Background()
+
+	if held, err := a.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected a to acquire the lease, got %v, %v", held, err)
+	}
+	// the lease expires a lease duration after b saw it renewed last
+	if held, err := b.TryAcquire(ctx); err != nil || held {
+		t.Fatalf("Expected b not to acquire the lease held by a, got %v, %v", held, err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if held, err := b.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected b to acquire the expired lease, got %v, %v", held, err)
+	}
+	if held, _ := a.TryAcquire(ctx); held {
+		t.Error("Expected a to lose the lease")
+	}
+}
+
+// testLock is held as told by held, and tells on leading whether the elector led when trying to acquire it
+type testLock struct {
+	elector  *Elector
+	held     chan bool
+	leading  chan bool
+	released chan struct{}
+}
+
+func (l *testLock) TryAcquire(ctx context.Context) (bool, error) {
+	select {
+	case l.leading <- l.elector.IsLeader():
+		return <-l.held, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (l *testLock) Release(ctx context.Context) error {
+	close(l.released)
+	return nil
+}
+
+func TestLeaseLockClockSkew(t *testing.T) {
+	server := fakeLeases(t)
+	defer server.Close()
+	token := tokenFile(t, "token")
+	a := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "a", time.Hour)
+	b := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "b", time.Hour)
+	ctx := context.Background()
+
+	if held, err := a.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("Expected a to acquire the lease, got %v, %v", held, err)
+	}
+	// the clock of a is behind by more than the lease duration
+	current, _ := a.get(ctx)
+	current.Spec.RenewTime = time.Now().Add(-2 * time.Hour).UTC().Format(microTime)
+	if ok, err := a.write(ctx, http.MethodPut, a.leaseURL(), current); err != nil || !ok {
+		t.Fatal(err)
+	}
+	if held, err := b.TryAcquire(ctx); err != nil || held {
+		t.Errorf("Expected b not to acquire the lease renewed by a on a skewed clock, got %v, %v", held, err)
+	}
+}
+
+func TestLeaseLockTokenRotation(t *testing.T) {
+	server := fakeLeases(t)
+	defer server.Close()
+	token := tokenFile(t, "expired")
+	a := newLeaseLock(server.Client(), server.URL, token, "default", "emqx-exporter", "a", time.Hour)
+	ctx := context.Background()
+
+	if _, err := a.TryAcquire(ctx); err == nil {
+		t.Fatal("Expected the expired token to be rejected")
+	}
+	if err := os.WriteFile(token, []byte("token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := a.TryAcquire(ctx); err != nil || !held {
+		t.Errorf("Expected the rotated token to be read, got %v, %v", held, err)
+	}
+}
+
+func TestElector(t *testing.T) {
+	lock := &testLock{held: make(chan bool), leading: make(chan bool), released: make(chan struct{})}
+	e := NewElector(lock, time.Millisecond, log.NewNopLogger())
+	lock.elector = e
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	for _, held := range []bool{true, false, true} {
+		<-lock.leading
+		lock.held <- held
+		if leading := <-lock.leading; leading != held {
+			t.Errorf("Expected the elector to lead: %v, got %v", held, leading)
+		}
+		lock.held <- held
+	}
+	cancel()
+	<-done
+	select {
+	case <-lock.released:
+	default:
+		t.Error("Expected the lock to be released")
+	}
+	if e.IsLeader() {
+		t.Error("Expected the elector to step down once stopped")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/exporter-toolkit/web"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// listenAndServe serves like web.ListenAndServe, besides on Unix sockets of listen addresses like `unix:///run/emqx-exporter.sock`.
+// The handler of srv is wrapped by preflight if set, in front of the basic auth of the web config file
+func listenAndServe(srv *http.Server, flags *web.FlagConfig, preflight func(http.Handler) http.Handler, logger log.Logger) error {
+	var listeners []net.Listener
+	if *flags.WebSystemdSocket {
+		level.Info(logger).Log("msg", "Listening on systemd activated listeners instead of port listeners.")
+		var err error
+		if listeners, err = activation.Listeners(); err != nil {
+			return err
+		}
+		if len(listeners) < 1 {
+			return errors.New("no socket activation file descriptors found")
+		}
+	} else {
+		for _, address := range *flags.WebListenAddresses {
+			l, err := listen(address)
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	if preflight != nil {
+		wrap := &wrapHandler{srv: srv, wrap: preflight}
+		for i, l := range listeners {
+			listeners[i] = &wrappingListener{Listener: l, wrap: wrap}
+		}
+	}
+	return web.ServeMultiple(listeners, srv, flags, logger)
+}
+
+// wrapHandler wraps the handler of srv once it's wrapped by the basic auth of the web config file, which web.Serve
+// does before accepting the connections of a listener
+type wrapHandler struct {
+	mu   sync.Mutex
+	srv  *http.Server
+	wrap func(http.Handler) http.Handler
+}
+
+// wrappedHandler tells the handler wrapped by wrapHandler
+type wrappedHandler struct {
+	http.Handler
+}
+
+func (w *wrapHandler) ensure() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// web.Serve wraps the handler again for every listener
+	if _, ok := w.srv.Handler.(*wrappedHandler); !ok {
+		w.srv.Handler = &wrappedHandler{w.wrap(w.srv.Handler)}
+	}
+}
+
+// wrappingListener wraps the handler of the server before its first connection is accepted
+type wrappingListener struct {
+	net.Listener
+	wrap *wrapHandler
+	once sync.Once
+}
+
+// Accept implements net.Listener
+func (l *wrappingListener) Accept() (net.Conn, error) {
+	l.once.Do(l.wrap.ensure)
+	return l.Listener.Accept()
+}
+
+// listen listens on the Unix socket of `unix:///path`, or on the TCP address otherwise
+func listen(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix://")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	// remove the socket left behind if the exporter was killed, the socket is removed on closing otherwise
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// serveH2C makes srv serve HTTP/2 over cleartext, both with prior knowledge and by upgrading from HTTP/1.1
+func serveH2C(srv *http.Server) error {
+	h2s := &http2.Server{}
+	// registers the GOAWAY of the h2c connections on srv.Shutdown
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	// leave the TLS settings, including HTTP/2 over TLS, to the web config file
+	srv.TLSConfig, srv.TLSNextProto = nil, nil
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/middleware"
+	"github.com/go-kit/log"
+	"github.com/prometheus/exporter-toolkit/web"
+	"golang.org/x/net/http2"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emqx-exporter.sock")
+
+	// leave the socket behind like a killed exporter
+	stale, err := listen("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced, got %s", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "OK" {
+		t.Errorf("Expected OK, got %q", body)
+	}
+}
+
+func TestServeH2C(t *testing.T) {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	if err := serveH2C(srv); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// HTTP/2 with prior knowledge
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	testcases := []struct {
+		client   *http.Client
+		expected string
+	}{
+		{client: client, expected: "HTTP/2.0"},
+		{client: http.DefaultClient, expected: "HTTP/1.1"},
+	}
+	for _, tc := range testcases {
+		resp, err := tc.client.Get("http://" + l.Addr().String() + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tc.expected {
+			t.Errorf("Expected to be served over %s, got %s", tc.expected, body)
+		}
+	}
+}
+
+// writeCert writes a self-signed certificate of the common name and its key to the files
+func writeCert(t *testing.T, commonName, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replaced by a rename like the projected volumes of the Kubernetes secrets, so it's never read half-written
+	for file, block := range map[string]*pem.Block{certFile: {Type: "CERTIFICATE", Bytes: der}, keyFile: {Type: "EC PRIVATE KEY", Bytes: keyDER}} {
+		if err := os.WriteFile(file+".tmp", pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(file+".tmp", file); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServeTLSReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, webConfig := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "web-config.yml")
+	writeCert(t, "before", certFile, keyFile)
+	if err := os.WriteFile(webConfig, []byte("tls_server_config:\n  cert_file: cert.pem\n  key_file: key.pem\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	systemdSocket := false
+	go web.Serve(l, srv, &web.FlagConfig{WebSystemdSocket: &systemdSocket, WebConfigFile: &webConfig}, log.NewNopLogger())
+	defer srv.Close()
+
+	servedCert := func() string {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if cert := servedCert(); cert != "before" {
+		t.Fatalf("Expected the certificate before the rotation, got %q", cert)
+	}
+	writeCert(t, "after", certFile, keyFile)
+	if cert := servedCert(); cert != "after" {
+		t.Errorf("Expected the rotated certificate on the next connection without a restart, got %q", cert)
+	}
+}
+
+func TestListenAndServePreflight(t *testing.T) {
+	dir := t.TempDir()
+	path, webConfig := filepath.Join(dir, "emqx-exporter.sock"), filepath.Join(dir, "web-config.yml")
+	// the password fakepassword
+	if err := os.WriteFile(webConfig, []byte("basic_auth_users:\n  alice: $2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	origins := []string{"https://status.example.com"}
+	srv := &http.Server{Handler: middleware.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}), origins)}
+	systemdSocket := false
+	flags := &web.FlagConfig{WebListenAddresses: &[]string{"unix://" + path}, WebSystemdSocket: &systemdSocket, WebConfigFile: &webConfig}
+	go listenAndServe(srv, flags, func(next http.Handler) http.Handler { return middleware.CORSPreflight(next, origins) }, log.NewNopLogger())
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	do := func(method, user string) *http.Response {
+		req, _ := http.NewRequest(method, "http://localhost/api/v1/metrics", nil)
+		req.Header.Set("Origin", origins[0])
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		if user != "" {
+			req.SetBasicAuth(user, "fakepassword")
+		}
+		var resp *http.Response
+		var err error
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if resp, err = client.Do(req); err == nil || time.Now().After(deadline) {
+				break
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// browsers send the preflight requests without the credentials
+	if resp := do(http.MethodOptions, ""); resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the preflight answered before the basic auth, got %s %v", resp.Status, resp.Header)
+	}
+	if resp := do(http.MethodGet, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without credentials, got %s", resp.Status)
+	}
+	if resp := do(http.MethodGet, "alice"); resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != origins[0] {
+		t.Errorf("Expected status 200 with the origin allowed, got %s %v", resp.Status, resp.Header)
+	}
+}
@@ -0,0 +1,123 @@
+// Package logfile writes the logs of the exporter to a file rotated by size and age, for the installs whose stdout
+// and stderr aren't captured by anything
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat suffixes the rotated files, it sorts in time order
+const backupTimeFormat = "20060102T150405.000"
+
+// File is a log file, which is renamed aside and replaced by a new one once it reaches maxSize bytes, or once it was
+// opened maxAge ago. Only the latest maxBackups rotated files are kept
+type File struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	opened     time.Time
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// Open opens the log file of path for appending. A maxSize or maxAge of 0 never rotates by size or age,
+// and a maxBackups of 0 keeps all rotated files
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*File, error) {
+	f := &File{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file failed. %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file failed. %w", err)
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+// Write implements io.Writer, it rotates the file first if p would take it beyond its size or it's too old
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && (f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize || f.maxAge > 0 && f.now().Sub(f.opened) >= f.maxAge) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen closes the file and opens path again, after it was rotated by an external tool like logrotate
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Close()
+	return f.open()
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// rotate renames the file aside with the time as suffix, opens a new one, and removes the oldest rotated files
+func (f *File) rotate() error {
+	f.file.Close()
+	backup := f.path + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		// keep on logging to the file rather than losing the logs
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("rotate log file failed. %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.maxBackups > 0 {
+		f.prune()
+	}
+	return nil
+}
+
+// prune removes the rotated files beyond the latest maxBackups ones
+func (f *File) prune() {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	backups := matches[:0]
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, f.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,76 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exporter.log")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f, err := Open(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		if _, err := f.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 rotated files kept, got %v", backups)
+	}
+	if backups[0] != path+".20240101T000004.000" {
+		t.Errorf("Expected the oldest rotated files removed, got %v", backups)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "12345678\n" {
+		t.Errorf("Expected the last line in the log file, got %q", data)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exporter.log")
+	f, err := Open(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := f.opened
+	f.now = func() time.Time { return now }
+
+	f.Write([]byte("old\n"))
+	now = now.Add(time.Hour)
+	f.Write([]byte("new\n"))
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("Expected the log file rotated after an hour, got %q", data)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exporter.log")
+	f, err := Open(path, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	// like logrotate does
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+	if data, _ := os.ReadFile(path); string(data) != "after\n" {
+		t.Errorf("Expected the log file reopened, got %q", data)
+	}
+}
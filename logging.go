@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/emqx/emqx-exporter/logfile"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+)
+
+// leveledLogger filters the lines of its base logger by a level which can be changed at runtime.
+// It's the logger of promlog.NewWithLogger, whose caller accounts for the frame of leveledLogger.Log
+type leveledLogger struct {
+	base    log.Logger
+	leveled atomic.Pointer[log.Logger]
+}
+
+func newLeveledLogger(base log.Logger, config *promlog.Config) *leveledLogger {
+	l := &leveledLogger{base: log.With(base, "ts", log.TimestampFormat(
+		func() time.Time { return time.Now().UTC() },
+		"2006-01-02T15:04:05.000Z07:00",
+	), "caller", log.Caller(6))}
+	l.SetLevel(config.Level)
+	return l
+}
+
+// Log implements log.Logger
+func (l *leveledLogger) Log(keyvals ...interface{}) error {
+	return (*l.leveled.Load()).Log(keyvals...)
+}
+
+// SetLevel filters out the lines below lvl, none if lvl is nil
+func (l *leveledLogger) SetLevel(lvl *promlog.AllowedLevel) {
+	// a filter allowing all keeps the depth of the caller
+	leveled := level.NewFilter(l.base, level.AllowAll())
+	if lvl != nil {
+		switch lvl.String() {
+		case "debug":
+			leveled = level.NewFilter(l.base, level.AllowDebug())
+		case "info":
+			leveled = level.NewFilter(l.base, level.AllowInfo())
+		case "warn":
+			leveled = level.NewFilter(l.base, level.AllowWarn())
+		case "error":
+			leveled = level.NewFilter(l.base, level.AllowError())
+		}
+	}
+	l.leveled.Store(&leveled)
+}
+
+// Unleveled returns a logger writing to the base logger of l whatever its level, for the lines which mustn't be filtered
+// out at runtime, like the audit records of the requests changing the level
+func (l *leveledLogger) Unleveled() log.Logger {
+	return unleveledLogger{level.NewFilter(l.base, level.AllowAll())}
+}
+
+// unleveledLogger calls its logger like leveledLogger, for the same depth of the caller
+type unleveledLogger struct {
+	logger log.Logger
+}
+
+// Log implements log.Logger
+func (l unleveledLogger) Log(keyvals ...interface{}) error {
+	return l.logger.Log(keyvals...)
+}
+
+// newLogger returns the logger of config, which writes to the log file of path if set rather than to stderr.
+// The log file is reopened on reopenSignals, for external tools like logrotate to rotate it, and closed by closeFile
+func newLogger(config *promlog.Config, path string, maxSize int64, maxAge time.Duration, maxBackups int) (logger *leveledLogger, closeFile func(), err error) {
+	if path == "" {
+		return newLeveledLogger(newFormatLogger(config, log.NewSyncWriter(os.Stderr)), config), func() {}, nil
+	}
+	file, err := logfile.Open(path, maxSize, maxAge, maxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger = newLeveledLogger(newFormatLogger(config, file), config)
+
+	reopen := make(chan os.Signal, 1)
+	if len(reopenSignals) > 0 {
+		signal.Notify(reopen, reopenSignals...)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-reopen:
+				if err := file.Reopen(); err != nil {
+					// the file stays closed, so tell stderr
+					level.Error(log.NewLogfmtLogger(os.Stderr)).Log("msg", "Error reopening log file", "err", err)
+					continue
+				}
+				level.Info(logger).Log("msg", "Reopened log file")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return logger, func() {
+		signal.Stop(reopen)
+		close(done)
+		file.Close()
+	}, nil
+}
+
+// newFormatLogger returns the logger of the --log.format of config writing to w
+func newFormatLogger(config *promlog.Config, w io.Writer) log.Logger {
+	if config.Format != nil && config.Format.String() == "json" {
+		return log.NewJSONLogger(w)
+	}
+	return log.NewLogfmtLogger(w)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make the log file reopened
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenSignals make the log file reopened, there's no SIGUSR1 on Windows
+var reopenSignals []os.Signal
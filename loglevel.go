@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+)
+
+// defaultLogLevelDuration is how long a level set without a duration lasts
+const defaultLogLevelDuration = 10 * time.Minute
+
+// logLevelHandler serves /-/loglevel, GET returns the current log level, and PUT sets the `level` parameter
+// for the `duration` parameter, after which the level of --log.level is restored
+type logLevelHandler struct {
+	logger  *leveledLogger
+	initial *promlog.AllowedLevel
+
+	mu      sync.Mutex
+	current string
+	// generation tells the revert of the last level set from those of the levels it replaced
+	generation int
+	revert     *time.Timer
+}
+
+func newLogLevelHandler(logger *leveledLogger, initial *promlog.AllowedLevel) *logLevelHandler {
+	return &logLevelHandler{logger: logger, initial: initial, current: initial.String()}
+}
+
+func (h *logLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.mu.Lock()
+		current := h.current
+		h.mu.Unlock()
+		fmt.Fprintln(w, current)
+	case http.MethodPut:
+		lvl := &promlog.AllowedLevel{}
+		if err := lvl.Set(r.FormValue("level")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		duration := defaultLogLevelDuration
+		if d := r.FormValue("duration"); d != "" {
+			var err error
+			if duration, err = time.ParseDuration(d); err != nil || duration <= 0 {
+				http.Error(w, fmt.Sprintf("invalid duration %q, it must be positive like 10m", d), http.StatusBadRequest)
+				return
+			}
+		}
+		h.set(lvl, duration)
+		fmt.Fprintf(w, "%s for %s\n", lvl, duration)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// set sets the level lvl, and restores the initial level after duration
+func (h *logLevelHandler) set(lvl *promlog.AllowedLevel, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.revert != nil {
+		h.revert.Stop()
+	}
+	h.generation++
+	generation := h.generation
+	h.logger.SetLevel(lvl)
+	h.current = lvl.String()
+	level.Info(h.logger).Log("msg", "Log level set", "level", lvl, "duration", duration)
+
+	h.revert = time.AfterFunc(duration, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.generation != generation {
+			return
+		}
+		h.logger.SetLevel(h.initial)
+		h.current = h.initial.String()
+		h.revert = nil
+		level.Info(h.logger).Log("msg", "Log level restored", "level", h.initial)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/middleware"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	initial := &promlog.AllowedLevel{}
+	initial.Set("info")
+	var out bytes.Buffer
+	logger := newLeveledLogger(log.NewLogfmtLogger(log.NewSyncWriter(&out)), &promlog.Config{Level: initial})
+	h := newLogLevelHandler(logger, initial)
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	for _, target := range []string{"/-/loglevel?level=verbose", "/-/loglevel?level=debug&duration=-1s"} {
+		if w := serve(http.MethodPut, target); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", target, w.Code)
+		}
+	}
+	if w := serve(http.MethodPost, "/-/loglevel?level=debug"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", w.Code)
+	}
+
+	level.Debug(logger).Log("msg", "hidden")
+	if w := serve(http.MethodPut, "/-/loglevel?level=debug&duration=100ms"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodGet, "/-/loglevel"); strings.TrimSpace(w.Body.String()) != "debug" {
+		t.Errorf("Expected the level debug, got %q", w.Body)
+	}
+	level.Debug(logger).Log("msg", "shown")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.TrimSpace(serve(http.MethodGet, "/-/loglevel").Body.String()) != "info" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the level info restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	level.Debug(logger).Log("msg", "hidden again")
+
+	logs := out.String()
+	if strings.Contains(logs, "hidden") || !strings.Contains(logs, "shown") {
+		t.Errorf("Expected the debug lines logged only while debug was set, got %s", logs)
+	}
+	if !strings.Contains(logs, "caller=loglevel_test.go:") {
+		t.Errorf("Expected the caller of the lines, got %s", logs)
+	}
+}
+
+func TestAuditUnleveled(t *testing.T) {
+	initial := &promlog.AllowedLevel{}
+	initial.Set("info")
+	var out bytes.Buffer
+	logger := newLeveledLogger(log.NewLogfmtLogger(log.NewSyncWriter(&out)), &promlog.Config{Level: initial})
+	h := middleware.Audit(newLogLevelHandler(logger, initial), log.With(logger.Unleveled(), "component", "audit"))
+
+	// the record of the request raising the level, and of any later one, is still written
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/-/loglevel?level=error", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+		}
+	}
+	level.Info(logger).Log("msg", "hidden")
+
+	logs := out.String()
+	if strings.Count(logs, "msg=Audit") != 2 || strings.Contains(logs, "hidden") {
+		t.Errorf("Expected the audit records only, got %s", logs)
+	}
+	if !strings.Contains(logs, "caller=audit.go:") {
+		t.Errorf("Expected the caller of the records, got %s", logs)
+	}
+}
@@ -14,23 +14,40 @@
 package main
 
 import (
-	"emqx-exporter/collector"
-	"emqx-exporter/config"
-	"emqx-exporter/prober"
-
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"html"
+	stdlog "log"
+	"math"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/middleware"
+	"github.com/emqx/emqx-exporter/prober"
+	"github.com/emqx/emqx-exporter/push"
+	"github.com/emqx/emqx-exporter/tracing"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"gopkg.in/yaml.v3"
 
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/prometheus/exporter-toolkit/web/kingpinflag"
@@ -39,6 +56,9 @@ import (
 var sc = config.NewSafeConfig(prometheus.DefaultRegisterer)
 
 func main() {
+	if isService, exitCode := runService(kingpin.CommandLine, os.Args[1:], &http.Server{}); isService {
+		os.Exit(exitCode)
+	}
 	os.Exit(run(kingpin.CommandLine, os.Args[1:], &http.Server{}))
 }
 
@@ -46,10 +66,54 @@ func run(app *kingpin.Application, args []string, srv *http.Server) (exitCode in
 	var (
 		configFile             = app.Flag("config.file", "EMQX exporter configuration file.").Default(filepath.Join(filepath.Dir(os.Args[0]), "config.yaml")).String()
 		maxProcs               = app.Flag("runtime.gomaxprocs", "The target number of CPUs Go will run on (GOMAXPROCS)").Envar("GOMAXPROCS").Default("4").Int()
-		maxRequests            = app.Flag("web.max-requests", "Maximum number of parallel scrape requests. Use 0 to disable.").Default("40").Int()
+		memoryLimit            = app.Flag("runtime.memory-limit", "Soft memory limit of the Go runtime like 512MiB, GOMEMLIMIT applies if not set. The heaviest collectors are disabled when the memory used approaches it.").Default("0").Bytes()
+		memoryDegradeRatio     = app.Flag("runtime.memory-degrade-ratio", "Ratio of the memory limit beyond which the heaviest collectors are disabled, until the memory used is back below 90% of it.").Default("0.9").Float64()
+		maxRequests            = app.Flag("web.max-requests", "Maximum number of parallel scrape requests to each of /metrics and /probe, beyond which they are rejected with status 503. Use 0 to disable.").Default("40").Int()
+		rateLimit              = app.Flag("web.rate-limit", "Maximum number of scrape requests per second to each of /metrics and /probe, beyond which they are rejected with status 429. Use 0 to disable.").Default("0").Float64()
+		rateLimitBurst         = app.Flag("web.rate-limit.burst", "Number of scrape requests allowed at once beyond --web.rate-limit.").Default("10").Int()
 		disableExporterMetrics = app.Flag("web.disable-exporter-metrics", "Exclude metrics about the exporter itself (promhttp_*, process_*, go_*).").Bool()
+		disableGoMetrics       = app.Flag("web.disable-go-metrics", "Exclude the go_* metrics about the Go runtime of the exporter.").Bool()
+		disableProcessMetrics  = app.Flag("web.disable-process-metrics", "Exclude the process_* metrics about the process of the exporter.").Bool()
+		goRuntimeMetrics       = app.Flag("web.go-runtime-metrics", "Add all the metrics of the runtime/metrics package to the go_* metrics, for debugging the exporter.").Bool()
+		exporterMetricsPrefix  = app.Flag("web.exporter-metrics-prefix", "Prefix of the names of the go_* and process_* metrics about the exporter, like emqx_exporter_.").Default("").String()
+		openMetricsCreated     = app.Flag("web.openmetrics.created-samples", "Expose the _created series of counters, histograms and summaries if the OpenMetrics format is negotiated.").Bool()
+		nativeHistograms       = app.Flag("probe.native-histograms", "Expose the probe latencies as a histogram with both classic and native buckets.").Bool()
+		deepReady              = app.Flag("web.ready.deep", "Verify the config file, the EMQX API reachability and the probe targets reachability on every readiness check of /ready, as /ready?deep=true does.").Bool()
+		deepReadyTTL           = app.Flag("web.ready.deep-ttl", "How long the result of a deep readiness check is reused by the following ones.").Default("10s").Duration()
+		corsOrigins            = app.Flag("web.cors.origin", "Origin allowed to call /api/v1/metrics, /api/v1/config, /api/openapi.json, /healthz and /ready from the browser, like https://status.example.com, repeat it to allow several, * allows any origin. No origin is allowed if not set.").Strings()
+		allowedCIDRs           = app.Flag("web.allowed-cidrs", "CIDR of the clients allowed to access all endpoints, repeat it to allow several. All clients are allowed if not set.").Strings()
+		accessLog              = app.Flag("web.access-log", "Log every request served by the exporter, with its status, duration and remote address.").Bool()
+		enableLogLevel         = app.Flag("web.enable-log-level", "Serve /-/loglevel to change the log level at runtime for a while, like curl -X PUT 'host:8085/-/loglevel?level=debug&duration=10m'.").Bool()
+		auditLog               = app.Flag("web.audit-log", "File to write the audit records of the requests changing the exporter at runtime to, like the ones to /-/loglevel, rather than the log. It isn't filtered by --log.level, and is rotated like --log.file.").Default("").String()
+		enablePprof            = app.Flag("web.enable-pprof", "Expose the pprof profiles at /debug/pprof/ and the expvar variables at /debug/vars.").Bool()
+		adminListenAddress     = app.Flag("web.admin-listen-address", "Address to serve the debug endpoints of --web.enable-pprof on, instead of the main listen address.").Default("").String()
+		once                   = app.Flag("once", "Collect the metrics of all clusters and probes once, push them to the pushgateway of the config file, or write them with the collect command, and exit.").Bool()
+		timeoutOffset          = app.Flag("web.timeout-offset", "Offset to subtract from the scrape timeout of Prometheus, to respond with partial data before the scrape times out.").Default("500ms").Duration()
+		enableH2C              = app.Flag("web.h2c", "Serve HTTP/2 over cleartext (h2c) besides HTTP/1.1, HTTP/2 over TLS is enabled by the web config file.").Bool()
+		drainTimeout           = app.Flag("web.drain-timeout", "Time to wait for the in-flight requests to finish on SIGTERM or SIGINT, before disconnecting the probes and exiting.").Default("30s").Duration()
+		dumpConfig             = app.Flag("dump-config", "Print the effective config with the secrets masked, and exit.").Bool()
+		leaderLease            = app.Flag("leader-election.lease", "Kubernetes Lease electing the leader among the replicas of the exporter, which is the only one collecting the clusters. Given as namespace/name, or name in the namespace of the pod.").Default("").String()
+		leaderLockFile         = app.Flag("leader-election.lock-file", "File electing the leader among the replicas of the exporter, which is the only one collecting the clusters. It's locked with flock(2) on a filesystem the replicas share.").Default("").String()
+		leaderIdentity         = app.Flag("leader-election.identity", "Identity of the replica holding the Kubernetes Lease, the hostname by default.").Default("").String()
+		leaseDuration          = app.Flag("leader-election.lease-duration", "Time the Kubernetes Lease of a leader failing to renew it lasts. The leader lock is tried every third of it.").Default("15s").Duration()
+		shard                  = app.Flag("shard", "Shard of the collection of this replica of the exporter, from 0 to --total-shards minus 1.").Default("0").Int()
+		totalShards            = app.Flag("total-shards", "Number of replicas of the exporter the collectors of the clusters are spread over, each collecting the collectors of its --shard.").Default("1").Int()
+		logFile                = app.Flag("log.file", "File to write the logs to rather than stderr, which is rotated by --log.file.max-size and --log.file.max-age, and reopened on SIGUSR1.").Default("").String()
+		logFileMaxSize         = app.Flag("log.file.max-size", "Size the log file is rotated at, 0 to never rotate it by size.").Default("100MiB").Bytes()
+		logFileMaxAge          = app.Flag("log.file.max-age", "Age the log file is rotated at, 0 to never rotate it by age.").Default("0s").Duration()
+		logFileMaxBackups      = app.Flag("log.file.max-backups", "Number of rotated log files kept, 0 to keep all of them.").Default("5").Int()
+		requireFIPS            = app.Flag("fips", "Refuse to start unless the cryptography runs in FIPS mode, built with GOEXPERIMENT=boringcrypto or run with GODEBUG=fips140=on.").Bool()
 		toolkitFlags           = kingpinflag.AddFlags(app, ":8085")
 	)
+	app.Command("serve", "Serve the metrics and probes of the config file, the default command.").Default()
+	versionCmd := app.Command("version", "Print the version and build context, like --version, and exit.")
+	checkCmd, checkOpts := addCheckCommand(app)
+	collectCmd, collectOpts := addCollectCommand(app)
+	rulesCmd, rulesOpts := addGenerateCommands(app)
+	migrateCmd, migrateOpts := addMigrateCommand(app)
+	doctorCmd, doctorOpts := addDoctorCommand(app)
+	benchCmd, benchOpts := addBenchCommand(app)
+	serviceCmds := addServiceCommands(app)
 	app.Version(version.Print("emqx-exporter"))
 	app.UsageWriter(os.Stdout)
 	app.HelpFlag.Short('h')
@@ -57,35 +121,550 @@ func run(app *kingpin.Application, args []string, srv *http.Server) (exitCode in
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(app, promlogConfig)
 
-	kingpin.MustParse(app.Parse(args))
+	cmd := kingpin.MustParse(app.Parse(args))
+	if cmd == versionCmd.FullCommand() {
+		fmt.Println(version.Print("emqx-exporter"))
+		return 0
+	}
+	if cmd == rulesCmd.FullCommand() {
+		return runGenerateRules(rulesOpts, os.Stdout)
+	}
+	if cmd == migrateCmd.FullCommand() {
+		return runMigrateConfig(app, migrateOpts, os.Stdin, os.Stdout, os.Stderr)
+	}
 
-	logger := promlog.New(promlogConfig)
+	logger, closeLog, err := newLogger(promlogConfig, *logFile, int64(*logFileMaxSize), *logFileMaxAge, *logFileMaxBackups)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening --log.file:", err)
+		return 1
+	}
+	defer closeLog()
+	// the standard logger of net/http and the dependencies logs in the --log.format of the others too
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.NewStdlibAdapter(level.Warn(logger)))
+	if *requireFIPS {
+		if collector.FIPSModule() == "" {
+			level.Error(logger).Log("msg", "--fips is set but the cryptography doesn't run in FIPS mode, build with GOEXPERIMENT=boringcrypto or run with GODEBUG=fips140=on")
+			return 1
+		}
+		level.Info(logger).Log("msg", "Running in FIPS mode", "module", collector.FIPSModule())
+	}
+	if cmd == checkCmd.FullCommand() {
+		return runCheck(checkOpts, os.Stdout, logger)
+	}
+	if cmd == doctorCmd.FullCommand() {
+		if doctorOpts.config == "" {
+			doctorOpts.config = *configFile
+		}
+		return runDoctor(doctorOpts, os.Stdout, logger)
+	}
+	if cmd == benchCmd.FullCommand() {
+		return runBench(benchOpts, os.Stdout, logger)
+	}
+	if cmd == collectCmd.FullCommand() {
+		if collectOpts.config == "" {
+			collectOpts.config = *configFile
+		}
+		return runCollect(collectOpts, *once, os.Stdout, logger)
+	}
+	if handled, exitCode := runServiceCommand(serviceCmds, cmd); handled {
+		return exitCode
+	}
 	level.Info(logger).Log("msg", "Starting emqx-exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 
 	// GOMAXPROCS returns the previous setting. If n < 1, it does not change the current setting.
 	runtime.GOMAXPROCS(*maxProcs)
 	level.Debug(logger).Log("msg", "Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
+	if *memoryLimit > 0 {
+		debug.SetMemoryLimit(int64(*memoryLimit))
+	}
+	if *memoryDegradeRatio <= 0 || *memoryDegradeRatio > 1 {
+		level.Error(logger).Log("msg", "--runtime.memory-degrade-ratio must be in (0, 1]", "ratio", *memoryDegradeRatio)
+		return 1
+	}
 
 	if err := sc.ReloadConfig(*configFile); err != nil {
 		level.Error(logger).Log("msg", "Error loading config", "err", err)
 		return 1
 	}
 	level.Info(logger).Log("msg", "Loaded config file")
+	if *dumpConfig {
+		c, err := redactedConfig(sc.C)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error marshalling configuration", "err", err)
+			return 1
+		}
+		os.Stdout.Write(c)
+		return 0
+	}
+
+	allowedPrefixes, err := middleware.ParseCIDRs(*allowedCIDRs)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error parsing --web.allowed-cidrs", "err", err)
+		return 1
+	}
+
+	collectorShard := collector.Shard{Index: *shard, Total: *totalShards}
+	if err := collectorShard.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Error parsing --shard", "err", err)
+		return 1
+	}
+	if collectorShard.Total > 1 {
+		level.Info(logger).Log("msg", "Collecting a shard of the collectors", "shard", collectorShard.Index, "total_shards", collectorShard.Total)
+	}
+
+	clusters, err := newClusters(sc.C, collectorShard, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating cluster", "err", err)
+		return 1
+	}
+	defer func() {
+		for _, cluster := range clusters {
+			cluster.Close()
+		}
+	}()
+
+	if *once {
+		gather := newPushGatherer(clusters, sc.C.Probes, nil, prober.HandlerOpts{EnableNativeHistograms: *nativeHistograms}, logger)
+		if err := pushOnce(clusters, gather, sc.C.Pushgateway); err != nil {
+			level.Error(logger).Log("msg", "Error pushing metrics once", "err", err)
+			return 1
+		}
+		level.Info(logger).Log("msg", "Pushed metrics to the pushgateway", "url", sc.C.Pushgateway.URL, "job", sc.C.Pushgateway.Job)
+		return 0
+	}
+	// ctx is done on SIGTERM or SIGINT, which stops pushing and shuts down the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	elector, err := newElector(*leaderLease, *leaderLockFile, *leaderIdentity, *leaseDuration, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error setting up leader election", "err", err)
+		return 1
+	}
+	elected := make(chan struct{})
+	if elector != nil {
+		for _, cluster := range clusters {
+			cluster.FollowLeader(elector.IsLeader)
+		}
+		go func() {
+			defer close(elected)
+			// the lock is released once ctx is done, for a standby replica to take over right away
+			elector.Run(ctx)
+		}()
+		level.Info(logger).Log("msg", "Collecting the clusters only while leading")
+	} else {
+		close(elected)
+	}
+
+	// a negative limit only returns the current one, which is math.MaxInt64 unless set by GOMEMLIMIT or --runtime.memory-limit
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		guard := collector.NewMemoryGuard(limit, *memoryDegradeRatio)
+		for _, cluster := range clusters {
+			cluster.GuardMemory(guard)
+		}
+		go guard.Run(ctx, time.Second, logger)
+		level.Info(logger).Log("msg", "Disabling the heaviest collectors beyond the soft memory limit", "memory_limit_bytes", limit, "ratio", *memoryDegradeRatio)
+	}
+
+	var scheduler *prober.Scheduler
+	if schedule := sc.C.ProbeSchedule; schedule != nil {
+		scheduler = prober.NewScheduler(func() []config.Probe {
+			sc.Lock()
+			defer sc.Unlock()
+			return sc.C.Probes
+		}, time.Duration(schedule.Interval), time.Duration(schedule.Timeout), prober.HandlerOpts{EnableNativeHistograms: *nativeHistograms}, logger)
+		go scheduler.Run(ctx)
+		level.Info(logger).Log("msg", "Probing on a schedule", "interval", schedule.Interval, "timeout", schedule.Timeout)
+	}
+
+	type pushSink struct {
+		name     string
+		sink     push.Sink
+		interval time.Duration
+	}
+	var sinks []pushSink
+	runPush := func(name string, sink push.Sink, interval time.Duration) {
+		sinks = append(sinks, pushSink{name: name, sink: sink, interval: interval})
+	}
+	if sc.C.RemoteWrite != nil {
+		runPush("remote_write", push.NewRemoteWriter(sc.C.RemoteWrite, logger), time.Duration(sc.C.RemoteWrite.Interval))
+		level.Info(logger).Log("msg", "Pushing metrics via remote write", "url", sc.C.RemoteWrite.URL, "interval", sc.C.RemoteWrite.Interval)
+	}
+	if sc.C.OTLP != nil {
+		runPush("otlp", push.NewOTLPExporter(sc.C.OTLP, logger), time.Duration(sc.C.OTLP.Interval))
+		level.Info(logger).Log("msg", "Pushing metrics via OTLP", "endpoint", sc.C.OTLP.Endpoint, "protocol", sc.C.OTLP.Protocol, "interval", sc.C.OTLP.Interval)
+	}
+	if sc.C.StatsD != nil {
+		runPush("statsd", push.NewStatsD(sc.C.StatsD), time.Duration(sc.C.StatsD.Interval))
+		level.Info(logger).Log("msg", "Pushing metrics via DogStatsD", "address", sc.C.StatsD.Address, "interval", sc.C.StatsD.Interval)
+	}
+	if sc.C.InfluxDB != nil {
+		runPush("influxdb", push.NewInfluxDB(sc.C.InfluxDB, logger), time.Duration(sc.C.InfluxDB.Interval))
+		level.Info(logger).Log("msg", "Writing metrics to InfluxDB", "url", sc.C.InfluxDB.URL, "version", sc.C.InfluxDB.Version, "interval", sc.C.InfluxDB.Interval)
+	}
+	if sc.C.Graphite != nil {
+		runPush("graphite", push.NewGraphite(sc.C.Graphite), time.Duration(sc.C.Graphite.Interval))
+		level.Info(logger).Log("msg", "Sending metrics to Graphite", "address", sc.C.Graphite.Address, "interval", sc.C.Graphite.Interval)
+	}
+	if sc.C.MQTTPublish != nil {
+		runPush("mqtt", push.NewMQTTPublisher(sc.C.MQTTPublish, logger), time.Duration(sc.C.MQTTPublish.Interval))
+		level.Info(logger).Log("msg", "Publishing health to MQTT", "target", sc.C.MQTTPublish.Target, "topic", sc.C.MQTTPublish.Topic, "interval", sc.C.MQTTPublish.Interval)
+	}
+	var pushers sync.WaitGroup
+	if len(sinks) > 0 {
+		shortest := sinks[0].interval
+		for _, s := range sinks[1:] {
+			if s.interval < shortest {
+				shortest = s.interval
+			}
+		}
+		// the sinks pushing at the same time share the metrics gathered, while the one of the shortest interval
+		// gathers them again on each of its pushes
+		gather := push.Share(newPushGatherer(clusters, sc.C.Probes, scheduler, prober.HandlerOpts{EnableNativeHistograms: *nativeHistograms}, logger), shortest/2)
+		for _, s := range sinks {
+			pushers.Add(1)
+			go func(s pushSink) {
+				defer pushers.Done()
+				push.Run(ctx, s.name, gather, s.sink, s.interval, logger)
+			}(s)
+		}
+	}
+
+	traced := make(chan struct{})
+	tracingConf := sc.C.Tracing
+	if tracingConf == nil {
+		if tracingConf, err = config.TracingFromEnv(os.Getenv); err != nil {
+			level.Error(logger).Log("msg", "Error configuring tracing", "err", err)
+			return 1
+		}
+	}
+	if tracingConf != nil {
+		exporter := tracing.NewExporter(tracingConf, log.With(logger, "component", "tracing"))
+		tracing.SetExporter(exporter)
+		go func() {
+			defer close(traced)
+			exporter.Run(ctx)
+		}()
+		level.Info(logger).Log("msg", "Exporting traces", "endpoint", tracingConf.Endpoint, "sampling_ratio", *tracingConf.SamplingRatio)
+	} else {
+		close(traced)
+	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", collector.NewHandler(*disableExporterMetrics, *maxRequests, sc.C.Metrics, logger))
+	mux.Handle("/metrics", middleware.RateLimit(middleware.Compress(middleware.ScrapeTimeout(collector.NewHandler(collector.HandlerOpts{
+		DisableExporterMetrics:          *disableExporterMetrics,
+		DisableGoMetrics:                *disableGoMetrics,
+		DisableProcessMetrics:           *disableProcessMetrics,
+		GoRuntimeMetrics:                *goRuntimeMetrics,
+		ExporterMetricsPrefix:           *exporterMetricsPrefix,
+		MaxRequests:                     *maxRequests,
+		EnableOpenMetricsCreatedSamples: *openMetricsCreated,
+	}, clusters, logger), *timeoutOffset)), *rateLimit, *rateLimitBurst))
+	mux.Handle("/api/v1/metrics", middleware.CORS(middleware.RateLimit(middleware.MaxInFlight(middleware.Compress(middleware.ScrapeTimeout(
+		collector.NewJSONHandler(clusters, logger), *timeoutOffset)), *maxRequests), *rateLimit, *rateLimitBurst), *corsOrigins))
+
+	// liveness only checks the process is serving
+	mux.Handle("/healthz", middleware.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}), *corsOrigins))
 
-	mux.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/ready", middleware.CORS(&readyHandler{
+		configFile: *configFile,
+		deep:       *deepReady,
+		ttl:        *deepReadyTTL,
+		clusters:   clusters,
+		probes: func() []config.Probe {
+			sc.RLock()
+			defer sc.RUnlock()
+			return sc.C.Probes
+		},
+	}, *corsOrigins))
+
+	mux.Handle("/probe", middleware.RateLimit(middleware.MaxInFlight(middleware.Compress(middleware.ScrapeTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scheduler != nil {
+			scheduler.Handler(w, r, nil)
+			return
+		}
 		sc.Lock()
 		probes := sc.C.Probes
 		sc.Unlock()
-		prober.Handler(w, r, probes, logger, nil)
-	})
+		prober.Handler(w, r, probes, prober.HandlerOpts{EnableNativeHistograms: *nativeHistograms}, logger, nil)
+	}), *timeoutOffset)), *maxRequests), *rateLimit, *rateLimitBurst))
+
+	// /config is kept for the earlier versions, both serve the effective config with the secrets masked
+	mux.Handle("/config", configHandler(sc, logger))
+	mux.Handle("/api/v1/config", middleware.CORS(configHandler(sc, logger), *corsOrigins))
+
+	mux.Handle("/api/openapi.json", middleware.CORS(openAPIHandler(sc, *enableLogLevel, logger), *corsOrigins))
+
+	landingPage, err := web.NewLandingPage(newLandingConfig(sc.C))
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		return 1
+	}
+	mux.Handle("/", landingPageHandler(landingPage))
+
+	// the audit records are written whatever the level, as it's one of the changes they record
+	auditLogger := log.With(logger.Unleveled(), "component", "audit")
+	if *auditLog != "" {
+		auditFileLogger, closeAuditLog, err := newLogger(&promlog.Config{Format: promlogConfig.Format}, *auditLog, int64(*logFileMaxSize), *logFileMaxAge, *logFileMaxBackups)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error opening --web.audit-log", "err", err)
+			return 1
+		}
+		defer closeAuditLog()
+		auditLogger = auditFileLogger
+		level.Info(logger).Log("msg", "Writing audit records", "file", *auditLog)
+	}
+	if *enableLogLevel {
+		mux.Handle("/-/loglevel", middleware.Audit(newLogLevelHandler(logger, promlogConfig.Level), auditLogger))
+		level.Info(logger).Log("msg", "Enabled changing the log level at /-/loglevel")
+	}
+
+	if *enablePprof {
+		if *adminListenAddress == "" {
+			registerDebugHandlers(mux)
+			level.Info(logger).Log("msg", "Enabled debug endpoints on the main listen address")
+		} else {
+			adminMux := http.NewServeMux()
+			registerDebugHandlers(adminMux)
+			// share the TLS and auth settings of the main listener
+			systemdSocket := false
+			adminFlags := &web.FlagConfig{
+				WebListenAddresses: &[]string{*adminListenAddress},
+				WebSystemdSocket:   &systemdSocket,
+				WebConfigFile:      toolkitFlags.WebConfigFile,
+			}
+			go func() {
+				adminSrv := &http.Server{Handler: middleware.AllowCIDRs(adminMux, allowedPrefixes)}
+				if err := listenAndServe(adminSrv, adminFlags, nil, logger); err != nil {
+					level.Error(logger).Log("msg", "Error starting admin HTTP server", "err", err)
+				}
+			}()
+			level.Info(logger).Log("msg", "Enabled debug endpoints on the admin listen address", "address", *adminListenAddress)
+		}
+	}
+
+	srv.Handler = middleware.AllowCIDRs(mux, allowedPrefixes)
+	if *accessLog {
+		srv.Handler = middleware.AccessLog(srv.Handler, logger)
+	}
+	if *enableH2C {
+		if *toolkitFlags.WebConfigFile != "" {
+			// the requests on an upgraded connection would skip the basic auth of the web config file
+			level.Error(logger).Log("msg", "--web.h2c can't be combined with --web.config.file")
+			return 1
+		}
+		if err := serveH2C(srv); err != nil {
+			level.Error(logger).Log("msg", "Error enabling h2c", "err", err)
+			return 1
+		}
+		level.Info(logger).Log("msg", "Serving HTTP/2 over cleartext (h2c)")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		level.Info(logger).Log("msg", "Shutting down, draining the in-flight requests", "timeout", *drainTimeout)
+		notifySystemdStopping(logger)
+		drainCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+		defer cancel()
+		// stops accepting requests, and waits for the in-flight ones
+		if err := srv.Shutdown(drainCtx); err != nil {
+			level.Warn(logger).Log("msg", "Error draining the in-flight requests", "err", err)
+		}
+	}()
+
+	go notifySystemd(mux, logger)
+	// the preflight requests are answered before the basic auth of the web config file, which browsers send them without
+	var preflight func(http.Handler) http.Handler
+	if len(*corsOrigins) > 0 {
+		preflight = func(next http.Handler) http.Handler {
+			return middleware.AllowCIDRs(middleware.CORSPreflight(next, *corsOrigins), allowedPrefixes)
+		}
+	}
+	if err := listenAndServe(srv, toolkitFlags, preflight, logger); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		level.Error(logger).Log("msg", "Error starting HTTP server", "err", err)
+		return 1
+	}
+
+	// the server may have been shut down by the Windows service rather than a signal
+	stop()
+	<-drained
+	pushers.Wait()
+	<-elected
+	<-traced
+	prober.DisconnectAll(250 * time.Millisecond)
+	level.Info(logger).Log("msg", "Shut down")
+	return 0
+}
+
+// newClusters returns the clusters of the config, keyed by their names, "" for the one of `metrics`
+func newClusters(c *config.Config, shard collector.Shard, logger log.Logger) (map[string]*collector.Cluster, error) {
+	clusters := make(map[string]*collector.Cluster, len(c.Clusters)+1)
+	var err error
+	if c.Metrics != nil {
+		if clusters[""], err = collector.NewCluster(c.Metrics, shard, logger); err != nil {
+			return nil, err
+		}
+	}
+	for i := range c.Clusters {
+		name := c.Clusters[i].Name
+		if clusters[name], err = collector.NewCluster(&c.Clusters[i], shard, logger); err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", name, err)
+		}
+	}
+	return clusters, nil
+}
+
+// waitDetected waits for the versions of all clusters to be detected, or for ctx to be done
+func waitDetected(ctx context.Context, clusters map[string]*collector.Cluster) error {
+	for name, cluster := range clusters {
+		if err := cluster.WaitDetected(ctx); err != nil {
+			return fmt.Errorf("cluster %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// pushOnce waits for the clusters to be reached, and pushes the metrics gathered once to the pushgateway
+func pushOnce(clusters map[string]*collector.Cluster, gather push.Gatherer, conf *config.Pushgateway) error {
+	if conf == nil {
+		return errors.New("--once requires pushgateway in the config file")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Timeout))
+	defer cancel()
+	if err := waitDetected(ctx, clusters); err != nil {
+		return err
+	}
+	timestamp := time.Now()
+	families, err := gather(ctx)
+	if err != nil {
+		return err
+	}
+	return push.NewPushgateway(conf).Push(ctx, families, timestamp)
+}
+
+// newPushGatherer gathers the metrics of all clusters and probes, like they are scraped from the endpoints.
+// The results of the last probes of scheduler are pushed if it's not nil, otherwise the probes are run concurrently
+func newPushGatherer(clusters map[string]*collector.Cluster, probes []config.Probe, scheduler *prober.Scheduler, opts prober.HandlerOpts, logger log.Logger) push.Gatherer {
+	return func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collector.NewBuildInfoCollector(), collector.NewFIPSCollector())
+		gatherers := prometheus.Gatherers{registry}
+		for _, cluster := range clusters {
+			gatherers = append(gatherers, cluster.Gatherer(ctx))
+		}
+		if scheduler != nil {
+			gatherers = append(gatherers, scheduler.Gatherers()...)
+			return gatherers.Gather()
+		}
+		probed := make([]prometheus.Gatherer, len(probes))
+		var wg sync.WaitGroup
+		for i := range probes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				probed[i] = prober.Probe(ctx, probes[i], opts, logger)
+			}(i)
+		}
+		wg.Wait()
+		return append(gatherers, probed...).Gather()
+	}
+}
+
+func newLandingConfig(c *config.Config) web.LandingConfig {
+	metricsLink := web.LandingLinks{
+		Address:     "/metrics",
+		Text:        "Metrics",
+		Description: "metrics about the exporter itself, no EMQX cluster is configured",
+	}
+	if c.Metrics != nil {
+		metricsLink.Description = "metrics of the EMQX cluster " + html.EscapeString(c.Metrics.Scheme+"://"+c.Metrics.Target)
+	}
+	links := []web.LandingLinks{metricsLink}
+
+	for _, cluster := range c.Clusters {
+		links = append(links, web.LandingLinks{
+			Address:     "/metrics?cluster=" + url.QueryEscape(cluster.Name),
+			Text:        "Metrics of " + html.EscapeString(cluster.Name),
+			Description: "metrics of the EMQX cluster " + html.EscapeString(cluster.Scheme+"://"+cluster.Target),
+		})
+	}
+
+	if c.Metrics != nil || len(c.Clusters) > 0 {
+		links = append(links, web.LandingLinks{
+			Address:     "/api/v1/metrics",
+			Text:        "JSON metrics",
+			Description: "metrics of the EMQX cluster as JSON grouped by collector, select the cluster by the cluster parameter",
+		})
+	}
+
+	for _, probe := range c.Probes {
+		links = append(links, web.LandingLinks{
+			Address:     "/probe?target=" + url.QueryEscape(probe.Target),
+			Text:        "Probe " + html.EscapeString(probe.Target),
+			Description: "probe the MQTT broker via " + html.EscapeString(probe.Scheme) + ", the target must be one of the configured probes",
+		})
+	}
+
+	links = append(links,
+		web.LandingLinks{
+			Address:     "/healthz",
+			Text:        "Health",
+			Description: "liveness of the exporter",
+		},
+		web.LandingLinks{
+			Address:     "/ready",
+			Text:        "Ready",
+			Description: "readiness of the exporter",
+		},
+		web.LandingLinks{
+			Address:     "/config",
+			Text:        "Config",
+			Description: "the loaded configuration with the secrets masked, like /api/v1/config",
+		},
+		web.LandingLinks{
+			Address:     "/api/v1/config",
+			Text:        "Effective config",
+			Description: "the loaded configuration with the defaults filled and the secrets masked",
+		},
+		web.LandingLinks{
+			Address:     "/api/openapi.json",
+			Text:        "OpenAPI",
+			Description: "the OpenAPI document of the endpoints, with the configured clusters and probe targets",
+		},
+		web.LandingLinks{
+			Address:     "https://github.com/emqx/emqx-exporter",
+			Text:        "Documentation",
+			Description: "how to configure the exporter and the Grafana dashboards",
+		},
+	)
+
+	return web.LandingConfig{
+		Name:        "EMQX Exporter",
+		Description: "Prometheus exporter and MQTT prober for EMQX",
+		Version:     version.Info(),
+		Links:       links,
+	}
+}
+
+// redactedConfig marshals the effective config, with the defaults filled and the secrets masked
+func redactedConfig(c *config.Config) ([]byte, error) {
+	r, err := c.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(r)
+}
 
-	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+// configHandler serves the config of sc with the secrets masked
+func configHandler(sc *config.SafeConfig, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sc.RLock()
-		c, err := yaml.Marshal(sc.C)
+		c, err := redactedConfig(sc.C)
 		sc.RUnlock()
 		if err != nil {
 			level.Warn(logger).Log("msg", "Error marshalling configuration", "err", err)
@@ -95,38 +674,24 @@ func run(app *kingpin.Application, args []string, srv *http.Server) (exitCode in
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write(c)
 	})
+}
 
-	landingConfig := web.LandingConfig{
-		Name:        "EMQX Exporter",
-		Description: "EMQX Exporter",
-		Version:     version.Info(),
-		Links: []web.LandingLinks{
-			{
-				Address: "/metrics",
-				Text:    "Metrics",
-			},
-			{
-				Address: "/probe",
-				Text:    "Probe",
-			},
-			{
-				Address: "/config",
-				Text:    "Config",
-			},
-		},
-	}
-	landingPage, err := web.NewLandingPage(landingConfig)
-	if err != nil {
-		level.Error(logger).Log("err", err)
-		return 1
-	}
-	mux.Handle("/", landingPage)
-
-	srv.Handler = mux
-	if err := web.ListenAndServe(srv, toolkitFlags, logger); err != nil {
-		level.Error(logger).Log("msg", "Error starting HTTP server", "err", err)
-		return 1
-	}
+// landingPageHandler serves the landing page at / only, rather than at every unknown path
+func landingPageHandler(landingPage http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		landingPage.ServeHTTP(w, r)
+	})
+}
 
-	return 0
+func registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
 }
@@ -15,7 +15,6 @@ package main
 
 import (
 	"context"
-	"emqx-exporter/config"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,6 +30,7 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	dockerClient "github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+	"github.com/emqx/emqx-exporter/config"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/format"
@@ -103,6 +103,8 @@ func TestAPIs(t *testing.T) {
 var _ = BeforeSuite(func() {
 	var err error
 	binName := "emqx-exporter"
+	// the config files written by the tests are read back with their API secrets
+	config.MarshalSecretValue = true
 
 	emqxExporter.binDir, err = os.MkdirTemp("/tmp", binName+"-test-bindir-")
 	Expect(err).NotTo(HaveOccurred())
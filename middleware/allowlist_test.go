@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteAddrAllowed(t *testing.T) {
+	prefixes, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.7", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]bool{
+		"10.1.2.3:51234":         true,
+		"192.168.1.7:80":         true,
+		"192.168.1.8:80":         false,
+		"[::ffff:10.0.0.1]:8085": true,
+		"[fd12::1]:8085":         true,
+		"[2001:db8::1]:8085":     false,
+		"not-an-address":         false,
+	}
+
+	for remoteAddr, expected := range testcases {
+		if got := remoteAddrAllowed(remoteAddr, prefixes); got != expected {
+			t.Errorf("Expected %v but got %v for '%s'", expected, got, remoteAddr)
+		}
+	}
+
+	if _, err := ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected invalid CIDR to be rejected")
+	}
+}
+
+func TestAllowCIDRsOverUnixSocket(t *testing.T) {
+	prefixes, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := AllowCIDRs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), prefixes)
+
+	testcases := []struct {
+		localAddr net.Addr
+		expected  int
+	}{
+		{localAddr: &net.UnixAddr{Name: "/run/emqx-exporter.sock", Net: "unix"}, expected: http.StatusOK},
+		{localAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8085}, expected: http.StatusForbidden},
+	}
+	for _, tc := range testcases {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.RemoteAddr = "@"
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tc.localAddr))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.expected {
+			t.Errorf("Expected status %d over %s, got %d", tc.expected, tc.localAddr.Network(), rec.Code)
+		}
+	}
+}
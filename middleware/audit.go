@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Audit writes an audit record of every request served by next which changes the exporter, i.e. all but GET, HEAD
+// and OPTIONS ones: who made it, what it changed, from where, and whether it succeeded. The logger tells when
+func Audit(next http.Handler, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		// the parameters of a form body are only readable once, so they're parsed for both the record and next
+		r.ParseForm()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		level.Info(logger).Log(
+			"msg", "Audit",
+			"user", requestUser(r),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"params", r.Form.Encode(),
+			"status", sw.status,
+			"remote_addr", r.RemoteAddr,
+			"forwarded_for", r.Header.Get("X-Forwarded-For"),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// requestUser returns the user authenticated by the web config file, by basic auth or a TLS client certificate
+func requestUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return ""
+}
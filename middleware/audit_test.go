@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestAudit(t *testing.T) {
+	var buf bytes.Buffer
+	h := Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.FormValue("level") != "debug" {
+			t.Errorf("Expected the form to stay readable by the handler, got %q", r.FormValue("level"))
+		}
+		if r.FormValue("duration") == "forever" {
+			http.Error(w, "invalid duration", http.StatusBadRequest)
+		}
+	}), log.NewLogfmtLogger(&buf))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/-/loglevel", nil))
+	if buf.Len() > 0 {
+		t.Errorf("Expected no audit record of a GET request, got %s", buf.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/-/loglevel?duration=forever", strings.NewReader("level=debug"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.SetBasicAuth("alice", "password")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	record := buf.String()
+	for _, field := range []string{"user=alice", "method=PUT", "path=/-/loglevel", "params=\"duration=forever&level=debug\"", "status=400", "remote_addr=192.0.2.1:1234", "forwarded_for=10.0.0.1"} {
+		if !strings.Contains(record, field) {
+			t.Errorf("Expected %s in the audit record %s", field, record)
+		}
+	}
+	if strings.Contains(record, "password") {
+		t.Errorf("Expected no password in the audit record %s", record)
+	}
+}
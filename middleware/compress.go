@@ -0,0 +1,146 @@
+// Package middleware provides the http.Handler wrappers shared by the endpoints of the exporter.
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+var zstdPool = sync.Pool{
+	New: func() interface{} {
+		// a response is a single stream, which isn't worth the goroutines of a concurrent encoder
+		z, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return z
+	},
+}
+
+// Compress compresses the responses by zstd or gzip, whichever is preferred by the Accept-Encoding header of the request.
+// The responses without body, like those to HEAD or of status 204 or 304, are sent as they are
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressResponseWriter holds the status back until the first write of the body, and only then takes an encoder,
+// so that nothing is compressed unless there's a body the status allows
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	// status is the one written by the handler, sent along the first write or once the handler returns
+	status      int
+	wroteHeader bool
+	encoder     io.WriteCloser
+	release     func()
+}
+
+func (w *compressResponseWriter) WriteHeader(statusCode int) {
+	// the informational responses are sent ahead of the final one
+	if statusCode < http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if bodyAllowed(w.status) {
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Encoding", w.encoding)
+			w.encoder, w.release = newEncoder(w.encoding, w.ResponseWriter)
+		}
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.encoder.Write(p)
+}
+
+// close sends the status held back if nothing was written, or ends the compressed body
+func (w *compressResponseWriter) close() {
+	if !w.wroteHeader {
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.release()
+	}
+}
+
+// newEncoder takes an encoder of encoding writing to w from its pool, and returns it along with the func putting it back
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, func()) {
+	if encoding == encodingZstd {
+		z := zstdPool.Get().(*zstd.Encoder)
+		z.Reset(w)
+		return z, func() { zstdPool.Put(z) }
+	}
+	gz := gzipPool.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return gz, func() { gzipPool.Put(gz) }
+}
+
+// bodyAllowed returns whether a response of status may have a body
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in the Accept-Encoding header,
+// zstd wins a tie as it's cheaper. It returns "" if neither of them is accepted
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != encodingGzip && encoding != encodingZstd {
+			continue
+		}
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ || (q == bestQ && q > 0 && encoding == encodingZstd) {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
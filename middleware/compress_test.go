@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	testcases := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    "gzip",
+		"gzip, deflate, br":       "gzip",
+		"gzip, zstd":              "zstd",
+		"zstd;q=0.5, gzip":        "gzip",
+		"gzip;q=0, zstd;q=0":      "",
+		"GZIP;q=0.8, zstd;q=0.75": "gzip",
+	}
+
+	for header, expected := range testcases {
+		got := negotiateEncoding(header)
+		if expected != got {
+			t.Errorf("Expected '%s' but got '%s' for '%s'", expected, got, header)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("emqx_test_gauge 1\n", 100)
+	h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	// the encoders are reused by the next responses
+	for i := 0; i < 3; i++ {
+		for encoding, decode := range decoders {
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			r.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Expected Content-Encoding %s, got %q", encoding, got)
+			}
+			d, err := decode(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(d)
+			if err != nil || string(got) != body {
+				t.Errorf("Expected the %s response to be decoded to the body, got %d bytes, %v", encoding, len(got), err)
+			}
+		}
+	}
+}
+
+func TestCompressWithoutBody(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		method string
+		status int
+		body   string
+	}{
+		{"empty body", "GET", http.StatusOK, ""},
+		{"no content", "GET", http.StatusNoContent, ""},
+		{"not modified", "GET", http.StatusNotModified, ""},
+		{"head", "HEAD", http.StatusOK, ""},
+	} {
+		h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+		}))
+		r := httptest.NewRequest(test.method, "/metrics", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+			t.Errorf("%s: expected status %d without a compressed body, got %d, %q, %d bytes", test.name, test.status, w.Code, w.Header().Get("Content-Encoding"), w.Body.Len())
+		}
+	}
+
+	// the status is sent along the first write of the body
+	h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "not ready")
+	}))
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected the compressed body of status 503, got %d, %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// CORS lets the pages of the origins call next from the browser, like a status dashboard served elsewhere.
+// The origin `*` allows any origin. The origins given explicitly are allowed to send credentials, like the basic auth
+// of the web config file. The preflight requests are answered without calling next
+func CORS(next http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	c := newCORSOrigins(origins)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.allow(w, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.preflight(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CORSPreflight answers the preflight requests from the origins like CORS, and passes the others to next.
+// It's meant to wrap the basic auth of the web config file, as the browsers send the preflight requests without the
+// credentials
+func CORSPreflight(next http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	c := newCORSOrigins(origins)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) && c.allow(w, r) && c.preflight(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type corsOrigins map[string]bool
+
+func newCORSOrigins(origins []string) corsOrigins {
+	c := make(corsOrigins, len(origins))
+	for _, origin := range origins {
+		c[origin] = true
+	}
+	return c
+}
+
+// allow sets the headers allowing the origin of r, and returns whether it's allowed
+func (c corsOrigins) allow(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	switch {
+	case origin == "":
+		return false
+	case c[origin]:
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	case c["*"]:
+		// the browsers don't send credentials to any origin
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	default:
+		return false
+	}
+	return true
+}
+
+// preflight answers r if it's a preflight request, and returns whether it is
+func (c corsOrigins) preflight(w http.ResponseWriter, r *http.Request) bool {
+	if !isPreflight(r) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	testcases := []struct {
+		origins       []string
+		method        string
+		origin        string
+		allowedOrigin string
+		status        int
+		called        bool
+	}{
+		{origins: []string{"https://status.example.com"}, method: http.MethodGet, origin: "https://status.example.com", allowedOrigin: "https://status.example.com", status: http.StatusOK, called: true},
+		{origins: []string{"https://status.example.com"}, method: http.MethodGet, origin: "https://evil.example.com", status: http.StatusOK, called: true},
+		{origins: []string{"https://status.example.com"}, method: http.MethodGet, status: http.StatusOK, called: true},
+		{origins: []string{"*"}, method: http.MethodGet, origin: "https://any.example.com", allowedOrigin: "*", status: http.StatusOK, called: true},
+		// the preflight requests are answered by the middleware
+		{origins: []string{"https://status.example.com"}, method: http.MethodOptions, origin: "https://status.example.com", allowedOrigin: "https://status.example.com", status: http.StatusNoContent},
+		{origins: nil, method: http.MethodGet, origin: "https://status.example.com", status: http.StatusOK, called: true},
+	}
+	for _, tc := range testcases {
+		called = false
+		r := httptest.NewRequest(tc.method, "/api/v1/metrics", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			r.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		w := httptest.NewRecorder()
+		CORS(next, tc.origins).ServeHTTP(w, r)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.allowedOrigin {
+			t.Errorf("%s from %q allowing %v: expected the allowed origin %q, got %q", tc.method, tc.origin, tc.origins, tc.allowedOrigin, got)
+		}
+		if w.Code != tc.status || called != tc.called {
+			t.Errorf("%s from %q allowing %v: expected status %d and next called %v, got %d and %v", tc.method, tc.origin, tc.origins, tc.status, tc.called, w.Code, called)
+		}
+		// the credentials are allowed to the origins given explicitly only
+		if credentials := w.Header().Get("Access-Control-Allow-Credentials"); (credentials == "true") != (tc.allowedOrigin != "" && tc.allowedOrigin != "*") {
+			t.Errorf("%s from %q allowing %v: unexpected credentials allowed %q", tc.method, tc.origin, tc.origins, credentials)
+		}
+		if tc.method == http.MethodOptions && w.Header().Get("Access-Control-Allow-Headers") != "Authorization" {
+			t.Errorf("Expected the preflight to allow the requested headers, got %q", w.Header().Get("Access-Control-Allow-Headers"))
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	h := CORSPreflight(next, []string{"https://status.example.com"})
+
+	for _, tc := range []struct {
+		method, origin string
+		preflight      bool
+		called         bool
+	}{
+		{method: http.MethodOptions, origin: "https://status.example.com", preflight: true},
+		// the preflight requests of other origins, and the other requests, are left to next
+		{method: http.MethodOptions, origin: "https://evil.example.com", preflight: true, called: true},
+		{method: http.MethodOptions, origin: "https://status.example.com", called: true},
+		{method: http.MethodGet, origin: "https://status.example.com", called: true},
+	} {
+		called = false
+		r := httptest.NewRequest(tc.method, "/api/v1/metrics", nil)
+		r.Header.Set("Origin", tc.origin)
+		if tc.preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if called != tc.called || !called && w.Code != http.StatusNoContent {
+			t.Errorf("%s from %q, preflight %v: expected next called %v, got %v and status %d", tc.method, tc.origin, tc.preflight, tc.called, called, w.Code)
+		}
+	}
+}
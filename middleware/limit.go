@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/time/rate"
+)
+
+// MaxInFlight rejects the requests beyond max in flight with status 503, 0 means no limit
+func MaxInFlight(next http.Handler, max int) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	inFlight := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+		default:
+			http.Error(w, "Limit of concurrent requests reached, try again later.", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimit rejects the requests beyond limit per second, with bursts of up to burst requests, with status 429.
+// A limit of 0 means no limit
+func RateLimit(next http.Handler, limit float64, burst int) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(limit), burst)
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / limit)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.Allow() {
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, "Rate limit of requests reached, try again later.", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// scrapeTimeoutHeader is set by Prometheus to the timeout of the scrape
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// ScrapeTimeout sets the deadline of the request context to the scrape timeout of Prometheus minus offset,
+// so that next can respond with what it got before Prometheus gives up on the scrape
+func ScrapeTimeout(next http.Handler, offset time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, err := scrapeTimeout(r.Header.Get(scrapeTimeoutHeader), offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scrapeTimeout returns the timeout of the header minus offset, the offset is ignored if it isn't less than
+// the timeout, and 0 means no timeout
+func scrapeTimeout(header string, offset time.Duration) (time.Duration, error) {
+	if header == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid %s header %q", scrapeTimeoutHeader, header)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if offset < timeout {
+		timeout -= offset
+	}
+	return timeout, nil
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScrapeTimeout(t *testing.T) {
+	testcases := []struct {
+		header   string
+		offset   time.Duration
+		expected time.Duration
+		err      bool
+	}{
+		{header: "", offset: 500 * time.Millisecond, expected: 0},
+		{header: "10", offset: 500 * time.Millisecond, expected: 9500 * time.Millisecond},
+		{header: "1.5", offset: 0, expected: 1500 * time.Millisecond},
+		{header: "0.4", offset: 500 * time.Millisecond, expected: 400 * time.Millisecond},
+		{header: "ten", offset: 500 * time.Millisecond, err: true},
+		{header: "-1", offset: 500 * time.Millisecond, err: true},
+	}
+
+	for _, tc := range testcases {
+		timeout, err := scrapeTimeout(tc.header, tc.offset)
+		if (err != nil) != tc.err {
+			t.Errorf("Unexpected error for header %q: %v", tc.header, err)
+			continue
+		}
+		if timeout != tc.expected {
+			t.Errorf("Expected timeout %s for header %q, got %s", tc.expected, tc.header, timeout)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/config"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// exit code of migrate-config if the config was written, but some arguments couldn't be converted
+const migratePartial = 2
+
+type migrateOptions struct {
+	input  string
+	output string
+}
+
+// addMigrateCommand adds the `migrate-config` command, which converts the flags of emqx-exporter v0.x to a config file
+func addMigrateCommand(app *kingpin.Application) (*kingpin.CmdClause, *migrateOptions) {
+	opts := &migrateOptions{}
+	cmd := app.Command("migrate-config", "Convert the arguments of emqx-exporter v0.x, the EMQX 4.x era, to a config file of the current schema, and report the ones which can't be converted.")
+	cmd.Arg("file", "File of the v0.x arguments, like the ExecStart line of a systemd unit or an args file, - for stdin.").Required().StringVar(&opts.input)
+	cmd.Flag("output", "File to write the config to rather than stdout.").Short('o').StringVar(&opts.output)
+	return cmd, opts
+}
+
+// legacyFlags are the flags of v0.x which moved to the config file, by how they set it.
+// They return the parts of the value which can't be converted, if any
+var legacyFlags = map[string]func(c *config.Config, value string) (unconverted string){
+	"emqx.nodes": func(c *config.Config, value string) string {
+		// the API of any node serves the whole cluster, so the others are only fallbacks, which aren't supported
+		nodes := strings.Split(value, ",")
+		target := strings.TrimSpace(nodes[0])
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			legacyMetrics(c).Scheme, target = u.Scheme, u.Host
+		}
+		legacyMetrics(c).Target = target
+		if len(nodes) > 1 {
+			return fmt.Sprintf("only the first node %s is used, the API of any node serves the whole cluster", target)
+		}
+		return ""
+	},
+	"emqx.auth-username": func(c *config.Config, value string) string {
+		legacyMetrics(c).APIKey = value
+		return ""
+	},
+	"emqx.auth-password": func(c *config.Config, value string) string {
+		legacyMetrics(c).APISecret = config.Secret(value)
+		return ""
+	},
+}
+
+func legacyMetrics(c *config.Config) *config.Metrics {
+	if c.Metrics == nil {
+		c.Metrics = &config.Metrics{}
+	}
+	return c.Metrics
+}
+
+// runMigrateConfig converts the arguments of the input of opts to a config written to the output of opts, or stdout.
+// The flags which the exporter still has are reported to be kept, and the arguments which can't be converted to stderr
+func runMigrateConfig(app *kingpin.Application, opts *migrateOptions, stdin io.Reader, stdout, stderr io.Writer) int {
+	var args []byte
+	var err error
+	if opts.input == "-" {
+		args, err = io.ReadAll(stdin)
+	} else {
+		args, err = os.ReadFile(opts.input)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error reading arguments:", err)
+		return 1
+	}
+
+	currentFlags := make(map[string]bool)
+	for _, flag := range app.Model().Flags {
+		currentFlags[flag.Name] = flag.IsBoolFlag()
+	}
+	c := &config.Config{}
+	var unconverted, kept []string
+	tokens := splitArgs(string(args))
+	// the binary started by the ExecStart line or a shell script
+	if len(tokens) > 0 && !strings.HasPrefix(tokens[0], "-") {
+		tokens = tokens[1:]
+	}
+	for i := 0; i < len(tokens); i++ {
+		flag := tokens[i]
+		if !strings.HasPrefix(flag, "--") {
+			unconverted = append(unconverted, fmt.Sprintf("%s: not a flag", flag))
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		isBool, current := currentFlags[name]
+		set, legacy := legacyFlags[name]
+		args := []string{flag}
+		// the value of an unknown flag is told by not being a flag
+		takesValue := legacy || current && !isBool || !current && i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1], "-")
+		if !hasValue && takesValue && i+1 < len(tokens) {
+			i++
+			value = tokens[i]
+			args = append(args, value)
+		}
+		switch {
+		case legacy:
+			if msg := set(c, value); msg != "" {
+				unconverted = append(unconverted, fmt.Sprintf("--%s: %s", name, msg))
+			}
+		case current:
+			kept = append(kept, args...)
+		default:
+			unconverted = append(unconverted, fmt.Sprintf("%s: unknown flag", strings.Join(args, " ")))
+		}
+	}
+	if c.Metrics == nil {
+		unconverted = append(unconverted, "no --emqx.nodes, so no metrics are collected")
+	}
+
+	// the config written is read back by the exporter, so the secrets are written as they are
+	config.MarshalSecretValue = true
+	defer func() { config.MarshalSecretValue = false }()
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(c); err != nil {
+		fmt.Fprintln(stderr, "Error marshalling config:", err)
+		return 1
+	}
+	if err = validateConfig(buf.Bytes()); err != nil {
+		fmt.Fprintln(stderr, "Error validating config:", err)
+		return 1
+	}
+	if opts.output == "" {
+		stdout.Write(buf.Bytes())
+	} else if err = os.WriteFile(opts.output, buf.Bytes(), 0o600); err != nil {
+		fmt.Fprintln(stderr, "Error writing config:", err)
+		return 1
+	}
+
+	if len(kept) > 0 {
+		fmt.Fprintln(stderr, "Flags to keep passing along with --config.file:", strings.Join(kept, " "))
+	}
+	for _, msg := range unconverted {
+		fmt.Fprintln(stderr, "Not converted:", msg)
+	}
+	if len(unconverted) > 0 {
+		return migratePartial
+	}
+	return 0
+}
+
+// splitArgs splits the arguments of s by white space, skipping the comments, line continuations and quotes.
+// Of a systemd unit, only the arguments of the ExecStart line and its continuations are kept
+func splitArgs(s string) []string {
+	var args []string
+	unquote := strings.NewReplacer(`"`, "", "'", "")
+	for _, line := range strings.Split(s, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			continue
+		}
+		if key, rest, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(key, "-") && !strings.ContainsAny(key, " \t") {
+			if key != "ExecStart" {
+				continue
+			}
+			line = rest
+		}
+		for _, field := range strings.Fields(line) {
+			if field != "\\" {
+				args = append(args, unquote.Replace(field))
+			}
+		}
+	}
+	return args
+}
+
+// validateConfig loads the config b like the exporter, with the defaults and checks of config.LoadConfig
+func validateConfig(b []byte) error {
+	dir, err := os.MkdirTemp("", "emqx-exporter-migrate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	if err = os.WriteFile(file, b, 0o600); err != nil {
+		return err
+	}
+	_, err = config.LoadConfig(file)
+	return err
+}
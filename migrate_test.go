@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/emqx/emqx-exporter/config"
+)
+
+func TestRunMigrateConfig(t *testing.T) {
+	app := kingpin.New("emqx-exporter", "")
+	app.Flag("web.listen-address", "").String()
+	app.Flag("web.disable-exporter-metrics", "").Bool()
+	dir := t.TempDir()
+
+	// an args file converted completely
+	opts := &migrateOptions{input: "-", output: filepath.Join(dir, "config.yaml")}
+	args := "--emqx.nodes=127.0.0.1:18083 # the node of the API\n--emqx.auth-username key --emqx.auth-password 'secret'\n"
+	var stdout, stderr bytes.Buffer
+	if code := runMigrateConfig(app, opts, strings.NewReader(args), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	c, err := config.LoadConfig(opts.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metrics.Target != "127.0.0.1:18083" || c.Metrics.APIKey != "key" || c.Metrics.APISecret != "secret" {
+		t.Errorf("Expected the metrics of the arguments with the secret as it is, got %+v", c.Metrics)
+	}
+
+	// the ExecStart line of a systemd unit, with flags kept and unknown
+	unit := `[Service]
+User=nobody
+ExecStart=/usr/local/bin/emqx-exporter \
+  --emqx.nodes="https://10.0.0.1:18083,10.0.0.2:18083" --emqx.auth-username=key --emqx.auth-password=secret \
+  --web.listen-address :8085 --web.disable-exporter-metrics --emqx.cluster-name prod
+`
+	opts = &migrateOptions{input: filepath.Join(dir, "emqx-exporter.service")}
+	if err = os.WriteFile(opts.input, []byte(unit), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := runMigrateConfig(app, opts, nil, &stdout, &stderr); code != migratePartial {
+		t.Fatalf("Expected exit code %d, got %d: %s", migratePartial, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "target: 10.0.0.1:18083\n  scheme: https\n") {
+		t.Errorf("Expected the first node with its scheme, got %s", stdout.String())
+	}
+	for _, line := range []string{
+		"Flags to keep passing along with --config.file: --web.listen-address :8085 --web.disable-exporter-metrics\n",
+		"Not converted: --emqx.nodes: only the first node 10.0.0.1:18083 is used",
+		"Not converted: --emqx.cluster-name prod: unknown flag\n",
+	} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Errorf("Expected %q in the report, got %s", line, stderr.String())
+		}
+	}
+	if strings.Contains(stderr.String(), "nobody") || strings.Contains(stderr.String(), "/usr/local/bin") {
+		t.Errorf("Expected only the arguments of ExecStart, got %s", stderr.String())
+	}
+}
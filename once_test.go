@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPushOnce(t *testing.T) {
+	if err := pushOnce(nil, nil, nil); err == nil {
+		t.Error("Expected --once to require a pushgateway")
+	}
+
+	pushed := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		pushed <- r.URL.Path + " " + string(b)
+	}))
+	defer server.Close()
+	gather := func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{{
+			Name:   proto.String("emqx_test_gauge"),
+			Help:   proto.String("A test gauge"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+		}}, nil
+	}
+	conf := &config.Pushgateway{URL: server.URL, Job: "emqx-exporter", Timeout: model.Duration(5 * time.Second)}
+	if err := pushOnce(map[string]*collector.Cluster{}, gather, conf); err != nil {
+		t.Fatal(err)
+	}
+	got := <-pushed
+	if !strings.HasPrefix(got, "/metrics/job/emqx-exporter ") || !strings.Contains(got, "emqx_test_gauge") {
+		t.Errorf("Expected the metrics gathered to be pushed for the job, got %q", got)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/version"
+)
+
+// object is a JSON object of the OpenAPI document
+type object = map[string]any
+
+// openAPIHandler serves /api/openapi.json, the OpenAPI document of the HTTP APIs of the exporter,
+// generated from the loaded config so that the clusters and the probe targets are enumerated
+func openAPIHandler(sc *config.SafeConfig, logLevel bool, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc.RLock()
+		doc, err := json.Marshal(openAPI(sc.C, logLevel))
+		sc.RUnlock()
+		if err != nil {
+			level.Warn(logger).Log("msg", "Error marshalling the OpenAPI document", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
+
+// openAPI returns the OpenAPI document of the endpoints of c, /-/loglevel is documented if logLevel is enabled
+func openAPI(c *config.Config, logLevel bool) object {
+	clusters := []string{}
+	if c.Metrics != nil {
+		clusters = append(clusters, "")
+	}
+	for _, cluster := range c.Clusters {
+		clusters = append(clusters, cluster.Name)
+	}
+	targets := []string{}
+	for _, probe := range c.Probes {
+		targets = append(targets, probe.Target)
+	}
+
+	clusterParam := object{
+		"name":        "cluster",
+		"in":          "query",
+		"description": "The name of the cluster of the clusters config, the cluster of the metrics config if empty",
+		"schema":      object{"type": "string", "enum": clusters},
+	}
+	collectParam := object{
+		"name":        "collect[]",
+		"in":          "query",
+		"description": "The collectors to run, all of them if not given",
+		"style":       "form",
+		"explode":     true,
+		"schema":      object{"type": "array", "items": object{"type": "string", "enum": collector.Names()}},
+	}
+	text := func(description string) object {
+		return object{"description": description, "content": object{"text/plain": object{"schema": object{"type": "string"}}}}
+	}
+	metrics := object{
+		"description": "The metrics in the Prometheus text or OpenMetrics format",
+		"content":     object{"text/plain": object{"schema": object{"type": "string"}}},
+	}
+
+	paths := object{
+		"/metrics": object{"get": object{
+			"summary":    "Metrics of an EMQX cluster and of the exporter",
+			"parameters": []object{clusterParam, collectParam},
+			"responses": object{
+				"200": metrics,
+				"400": text("The cluster or a collector is unknown"),
+				"429": text("Beyond --web.rate-limit"),
+				"503": text("Beyond --web.max-requests"),
+			},
+		}},
+		"/api/v1/metrics": object{"get": object{
+			"summary":    "Metrics of an EMQX cluster as JSON grouped by collector",
+			"parameters": []object{clusterParam, collectParam},
+			"responses": object{
+				"200": object{
+					"description": "The metrics grouped by collector",
+					"content":     object{"application/json": object{"schema": object{"$ref": "#/components/schemas/JSONMetrics"}}},
+				},
+				"400": text("The cluster or a collector is unknown"),
+				"429": text("Beyond --web.rate-limit"),
+				"503": text("Beyond --web.max-requests"),
+			},
+		}},
+		"/probe": object{"get": object{
+			"summary": "Probe an MQTT broker by the configured probe of the target",
+			"parameters": []object{{
+				"name":        "target",
+				"in":          "query",
+				"required":    true,
+				"description": "The target of one of the configured probes",
+				"schema":      object{"type": "string", "enum": targets},
+			}},
+			"responses": object{
+				"200": metrics,
+				"400": text("The target isn't configured"),
+				"429": text("Beyond --web.rate-limit"),
+				"503": text("Beyond --web.max-requests, or the scheduled probe didn't run yet"),
+			},
+		}},
+		"/healthz": object{"get": object{
+			"summary":   "Liveness of the exporter",
+			"responses": object{"200": text("The exporter is serving")},
+		}},
+		"/ready": object{"get": object{
+			"summary": "Readiness of the exporter",
+			"parameters": []object{{
+				"name":        "deep",
+				"in":          "query",
+				"description": "Verify the config file, the EMQX API and the probe targets are reachable, as --web.ready.deep does",
+				"schema":      object{"type": "boolean"},
+			}},
+			"responses": object{
+				"200": text("The exporter is ready"),
+				"503": text("The deep check failed"),
+			},
+		}},
+		"/config": object{"get": object{
+			"summary":   "The loaded configuration with the defaults filled and the secrets masked, like /api/v1/config",
+			"responses": object{"200": text("The configuration as YAML")},
+		}},
+		"/api/v1/config": object{"get": object{
+			"summary":   "The loaded configuration with the defaults filled and the secrets masked",
+			"responses": object{"200": text("The configuration as YAML")},
+		}},
+	}
+	if logLevel {
+		paths["/-/loglevel"] = object{
+			"get": object{
+				"summary":   "The current log level",
+				"responses": object{"200": text("The log level")},
+			},
+			"put": object{
+				"summary": "Set the log level for a while",
+				"parameters": []object{
+					{"name": "level", "in": "query", "required": true, "schema": object{"type": "string", "enum": []string{"debug", "info", "warn", "error"}}},
+					{"name": "duration", "in": "query", "description": "How long the level lasts, like 10m", "schema": object{"type": "string", "default": defaultLogLevelDuration.String()}},
+				},
+				"responses": object{
+					"200": text("The level set and its duration"),
+					"400": text("The level or the duration is invalid"),
+				},
+			},
+		}
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "EMQX Exporter",
+			"description": "Prometheus exporter and MQTT prober for EMQX",
+			"version":     version.Version,
+		},
+		"paths": paths,
+		"components": object{"schemas": object{
+			"JSONMetrics": object{
+				"type":     "object",
+				"required": []string{"timestamp", "collectors"},
+				"properties": object{
+					"cluster":    object{"type": "string", "description": "The name of the cluster, omitted for the default one"},
+					"timestamp":  object{"type": "integer", "format": "int64", "description": "The time of the collection in milliseconds"},
+					"leader":     object{"type": "boolean", "description": "Whether the replica collects the cluster, given only with leader election"},
+					"collectors": object{"type": "object", "additionalProperties": object{"$ref": "#/components/schemas/JSONCollector"}},
+				},
+			},
+			"JSONCollector": object{
+				"type":     "object",
+				"required": []string{"success", "metrics"},
+				"properties": object{
+					"success":  object{"type": "boolean"},
+					"degraded": object{"type": "boolean", "description": "Whether the collector is disabled to relieve the memory of the exporter"},
+					"error":    object{"type": "string"},
+					"metrics":  object{"type": "array", "items": object{"$ref": "#/components/schemas/JSONSample"}},
+				},
+			},
+			"JSONSample": object{
+				"type":        "object",
+				"description": "A sample of a metric, histograms and summaries are given by their _sum and _count",
+				"required":    []string{"name", "value"},
+				"properties": object{
+					"name":   object{"type": "string"},
+					"labels": object{"type": "object", "additionalProperties": object{"type": "string"}},
+					"value":  object{"type": "number"},
+				},
+			},
+		}},
+	}
+}
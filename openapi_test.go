@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	sc := config.NewSafeConfig(prometheus.NewRegistry())
+	sc.C = &config.Config{
+		Clusters: []config.Metrics{{Name: "eu"}, {Name: "us"}},
+		Probes:   []config.Probe{{Target: "127.0.0.1:1883"}},
+	}
+	w := httptest.NewRecorder()
+	openAPIHandler(sc, false, log.NewNopLogger()).ServeHTTP(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected a JSON document, got %q", ct)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					Enum  []string `json:"enum"`
+					Items struct {
+						Enum []string `json:"enum"`
+					} `json:"items"`
+				} `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/metrics", "/api/v1/metrics", "/probe", "/healthz", "/ready", "/config", "/api/v1/config"} {
+		if _, ok := doc.Paths[path]["get"]; !ok {
+			t.Errorf("Expected GET %s to be documented", path)
+		}
+	}
+	if _, ok := doc.Paths["/-/loglevel"]; ok {
+		t.Error("Expected /-/loglevel not to be documented while disabled")
+	}
+
+	params := doc.Paths["/api/v1/metrics"]["get"].Parameters
+	if len(params) != 2 || !reflect.DeepEqual(params[0].Schema.Enum, []string{"eu", "us"}) {
+		t.Errorf("Expected the clusters to be enumerated, got %+v", params)
+	} else if len(params[1].Schema.Items.Enum) == 0 {
+		t.Error("Expected the collectors to be enumerated")
+	}
+	params = doc.Paths["/probe"]["get"].Parameters
+	if len(params) != 1 || !reflect.DeepEqual(params[0].Schema.Enum, []string{"127.0.0.1:1883"}) {
+		t.Errorf("Expected the probe targets to be enumerated, got %+v", params)
+	}
+}
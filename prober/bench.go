@@ -0,0 +1,210 @@
+package prober
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/mqttutil"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// BenchOptions bound the synthetic load of Bench
+type BenchOptions struct {
+	// Connections is the number of clients connected to the target
+	Connections int
+	// Concurrency is the number of clients connecting at once
+	Concurrency int
+	// Rate is the number of messages per second published over all the clients
+	Rate float64
+	// Duration is how long the messages are published once the clients are connected
+	Duration time.Duration
+	// ConnectTimeout is the timeout of the connection of each client
+	ConnectTimeout time.Duration
+	// Drain is how long the messages published are waited for once the publishing stopped
+	Drain time.Duration
+}
+
+// BenchResult are the counts and latencies measured by Bench
+type BenchResult struct {
+	// Connect are the latencies of the CONNECT of the clients which connected
+	Connect       []time.Duration
+	ConnectFailed int
+	// ConnectionLost is the number of clients which lost their connection during the bench
+	ConnectionLost int
+	Sent           int
+	PublishFailed  int
+	// RoundTrip are the latencies from the publishing of the messages received to their delivery back
+	RoundTrip []time.Duration
+}
+
+// Lost returns the number of messages published, but not received
+func (r *BenchResult) Lost() int {
+	return r.Sent - r.PublishFailed - len(r.RoundTrip)
+}
+
+// benchClient is a client of Bench, which subscribes to a topic of its own
+type benchClient struct {
+	client mqtt.Client
+	topic  string
+}
+
+// Bench connects opts.Connections clients to the target of probe, each subscribing to a topic of its own below
+// the topic of probe, and publishes opts.Rate messages per second round robin over them for opts.Duration.
+// The client IDs of the clients are suffixed with their index. It stops early if ctx is done
+func Bench(ctx context.Context, probe config.Probe, opts BenchOptions, logger log.Logger) *BenchResult {
+	var (
+		mu     sync.Mutex
+		result = &BenchResult{}
+		sentAt = make(map[uint64]time.Time)
+		lost   int64
+	)
+	onMessage := func(_ mqtt.Client, m mqtt.Message) {
+		if len(m.Payload()) != 8 {
+			return
+		}
+		now := time.Now()
+		seq := binary.BigEndian.Uint64(m.Payload())
+		mu.Lock()
+		defer mu.Unlock()
+		// duplicates of QoS 1 are only counted once
+		if start, ok := sentAt[seq]; ok {
+			delete(sentAt, seq)
+			result.RoundTrip = append(result.RoundTrip, now.Sub(start))
+		}
+	}
+
+	clients := make([]*benchClient, opts.Connections)
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := range clients {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			p := probe
+			p.ClientID = fmt.Sprintf("%s_%d", probe.ClientID, i)
+			connectCtx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+			defer cancel()
+			opt := newClientOptions(connectCtx, p).SetAutoReconnect(false)
+			opt.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+				level.Debug(logger).Log("msg", "Lost connection to MQTT broker", "client_id", p.ClientID, "err", err)
+				atomic.AddInt64(&lost, 1)
+			})
+			c := mqtt.NewClient(opt)
+			start := time.Now()
+			err := mqttutil.WaitToken(connectCtx, c.Connect())
+			took := time.Since(start)
+			topic := fmt.Sprintf("%s/%d", probe.Topic, i)
+			if err == nil {
+				err = mqttutil.WaitToken(connectCtx, c.Subscribe(topic, probe.QoS, onMessage))
+			}
+			if err != nil {
+				level.Debug(logger).Log("msg", "Failed to connect to MQTT broker", "client_id", p.ClientID, "err", err)
+				c.Disconnect(0)
+				mu.Lock()
+				result.ConnectFailed++
+				mu.Unlock()
+				return
+			}
+			mu.Lock()
+			result.Connect = append(result.Connect, took)
+			mu.Unlock()
+			clients[i] = &benchClient{client: c, topic: topic}
+		}(i)
+	}
+	wg.Wait()
+	defer func() {
+		for _, c := range clients {
+			if c != nil {
+				c.client.Disconnect(250)
+			}
+		}
+	}()
+
+	connected := make([]*benchClient, 0, len(clients))
+	for _, c := range clients {
+		if c != nil {
+			connected = append(connected, c)
+		}
+	}
+	if len(connected) == 0 || ctx.Err() != nil {
+		result.ConnectionLost = int(atomic.LoadInt64(&lost))
+		return result
+	}
+
+	// the messages due by now are published on each tick, which keeps the rate whatever the resolution of the ticker
+	var published sync.WaitGroup
+	ticker := time.NewTicker(10 * time.Millisecond)
+	start := time.Now()
+	timer := time.NewTimer(opts.Duration)
+publish:
+	for {
+		select {
+		case <-ctx.Done():
+			break publish
+		case <-timer.C:
+			break publish
+		case <-ticker.C:
+		}
+		due := int(time.Since(start).Seconds() * opts.Rate)
+		for ; result.Sent < due; result.Sent++ {
+			c := connected[result.Sent%len(connected)]
+			seq := uint64(result.Sent)
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, seq)
+			mu.Lock()
+			sentAt[seq] = time.Now()
+			mu.Unlock()
+			token := c.client.Publish(c.topic, probe.QoS, false, payload)
+			published.Add(1)
+			go func() {
+				defer published.Done()
+				if mqttutil.WaitToken(ctx, token) != nil {
+					mu.Lock()
+					delete(sentAt, seq)
+					result.PublishFailed++
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	ticker.Stop()
+	timer.Stop()
+	published.Wait()
+
+	// the messages still in flight are waited for, up to opts.Drain
+	drain := time.NewTimer(opts.Drain)
+	defer drain.Stop()
+	for {
+		mu.Lock()
+		pending := len(sentAt)
+		mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-drain.C:
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result.ConnectionLost = int(atomic.LoadInt64(&lost))
+	// the slice is copied, as the late messages may still be appended to it
+	result.RoundTrip = append([]time.Duration(nil), result.RoundTrip...)
+	return result
+}
@@ -0,0 +1,63 @@
+package prober
+
+import (
+	"context"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// assignedClientIDCollectors connects to the target of probe with an empty client ID over MQTT 5, and returns
+// whether the broker told the client ID it assigned, with the collectors of the result
+func assignedClientIDCollectors(ctx context.Context, probe config.Probe, logger log.Logger) (bool, []prometheus.Collector) {
+	assignedGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_client_id_assigned",
+		Help:        "Whether the broker assigned a client ID to the probe connecting without one",
+		ConstLabels: probeLabels(probe),
+	})
+	collectors := []prometheus.Collector{assignedGauge}
+
+	clientID, err := assignedClientID(ctx, probe)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to connect to MQTT broker over MQTT 5", "target", probe.Target, "err", err)
+		return false, collectors
+	}
+	if clientID == "" {
+		level.Debug(logger).Log("msg", "No client ID assigned by MQTT broker", "target", probe.Target)
+		return false, collectors
+	}
+	assignedGauge.Set(1)
+	labels := probeLabels(probe)
+	labels["client_id"] = clientID
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_assigned_client_id_info",
+		Help:        "The client ID the broker assigned to the probe connecting without one",
+		ConstLabels: labels,
+	})
+	info.Set(1)
+	return true, append(collectors, info)
+}
+
+// assignedClientID connects to the target of probe with an empty client ID over MQTT 5, and returns the
+// Assigned Client Identifier of the CONNACK, which is empty if the broker didn't tell one
+func assignedClientID(ctx context.Context, probe config.Probe) (id string, err error) {
+	ctx, span := tracing.Start(ctx, "mqtt5 connect")
+	defer func() { span.End(err) }()
+	conn, err := dialMQTT5(ctx, probe)
+	if err != nil {
+		return "", err
+	}
+	defer conn.close()
+	connack, err := conn.connect(mqtt5Connect{cleanStart: true, keepAlive: 30}, probe.Username, string(probe.Password))
+	if err != nil {
+		return "", err
+	}
+	return string(connack.properties[propAssignedClientID]), nil
+}
@@ -0,0 +1,95 @@
+package prober
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+// serveConnack accepts one MQTT 5 connection on l, and replies to its CONNECT with a CONNACK of the session present
+// flag and properties returned by reply
+func serveConnack(t *testing.T, l net.Listener, reply func(connect []byte) (bool, []byte)) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	c := &mqtt5Conn{conn: conn, r: bufio.NewReader(conn)}
+	packetType, body, err := c.readPacket()
+	if err != nil || packetType>>4 != packetConnect || len(body) < 7 || body[6] != 5 {
+		t.Errorf("Expected an MQTT 5 CONNECT, got packet type %d: %x %v", packetType>>4, body, err)
+		return
+	}
+	sessionPresent, properties := reply(body)
+	var ack byte
+	if sessionPresent {
+		ack = 1
+	}
+	body = append([]byte{ack, 0}, appendVarint(nil, len(properties))...)
+	c.writePacket(packetConnack<<4, append(body, properties...))
+	c.readPacket()
+}
+
+func TestAssignedClientID(t *testing.T) {
+	for name, test := range map[string]struct {
+		properties []byte
+		expected   string
+	}{
+		"assigned":     {properties: append([]byte{propAssignedClientID}, appendString(nil, "auto-1b2c")...), expected: "auto-1b2c"},
+		"not assigned": {properties: append([]byte{0x21}, 0, 10), expected: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go serveConnack(t, l, func(connect []byte) (bool, []byte) {
+				// flags, keep alive, no properties, and an empty client ID
+				if len(connect) < 13 || connect[10] != 0 || connect[11] != 0 || connect[12] != 0 {
+					t.Errorf("Expected an empty client ID, got %x", connect)
+				}
+				return false, test.properties
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			probe := config.Probe{Target: l.Addr().String(), Scheme: "tcp"}
+			id, err := assignedClientID(ctx, probe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != test.expected {
+				t.Errorf("Expected the client ID %q, got %q", test.expected, id)
+			}
+		})
+	}
+}
+
+func TestReadProperties(t *testing.T) {
+	var props []byte
+	props = append(props, 0x11, 0, 0, 0, 60)
+	props = append(append(props, propUserProperty), append(appendString(nil, "k"), appendString(nil, "v")...)...)
+	props = append(append(props, propReasonString), appendString(nil, "ok")...)
+	b := append(appendVarint(nil, len(props)), props...)
+	b = append(b, 0xFF)
+
+	properties, rest, err := readProperties(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(properties[propReasonString]) != "ok" || len(properties[0x11]) != 4 || len(properties[propUserProperty]) != 6 {
+		t.Errorf("Unexpected properties %v", properties)
+	}
+	if len(rest) != 1 || rest[0] != 0xFF {
+		t.Errorf("Expected the rest after the properties, got %x", rest)
+	}
+
+	if _, _, err = readProperties([]byte{3, propReasonString, 0, 5}); err == nil {
+		t.Error("Expected a truncated property to fail")
+	}
+}
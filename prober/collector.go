@@ -0,0 +1,68 @@
+// Package prober probes MQTT brokers by publishing a message and waiting for it to be delivered back.
+//
+// It can be embedded into another program, which registers the probes to its own registry with New
+// and the config.Probe built in code, rather than running the exporter as a separate process.
+package prober
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector probes its targets in parallel on every collection, for up to its timeout.
+// It's how the probes are run when embedded into another program, rather than on the `/probe` requests
+type Collector struct {
+	probes  []config.Probe
+	timeout time.Duration
+	opts    HandlerOpts
+	logger  log.Logger
+}
+
+// New validates the probes and fills their defaults like the config file, and registers a Collector of them to reg,
+// which probes every target for up to timeout on each collection
+func New(probes []config.Probe, timeout time.Duration, opts HandlerOpts, reg prometheus.Registerer, logger log.Logger) (*Collector, error) {
+	completed := make([]config.Probe, len(probes))
+	targets := make(map[string]bool, len(probes))
+	for index, probe := range probes {
+		if targets[probe.Target] {
+			return nil, fmt.Errorf("probes[%d].target %q is duplicated", index, probe.Target)
+		}
+		targets[probe.Target] = true
+		if err := probe.Complete(index); err != nil {
+			return nil, err
+		}
+		completed[index] = probe
+	}
+	c := &Collector{probes: completed, timeout: timeout, opts: opts, logger: logger}
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Describe implements the prometheus.Collector interface.
+// The collector is unchecked, as the latency histograms are only collected with native histograms enabled
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements the prometheus.Collector interface
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, probe := range c.probes {
+		wg.Add(1)
+		go func(probe config.Probe) {
+			defer wg.Done()
+			for _, collector := range probeCollectors(ctx, probe, c.opts, c.logger) {
+				collector.Collect(ch)
+			}
+		}(probe)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,51 @@
+package prober
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNew(t *testing.T) {
+	// a listener which never completes the MQTT handshake, like a hung broker
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	reg := prometheus.NewRegistry()
+	if _, err = New([]config.Probe{{}}, time.Second, HandlerOpts{}, reg, log.NewNopLogger()); err == nil || err.Error() != "probes[0].target is required" {
+		t.Errorf("Expected the target to be required, got %v", err)
+	}
+
+	if _, err = New([]config.Probe{{Target: "emqx:1883"}, {Name: "other", Target: "emqx:1883"}}, time.Second, HandlerOpts{}, reg, log.NewNopLogger()); err == nil {
+		t.Error("Expected the probes of the same target to be rejected")
+	}
+
+	probes := []config.Probe{{Target: l.Addr().String()}}
+	if _, err = New(probes, 200*time.Millisecond, HandlerOpts{}, reg, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if probes[0].ClientID != "" {
+		t.Error("Expected the probes passed not to be modified")
+	}
+	begin := time.Now()
+	expected := `
+# HELP emqx_mqtt_probe_success Displays whether or not the probe was a success
+# TYPE emqx_mqtt_probe_success gauge
+emqx_mqtt_probe_success{target="` + l.Addr().String() + `"} 0
+`
+	if err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "emqx_mqtt_probe_success"); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("Expected the probe to time out after 200ms, took %s", elapsed)
+	}
+}
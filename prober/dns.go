@@ -0,0 +1,54 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dnsCollectors resolves the host of the target of probe, and returns whether it resolved, with the collectors of
+// the lookup duration and of the IP the client dials first. So a slow DNS is told apart from a slow broker
+func dnsCollectors(ctx context.Context, probe config.Probe, logger log.Logger) (bool, []prometheus.Collector) {
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_dns_lookup_duration_seconds",
+		Help:        "Returns how long the DNS lookup of the target took in seconds",
+		ConstLabels: probeLabels(probe),
+	})
+	collectors := []prometheus.Collector{durationGauge}
+
+	host, _, err := net.SplitHostPort(probe.Target)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid probe target", "target", probe.Target, "err", err)
+		return false, collectors
+	}
+	_, span := tracing.Start(ctx, "dns lookup")
+	span.SetAttributes("host", host)
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	durationGauge.Set(time.Since(start).Seconds())
+	span.End(err)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to resolve the probe target", "target", probe.Target, "err", err)
+		return false, collectors
+	}
+
+	labels := probeLabels(probe)
+	labels["ip"] = addrs[0].String()
+	ipInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_resolved_ip_info",
+		Help:        "The IP the target resolved to, which the probe client dials first",
+		ConstLabels: labels,
+	})
+	ipInfo.Set(1)
+	return true, append(collectors, ipInfo)
+}
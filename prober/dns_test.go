@@ -0,0 +1,41 @@
+package prober
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDNSCollectors(t *testing.T) {
+	resolved, collectors := dnsCollectors(context.Background(), config.Probe{Target: "127.0.0.1:1883"}, log.NewNopLogger())
+	if !resolved || len(collectors) != 2 {
+		t.Fatalf("Expected the target to resolve, got %v with %d collectors", resolved, len(collectors))
+	}
+	expected := `
+# HELP emqx_mqtt_probe_resolved_ip_info The IP the target resolved to, which the probe client dials first
+# TYPE emqx_mqtt_probe_resolved_ip_info gauge
+emqx_mqtt_probe_resolved_ip_info{ip="127.0.0.1",target="127.0.0.1:1883"} 1
+`
+	if err := testutil.CollectAndCompare(collectors[1], strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// the name of the probe labels its metrics along with the target
+	_, collectors = dnsCollectors(context.Background(), config.Probe{Name: "local", Target: "127.0.0.1:1883"}, log.NewNopLogger())
+	expected = `
+# HELP emqx_mqtt_probe_resolved_ip_info The IP the target resolved to, which the probe client dials first
+# TYPE emqx_mqtt_probe_resolved_ip_info gauge
+emqx_mqtt_probe_resolved_ip_info{ip="127.0.0.1",name="local",target="127.0.0.1:1883"} 1
+`
+	if err := testutil.CollectAndCompare(collectors[1], strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	if resolved, _ = dnsCollectors(context.Background(), config.Probe{Target: "emqx.invalid:1883"}, log.NewNopLogger()); resolved {
+		t.Error("Expected the .invalid domain not to resolve")
+	}
+}
@@ -0,0 +1,161 @@
+package prober
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// flowQuiet is how long the subscriber of the flow control check waits for more messages before it considers
+// the broker stopped sending
+const flowQuiet = 200 * time.Millisecond
+
+// flowViolations keeps the counter of the flow control violations of each target across probes
+var flowViolations = struct {
+	sync.Mutex
+	counters map[probeKey]prometheus.Counter
+}{counters: make(map[probeKey]prometheus.Counter)}
+
+func flowViolationsCounter(labels prometheus.Labels) prometheus.Counter {
+	flowViolations.Lock()
+	defer flowViolations.Unlock()
+	c, ok := flowViolations.counters[keyOf(labels)]
+	if !ok {
+		c = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "emqx",
+			Subsystem:   "mqtt",
+			Name:        "probe_receive_maximum_violations_total",
+			Help:        "How many probes the broker sent more QoS 1 messages unacknowledged than the Receive Maximum of the subscriber",
+			ConstLabels: labels,
+		})
+		flowViolations.counters[keyOf(labels)] = c
+	}
+	return c
+}
+
+// flowCollectors checks the broker honors the Receive Maximum of probe, and returns whether it did, with the collectors
+// of the violations and the most messages in flight
+func flowCollectors(ctx context.Context, probe config.Probe, logger log.Logger) (bool, []prometheus.Collector) {
+	violations := flowViolationsCounter(probeLabels(probe))
+	inFlightGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_receive_maximum_in_flight",
+		Help:        "The most QoS 1 messages the broker sent unacknowledged to the subscriber with the Receive Maximum of the probe",
+		ConstLabels: probeLabels(probe),
+	})
+	collectors := []prometheus.Collector{violations, inFlightGauge}
+
+	inFlight, err := checkFlowControl(ctx, probe)
+	inFlightGauge.Set(float64(inFlight))
+	if inFlight > int(probe.ReceiveMaximum) {
+		violations.Inc()
+		level.Error(logger).Log("msg", "MQTT broker exceeded the Receive Maximum", "target", probe.Target, "receive_maximum", probe.ReceiveMaximum, "in_flight", inFlight)
+		return false, collectors
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to check the flow control of MQTT broker", "target", probe.Target, "err", err)
+		return false, collectors
+	}
+	return true, collectors
+}
+
+// checkFlowControl subscribes to a topic below the one of probe over MQTT 5 with its Receive Maximum, publishes twice
+// as many QoS 1 messages to it from another client, and receives them by acknowledging the messages in flight
+// whenever the broker stops sending. It returns the most messages in flight, which exceeds the Receive Maximum
+// if the broker didn't honor it, and an error if not all messages were received
+func checkFlowControl(ctx context.Context, probe config.Probe) (maxInFlight int, err error) {
+	ctx, span := tracing.Start(ctx, "mqtt5 flow control")
+	defer func() { span.End(err) }()
+	topic := probe.Topic + "/flow"
+	sub, err := dialMQTT5(ctx, probe)
+	if err != nil {
+		return 0, err
+	}
+	defer sub.close()
+	receiveMaximum := binary.BigEndian.AppendUint16([]byte{propReceiveMaximum}, probe.ReceiveMaximum)
+	connect := mqtt5Connect{clientID: flowClientID(probe, "_flow_sub"), cleanStart: true, keepAlive: 30, properties: receiveMaximum}
+	if _, err = sub.connect(connect, probe.Username, string(probe.Password)); err != nil {
+		return 0, err
+	}
+	if err = sub.subscribe(1, topic, 1); err != nil {
+		return 0, err
+	}
+
+	pub, err := dialMQTT5(ctx, probe)
+	if err != nil {
+		return 0, err
+	}
+	defer pub.close()
+	connect = mqtt5Connect{clientID: flowClientID(probe, "_flow_pub"), cleanStart: true, keepAlive: 30}
+	if _, err = pub.connect(connect, probe.Username, string(probe.Password)); err != nil {
+		return 0, err
+	}
+	total := 2 * int(probe.ReceiveMaximum)
+	for i := 1; i <= total; i++ {
+		if err = pub.publish(uint16(i), topic, binary.BigEndian.AppendUint16(nil, uint16(i))); err != nil {
+			return 0, err
+		}
+	}
+
+	received := make(map[uint16]bool, total)
+	var inFlight []uint16
+	for len(received) < total {
+		p, err := sub.readPublish(ctx, flowQuiet)
+		if err != nil {
+			return maxInFlight, err
+		}
+		if p == nil {
+			// the broker stopped sending, which it may only do with the window full if it honors the Receive Maximum
+			if len(inFlight) == 0 {
+				return maxInFlight, fmt.Errorf("received %d of the %d messages", len(received), total)
+			}
+			for _, id := range inFlight {
+				if err = sub.puback(id); err != nil {
+					return maxInFlight, err
+				}
+			}
+			inFlight = inFlight[:0]
+			continue
+		}
+		if p.topic != topic || len(p.payload) != 2 {
+			continue
+		}
+		if p.qos > 0 && !containsPacketID(inFlight, p.packetID) {
+			inFlight = append(inFlight, p.packetID)
+			if len(inFlight) > maxInFlight {
+				maxInFlight = len(inFlight)
+			}
+		}
+		received[binary.BigEndian.Uint16(p.payload)] = true
+	}
+	for _, id := range inFlight {
+		sub.puback(id)
+	}
+	return maxInFlight, nil
+}
+
+// flowClientID returns the client ID of probe with suffix, or an empty one for the broker to assign if probe has none
+func flowClientID(probe config.Probe, suffix string) string {
+	if probe.ClientID == "" {
+		return ""
+	}
+	return probe.ClientID + suffix
+}
+
+func containsPacketID(ids []uint16, id uint16) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
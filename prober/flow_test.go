@@ -0,0 +1,113 @@
+package prober
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// serveFlow accepts the subscriber and the publisher of the flow control check on l, and delivers the messages
+// published to the subscriber with up to window of them unacknowledged
+func serveFlow(t *testing.T, l net.Listener, window int) {
+	accept := func() *mqtt5Conn {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil
+		}
+		c := &mqtt5Conn{conn: conn, r: bufio.NewReader(conn)}
+		if packetType, _, err := c.readPacket(); err != nil || packetType>>4 != packetConnect {
+			t.Errorf("Expected a CONNECT, got packet type %d: %v", packetType>>4, err)
+		}
+		c.writePacket(packetConnack<<4, []byte{0, 0, 0})
+		return c
+	}
+	sub := accept()
+	if sub == nil {
+		return
+	}
+	defer sub.conn.Close()
+	_, body, _ := sub.readPacket()
+	sub.writePacket(packetSuback<<4, append(body[:2:2], 0, 1))
+	topic := string(body[5 : len(body)-1])
+
+	pub := accept()
+	if pub == nil {
+		return
+	}
+	defer pub.conn.Close()
+	var payloads [][]byte
+	for {
+		header, body, err := pub.readPacket()
+		if err != nil || header>>4 != packetPublish {
+			break
+		}
+		id := body[2+len(topic):][:2]
+		payloads = append(payloads, body[2+len(topic)+3:])
+		pub.writePacket(packetPuback<<4, id)
+		if len(payloads) == 4 {
+			break
+		}
+	}
+
+	inFlight := 0
+	for next := 0; next < len(payloads); {
+		for ; inFlight < window && next < len(payloads); next++ {
+			body := appendString(nil, topic)
+			body = binary.BigEndian.AppendUint16(body, uint16(next+1))
+			body = append(append(body, 0), payloads[next]...)
+			sub.writePacket(packetPublish<<4|0x02, body)
+			inFlight++
+		}
+		if header, _, err := sub.readPacket(); err != nil || header>>4 != packetPuback {
+			return
+		}
+		inFlight--
+	}
+	for {
+		if header, _, err := sub.readPacket(); err != nil || header>>4 == packetDisconnect {
+			return
+		}
+	}
+}
+
+func TestFlowCollectors(t *testing.T) {
+	for name, test := range map[string]struct {
+		window   int
+		honored  bool
+		inFlight float64
+	}{
+		"honored":  {window: 2, honored: true, inFlight: 2},
+		"exceeded": {window: 3, honored: false, inFlight: 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go serveFlow(t, l, test.window)
+
+			probe := config.Probe{Target: l.Addr().String(), Scheme: "tcp", ClientID: "probe", Topic: "probe-" + name, ReceiveMaximum: 2}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			violations := testutil.ToFloat64(flowViolationsCounter(probeLabels(probe)))
+			honored, collectors := flowCollectors(ctx, probe, log.NewNopLogger())
+			if honored != test.honored {
+				t.Errorf("Expected the Receive Maximum honored to be %v", test.honored)
+			}
+			if inFlight := testutil.ToFloat64(collectors[1]); inFlight != test.inFlight {
+				t.Errorf("Expected %v messages in flight at most, got %v", test.inFlight, inFlight)
+			}
+			if v := testutil.ToFloat64(collectors[0]) - violations; (v == 1) == test.honored {
+				t.Errorf("Unexpected %v violations", v)
+			}
+		})
+	}
+}
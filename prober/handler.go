@@ -1,69 +1,217 @@
 package prober
 
 import (
-	"emqx-exporter/config"
+	"context"
 
 	"fmt"
 
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func Handler(w http.ResponseWriter, r *http.Request, probes []config.Probe, logger log.Logger, params url.Values) {
-	var probe config.Probe
+// HandlerOpts specifies options how to serve probe results
+type HandlerOpts struct {
+	// EnableNativeHistograms exposes the latencies of all probes to a target as a histogram
+	// with both classic and native (sparse) buckets, and exemplars linking to the traced probes
+	EnableNativeHistograms bool
+}
+
+// probeKey tells apart the metrics kept across probes, by the target and the name of the probe
+type probeKey struct {
+	target string
+	name   string
+}
+
+func keyOf(labels prometheus.Labels) probeKey {
+	return probeKey{target: labels["target"], name: labels["name"]}
+}
+
+// probeLabels returns the labels of the metrics of probe, which are its target and its name if any
+func probeLabels(probe config.Probe) prometheus.Labels {
+	labels := prometheus.Labels{"target": probe.Target}
+	if probe.Name != "" {
+		labels["name"] = probe.Name
+	}
+	return labels
+}
+
+// probeLatencies keeps the latency histogram of each target across probes
+var probeLatencies = struct {
+	sync.Mutex
+	histograms map[probeKey]prometheus.Histogram
+}{histograms: make(map[probeKey]prometheus.Histogram)}
+
+func probeLatencyHistogram(labels prometheus.Labels) prometheus.Histogram {
+	probeLatencies.Lock()
+	defer probeLatencies.Unlock()
+	h, ok := probeLatencies.histograms[keyOf(labels)]
+	if !ok {
+		h = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:                       "emqx",
+			Subsystem:                       "mqtt",
+			Name:                            "probe_latency_seconds",
+			Help:                            "Histogram of how long the probes took to complete in seconds",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: time.Hour,
+			ConstLabels:                     labels,
+		})
+		probeLatencies.histograms[keyOf(labels)] = h
+	}
+	return h
+}
+
+// Forget drops what's kept across the probes of the targets which aren't among probes anymore, their counters, histograms
+// and TLS sessions, and disconnects their clients. So the series of a removed target start over if it's probed again,
+// rather than from the values it had last
+func Forget(probes []config.Probe) {
+	keep := make(map[probeKey]struct{}, len(probes))
+	targets := make(map[string]struct{}, len(probes))
+	for _, probe := range probes {
+		keep[keyOf(probeLabels(probe))] = struct{}{}
+		targets[probe.Target] = struct{}{}
+	}
+	forgetKeys(&probeLatencies.Mutex, probeLatencies.histograms, keep)
+	forgetKeys(&outOfOrder.Mutex, outOfOrder.counters, keep)
+	forgetKeys(&flowViolations.Mutex, flowViolations.counters, keep)
+	forgetKeys(&tlsSessions.Mutex, tlsSessions.caches, keep)
+
+	manager.Lock()
+	defer manager.Unlock()
+	for target, probe := range manager.probes {
+		if _, ok := targets[target]; ok {
+			continue
+		}
+		if probe != nil {
+			probe.Client.Disconnect(0)
+		}
+		delete(manager.probes, target)
+	}
+}
+
+// forgetKeys deletes the entries of m not in keep, holding mu
+func forgetKeys[V any](mu *sync.Mutex, m map[probeKey]V, keep map[probeKey]struct{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key := range m {
+		if _, ok := keep[key]; !ok {
+			delete(m, key)
+		}
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request, probes []config.Probe, opts HandlerOpts, logger log.Logger, params url.Values) {
 	if params == nil {
 		params = r.URL.Query()
 	}
 	target := params.Get("target")
-	for i := 0; i < len(probes); i++ {
-		if probes[i].Target == target {
-			probe = probes[i]
-			break
-		}
-	}
-	if probe.Target == "" {
+	probe, ok := findProbe(probes, target)
+	if !ok {
 		http.Error(w, fmt.Sprintf("Unknown probe target %q", target), http.StatusBadRequest)
 		level.Debug(logger).Log("msg", "Unknown probe target", "target", target)
 		return
 	}
 
+	registry := Probe(tracing.FromRequest(r), probe, opts, logger)
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true, DisableCompression: true})
+	h.ServeHTTP(w, r)
+}
+
+// findProbe returns the probe of target among probes
+func findProbe(probes []config.Probe, target string) (config.Probe, bool) {
+	for i := 0; i < len(probes); i++ {
+		if probes[i].Target == target {
+			return probes[i], true
+		}
+	}
+	return config.Probe{}, false
+}
+
+// Probe probes the target on behalf of ctx, and returns a registry of the results
+func Probe(ctx context.Context, probe config.Probe, opts HandlerOpts, logger log.Logger) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeCollectors(ctx, probe, opts, logger)...)
+	return registry
+}
+
+// probeCollectors probes the target on behalf of ctx, and returns the collectors of the results
+func probeCollectors(ctx context.Context, probe config.Probe, opts HandlerOpts, logger log.Logger) []prometheus.Collector {
 	probeSuccessGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "emqx",
-		Subsystem: "mqtt",
-		Name:      "probe_success",
-		Help:      "Displays whether or not the probe was a success",
-		ConstLabels: prometheus.Labels{
-			"target": probe.Target,
-		},
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_success",
+		Help:        "Displays whether or not the probe was a success",
+		ConstLabels: probeLabels(probe),
 	})
 	probeDurationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "emqx",
-		Subsystem: "mqtt",
-		Name:      "probe_duration_seconds",
-		Help:      "Returns how long the probe took to complete in seconds",
-		ConstLabels: prometheus.Labels{
-			"target": probe.Target,
-		},
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_duration_seconds",
+		Help:        "Returns how long the probe took to complete in seconds",
+		ConstLabels: probeLabels(probe),
 	})
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(probeSuccessGauge)
-	registry.MustRegister(probeDurationGauge)
+	collectors := []prometheus.Collector{probeSuccessGauge, probeDurationGauge}
 
+	if probe.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(probe.Timeout))
+		defer cancel()
+	}
+	ctx, span := tracing.Start(ctx, "probe")
+	span.SetAttributes("target", probe.Target)
+	defer span.End(nil)
+	// resolved aside from the duration of the probe, which the client may not dial
+	resolved, dns := dnsCollectors(ctx, probe, logger)
+	collectors = append(collectors, dns...)
 	start := time.Now()
-	if ProbeMQTT(probe, logger) {
+	success := ProbeMQTT(ctx, probe, logger) && resolved
+	duration := time.Since(start).Seconds()
+	probeDurationGauge.Set(duration)
+	if probe.QoS > 0 {
+		collectors = append(collectors, outOfOrderCounter(probeLabels(probe)))
+	}
+	// the MQTT 5 checks are aside from the duration, which stays comparable to the probes of the other targets
+	if probe.SessionExpiryInterval != 0 {
+		connected, session := sessionCollectors(ctx, probe, logger)
+		collectors = append(collectors, session...)
+		success = success && connected
+	}
+	if probe.ReceiveMaximum != 0 {
+		honored, flow := flowCollectors(ctx, probe, logger)
+		collectors = append(collectors, flow...)
+		success = success && honored
+	}
+	if probe.AssignClientID {
+		assigned, assignment := assignedClientIDCollectors(ctx, probe, logger)
+		collectors = append(collectors, assignment...)
+		if probe.ExpectAssignedClientID && !assigned {
+			success = false
+		}
+	}
+	if success {
 		probeSuccessGauge.Set(1)
 	} else {
 		probeSuccessGauge.Set(0)
 	}
-	probeDurationGauge.Set(time.Since(start).Seconds())
-
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	if opts.EnableNativeHistograms {
+		latency := probeLatencyHistogram(probeLabels(probe))
+		if exemplar := tracing.Exemplar(ctx); exemplar != nil {
+			latency.(prometheus.ExemplarObserver).ObserveWithExemplar(duration, exemplar)
+		} else {
+			latency.Observe(duration)
+		}
+		collectors = append(collectors, latency)
+	}
+	return collectors
 }
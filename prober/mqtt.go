@@ -2,18 +2,56 @@ package prober
 
 import (
 	"context"
-	"emqx-exporter/config"
+	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/mqttutil"
+	"github.com/emqx/emqx-exporter/tracing"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type MQTTProbe struct {
 	Client  mqtt.Client
 	MsgChan <-chan mqtt.Message
+	// labels of the metrics of the probe
+	labels prometheus.Labels
+	// sent and received are the sequence numbers of the last message published and received by the client
+	sent     atomic.Uint64
+	received atomic.Uint64
+}
+
+// probePayload prefixes the sequence number of the messages of the probes
+const probePayload = "hello world "
+
+// outOfOrder keeps the counter of the messages received out of order of each target across probes
+var outOfOrder = struct {
+	sync.Mutex
+	counters map[probeKey]prometheus.Counter
+}{counters: make(map[probeKey]prometheus.Counter)}
+
+func outOfOrderCounter(labels prometheus.Labels) prometheus.Counter {
+	outOfOrder.Lock()
+	defer outOfOrder.Unlock()
+	c, ok := outOfOrder.counters[keyOf(labels)]
+	if !ok {
+		c = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "emqx",
+			Subsystem:   "mqtt",
+			Name:        "probe_out_of_order_messages_total",
+			Help:        "How many QoS 1 or 2 messages of the probes were received after a message published later",
+			ConstLabels: labels,
+		})
+		outOfOrder.counters[keyOf(labels)] = c
+	}
+	return c
 }
 
 type mqttProbeManager struct {
@@ -30,7 +68,6 @@ func init() {
 	go func() {
 		for {
 			manager.Lock()
-			defer manager.Unlock()
 			for target, probe := range manager.probes {
 				if probe == nil {
 					delete(manager.probes, target)
@@ -52,11 +89,24 @@ func init() {
 	}()
 }
 
-func initMQTTProbe(probe config.Probe, logger log.Logger) (*MQTTProbe, error) {
-	opt := mqtt.NewClientOptions().AddBroker(probe.Scheme + "://" + probe.Target).SetClientID(probe.ClientID).SetUsername(probe.Username).SetPassword(probe.Password)
-	if probe.TLSClientConfig != nil {
-		opt.SetTLSConfig(probe.TLSClientConfig.ToTLSConfig())
+// newClientOptions returns the options of a client of the probe, which doesn't dial for longer than ctx allows
+func newClientOptions(ctx context.Context, probe config.Probe) *mqtt.ClientOptions {
+	opt := mqtt.NewClientOptions().AddBroker(probe.Scheme + "://" + probe.Target).SetClientID(probe.ClientID).SetUsername(probe.Username).SetPassword(string(probe.Password))
+	if conf := tlsConfig(probe); conf != nil {
+		opt.SetTLSConfig(conf)
+	}
+	if probe.CleanStart != nil {
+		opt.SetCleanSession(*probe.CleanStart)
+	}
+	// don't dial for longer than the probe may take
+	if deadline, ok := ctx.Deadline(); ok {
+		opt.SetConnectTimeout(time.Until(deadline))
 	}
+	return opt
+}
+
+func initMQTTProbe(ctx context.Context, probe config.Probe, logger log.Logger) (*MQTTProbe, error) {
+	opt := newClientOptions(ctx, probe)
 	opt.SetOnConnectHandler(func(c mqtt.Client) {
 		level.Info(logger).Log("msg", "Connected to MQTT broker", "target", probe.Target)
 	})
@@ -64,9 +114,14 @@ func initMQTTProbe(probe config.Probe, logger log.Logger) (*MQTTProbe, error) {
 		level.Error(logger).Log("msg", "Lost connection to MQTT broker", "target", probe.Target, "err", err)
 	})
 	c := mqtt.NewClient(opt)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		level.Error(logger).Log("msg", "Failed to connect to MQTT broker", "target", probe.Target, "err", token.Error())
-		return nil, token.Error()
+	_, span := tracing.Start(ctx, "mqtt connect")
+	err := mqttutil.WaitToken(ctx, c.Connect())
+	span.End(err)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to connect to MQTT broker", "target", probe.Target, "err", err)
+		// stop connecting in the background if the probe timed out
+		c.Disconnect(0)
+		return nil, err
 	}
 
 	var msgChan = make(chan mqtt.Message)
@@ -80,37 +135,129 @@ func initMQTTProbe(probe config.Probe, logger log.Logger) (*MQTTProbe, error) {
 	return &MQTTProbe{
 		Client:  c,
 		MsgChan: msgChan,
+		labels:  probeLabels(probe),
 	}, nil
 }
 
-func ProbeMQTT(probe config.Probe, logger log.Logger) bool {
+// ProbeMQTT publishes a message to the target and waits for it to be delivered back,
+// it fails if that doesn't complete before ctx is done
+func ProbeMQTT(ctx context.Context, probe config.Probe, logger log.Logger) bool {
+	if probe.ColdConnect {
+		// a client of its own, disconnected once done, for the probe to take the connect and the handshake
+		mqttProbe, err := initMQTTProbe(ctx, probe, logger)
+		if err != nil {
+			return false
+		}
+		defer mqttProbe.disconnect()
+		return mqttProbe.probe(ctx, probe)
+	}
+
+	// the probes of the targets run at once, while the clients of the removed targets are forgotten
+	manager.RLock()
 	mqttProbe, ok := manager.probes[probe.Target]
+	manager.RUnlock()
 	if !ok {
-		var err error
-		if mqttProbe, err = initMQTTProbe(probe, logger); err != nil {
+		created, err := initMQTTProbe(ctx, probe, logger)
+		if err != nil {
 			return false
 		}
 		manager.Lock()
-		defer manager.Unlock()
-		manager.probes[probe.Target] = mqttProbe
+		if mqttProbe, ok = manager.probes[probe.Target]; !ok {
+			mqttProbe = created
+			manager.probes[probe.Target] = mqttProbe
+		}
+		manager.Unlock()
+		// another probe of the target created a client meanwhile
+		if mqttProbe != created {
+			created.disconnect()
+		}
 	}
 
 	if !mqttProbe.Client.IsConnected() {
 		return false
 	}
+	return mqttProbe.probe(ctx, probe)
+}
 
-	if token := mqttProbe.Client.Publish(probe.Topic, probe.QoS, false, "hello world"); token.Wait() && token.Error() != nil {
+// probe publishes a message of probe with the client and waits for it to be delivered back
+func (p *MQTTProbe) probe(ctx context.Context, probe config.Probe) bool {
+	seq := p.sent.Add(1)
+	_, span := tracing.Start(ctx, "mqtt publish")
+	span.SetAttributes("topic", probe.Topic, "qos", int(probe.QoS))
+	err := mqttutil.WaitToken(ctx, p.Client.Publish(probe.Topic, probe.QoS, false, probePayload+strconv.FormatUint(seq, 10)))
+	span.End(err)
+	if err != nil {
 		return false
 	}
 
-	select {
-	case msg := <-mqttProbe.MsgChan:
-		if msg == nil {
+	_, span = tracing.Start(ctx, "mqtt receive")
+	defer func() { span.End(err) }()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-p.MsgChan:
+			if msg == nil {
+				err = errors.New("no message received")
+				return false
+			}
+			// the messages of the earlier probes which timed out may still be delivered
+			if received, ok := p.receive(msg); ok && received >= seq {
+				return true
+			}
+		case <-timeout:
+			err = errors.New("message not received within 5s")
+			return false
+		case <-ctx.Done():
+			err = ctx.Err()
 			return false
 		}
-	case <-time.After(5 * time.Second):
-		return false
 	}
+}
+
+// disconnect disconnects the client, and drops the messages delivered meanwhile, which would block it otherwise
+func (p *MQTTProbe) disconnect() {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-p.MsgChan:
+			case <-done:
+				return
+			}
+		}
+	}()
+	p.Client.Disconnect(0)
+	close(done)
+}
+
+// receive returns the sequence number of msg, and counts it as out of order if it's a QoS 1 or 2 message published
+// before the last one received, as the brokers keep the order of those messages on a topic
+func (p *MQTTProbe) receive(msg mqtt.Message) (uint64, bool) {
+	s, ok := strings.CutPrefix(string(msg.Payload()), probePayload)
+	if !ok {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if last := p.received.Load(); seq < last && msg.Qos() > 0 {
+		outOfOrderCounter(p.labels).Inc()
+	} else if seq > last {
+		p.received.Store(seq)
+	}
+	return seq, true
+}
 
-	return true
+// DisconnectAll disconnects the clients of the probes, after waiting up to quiesce for their in-flight work.
+// The clean DISCONNECT prevents the broker from publishing their wills and keeping their sessions
+func DisconnectAll(quiesce time.Duration) {
+	manager.Lock()
+	defer manager.Unlock()
+	for target, probe := range manager.probes {
+		if probe != nil {
+			probe.Client.Disconnect(uint(quiesce.Milliseconds()))
+		}
+		delete(manager.probes, target)
+	}
 }
@@ -0,0 +1,378 @@
+package prober
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+// MQTT 5 packet types, in the high nibble of the first byte of a packet
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetDisconnect = 14
+)
+
+// MQTT 5 properties
+const (
+	propSubscriptionID   = 0x0B
+	propSessionExpiry    = 0x11
+	propAssignedClientID = 0x12
+	propReasonString     = 0x1F
+	propReceiveMaximum   = 0x21
+	propUserProperty     = 0x26
+)
+
+// mqtt5Conn is a minimal MQTT 5 client connection, for the checks of the probes which need the properties of MQTT 5
+// that the MQTT 3.1.1 client of the probes doesn't tell
+type mqtt5Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// mqtt5Connect are the options of the CONNECT packet
+type mqtt5Connect struct {
+	clientID   string
+	cleanStart bool
+	keepAlive  uint16
+	// properties are written as they are
+	properties []byte
+}
+
+// mqtt5Connack is a CONNACK packet
+type mqtt5Connack struct {
+	sessionPresent bool
+	reasonCode     byte
+	properties     mqtt5Properties
+}
+
+// mqtt5Publish is a PUBLISH packet
+type mqtt5Publish struct {
+	topic    string
+	qos      byte
+	dup      bool
+	packetID uint16
+	payload  []byte
+}
+
+// mqtt5Properties are the properties of a packet by identifier, of which only the last one is kept if repeated
+type mqtt5Properties map[byte][]byte
+
+// dialMQTT5 connects to the target of probe over TCP, or TLS for its secure schemes, for up to the deadline of ctx.
+// The WebSocket schemes aren't supported
+func dialMQTT5(ctx context.Context, probe config.Probe) (*mqtt5Conn, error) {
+	host, _, err := net.SplitHostPort(probe.Target)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	switch probe.Scheme {
+	case "tcp", "mqtt":
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", probe.Target)
+	case "ssl", "tls", "mqtts":
+		conf := tlsConfig(probe)
+		if conf.ServerName == "" {
+			conf.ServerName = host
+		}
+		conn, err = (&tls.Dialer{Config: conf}).DialContext(ctx, "tcp", probe.Target)
+	default:
+		return nil, fmt.Errorf("MQTT 5 checks don't support the scheme %s", probe.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return &mqtt5Conn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// connect sends the CONNECT packet of opts, and returns the CONNACK, or an error if the connection is refused
+func (c *mqtt5Conn) connect(opts mqtt5Connect, username string, password string) (*mqtt5Connack, error) {
+	flags := byte(0)
+	if opts.cleanStart {
+		flags |= 0x02
+	}
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 5, flags)
+	body = binary.BigEndian.AppendUint16(body, opts.keepAlive)
+	body = appendVarint(body, len(opts.properties))
+	body = append(body, opts.properties...)
+	body = appendString(body, opts.clientID)
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	if err := c.writePacket(packetConnect<<4, body); err != nil {
+		return nil, err
+	}
+
+	packetType, body, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if packetType>>4 != packetConnack || len(body) < 2 {
+		return nil, fmt.Errorf("expected a CONNACK, got packet type %d", packetType>>4)
+	}
+	connack := &mqtt5Connack{sessionPresent: body[0]&0x01 != 0, reasonCode: body[1]}
+	if len(body) > 2 {
+		if connack.properties, _, err = readProperties(body[2:]); err != nil {
+			return nil, fmt.Errorf("CONNACK: %w", err)
+		}
+	}
+	if connack.reasonCode >= 0x80 {
+		err = fmt.Errorf("connection refused with reason code 0x%02x", connack.reasonCode)
+		if reason, ok := connack.properties[propReasonString]; ok {
+			err = fmt.Errorf("%w: %s", err, reason)
+		}
+		return connack, err
+	}
+	return connack, nil
+}
+
+// subscribe subscribes to topic at qos, and returns an error if the broker refused it
+func (c *mqtt5Conn) subscribe(packetID uint16, topic string, qos byte) error {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	body = append(body, 0)
+	body = appendString(body, topic)
+	body = append(body, qos)
+	if err := c.writePacket(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	packetType, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType>>4 != packetSuback || len(body) < 3 {
+		return fmt.Errorf("expected a SUBACK, got packet type %d", packetType>>4)
+	}
+	_, codes, err := readProperties(body[2:])
+	if err != nil {
+		return fmt.Errorf("SUBACK: %w", err)
+	}
+	if len(codes) != 1 || codes[0] >= 0x80 {
+		return fmt.Errorf("subscription to %s refused with reason codes %x", topic, codes)
+	}
+	return nil
+}
+
+// publish publishes payload to topic at QoS 1, and waits for the PUBACK
+func (c *mqtt5Conn) publish(packetID uint16, topic string, payload []byte) error {
+	body := appendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, packetID)
+	body = append(body, 0)
+	body = append(body, payload...)
+	if err := c.writePacket(packetPublish<<4|0x02, body); err != nil {
+		return err
+	}
+
+	packetType, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType>>4 != packetPuback || len(body) < 2 || binary.BigEndian.Uint16(body) != packetID {
+		return fmt.Errorf("expected the PUBACK of packet %d, got packet type %d", packetID, packetType>>4)
+	}
+	// no reason code is success
+	if len(body) > 2 && body[2] >= 0x80 {
+		return fmt.Errorf("publish to %s refused with reason code 0x%02x", topic, body[2])
+	}
+	return nil
+}
+
+// puback acknowledges the PUBLISH of packetID
+func (c *mqtt5Conn) puback(packetID uint16) error {
+	return c.writePacket(packetPuback<<4, binary.BigEndian.AppendUint16(nil, packetID))
+}
+
+// readPublish returns the next packet, which must be a PUBLISH, or nil if none starts within quiet
+func (c *mqtt5Conn) readPublish(ctx context.Context, quiet time.Duration) (*mqtt5Publish, error) {
+	c.conn.SetReadDeadline(time.Now().Add(quiet))
+	_, err := c.r.Peek(1)
+	// the rest of the packet is read up to the deadline of the connection
+	deadline, _ := ctx.Deadline()
+	c.conn.SetReadDeadline(deadline)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	header, body, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if header>>4 != packetPublish {
+		return nil, fmt.Errorf("expected a PUBLISH, got packet type %d", header>>4)
+	}
+	p := &mqtt5Publish{qos: header >> 1 & 0x03, dup: header&0x08 != 0}
+	if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body)) {
+		return nil, errors.New("PUBLISH truncated")
+	}
+	n := 2 + int(binary.BigEndian.Uint16(body))
+	p.topic, body = string(body[2:n]), body[n:]
+	if p.qos > 0 {
+		if len(body) < 2 {
+			return nil, errors.New("PUBLISH truncated")
+		}
+		p.packetID, body = binary.BigEndian.Uint16(body), body[2:]
+	}
+	if _, p.payload, err = readProperties(body); err != nil {
+		return nil, fmt.Errorf("PUBLISH: %w", err)
+	}
+	return p, nil
+}
+
+// close disconnects normally, so that the broker doesn't publish the will, and closes the connection
+func (c *mqtt5Conn) close() error {
+	c.writePacket(packetDisconnect<<4, []byte{0x00, 0x00})
+	return c.conn.Close()
+}
+
+func (c *mqtt5Conn) writePacket(header byte, body []byte) error {
+	packet := appendVarint([]byte{header}, len(body))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// readPacket returns the first byte and the body of the next packet
+func (c *mqtt5Conn) readPacket() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readVarint(c.r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// propertySizes are the sizes of the fixed size property values, the others are strings or binary data
+// prefixed by their length, except the variable byte integers and the user properties
+var propertySizes = map[byte]int{
+	0x01: 1, 0x02: 4, 0x11: 4, 0x13: 2, 0x17: 1, 0x18: 4, 0x19: 1,
+	0x21: 2, 0x22: 2, 0x23: 2, 0x24: 1, 0x25: 1, 0x27: 4, 0x28: 1, 0x29: 1, 0x2A: 1,
+}
+
+// readProperties reads the properties prefixed by their length from b, and returns them with the rest of b
+func readProperties(b []byte) (mqtt5Properties, []byte, error) {
+	length, n, err := decodeVarint(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n+length > len(b) {
+		return nil, nil, errors.New("properties longer than the packet")
+	}
+	props, rest := b[n:n+length], b[n+length:]
+	properties := make(mqtt5Properties)
+	for len(props) > 0 {
+		id := props[0]
+		props = props[1:]
+		start := 0
+		size, fixed := propertySizes[id]
+		switch {
+		case fixed:
+		case id == propSubscriptionID:
+			if _, size, err = decodeVarint(props); err != nil {
+				return nil, nil, err
+			}
+		case id == propUserProperty:
+			// a pair of strings, which is kept with their lengths
+			if len(props) >= 2 {
+				size = 2 + int(binary.BigEndian.Uint16(props))
+			}
+			if len(props) >= size+2 {
+				size += 2 + int(binary.BigEndian.Uint16(props[size:]))
+			}
+		default:
+			// a string or binary data, whose value is kept without its length
+			if len(props) >= 2 {
+				start, size = 2, 2+int(binary.BigEndian.Uint16(props))
+			}
+		}
+		if size == 0 || size > len(props) {
+			return nil, nil, fmt.Errorf("property 0x%02x truncated", id)
+		}
+		properties[id] = props[start:size]
+		props = props[size:]
+	}
+	return properties, rest, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendVarint appends the variable byte integer of MQTT
+func appendVarint(b []byte, v int) []byte {
+	for {
+		digit := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+var errMalformedVarint = errors.New("malformed variable byte integer")
+
+func readVarint(r io.ByteReader) (int, error) {
+	v, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			return v, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errMalformedVarint
+}
+
+// decodeVarint returns the variable byte integer at the start of b, and its size
+func decodeVarint(b []byte) (int, int, error) {
+	v, multiplier := 0, 1
+	for i := 0; i < 4 && i < len(b); i++ {
+		v += int(b[i]&0x7F) * multiplier
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+		multiplier *= 128
+	}
+	return 0, 0, errMalformedVarint
+}
@@ -0,0 +1,46 @@
+package prober
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// message is an mqtt.Message of a payload at a QoS
+type message struct {
+	mqtt.Message
+	payload string
+	qos     byte
+}
+
+func (m message) Payload() []byte { return []byte(m.payload) }
+func (m message) Qos() byte       { return m.qos }
+
+func TestReceiveOutOfOrder(t *testing.T) {
+	p := &MQTTProbe{labels: prometheus.Labels{"target": "receive-out-of-order"}}
+	for _, test := range []struct {
+		msg        message
+		seq        uint64
+		ok         bool
+		outOfOrder float64
+	}{
+		{msg: message{payload: "hello world 2", qos: 1}, seq: 2, ok: true},
+		{msg: message{payload: "hello world 1", qos: 1}, seq: 1, ok: true, outOfOrder: 1},
+		// the brokers may redeliver a message at QoS 1
+		{msg: message{payload: "hello world 2", qos: 1}, seq: 2, ok: true, outOfOrder: 1},
+		// the order of the QoS 0 messages isn't guaranteed
+		{msg: message{payload: "hello world 1", qos: 0}, seq: 1, ok: true, outOfOrder: 1},
+		{msg: message{payload: "hello world", qos: 1}, outOfOrder: 1},
+		{msg: message{payload: "hello world 3", qos: 1}, seq: 3, ok: true, outOfOrder: 1},
+	} {
+		seq, ok := p.receive(test.msg)
+		if seq != test.seq || ok != test.ok {
+			t.Errorf("%q: expected the sequence number %d %v, got %d %v", test.msg.payload, test.seq, test.ok, seq, ok)
+		}
+		if outOfOrder := testutil.ToFloat64(outOfOrderCounter(p.labels)); outOfOrder != test.outOfOrder {
+			t.Errorf("%q: expected %v messages out of order, got %v", test.msg.payload, test.outOfOrder, outOfOrder)
+		}
+	}
+}
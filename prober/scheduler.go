@@ -0,0 +1,154 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Scheduler runs the probes on an interval aside from the /probe requests, which are served the results of the last
+// probes. So a hung MQTT connect never blocks a request
+type Scheduler struct {
+	probes   func() []config.Probe
+	interval time.Duration
+	timeout  time.Duration
+	opts     HandlerOpts
+	logger   log.Logger
+
+	mu      sync.RWMutex
+	results map[string]probeResult
+	// running are the targets whose probe is in flight, which isn't started again until it's done
+	running map[string]struct{}
+}
+
+type probeResult struct {
+	registry  *prometheus.Registry
+	timestamp time.Time
+}
+
+// NewScheduler returns a scheduler of the probes returned by probes, which are run on every interval for up to timeout
+func NewScheduler(probes func() []config.Probe, interval, timeout time.Duration, opts HandlerOpts, logger log.Logger) *Scheduler {
+	return &Scheduler{
+		probes:   probes,
+		interval: interval,
+		timeout:  timeout,
+		opts:     opts,
+		logger:   logger,
+		results:  make(map[string]probeResult),
+		running:  make(map[string]struct{}),
+	}
+}
+
+// Run starts the probes on every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		probes := s.probes()
+		s.forget(probes)
+		for _, probe := range probes {
+			s.start(ctx, probe)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// forget drops the results of the targets which aren't among probes anymore, so they're not served until probed again
+func (s *Scheduler) forget(probes []config.Probe) {
+	targets := make(map[string]struct{}, len(probes))
+	for _, probe := range probes {
+		targets[probe.Target] = struct{}{}
+	}
+	s.mu.Lock()
+	for target := range s.results {
+		if _, ok := targets[target]; !ok {
+			delete(s.results, target)
+		}
+	}
+	s.mu.Unlock()
+	Forget(probes)
+}
+
+// start runs the probe aside, unless the previous probe of its target is still running
+func (s *Scheduler) start(ctx context.Context, probe config.Probe) {
+	s.mu.Lock()
+	if _, ok := s.running[probe.Target]; ok {
+		s.mu.Unlock()
+		level.Warn(s.logger).Log("msg", "Previous probe still running, skipping", "target", probe.Target)
+		return
+	}
+	s.running[probe.Target] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		begin := time.Now()
+		registry := Probe(ctx, probe, s.opts, s.logger)
+
+		s.mu.Lock()
+		delete(s.running, probe.Target)
+		s.results[probe.Target] = probeResult{registry: registry, timestamp: begin}
+		s.mu.Unlock()
+	}()
+}
+
+// Gatherers returns the registries of the last probes of the targets, whose metrics are pushed like they are served
+func (s *Scheduler) Gatherers() prometheus.Gatherers {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	gatherers := make(prometheus.Gatherers, 0, len(s.results))
+	for _, result := range s.results {
+		gatherers = append(gatherers, result.registry)
+	}
+	return gatherers
+}
+
+// Handler serves the result of the last probe of the target of the request, with its age
+func (s *Scheduler) Handler(w http.ResponseWriter, r *http.Request, params url.Values) {
+	if params == nil {
+		params = r.URL.Query()
+	}
+	target := params.Get("target")
+	probe, ok := findProbe(s.probes(), target)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown probe target %q", target), http.StatusBadRequest)
+		level.Debug(s.logger).Log("msg", "Unknown probe target", "target", target)
+		return
+	}
+
+	s.mu.RLock()
+	result, ok := s.results[target]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("Probe target %q not probed yet", target), http.StatusServiceUnavailable)
+		return
+	}
+
+	age := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_result_age_seconds",
+		Help:        "How long ago the probe served was started in seconds",
+		ConstLabels: probeLabels(probe),
+	})
+	age.Set(time.Since(result.timestamp).Seconds())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(age)
+
+	h := promhttp.HandlerFor(prometheus.Gatherers{result.registry, registry}, promhttp.HandlerOpts{EnableOpenMetrics: true, DisableCompression: true})
+	h.ServeHTTP(w, r)
+}
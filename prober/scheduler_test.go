@@ -0,0 +1,162 @@
+package prober
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+)
+
+func TestScheduler(t *testing.T) {
+	// a listener which never completes the MQTT handshake, like a hung broker
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	probes := []config.Probe{{Target: l.Addr().String(), Scheme: "tcp", ClientID: "test", Topic: "test"}}
+	s := NewScheduler(func() []config.Probe { return probes }, time.Hour, 200*time.Millisecond, HandlerOpts{}, log.NewNopLogger())
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Handler(w, httptest.NewRequest("GET", "/probe?target="+target, nil), nil)
+		return w
+	}
+
+	if w := serve("unknown:1883"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown target, got %d", w.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	begin := time.Now()
+	if w := serve(probes[0].Target); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before the first probe is done, got %d", w.Code)
+	}
+	if time.Since(begin) > 100*time.Millisecond {
+		t.Errorf("Expected the request not to wait for the probe, it took %s", time.Since(begin))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := serve(probes[0].Target)
+		if w.Code == http.StatusOK {
+			body := w.Body.String()
+			if !strings.Contains(body, "emqx_mqtt_probe_success{target=") || !strings.Contains(body, "emqx_mqtt_probe_result_age_seconds{target=") {
+				t.Errorf("Expected the probe result with its age, got %s", body)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the result of the probe, got status %d", w.Code)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	families, err := s.Gatherers().Gather()
+	if err != nil || len(families) == 0 {
+		t.Errorf("Expected the last probe results to be gathered to push, got %d families, %v", len(families), err)
+	}
+
+	// the target is removed
+	removed := probes[0].Target
+	probes = nil
+	s.forget(probes)
+	s.mu.RLock()
+	_, ok := s.results[removed]
+	s.mu.RUnlock()
+	if ok {
+		t.Error("Expected the result of the removed target to be forgotten")
+	}
+}
+
+// serveSlowBroker accepts the MQTT clients on l, and acknowledges their connects after delay and their subscriptions,
+// but never delivers what they publish, so that their probes run until they time out
+func serveSlowBroker(l net.Listener, delay time.Duration) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			c := &mqtt5Conn{conn: conn, r: bufio.NewReader(conn)}
+			for {
+				header, body, err := c.readPacket()
+				if err != nil {
+					return
+				}
+				switch header >> 4 {
+				case packetConnect:
+					time.Sleep(delay)
+					c.writePacket(packetConnack<<4, []byte{0, 0})
+				case packetSubscribe:
+					c.writePacket(packetSuback<<4, append(body[:2:2], 0))
+				case packetDisconnect:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// TestSchedulerConcurrentProbes runs the probes of slow targets over several ticks, for `go test -race` to catch
+// the clients of the probes shared unsynchronized
+func TestSchedulerConcurrentProbes(t *testing.T) {
+	var targets []string
+	for i := 0; i < 8; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go serveSlowBroker(l, time.Duration(i)*10*time.Millisecond)
+		targets = append(targets, l.Addr().String())
+	}
+	defer Forget(nil)
+
+	var mu sync.Mutex
+	ticks := 0
+	// half of the targets are removed and added back on every other tick, while the probes of the others are still
+	// connecting or waiting for their messages
+	probes := func() []config.Probe {
+		mu.Lock()
+		defer mu.Unlock()
+		ticks++
+		var probes []config.Probe
+		for i, target := range targets {
+			if i%2 == 0 || ticks%2 == 1 {
+				probes = append(probes, config.Probe{Target: target, Scheme: "tcp", ClientID: "test-" + target, Topic: "test"})
+			}
+		}
+		return probes
+	}
+	s := NewScheduler(probes, 20*time.Millisecond, 50*time.Millisecond, HandlerOpts{}, log.NewNopLogger())
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.RLock()
+		running := len(s.running)
+		s.mu.RUnlock()
+		if running == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the probes to time out")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package prober
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sessionCollectors connects to the target of probe over MQTT 5 with its clean start and session expiry interval,
+// and returns whether it connected, with the collectors of the connect latency and of whether the session was resumed
+func sessionCollectors(ctx context.Context, probe config.Probe, logger log.Logger) (bool, []prometheus.Collector) {
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_connect_duration_seconds",
+		Help:        "How long the MQTT 5 connection of the probe with its clean start and session expiry interval took in seconds",
+		ConstLabels: probeLabels(probe),
+	})
+	sessionPresentGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "emqx",
+		Subsystem:   "mqtt",
+		Name:        "probe_session_present",
+		Help:        "Whether the broker resumed the session of the MQTT 5 connection of the probe",
+		ConstLabels: probeLabels(probe),
+	})
+
+	start := time.Now()
+	connack, err := connectSession(ctx, probe)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to connect to MQTT broker over MQTT 5", "target", probe.Target, "err", err)
+		return false, nil
+	}
+	durationGauge.Set(time.Since(start).Seconds())
+	if connack.sessionPresent {
+		sessionPresentGauge.Set(1)
+	}
+	return true, []prometheus.Collector{durationGauge, sessionPresentGauge}
+}
+
+// connectSession connects to the target of probe over MQTT 5 with its clean start and session expiry interval,
+// and disconnects, which leaves the session to be resumed by the next probe if clean start is false.
+// Its client ID is apart from the one of the probe client, which would be taken over otherwise
+func connectSession(ctx context.Context, probe config.Probe) (connack *mqtt5Connack, err error) {
+	ctx, span := tracing.Start(ctx, "mqtt5 connect")
+	defer func() { span.End(err) }()
+	conn, err := dialMQTT5(ctx, probe)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	properties := binary.BigEndian.AppendUint32([]byte{propSessionExpiry}, uint32(time.Duration(probe.SessionExpiryInterval)/time.Second))
+	return conn.connect(mqtt5Connect{
+		clientID:   probe.ClientID + "_session",
+		cleanStart: probe.CleanStart == nil || *probe.CleanStart,
+		keepAlive:  30,
+		properties: properties,
+	}, probe.Username, string(probe.Password))
+}
@@ -0,0 +1,51 @@
+package prober
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+func TestSessionCollectors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveConnack(t, l, func(connect []byte) (bool, []byte) {
+		// clean start unset, and the session expiry interval as the only property
+		expected := binary.BigEndian.AppendUint32([]byte{5, propSessionExpiry}, 300)
+		if connect[7]&0x02 != 0 || string(connect[10:16]) != string(expected) {
+			t.Errorf("Expected a CONNECT resuming the session, got %x", connect)
+		}
+		if id := connect[18 : 18+binary.BigEndian.Uint16(connect[16:])]; string(id) != "probe_session" {
+			t.Errorf("Expected the client ID probe_session, got %s", id)
+		}
+		return true, nil
+	})
+
+	cleanStart := false
+	probe := config.Probe{Target: l.Addr().String(), Scheme: "tcp", ClientID: "probe", CleanStart: &cleanStart,
+		SessionExpiryInterval: model.Duration(5 * time.Minute)}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	connected, collectors := sessionCollectors(ctx, probe, log.NewNopLogger())
+	if !connected || len(collectors) != 2 {
+		t.Fatalf("Expected to connect, got %v with %d collectors", connected, len(collectors))
+	}
+	if present := testutil.ToFloat64(collectors[1]); present != 1 {
+		t.Errorf("Expected the session to be present, got %v", present)
+	}
+
+	l.Close()
+	if connected, _ = sessionCollectors(ctx, probe, log.NewNopLogger()); connected {
+		t.Error("Expected the connection to fail without the broker")
+	}
+}
@@ -0,0 +1,50 @@
+package prober
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+// tlsSessions keeps the TLS sessions of each probe across its runs and its connections, so that they resume
+// the sessions rather than doing full handshakes with the broker
+var tlsSessions = struct {
+	sync.Mutex
+	caches map[probeKey]tls.ClientSessionCache
+}{caches: make(map[probeKey]tls.ClientSessionCache)}
+
+// secureScheme tells whether the scheme of a probe connects over TLS
+func secureScheme(scheme string) bool {
+	switch scheme {
+	case "ssl", "tls", "mqtts", "tcps", "wss":
+		return true
+	}
+	return false
+}
+
+// tlsConfig returns the TLS config of the connections of probe, nil if it doesn't connect over TLS.
+// The connections resume the TLS sessions of the earlier ones unless the probe connects cold
+func tlsConfig(probe config.Probe) *tls.Config {
+	conf := probe.TLSClientConfig.ToTLSConfig()
+	if !secureScheme(probe.Scheme) {
+		return conf
+	}
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+	if probe.ColdConnect {
+		return conf
+	}
+
+	key := keyOf(probeLabels(probe))
+	tlsSessions.Lock()
+	defer tlsSessions.Unlock()
+	cache, ok := tlsSessions.caches[key]
+	if !ok {
+		cache = tls.NewLRUClientSessionCache(0)
+		tlsSessions.caches[key] = cache
+	}
+	conf.ClientSessionCache = cache
+	return conf
+}
@@ -0,0 +1,77 @@
+package prober
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+func TestTLSSessionResumption(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// the session tickets of TLS 1.3 are read by the client along with the data following the handshake
+			conn.Write([]byte{0})
+			conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+	}()
+
+	// dial returns whether the connection of probe resumed a TLS session
+	dial := func(probe config.Probe) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn, err := dialMQTT5(ctx, probe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.close()
+		if _, err = conn.r.ReadByte(); err != nil {
+			t.Fatal(err)
+		}
+		return conn.conn.(*tls.Conn).ConnectionState().DidResume
+	}
+	probe := config.Probe{Target: l.Addr().String(), Scheme: "ssl", TLSClientConfig: &config.TLSClientConfig{InsecureSkipVerify: true}}
+	if dial(probe) {
+		t.Error("Expected the first connection to do a full handshake")
+	}
+	if !dial(probe) {
+		t.Error("Expected the next connection to resume the TLS session")
+	}
+
+	probe.ColdConnect = true
+	if dial(probe) {
+		t.Error("Expected the connection of the cold probe to do a full handshake")
+	}
+}
@@ -0,0 +1,87 @@
+package push
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// pathReplacer replaces the characters which separate the components of a path, or the fields of a line
+	pathReplacer = strings.NewReplacer(".", "_", " ", "_", "\n", "_", ";", "_", "=", "_")
+	// tagValueReplacer replaces the characters which are invalid in tag values
+	tagValueReplacer = strings.NewReplacer(";", "_", "~", "_", " ", "_", "\n", "_")
+)
+
+// Graphite sends the metrics in the Graphite plaintext protocol, with the labels as components of the path
+// like `prefix.name.label.value`, or as tags like `prefix.name;label=value` if config.Graphite.Tagged is set
+type Graphite struct {
+	conf *config.Graphite
+}
+
+// NewGraphite returns a sink sending to the Graphite of conf
+func NewGraphite(conf *config.Graphite) *Graphite {
+	return &Graphite{conf: conf}
+}
+
+// Push implements Sink, the metrics not sent before the connection broke are sent on the next interval
+func (g *Graphite) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.conf.Timeout))
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", g.conf.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	var line []byte
+	for _, sample := range Samples(families, nil) {
+		line = g.appendLine(line[:0], sample, timestamp.Unix())
+		if _, err = w.Write(line); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// appendLine appends the sample like `path value timestamp`, or nothing if its value can't be sent
+func (g *Graphite) appendLine(b []byte, sample Sample, timestamp int64) []byte {
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return b
+	}
+	b = append(b, g.conf.Prefix...)
+	b = append(b, pathReplacer.Replace(sample.Name)...)
+	for _, l := range sample.Labels {
+		if l.Value == "" {
+			continue
+		}
+		if g.conf.Tagged {
+			b = append(b, ';')
+			b = append(b, pathReplacer.Replace(l.Name)...)
+			b = append(b, '=')
+			b = append(b, tagValueReplacer.Replace(l.Value)...)
+		} else {
+			b = append(b, '.')
+			b = append(b, pathReplacer.Replace(l.Name)...)
+			b = append(b, '.')
+			b = append(b, pathReplacer.Replace(l.Value)...)
+		}
+	}
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, sample.Value, 'f', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, timestamp, 10)
+	return append(b, '\n')
+}
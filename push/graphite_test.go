@@ -0,0 +1,36 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+func TestGraphiteAppendLine(t *testing.T) {
+	sample := Sample{
+		Name:   "emqx_test_gauge",
+		Labels: []Label{{Name: "node", Value: "emqx@10.0.0.1"}, {Name: "rule", Value: "rule 1"}},
+		Value:  1.5,
+	}
+
+	testcases := []struct {
+		conf     config.Graphite
+		expected string
+	}{
+		{
+			conf:     config.Graphite{Prefix: "emqx."},
+			expected: "emqx.emqx_test_gauge.node.emqx@10_0_0_1.rule.rule_1 1.5 1700000000\n",
+		},
+		{
+			conf:     config.Graphite{Prefix: "emqx.", Tagged: true},
+			expected: "emqx.emqx_test_gauge;node=emqx@10.0.0.1;rule=rule_1 1.5 1700000000\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		g := NewGraphite(&tc.conf)
+		if got := string(g.appendLine(nil, sample, 1700000000)); got != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, got)
+		}
+	}
+}
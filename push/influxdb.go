@@ -0,0 +1,133 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// InfluxDB writes the metrics in the InfluxDB line protocol, each sample as a point of the measurement
+// named after it, with the labels as tags and the value as the `value` field
+type InfluxDB struct {
+	conf   *config.InfluxDB
+	client *http.Client
+	url    string
+	logger log.Logger
+}
+
+// NewInfluxDB returns a sink writing to the InfluxDB of conf
+func NewInfluxDB(conf *config.InfluxDB, logger log.Logger) *InfluxDB {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf.TLSClientConfig.ToTLSConfig()
+
+	u, _ := url.Parse(conf.URL)
+	query := url.Values{"precision": {"ms"}}
+	if conf.Version == 1 {
+		u = u.JoinPath("write")
+		query.Set("db", conf.Database)
+		if conf.RetentionPolicy != "" {
+			query.Set("rp", conf.RetentionPolicy)
+		}
+	} else {
+		u = u.JoinPath("api", "v2", "write")
+		query.Set("org", conf.Org)
+		query.Set("bucket", conf.Bucket)
+	}
+	u.RawQuery = query.Encode()
+
+	return &InfluxDB{
+		conf:   conf,
+		client: &http.Client{Transport: transport},
+		url:    u.String(),
+		logger: logger,
+	}
+}
+
+// Push implements Sink
+func (i *InfluxDB) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	var body []byte
+	for _, sample := range Samples(families, nil) {
+		body = appendPoint(body, sample, timestamp.UnixMilli())
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return retry(ctx, i.conf.MaxRetries, i.logger, func() error {
+		return i.post(ctx, body)
+	})
+}
+
+func (i *InfluxDB) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(i.conf.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "emqx-exporter/"+version.Version)
+	if i.conf.Token != "" {
+		req.Header.Set("Authorization", "Token "+string(i.conf.Token))
+	}
+	if i.conf.BasicAuth != nil {
+		req.SetBasicAuth(i.conf.BasicAuth.Username, string(i.conf.BasicAuth.Password))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("InfluxDB write %s: %s: %s", i.conf.URL, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// appendPoint appends the sample like `name,tag=value value=1 1700000000000`,
+// or nothing if its value can't be written
+func appendPoint(b []byte, sample Sample, timestamp int64) []byte {
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return b
+	}
+	b = append(b, measurementEscaper.Replace(sample.Name)...)
+	for _, l := range sample.Labels {
+		// tags with empty values are invalid
+		if l.Value == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, tagEscaper.Replace(l.Name)...)
+		b = append(b, '=')
+		b = append(b, tagEscaper.Replace(l.Value)...)
+	}
+	b = append(b, " value="...)
+	b = strconv.AppendFloat(b, sample.Value, 'g', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, timestamp, 10)
+	return append(b, '\n')
+}
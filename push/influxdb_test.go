@@ -0,0 +1,54 @@
+package push
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+func TestInfluxDBPush(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "emqx" || r.URL.Query().Get("precision") != "ms" ||
+			r.Header.Get("Authorization") != "Token some_token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_test_gauge", Help: "test"}, []string{"node", "rule"})
+	gauge.WithLabelValues("emqx-0", "rule 1,a").Set(1.5)
+	registry.MustRegister(gauge)
+	families, _ := registry.Gather()
+
+	i := NewInfluxDB(&config.InfluxDB{
+		URL:        server.URL,
+		Version:    2,
+		Org:        "factory",
+		Bucket:     "emqx",
+		Token:      "some_token",
+		Timeout:    model.Duration(time.Second),
+		MaxRetries: 1,
+	}, log.NewNopLogger())
+	if err := i.Push(context.Background(), families, time.UnixMilli(1700000000000)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `emqx_test_gauge,node=emqx-0,rule=rule\ 1\,a value=1.5 1700000000000` + "\n"
+	if body != expected {
+		t.Errorf("Expected %q, got %q", expected, body)
+	}
+}
@@ -0,0 +1,154 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/mqttutil"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// HealthSummary is the summary published by MQTTPublisher
+type HealthSummary struct {
+	// Timestamp of the collection in milliseconds
+	Timestamp int64           `json:"timestamp"`
+	Clusters  []ClusterHealth `json:"clusters"`
+	Probes    []ProbeResult   `json:"probes"`
+}
+
+// ClusterHealth is the health of a cluster, the default cluster is named ""
+type ClusterHealth struct {
+	Cluster string `json:"cluster"`
+	// Healthy is true if all collectors of the cluster succeeded
+	Healthy bool `json:"healthy"`
+	// Status is the value of emqx_cluster_status, absent if the cluster couldn't be reached
+	Status *float64 `json:"status,omitempty"`
+	// Collectors tells whether each collector succeeded
+	Collectors map[string]bool `json:"collectors"`
+}
+
+// ProbeResult is the result of probing a target
+type ProbeResult struct {
+	Target string `json:"target"`
+	// Name of the probe, if any
+	Name            string  `json:"name,omitempty"`
+	Success         bool    `json:"success"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// MQTTPublisher publishes a JSON summary of the probe results and the cluster health to an MQTT topic,
+// the connection to the broker is kept across the intervals
+type MQTTPublisher struct {
+	conf   *config.MQTTPublish
+	client mqtt.Client
+}
+
+// NewMQTTPublisher returns a sink publishing to the broker of conf
+func NewMQTTPublisher(conf *config.MQTTPublish, logger log.Logger) *MQTTPublisher {
+	opt := mqtt.NewClientOptions().AddBroker(conf.Scheme + "://" + conf.Target).SetClientID(conf.ClientID).
+		SetUsername(conf.Username).SetPassword(string(conf.Password)).SetConnectTimeout(time.Duration(conf.Timeout)).
+		// reconnected on the next interval instead
+		SetAutoReconnect(false)
+	if conf.TLSClientConfig != nil {
+		opt.SetTLSConfig(conf.TLSClientConfig.ToTLSConfig())
+	}
+	opt.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		level.Warn(logger).Log("msg", "Lost connection to MQTT broker", "target", conf.Target, "err", err)
+	})
+	return &MQTTPublisher{conf: conf, client: mqtt.NewClient(opt)}
+}
+
+// Push implements Sink
+func (p *MQTTPublisher) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.conf.Timeout))
+	defer cancel()
+	if !p.client.IsConnectionOpen() {
+		if err := mqttutil.WaitToken(ctx, p.client.Connect()); err != nil {
+			// stop connecting in the background if it timed out
+			p.client.Disconnect(0)
+			return err
+		}
+	}
+	payload, err := json.Marshal(Summarize(families, timestamp))
+	if err != nil {
+		return err
+	}
+	return mqttutil.WaitToken(ctx, p.client.Publish(p.conf.Topic, p.conf.QoS, p.conf.Retain, payload))
+}
+
+// Close disconnects from the broker
+func (p *MQTTPublisher) Close() error {
+	if p.client.IsConnectionOpen() {
+		p.client.Disconnect(250)
+	}
+	return nil
+}
+
+// Summarize returns the health of the clusters from `emqx_scrape_collector_success` and `emqx_cluster_status`,
+// and the probe results from `emqx_mqtt_probe_success` and `emqx_mqtt_probe_duration_seconds`
+func Summarize(families []*dto.MetricFamily, timestamp time.Time) HealthSummary {
+	clusters := make(map[string]*ClusterHealth)
+	clusterOf := func(name string) *ClusterHealth {
+		if clusters[name] == nil {
+			clusters[name] = &ClusterHealth{Cluster: name, Healthy: true, Collectors: map[string]bool{}}
+		}
+		return clusters[name]
+	}
+	probes := make(map[string]*ProbeResult)
+	probeOf := func(target string) *ProbeResult {
+		if probes[target] == nil {
+			probes[target] = &ProbeResult{Target: target}
+		}
+		return probes[target]
+	}
+
+	for _, family := range families {
+		for _, m := range family.Metric {
+			value := m.GetGauge().GetValue()
+			switch family.GetName() {
+			case "emqx_scrape_collector_success":
+				cluster := clusterOf(labelValue(m, "cluster"))
+				cluster.Collectors[labelValue(m, "collector")] = value == 1
+				cluster.Healthy = cluster.Healthy && value == 1
+			case "emqx_cluster_status":
+				clusterOf(labelValue(m, "cluster")).Status = &value
+			case "emqx_mqtt_probe_success":
+				probe := probeOf(labelValue(m, "target"))
+				probe.Success = value == 1
+				probe.Name = labelValue(m, "name")
+			case "emqx_mqtt_probe_duration_seconds":
+				probeOf(labelValue(m, "target")).DurationSeconds = value
+			}
+		}
+	}
+
+	summary := HealthSummary{
+		Timestamp: timestamp.UnixMilli(),
+		Clusters:  make([]ClusterHealth, 0, len(clusters)),
+		Probes:    make([]ProbeResult, 0, len(probes)),
+	}
+	for _, cluster := range clusters {
+		summary.Clusters = append(summary.Clusters, *cluster)
+	}
+	sort.Slice(summary.Clusters, func(i, j int) bool { return summary.Clusters[i].Cluster < summary.Clusters[j].Cluster })
+	for _, probe := range probes {
+		summary.Probes = append(summary.Probes, *probe)
+	}
+	sort.Slice(summary.Probes, func(i, j int) bool { return summary.Probes[i].Target < summary.Probes[j].Target })
+	return summary
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
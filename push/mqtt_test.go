@@ -0,0 +1,48 @@
+package push
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSummarize(t *testing.T) {
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_scrape_collector_success"}, []string{"cluster", "collector"})
+	success.WithLabelValues("a", "cluster").Set(1)
+	success.WithLabelValues("a", "rule").Set(0)
+	success.WithLabelValues("b", "cluster").Set(1)
+	status := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_cluster_status"}, []string{"cluster"})
+	status.WithLabelValues("b").Set(1)
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{Name: "emqx_mqtt_probe_success", ConstLabels: prometheus.Labels{"target": "broker:1883"}})
+	probeSuccess.Set(1)
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{Name: "emqx_mqtt_probe_duration_seconds", ConstLabels: prometheus.Labels{"target": "broker:1883"}})
+	probeDuration.Set(0.25)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(success, status, probeSuccess, probeDuration)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := Summarize(families, time.UnixMilli(1700000000000))
+	if summary.Timestamp != 1700000000000 || len(summary.Clusters) != 2 || len(summary.Probes) != 1 {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	a, b := summary.Clusters[0], summary.Clusters[1]
+	if a.Cluster != "a" || a.Healthy || !a.Collectors["cluster"] || a.Collectors["rule"] || a.Status != nil {
+		t.Errorf("Expected cluster a to be unhealthy for its failed rule collector, got %+v", a)
+	}
+	if b.Cluster != "b" || !b.Healthy || b.Status == nil || *b.Status != 1 {
+		t.Errorf("Expected cluster b to be healthy, got %+v", b)
+	}
+	if probe := summary.Probes[0]; probe != (ProbeResult{Target: "broker:1883", Success: true, DurationSeconds: 0.25}) {
+		t.Errorf("Unexpected probe result %+v", probe)
+	}
+
+	if empty := Summarize([]*dto.MetricFamily{}, time.Now()); empty.Clusters == nil || empty.Probes == nil {
+		t.Errorf("Expected empty lists rather than null, got %+v", empty)
+	}
+}
@@ -0,0 +1,359 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/grpcutil"
+	"github.com/emqx/emqx-exporter/internal/protoutil"
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// resourceLabels are moved from the labels of the metrics to the attributes of their resources
+var resourceLabels = []string{"cluster", "node"}
+
+// OTLPExporter pushes the metrics via the OpenTelemetry protocol, over HTTP with protobuf or over gRPC.
+// Counters, histograms and summaries are exported as cumulative, starting from their creation if known,
+// otherwise from the creation of the exporter
+type OTLPExporter struct {
+	conf      *config.OTLP
+	client    *http.Client
+	url       string
+	startTime time.Time
+	logger    log.Logger
+}
+
+// NewOTLPExporter returns a sink exporting to the collector of conf
+func NewOTLPExporter(conf *config.OTLP, logger log.Logger) *OTLPExporter {
+	e := &OTLPExporter{conf: conf, startTime: time.Now(), logger: logger}
+	tlsConfig := conf.TLSClientConfig.ToTLSConfig()
+
+	endpoint, _ := url.Parse(conf.Endpoint)
+	if conf.Protocol == "grpc" {
+		endpoint.Path = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+		if endpoint.Scheme == "http" {
+			tlsConfig = nil
+		}
+		e.client = &http.Client{Transport: grpcutil.NewTransport(tlsConfig, nil)}
+	} else {
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = "/v1/metrics"
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		e.client = &http.Client{Transport: transport}
+	}
+	e.url = endpoint.String()
+	return e
+}
+
+// Push implements Sink
+func (e *OTLPExporter) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	body := encodeExportRequest(families, e.resourceAttributes(), e.startTime, timestamp)
+	return retry(ctx, e.conf.MaxRetries, e.logger, func() error {
+		if e.conf.Protocol == "grpc" {
+			return e.postGRPC(ctx, body)
+		}
+		return e.postHTTP(ctx, body)
+	})
+}
+
+func (e *OTLPExporter) resourceAttributes() map[string]string {
+	attributes := map[string]string{
+		"service.name":    "emqx-exporter",
+		"service.version": version.Version,
+	}
+	for name, value := range e.conf.ResourceAttributes {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+func (e *OTLPExporter) newRequest(ctx context.Context, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "emqx-exporter/"+version.Version)
+	for name, value := range e.conf.Headers {
+		req.Header.Set(name, string(value))
+	}
+	return req, nil
+}
+
+func (e *OTLPExporter) postHTTP(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.conf.Timeout))
+	defer cancel()
+	req, err := e.newRequest(ctx, body, "application/x-protobuf")
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP export %s: %s", e.url, resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return recoverableError{err}
+	}
+	// the body is a protobuf google.rpc.Status, which has a readable message at least
+	return fmt.Errorf("%s: %q", err, bytes.TrimSpace(msg))
+}
+
+func (e *OTLPExporter) postGRPC(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.conf.Timeout))
+	defer cancel()
+	req, err := e.newRequest(ctx, grpcutil.Frame(body), "application/grpc")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("TE", "trailers")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("OTLP export %s: %s", e.url, resp.Status)
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			return recoverableError{err}
+		}
+		return err
+	}
+	// the ExportMetricsServiceResponse is skipped, the status follows it in the trailers
+	for {
+		if _, err = grpcutil.ReadFrame(resp.Body, grpcutil.MaxMessageSize); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		return fmt.Errorf("OTLP export %s: %w", e.url, err)
+	}
+	code, message, err := grpcutil.Status(resp)
+	if err != nil {
+		return fmt.Errorf("OTLP export %s: %w", e.url, err)
+	}
+	if code == 0 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP export %s: grpc-status %d: %s", e.url, code, message)
+	switch code {
+	// CANCELLED, DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, OUT_OF_RANGE, UNAVAILABLE, DATA_LOSS
+	case 1, 4, 8, 10, 11, 14, 15:
+		return recoverableError{err}
+	}
+	return err
+}
+
+// otlpResource holds the metrics of a resource, identified by the values of resourceLabels
+type otlpResource struct {
+	attributes []Label
+	metrics    [][]byte
+}
+
+// encodeExportRequest encodes the families as an ExportMetricsServiceRequest protobuf message, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/metrics/v1/metrics.proto
+func encodeExportRequest(families []*dto.MetricFamily, attributes map[string]string, start, now time.Time) []byte {
+	var keys []string
+	resources := make(map[string]*otlpResource)
+	for _, family := range families {
+		var familyKeys []string
+		byResource := make(map[string][]*dto.Metric)
+		for _, m := range family.Metric {
+			key, resourceAttributes := resourceOf(m)
+			if _, ok := resources[key]; !ok {
+				keys = append(keys, key)
+				resources[key] = &otlpResource{attributes: resourceAttributes}
+			}
+			if _, ok := byResource[key]; !ok {
+				familyKeys = append(familyKeys, key)
+			}
+			byResource[key] = append(byResource[key], m)
+		}
+		for _, key := range familyKeys {
+			resources[key].metrics = append(resources[key].metrics, encodeMetric(family, byResource[key], start, now))
+		}
+	}
+
+	var scope []byte
+	scope = protoutil.AppendString(scope, 1, "emqx-exporter")
+	scope = protoutil.AppendString(scope, 2, version.Version)
+
+	var request []byte
+	for _, key := range keys {
+		r := resources[key]
+		resourceAttributes := r.attributes
+		for name, value := range attributes {
+			resourceAttributes = append(resourceAttributes, Label{Name: name, Value: value})
+		}
+		sort.Slice(resourceAttributes, func(i, j int) bool { return resourceAttributes[i].Name < resourceAttributes[j].Name })
+		var resource []byte
+		for _, a := range resourceAttributes {
+			resource = protoutil.AppendMessage(resource, 1, protoutil.EncodeKeyValue(a.Name, a.Value))
+		}
+
+		scopeMetrics := protoutil.AppendMessage(nil, 1, scope)
+		for _, metric := range r.metrics {
+			scopeMetrics = protoutil.AppendMessage(scopeMetrics, 2, metric)
+		}
+
+		resourceMetrics := protoutil.AppendMessage(nil, 1, resource)
+		resourceMetrics = protoutil.AppendMessage(resourceMetrics, 2, scopeMetrics)
+		request = protoutil.AppendMessage(request, 1, resourceMetrics)
+	}
+	return request
+}
+
+// resourceOf returns the key and the attributes of the resource of the metric
+func resourceOf(m *dto.Metric) (string, []Label) {
+	var key strings.Builder
+	var attributes []Label
+	for _, name := range resourceLabels {
+		for _, l := range m.Label {
+			if l.GetName() == name && l.GetValue() != "" {
+				attributes = append(attributes, Label{Name: name, Value: l.GetValue()})
+				key.WriteString(l.GetValue())
+			}
+		}
+		key.WriteByte(0xff)
+	}
+	return key.String(), attributes
+}
+
+func encodeMetric(family *dto.MetricFamily, metrics []*dto.Metric, start, now time.Time) []byte {
+	var metric []byte
+	metric = protoutil.AppendString(metric, 1, family.GetName())
+	metric = protoutil.AppendString(metric, 2, family.GetHelp())
+	if family.GetUnit() != "" {
+		metric = protoutil.AppendString(metric, 3, family.GetUnit())
+	}
+
+	var data []byte
+	switch family.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		for _, m := range metrics {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			data = protoutil.AppendMessage(data, 1, encodeNumberDataPoint(m, time.Time{}, now, value))
+		}
+		return protoutil.AppendMessage(metric, 5, data)
+	case dto.MetricType_COUNTER:
+		for _, m := range metrics {
+			data = protoutil.AppendMessage(data, 1, encodeNumberDataPoint(m, startTime(m.GetCounter().GetCreatedTimestamp(), start), now, m.GetCounter().GetValue()))
+		}
+		data = protoutil.AppendVarint(data, 2, 2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+		data = protoutil.AppendVarint(data, 3, 1) // is_monotonic
+		return protoutil.AppendMessage(metric, 7, data)
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		for _, m := range metrics {
+			data = protoutil.AppendMessage(data, 1, encodeHistogramDataPoint(m, startTime(m.GetHistogram().GetCreatedTimestamp(), start), now))
+		}
+		data = protoutil.AppendVarint(data, 2, 2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+		return protoutil.AppendMessage(metric, 9, data)
+	case dto.MetricType_SUMMARY:
+		for _, m := range metrics {
+			data = protoutil.AppendMessage(data, 1, encodeSummaryDataPoint(m, startTime(m.GetSummary().GetCreatedTimestamp(), start), now))
+		}
+		return protoutil.AppendMessage(metric, 11, data)
+	}
+	return metric
+}
+
+// startTime returns the creation of the metric if known, otherwise start
+func startTime(created *timestamppb.Timestamp, start time.Time) time.Time {
+	if created.GetSeconds() > 0 {
+		return created.AsTime()
+	}
+	return start
+}
+
+func encodeNumberDataPoint(m *dto.Metric, start, now time.Time, value float64) []byte {
+	point := appendAttributes(nil, 7, m.Label)
+	if !start.IsZero() {
+		point = protoutil.AppendFixed64(point, 2, uint64(start.UnixNano()))
+	}
+	point = protoutil.AppendFixed64(point, 3, uint64(now.UnixNano()))
+	return protoutil.AppendFixed64(point, 4, math.Float64bits(value))
+}
+
+func encodeHistogramDataPoint(m *dto.Metric, start, now time.Time) []byte {
+	h := m.GetHistogram()
+	point := appendAttributes(nil, 9, m.Label)
+	point = protoutil.AppendFixed64(point, 2, uint64(start.UnixNano()))
+	point = protoutil.AppendFixed64(point, 3, uint64(now.UnixNano()))
+	point = protoutil.AppendFixed64(point, 4, h.GetSampleCount())
+	point = protoutil.AppendFixed64(point, 5, math.Float64bits(h.GetSampleSum()))
+
+	// OTLP buckets aren't cumulative, and the +Inf bucket has no bound
+	var counts, bounds []byte
+	var previous uint64
+	for _, b := range h.Bucket {
+		if math.IsInf(b.GetUpperBound(), +1) {
+			break
+		}
+		counts = protowire.AppendFixed64(counts, b.GetCumulativeCount()-previous)
+		bounds = protowire.AppendFixed64(bounds, math.Float64bits(b.GetUpperBound()))
+		previous = b.GetCumulativeCount()
+	}
+	counts = protowire.AppendFixed64(counts, h.GetSampleCount()-previous)
+	point = protoutil.AppendMessage(point, 6, counts)
+	return protoutil.AppendMessage(point, 7, bounds)
+}
+
+func encodeSummaryDataPoint(m *dto.Metric, start, now time.Time) []byte {
+	s := m.GetSummary()
+	point := appendAttributes(nil, 7, m.Label)
+	point = protoutil.AppendFixed64(point, 2, uint64(start.UnixNano()))
+	point = protoutil.AppendFixed64(point, 3, uint64(now.UnixNano()))
+	point = protoutil.AppendFixed64(point, 4, s.GetSampleCount())
+	point = protoutil.AppendFixed64(point, 5, math.Float64bits(s.GetSampleSum()))
+	for _, q := range s.Quantile {
+		var quantile []byte
+		quantile = protoutil.AppendFixed64(quantile, 1, math.Float64bits(q.GetQuantile()))
+		quantile = protoutil.AppendFixed64(quantile, 2, math.Float64bits(q.GetValue()))
+		point = protoutil.AppendMessage(point, 6, quantile)
+	}
+	return point
+}
+
+// appendAttributes appends the labels but the resource ones as attributes at the field
+func appendAttributes(b []byte, field protowire.Number, labels []*dto.LabelPair) []byte {
+	for _, l := range labels {
+		isResource := false
+		for _, name := range resourceLabels {
+			isResource = isResource || l.GetName() == name
+		}
+		if !isResource {
+			b = protoutil.AppendMessage(b, field, protoutil.EncodeKeyValue(l.GetName(), l.GetValue()))
+		}
+	}
+	return b
+}
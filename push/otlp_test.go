@@ -0,0 +1,192 @@
+package push
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type protoField struct {
+	num   protowire.Number
+	bytes []byte
+	fixed uint64
+}
+
+func decodeFields(t *testing.T, b []byte) []protoField {
+	var fields []protoField
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal("invalid tag")
+		}
+		b = b[n:]
+		f := protoField{num: num}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			f.fixed, n = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			f.fixed, n = protowire.ConsumeVarint(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatal("invalid field")
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func fieldsOf(t *testing.T, b []byte, num protowire.Number) []protoField {
+	var fields []protoField
+	for _, f := range decodeFields(t, b) {
+		if f.num == num {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// attributesOf returns the KeyValue string attributes at the field of the message
+func attributesOf(t *testing.T, b []byte, num protowire.Number) map[string]string {
+	attributes := make(map[string]string)
+	for _, kv := range fieldsOf(t, b, num) {
+		key := string(fieldsOf(t, kv.bytes, 1)[0].bytes)
+		value := fieldsOf(t, fieldsOf(t, kv.bytes, 2)[0].bytes, 1)[0].bytes
+		attributes[key] = string(value)
+	}
+	return attributes
+}
+
+func testFamilies(t *testing.T) []*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_test_gauge", Help: "test gauge"}, []string{"cluster", "node", "state"})
+	gauge.WithLabelValues("prod", "emqx-0", "running").Set(1)
+	gauge.WithLabelValues("prod", "emqx-1", "running").Set(2)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "emqx_test_seconds", Help: "test histogram", Buckets: []float64{0.5, 1}})
+	histogram.Observe(0.7)
+	histogram.Observe(3)
+	registry.MustRegister(gauge, histogram)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families
+}
+
+func TestEncodeExportRequest(t *testing.T) {
+	families := testFamilies(t)
+	for _, family := range families {
+		for _, m := range family.Metric {
+			if m.Histogram != nil {
+				// falls back to the start of the exporter
+				m.Histogram.CreatedTimestamp = nil
+			}
+		}
+	}
+	request := encodeExportRequest(families, map[string]string{"service.name": "emqx-exporter"}, time.Unix(100, 0), time.Unix(200, 0))
+
+	resources := fieldsOf(t, request, 1)
+	// emqx-0 and emqx-1 of the gauge, and the histogram without cluster and node
+	if len(resources) != 3 {
+		t.Fatalf("Expected 3 resources, got %d", len(resources))
+	}
+	for _, r := range resources {
+		resource := fieldsOf(t, r.bytes, 1)[0].bytes
+		attributes := attributesOf(t, resource, 1)
+		scopeMetrics := fieldsOf(t, r.bytes, 2)[0].bytes
+		metrics := fieldsOf(t, scopeMetrics, 2)
+		if len(metrics) != 1 {
+			t.Fatalf("Expected 1 metric per resource, got %d", len(metrics))
+		}
+		name := string(fieldsOf(t, metrics[0].bytes, 1)[0].bytes)
+
+		switch name {
+		case "emqx_test_gauge":
+			if attributes["cluster"] != "prod" || attributes["node"] == "" || attributes["service.name"] != "emqx-exporter" {
+				t.Errorf("Unexpected resource attributes %v", attributes)
+			}
+			gauge := fieldsOf(t, metrics[0].bytes, 5)[0].bytes
+			point := fieldsOf(t, gauge, 1)[0].bytes
+			if pointAttributes := attributesOf(t, point, 7); len(pointAttributes) != 1 || pointAttributes["state"] != "running" {
+				t.Errorf("Expected the state attribute only, got %v", pointAttributes)
+			}
+		case "emqx_test_seconds":
+			if _, ok := attributes["cluster"]; ok {
+				t.Errorf("Unexpected cluster attribute of %s", name)
+			}
+			histogram := fieldsOf(t, metrics[0].bytes, 9)[0].bytes
+			point := fieldsOf(t, histogram, 1)[0].bytes
+			if start := fieldsOf(t, point, 2)[0].fixed; start != uint64(time.Unix(100, 0).UnixNano()) {
+				t.Errorf("Expected start time 100s, got %d", start)
+			}
+			if count := fieldsOf(t, point, 4)[0].fixed; count != 2 {
+				t.Errorf("Expected count 2, got %d", count)
+			}
+			counts := fieldsOf(t, point, 6)[0].bytes
+			bounds := fieldsOf(t, point, 7)[0].bytes
+			expectedCounts := []uint64{0, 1, 1}
+			expectedBounds := []float64{0.5, 1}
+			for i, c := range expectedCounts {
+				if got := binary.LittleEndian.Uint64(counts[i*8:]); got != c {
+					t.Errorf("Expected bucket %d count %d, got %d", i, c, got)
+				}
+			}
+			for i, b := range expectedBounds {
+				if got := math.Float64frombits(binary.LittleEndian.Uint64(bounds[i*8:])); got != b {
+					t.Errorf("Expected bound %d to be %v, got %v", i, b, got)
+				}
+			}
+		default:
+			t.Errorf("Unexpected metric %s", name)
+		}
+	}
+}
+
+func TestOTLPExporterGRPC(t *testing.T) {
+	var received []byte
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" ||
+			r.URL.Path != "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		frame, _ := io.ReadAll(r.Body)
+		received = frame[5:]
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	e := NewOTLPExporter(&config.OTLP{
+		Endpoint:        server.URL,
+		Protocol:        "grpc",
+		Timeout:         model.Duration(time.Second),
+		TLSClientConfig: &config.TLSClientConfig{InsecureSkipVerify: true},
+	}, log.NewNopLogger())
+	if err := e.Push(context.Background(), testFamilies(t), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fieldsOf(t, received, 1)) != 3 {
+		t.Errorf("Expected the export request with 3 resources, got %d bytes", len(received))
+	}
+}
@@ -0,0 +1,83 @@
+// Package push sends the metrics of the exporter on an interval, to the systems which can't scrape it.
+package push
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Gatherer collects the metrics to push once, on behalf of ctx
+type Gatherer func(ctx context.Context) ([]*dto.MetricFamily, error)
+
+// Share returns a gatherer reusing the metrics gathered by gather for up to maxAge, so that the sinks pushing at the
+// same time gather the clusters and probes once. The sinks calling it meanwhile wait for the gathering in flight
+func Share(gather Gatherer, maxAge time.Duration) Gatherer {
+	var (
+		mu       sync.Mutex
+		gathered time.Time
+		families []*dto.MetricFamily
+		err      error
+	)
+	return func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !gathered.IsZero() && time.Since(gathered) < maxAge {
+			return families, err
+		}
+		gathered = time.Now()
+		families, err = gather(ctx)
+		return families, err
+	}
+}
+
+// Sink is a system the metrics are pushed to
+type Sink interface {
+	// Push sends the metric families gathered at the timestamp
+	Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error
+}
+
+// Run gathers the metrics and pushes them to the sink every interval, until ctx is done.
+// The gathering is bound by the interval, so that it doesn't pile up if the cluster is slow.
+// The sink is closed once ctx is done, if it's an io.Closer
+func Run(ctx context.Context, name string, gather Gatherer, sink Sink, interval time.Duration, logger log.Logger) {
+	logger = log.With(logger, "sink", name)
+	if closer, ok := sink.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				level.Warn(logger).Log("msg", "Error closing sink", "err", err)
+			}
+		}()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pushOnce(ctx, gather, sink, interval, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func pushOnce(ctx context.Context, gather Gatherer, sink Sink, interval time.Duration, logger log.Logger) {
+	timestamp := time.Now()
+	gatherCtx, cancel := context.WithTimeout(ctx, interval)
+	families, err := gather(gatherCtx)
+	cancel()
+	if err != nil {
+		// the families gathered without error are still pushed
+		level.Warn(logger).Log("msg", "Error gathering metrics to push", "err", err)
+	}
+	if err := sink.Push(ctx, families, timestamp); err != nil {
+		level.Error(logger).Log("msg", "Error pushing metrics", "err", err)
+		return
+	}
+	level.Debug(logger).Log("msg", "Pushed metrics", "families", len(families), "duration_seconds", time.Since(timestamp).Seconds())
+}
@@ -0,0 +1,31 @@
+package push
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestShare(t *testing.T) {
+	gathered := 0
+	gather := Share(func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		gathered++
+		return nil, nil
+	}, 100*time.Millisecond)
+
+	// the sinks pushing at the same time
+	for i := 0; i < 3; i++ {
+		gather(context.Background())
+	}
+	if gathered != 1 {
+		t.Errorf("Expected the metrics to be gathered once for the sinks pushing together, got %d", gathered)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	gather(context.Background())
+	if gathered != 2 {
+		t.Errorf("Expected the metrics to be gathered again after maxAge, got %d", gathered)
+	}
+}
@@ -0,0 +1,40 @@
+package push
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Pushgateway pushes the metrics to a Prometheus Pushgateway,
+// replacing the metrics pushed before with the same job and grouping labels
+type Pushgateway struct {
+	conf   *config.Pushgateway
+	client *http.Client
+}
+
+// NewPushgateway returns a sink pushing to the Pushgateway of conf
+func NewPushgateway(conf *config.Pushgateway) *Pushgateway {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf.TLSClientConfig.ToTLSConfig()
+	return &Pushgateway{conf: conf, client: &http.Client{Transport: transport}}
+}
+
+// Push implements Sink, the Pushgateway sets the push time itself
+func (p *Pushgateway) Push(ctx context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	pusher := push.New(p.conf.URL, p.conf.Job).
+		Client(p.client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil }))
+	for name, value := range p.conf.GroupingLabels {
+		pusher = pusher.Grouping(name, value)
+	}
+	if p.conf.BasicAuth != nil {
+		pusher = pusher.BasicAuth(p.conf.BasicAuth.Username, string(p.conf.BasicAuth.Password))
+	}
+	return pusher.PushContext(ctx)
+}
@@ -0,0 +1,56 @@
+package push
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPushgateway(t *testing.T) {
+	var method, path, user, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		user, _, _ = r.BasicAuth()
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	families := []*dto.MetricFamily{{
+		Name:   proto.String("emqx_test_gauge"),
+		Help:   proto.String("A test gauge"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1.5)}}},
+	}}
+	p := NewPushgateway(&config.Pushgateway{
+		URL:            server.URL,
+		Job:            "emqx-exporter",
+		GroupingLabels: map[string]string{"instance": "exporter-0"},
+		BasicAuth:      &config.BasicAuth{Username: "user", Password: "secret"},
+	})
+	if err := p.Push(context.Background(), families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// the metrics of the same job and grouping labels are replaced
+	if method != http.MethodPut {
+		t.Errorf("Expected a PUT, got %s", method)
+	}
+	if path != "/metrics/job/emqx-exporter/instance/exporter-0" {
+		t.Errorf("Expected the job and grouping labels in the path, got %s", path)
+	}
+	if user != "user" {
+		t.Errorf("Expected basic auth of user, got %q", user)
+	}
+	if !strings.Contains(body, "emqx_test_gauge") {
+		t.Errorf("Expected the metrics to be pushed, got %q", body)
+	}
+}
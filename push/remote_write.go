@@ -0,0 +1,187 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/protoutil"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/klauspost/compress/s2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriter pushes the metrics via the Prometheus remote write protocol 1.0.
+// The pushes which failed are kept in memory, up to config.RemoteWrite.MaxPendingPushes,
+// and retried before the next one. It's not safe for concurrent use
+type RemoteWriter struct {
+	conf    *config.RemoteWrite
+	client  *http.Client
+	logger  log.Logger
+	pending [][]byte
+	// last are the series of the last push by their labels, if the staleness markers are pushed
+	last map[string]Sample
+}
+
+// staleNaN is the value of the staleness markers of Prometheus, a NaN told apart from the NaN of a sample
+var staleNaN = math.Float64frombits(0x7ff0000000000002)
+
+// NewRemoteWriter returns a sink pushing to the remote write endpoint of conf
+func NewRemoteWriter(conf *config.RemoteWrite, logger log.Logger) *RemoteWriter {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf.TLSClientConfig.ToTLSConfig()
+	return &RemoteWriter{
+		conf:   conf,
+		client: &http.Client{Transport: transport},
+		logger: logger,
+	}
+}
+
+// Push implements Sink
+func (rw *RemoteWriter) Push(ctx context.Context, families []*dto.MetricFamily, timestamp time.Time) error {
+	samples := Samples(families, rw.conf.ExternalLabels)
+	if rw.conf.StalenessMarkers {
+		samples = rw.markStale(samples)
+	}
+	if len(samples) > 0 {
+		rw.pending = append(rw.pending, s2.EncodeSnappy(nil, encodeWriteRequest(samples, timestamp.UnixMilli())))
+	}
+	if dropped := len(rw.pending) - rw.conf.MaxPendingPushes; dropped > 0 {
+		level.Warn(rw.logger).Log("msg", "Dropping the oldest pending pushes", "count", dropped)
+		rw.pending = rw.pending[dropped:]
+	}
+
+	for len(rw.pending) > 0 {
+		err := rw.send(ctx, rw.pending[0])
+		var recoverable recoverableError
+		if err != nil && errors.As(err, &recoverable) {
+			return fmt.Errorf("%s, %d pushes pending", err, len(rw.pending))
+		}
+		// the push is dropped if the endpoint rejected it, as it won't take it on a retry either
+		rw.pending = rw.pending[1:]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markStale appends a staleness marker to samples for each series of the last push missing from them,
+// and remembers their series for the next push
+func (rw *RemoteWriter) markStale(samples []Sample) []Sample {
+	series := make(map[string]Sample, len(samples))
+	for _, s := range samples {
+		series[seriesKey(s)] = s
+	}
+	for key, s := range rw.last {
+		if _, ok := series[key]; !ok {
+			samples = append(samples, Sample{Name: s.Name, Labels: s.Labels, Value: staleNaN})
+		}
+	}
+	rw.last = series
+	return samples
+}
+
+// seriesKey identifies the series of s by its name and labels
+func seriesKey(s Sample) string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	for _, l := range s.Labels {
+		b.WriteByte(0)
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+	}
+	return b.String()
+}
+
+// send posts the body, and retries it with exponential backoff if it failed for a recoverable reason
+func (rw *RemoteWriter) send(ctx context.Context, body []byte) error {
+	return retry(ctx, rw.conf.MaxRetries, rw.logger, func() error {
+		return rw.post(ctx, body)
+	})
+}
+
+func (rw *RemoteWriter) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(rw.conf.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "emqx-exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for name, value := range rw.conf.Headers {
+		req.Header.Set(name, string(value))
+	}
+	if rw.conf.BasicAuth != nil {
+		req.SetBasicAuth(rw.conf.BasicAuth.Username, string(rw.conf.BasicAuth.Password))
+	}
+	if rw.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+string(rw.conf.BearerToken))
+	}
+
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("remote write %s: %s: %s", rw.conf.URL, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// encodeWriteRequest encodes the samples as a prometheus.WriteRequest protobuf message, see
+// https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+func encodeWriteRequest(samples []Sample, timestamp int64) []byte {
+	var request, series, sample []byte
+	for _, s := range samples {
+		labels := append([]Label{{Name: model.MetricNameLabel, Value: s.Name}}, s.Labels...)
+		sort.SliceStable(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+		series = series[:0]
+		for _, l := range labels {
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendVarint(series, uint64(encodedStringSize(1, l.Name)+encodedStringSize(2, l.Value)))
+			series = protoutil.AppendString(series, 1, l.Name)
+			series = protoutil.AppendString(series, 2, l.Value)
+		}
+		sample = sample[:0]
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	return request
+}
+
+func encodedStringSize(field protowire.Number, s string) int {
+	return protowire.SizeTag(field) + protowire.SizeBytes(len(s))
+}
@@ -0,0 +1,146 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRemoteWriterPush(t *testing.T) {
+	var received map[string]float64
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Scope-OrgID") != "edge" {
+			http.Error(w, "unexpected headers", http.StatusBadRequest)
+			return
+		}
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := s2.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = decodeWriteRequest(t, body)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_test_gauge", Help: "test"}, []string{"node"})
+	gauge.WithLabelValues("emqx-0").Set(3)
+	registry.MustRegister(gauge)
+	families, _ := registry.Gather()
+
+	rw := NewRemoteWriter(&config.RemoteWrite{
+		URL:              server.URL,
+		Timeout:          model.Duration(time.Second),
+		ExternalLabels:   map[string]string{"site": "edge-1"},
+		Headers:          map[string]config.Secret{"X-Scope-OrgID": "edge"},
+		MaxRetries:       3,
+		MaxPendingPushes: 10,
+	}, log.NewNopLogger())
+	if err := rw.Push(context.Background(), families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `__name__="emqx_test_gauge",node="emqx-0",site="edge-1"`
+	if received[expected] != 3 || len(received) != 1 {
+		t.Errorf("Expected series %s to be 3, got %v", expected, received)
+	}
+	if len(rw.pending) != 0 {
+		t.Errorf("Expected no pending pushes, got %d", len(rw.pending))
+	}
+}
+
+func TestRemoteWriterStalenessMarkers(t *testing.T) {
+	var received map[string]float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := s2.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = decodeWriteRequest(t, body)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_test_gauge", Help: "test"}, []string{"node"})
+	gauge.WithLabelValues("emqx-0").Set(3)
+	gauge.WithLabelValues("emqx-1").Set(5)
+	registry.MustRegister(gauge)
+
+	rw := NewRemoteWriter(&config.RemoteWrite{URL: server.URL, Timeout: model.Duration(time.Second), MaxPendingPushes: 10, StalenessMarkers: true}, log.NewNopLogger())
+	push := func() {
+		families, _ := registry.Gather()
+		if err := rw.Push(context.Background(), families, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push()
+	// the node left the cluster
+	gauge.DeleteLabelValues("emqx-1")
+	push()
+	if v := received[`__name__="emqx_test_gauge",node="emqx-0"`]; v != 3 {
+		t.Errorf("Expected the series of the node still there to be 3, got %v", v)
+	}
+	if v := received[`__name__="emqx_test_gauge",node="emqx-1"`]; math.Float64bits(v) != math.Float64bits(staleNaN) {
+		t.Errorf("Expected a staleness marker for the series of the node which left, got %v", received)
+	}
+	push()
+	if len(received) != 1 {
+		t.Errorf("Expected the staleness marker to be pushed once, got %v", received)
+	}
+}
+
+// decodeWriteRequest returns the values of the series by their labels
+func decodeWriteRequest(t *testing.T, b []byte) map[string]float64 {
+	series := make(map[string]float64)
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeTag(b)
+		ts, m := protowire.ConsumeBytes(b[n:])
+		if m < 0 {
+			t.Fatal("invalid time series")
+		}
+		b = b[n+m:]
+
+		var labels []string
+		var value float64
+		for len(ts) > 0 {
+			num, _, n := protowire.ConsumeTag(ts)
+			field, m := protowire.ConsumeBytes(ts[n:])
+			ts = ts[n+m:]
+			switch num {
+			case 1:
+				_, _, n := protowire.ConsumeTag(field)
+				name, m := protowire.ConsumeString(field[n:])
+				_, _, o := protowire.ConsumeTag(field[n+m:])
+				v, _ := protowire.ConsumeString(field[n+m+o:])
+				labels = append(labels, name+`="`+v+`"`)
+			case 2:
+				_, _, n := protowire.ConsumeTag(field)
+				bits, _ := protowire.ConsumeFixed64(field[n:])
+				value = math.Float64frombits(bits)
+			}
+		}
+		series[strings.Join(labels, ",")] = value
+	}
+	return series
+}
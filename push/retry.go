@@ -0,0 +1,39 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// recoverableError is an error which a retry may recover from
+type recoverableError struct {
+	error
+}
+
+func (e recoverableError) Unwrap() error {
+	return e.error
+}
+
+// retry calls f until it succeeds, or fails for an unrecoverable reason, or maxRetries retries failed,
+// with exponential backoff between the calls
+func retry(ctx context.Context, maxRetries int, logger log.Logger, f func() error) error {
+	backoff := 500 * time.Millisecond
+	for retries := 0; ; retries++ {
+		err := f()
+		var recoverable recoverableError
+		if err == nil || !errors.As(err, &recoverable) || retries >= maxRetries {
+			return err
+		}
+		level.Debug(logger).Log("msg", "Retrying push", "retries", retries+1, "err", err)
+		select {
+		case <-ctx.Done():
+			return recoverableError{ctx.Err()}
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,105 @@
+package push
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// Label is a label of a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a series, as it would be scraped in the text format
+type Sample struct {
+	Name string
+	// Labels are sorted by name, without the metric name
+	Labels []Label
+	Value  float64
+	// Cumulative tells the value only goes up, like a counter or the _bucket, _sum and _count of a histogram
+	Cumulative bool
+}
+
+// Samples flattens the metric families into samples, histograms and summaries
+// into their `_bucket`, `quantile`, `_sum` and `_count` series, and adds the extra labels to all of them
+func Samples(families []*dto.MetricFamily, extraLabels map[string]string) []Sample {
+	var samples []Sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.Metric {
+			labels := make([]Label, 0, len(m.Label)+len(extraLabels)+1)
+			for _, l := range m.Label {
+				labels = append(labels, Label{Name: l.GetName(), Value: l.GetValue()})
+			}
+			for n, v := range extraLabels {
+				// the labels of the metric take precedence
+				if !hasLabel(m.Label, n) {
+					labels = append(labels, Label{Name: n, Value: v})
+				}
+			}
+
+			add := func(name string, value float64, cumulative bool, extra ...Label) {
+				sampleLabels := append(append(make([]Label, 0, len(labels)+len(extra)), labels...), extra...)
+				sort.Slice(sampleLabels, func(i, j int) bool { return sampleLabels[i].Name < sampleLabels[j].Name })
+				samples = append(samples, Sample{Name: name, Labels: sampleLabels, Value: value, Cumulative: cumulative})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue(), true)
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue(), false)
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue(), false)
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().Quantile {
+					add(name, q.GetValue(), false, Label{Name: model.QuantileLabel, Value: formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m.GetSummary().GetSampleSum(), true)
+				add(name+"_count", float64(m.GetSummary().GetSampleCount()), true)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				// a gauge histogram may go down
+				cumulative := family.GetType() == dto.MetricType_HISTOGRAM
+				infSeen := false
+				for _, b := range h.Bucket {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), cumulative, Label{Name: model.BucketLabel, Value: formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(h.GetSampleCount()), cumulative, Label{Name: model.BucketLabel, Value: "+Inf"})
+				}
+				add(name+"_sum", h.GetSampleSum(), cumulative)
+				add(name+"_count", float64(h.GetSampleCount()), cumulative)
+			}
+		}
+	}
+	return samples
+}
+
+func hasLabel(labels []*dto.LabelPair, name string) bool {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,43 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSamples(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "emqx_test_seconds", Help: "test", Buckets: []float64{0.5, 1}})
+	histogram.Observe(0.7)
+	registry.MustRegister(histogram)
+	families, _ := registry.Gather()
+
+	samples := Samples(families, map[string]string{"cluster": "prod"})
+	expected := []struct {
+		name  string
+		le    string
+		value float64
+	}{
+		{"emqx_test_seconds_bucket", "0.5", 0},
+		{"emqx_test_seconds_bucket", "1", 1},
+		{"emqx_test_seconds_bucket", "+Inf", 1},
+		{"emqx_test_seconds_sum", "", 0.7},
+		{"emqx_test_seconds_count", "", 1},
+	}
+	if len(samples) != len(expected) {
+		t.Fatalf("Expected %d samples, got %v", len(expected), samples)
+	}
+	for i, e := range expected {
+		s := samples[i]
+		le := ""
+		for _, l := range s.Labels {
+			if l.Name == "le" {
+				le = l.Value
+			}
+		}
+		if s.Name != e.name || le != e.le || s.Value != e.value || s.Labels[0].Name != "cluster" {
+			t.Errorf("Expected sample %s{le=%q} %v with the cluster label, got %v", e.name, e.le, e.value, s)
+		}
+	}
+}
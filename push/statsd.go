@@ -0,0 +1,120 @@
+package push
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// tagReplacer replaces the characters which have a meaning in the DogStatsD protocol
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_", ":", "_")
+
+// StatsD pushes the metrics as DogStatsD datagrams, with the labels as tags.
+// Gauges are sent as gauges, while cumulative values like counters are sent as counts of the increase
+// since the last push, so a count is first sent on the second push. It's not safe for concurrent use
+type StatsD struct {
+	conf     *config.StatsD
+	network  string
+	address  string
+	previous map[string]float64
+}
+
+// NewStatsD returns a sink pushing to the DogStatsD server of conf
+func NewStatsD(conf *config.StatsD) *StatsD {
+	s := &StatsD{conf: conf, network: "udp", address: conf.Address}
+	if path, ok := strings.CutPrefix(conf.Address, "unix://"); ok {
+		s.network, s.address = "unixgram", path
+	}
+	return s
+}
+
+// Push implements Sink
+func (s *StatsD) Push(ctx context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	current := make(map[string]float64, len(s.previous))
+	var packet []byte
+	for _, sample := range Samples(families, nil) {
+		line := s.appendLine(nil, sample, current)
+		if len(line) == 0 {
+			continue
+		}
+		if len(packet) > 0 && len(packet)+1+len(line) > s.conf.MaxPacketSize {
+			if _, err = conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err = conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	s.previous = current
+	return nil
+}
+
+// appendLine appends the sample like `name:value|g|#tag:value`, or nothing if it has no value to send
+func (s *StatsD) appendLine(b []byte, sample Sample, current map[string]float64) []byte {
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return b
+	}
+
+	var tags []byte
+	for _, tag := range s.conf.Tags {
+		tags = appendTag(tags, tag)
+	}
+	for _, l := range sample.Labels {
+		tags = appendTag(tags, tagReplacer.Replace(l.Name)+":"+tagReplacer.Replace(l.Value))
+	}
+
+	value, metricType := sample.Value, "g"
+	if sample.Cumulative {
+		key := sample.Name + "|" + string(tags)
+		current[key] = sample.Value
+		previous, ok := s.previous[key]
+		if !ok {
+			return b
+		}
+		value, metricType = sample.Value-previous, "c"
+		// the counter was reset
+		if value < 0 {
+			value = sample.Value
+		}
+	}
+
+	b = append(b, s.conf.Prefix...)
+	b = append(b, sample.Name...)
+	b = append(b, ':')
+	b = strconv.AppendFloat(b, value, 'f', -1, 64)
+	b = append(b, '|')
+	b = append(b, metricType...)
+	if len(tags) > 0 {
+		b = append(b, "|#"...)
+		b = append(b, tags...)
+	}
+	return b
+}
+
+func appendTag(tags []byte, tag string) []byte {
+	if len(tags) > 0 {
+		tags = append(tags, ',')
+	}
+	return append(tags, tag...)
+}
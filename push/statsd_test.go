@@ -0,0 +1,57 @@
+package push
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsDPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "emqx_test_gauge", Help: "test"}, []string{"node"})
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "emqx_test_total", Help: "test"})
+	registry.MustRegister(gauge, counter)
+	gauge.WithLabelValues("emqx-0").Set(3)
+	counter.Add(5)
+
+	s := NewStatsD(&config.StatsD{Address: conn.LocalAddr().String(), Prefix: "site.", Tags: []string{"env:prod"}, MaxPacketSize: 1432})
+	receive := func() string {
+		buf := make([]byte, 1432)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	families, _ := registry.Gather()
+	if err := s.Push(context.Background(), families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// the count is first sent on the second push
+	if got, expected := receive(), "site.emqx_test_gauge:3|g|#env:prod,node:emqx-0"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	counter.Add(2)
+	families, _ = registry.Gather()
+	if err := s.Push(context.Background(), families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	got := receive()
+	if !strings.Contains(got, "site.emqx_test_total:2|c|#env:prod") || !strings.Contains(got, "site.emqx_test_gauge:3|g") {
+		t.Errorf("Expected the increase of the counter and the gauge, got %q", got)
+	}
+}
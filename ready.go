@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/collector"
+	"github.com/emqx/emqx-exporter/config"
+)
+
+const (
+	// readyCheckTimeout bounds a deep check, which the readiness checks waiting for it don't cancel
+	readyCheckTimeout = 10 * time.Second
+	// readyDialTimeout bounds the dial of a probe target by a deep check
+	readyDialTimeout = 5 * time.Second
+)
+
+// readyHandler serves /ready, which with the `deep` parameter verifies the config file is valid, the EMQX API
+// of each cluster responds, and at least one of the probe targets is reachable. The result of the deep check is
+// kept for ttl, to not hit EMQX on each readiness check of each replica
+type readyHandler struct {
+	configFile string
+	// deep makes every check deep, as --web.ready.deep
+	deep     bool
+	ttl      time.Duration
+	clusters map[string]*collector.Cluster
+	probes   func() []config.Probe
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+	// running is closed once the running deep check is done, nil if none is
+	running chan struct{}
+}
+
+func (h *readyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.deep || r.URL.Query().Get("deep") == "true" {
+		if err := h.check(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Write([]byte("OK"))
+}
+
+// check returns the error of the last deep check if it's younger than ttl, otherwise checks again.
+// The concurrent checks wait for the one running, up to ctx
+func (h *readyHandler) check(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.checked.IsZero() && time.Since(h.checked) < h.ttl {
+		defer h.mu.Unlock()
+		return h.err
+	}
+	running := h.running
+	if running == nil {
+		running = make(chan struct{})
+		h.running = running
+		// the check outlives the request starting it, for the ones waiting for it
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), readyCheckTimeout)
+			defer cancel()
+			err := h.deepCheck(ctx)
+			h.mu.Lock()
+			h.checked, h.err, h.running = time.Now(), err, nil
+			h.mu.Unlock()
+			close(running)
+		}()
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+func (h *readyHandler) deepCheck(ctx context.Context) error {
+	if _, err := config.LoadConfig(h.configFile); err != nil {
+		return err
+	}
+	for name, cluster := range h.clusters {
+		if err := cluster.Check(ctx); err != nil {
+			return fmt.Errorf("cluster %q: %s", name, err)
+		}
+	}
+
+	probes := h.probes()
+	if len(probes) == 0 {
+		return nil
+	}
+	// the targets are dialed concurrently, until one of them is reachable
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(probes))
+	for _, probe := range probes {
+		go func(probe config.Probe) {
+			if err := dialProbe(ctx, probe); err != nil {
+				errs <- fmt.Errorf("probe %q: %w", probe.Target, err)
+				return
+			}
+			errs <- nil
+		}(probe)
+	}
+	var failed []error
+	for range probes {
+		err := <-errs
+		if err == nil {
+			return nil
+		}
+		failed = append(failed, err)
+	}
+	return fmt.Errorf("no probe target is reachable: %w", errors.Join(failed...))
+}
+
+// defaultPorts are the ports of the probe targets without one by scheme, like those the probe connects to
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"tcps":  "8883",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// dialProbe opens a TCP connection to the target of probe, the default port being the one of its scheme,
+// and the path of the WebSocket targets being ignored
+func dialProbe(ctx context.Context, probe config.Probe) error {
+	target, _, _ := strings.Cut(probe.Target, "/")
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		port, ok := defaultPorts[probe.Scheme]
+		if !ok {
+			port = defaultPorts["tcp"]
+		}
+		target = net.JoinHostPort(target, port)
+	}
+	conn, err := (&net.Dialer{Timeout: readyDialTimeout}).DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+)
+
+func TestReadyHandler(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configFile, []byte("probes:\n  - target: 127.0.0.1:1883\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	h := &readyHandler{
+		configFile: configFile,
+		ttl:        100 * time.Millisecond,
+		probes: func() []config.Probe {
+			return []config.Probe{{Target: closed.Addr().String()}, {Target: listener.Addr().String() + "/mqtt"}}
+		},
+	}
+	ready := func(target string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+
+	if code := ready("/ready?deep=true"); code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a probe target reachable, got %d", code)
+	}
+	listener.Close()
+	if code := ready("/ready?deep=true"); code != http.StatusOK {
+		t.Errorf("Expected the result of the last deep check within the TTL, got %d", code)
+	}
+	time.Sleep(h.ttl)
+	if code := ready("/ready?deep=true"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 with no probe target reachable, got %d", code)
+	}
+	if code := ready("/ready"); code != http.StatusOK {
+		t.Errorf("Expected status 200 without the deep check, got %d", code)
+	}
+
+	h.deep = true
+	if code := ready("/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected every check to be deep with --web.ready.deep, got %d", code)
+	}
+}
+
+func TestReadyHandlerConcurrent(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configFile, []byte("probes:\n  - target: 127.0.0.1:1883\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var checks atomic.Int32
+	release := make(chan struct{})
+	h := &readyHandler{
+		configFile: configFile,
+		ttl:        time.Minute,
+		probes: func() []config.Probe {
+			checks.Add(1)
+			<-release
+			return []config.Probe{{Target: listener.Addr().String()}}
+		},
+	}
+	codes := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready?deep=true", nil))
+			codes <- w.Code
+		}()
+	}
+	// a readiness check going away doesn't wait for the deep check
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.check(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the canceled check not to wait, got %v", err)
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+	}
+	if n := checks.Load(); n != 1 {
+		t.Errorf("Expected the concurrent readiness checks to share one deep check, got %d", n)
+	}
+}
+
+func TestDialProbeDefaultPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	defaultPorts["test"] = port
+	defer delete(defaultPorts, "test")
+
+	if err := dialProbe(context.Background(), config.Probe{Target: "127.0.0.1/mqtt", Scheme: "test"}); err != nil {
+		t.Errorf("Expected the default port of the scheme to be dialed, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// runService runs the exporter as a Windows service, which is never the case on other platforms
+func runService(app *kingpin.Application, args []string, srv *http.Server) (isService bool, exitCode int) {
+	return false, 0
+}
+
+type serviceCommands struct{}
+
+// addServiceCommands adds the commands to install and uninstall the Windows service, none on other platforms
+func addServiceCommands(app *kingpin.Application) *serviceCommands {
+	return &serviceCommands{}
+}
+
+// runServiceCommand runs the command if it's one of the service commands
+func runServiceCommand(cmds *serviceCommands, cmd string) (handled bool, exitCode int) {
+	return false, 0
+}
@@ -0,0 +1,180 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name of the Windows service and of its event log source
+const serviceName = "emqx-exporter"
+
+// runService runs the exporter as a Windows service if it's started by the service control manager,
+// with the logs written to the event log
+func runService(app *kingpin.Application, args []string, srv *http.Server) (isService bool, exitCode int) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, 0
+	}
+
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		defer elog.Close()
+		// the logger writes to stderr, which isn't attached to anything for a service
+		if r, w, err := os.Pipe(); err == nil {
+			os.Stderr = w
+			go forwardToEventLog(r, elog)
+		}
+	}
+
+	s := &service{app: app, args: args, srv: srv}
+	if err := svc.Run(serviceName, s); err != nil {
+		fmt.Fprintf(os.Stderr, "level=error msg=\"Error running the Windows service\" err=%q\n", err)
+		return true, 1
+	}
+	return true, s.exitCode
+}
+
+type service struct {
+	app      *kingpin.Application
+	args     []string
+	srv      *http.Server
+	exitCode int
+}
+
+// Execute implements svc.Handler, the exporter stops serving when the service is stopped or the system shuts down
+func (s *service) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	exited := make(chan int, 1)
+	go func() {
+		exited <- run(s.app, s.args, s.srv)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case s.exitCode = <-exited:
+			return false, uint32(s.exitCode)
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				// closes the listeners without waiting, run drains the in-flight requests and disconnects the probes
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				s.srv.Shutdown(ctx)
+				s.exitCode = <-exited
+				return false, uint32(s.exitCode)
+			}
+		}
+	}
+}
+
+// forwardToEventLog writes the log lines to the event log, as errors, warnings or information by their levels
+func forwardToEventLog(r io.Reader, elog *eventlog.Log) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.Contains(line, "level=error"):
+			elog.Error(1, line)
+		case strings.Contains(line, "level=warn"):
+			elog.Warning(1, line)
+		default:
+			elog.Info(1, line)
+		}
+	}
+}
+
+type serviceCommands struct {
+	install   *kingpin.CmdClause
+	uninstall *kingpin.CmdClause
+	flags     *[]string
+}
+
+// addServiceCommands adds the commands to install and uninstall the Windows service
+func addServiceCommands(app *kingpin.Application) *serviceCommands {
+	cmds := &serviceCommands{
+		install:   app.Command("install-service", "Install the exporter as a Windows service started automatically, pass its flags after --."),
+		uninstall: app.Command("uninstall-service", "Uninstall the Windows service of the exporter."),
+	}
+	cmds.flags = cmds.install.Arg("flags", "Flags of the service, like --config.file.").Strings()
+	return cmds
+}
+
+// runServiceCommand runs the command if it's one of the service commands
+func runServiceCommand(cmds *serviceCommands, cmd string) (handled bool, exitCode int) {
+	var err error
+	switch cmd {
+	case cmds.install.FullCommand():
+		err = installService(*cmds.flags)
+	case cmds.uninstall.FullCommand():
+		err = uninstallService()
+	default:
+		return false, 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return true, 1
+	}
+	return true, 0
+}
+
+func installService(flags []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "EMQX Exporter",
+		Description: "Prometheus exporter and MQTT prober for EMQX",
+		StartType:   mgr.StartAutomatic,
+	}, flags...)
+	if err != nil {
+		return fmt.Errorf("error creating service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+	if err = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("error installing event log source %s: %w", serviceName, err)
+	}
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("error opening service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+	if err = s.Delete(); err != nil {
+		return fmt.Errorf("error deleting service %s: %w", serviceName, err)
+	}
+	return eventlog.Remove(serviceName)
+}
@@ -0,0 +1,274 @@
+// Package spiffe fetches the X.509 SVIDs of the exporter from the SPIFFE Workload API, like the one of the SPIRE agent,
+// and keeps them up to date as they are rotated, to present them as the client certificates of the TLS connections.
+package spiffe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emqx/emqx-exporter/internal/grpcutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// EnvEndpointSocket is the environment variable telling the address of the Workload API, like `unix:///run/spire/sockets/agent.sock`
+const EnvEndpointSocket = "SPIFFE_ENDPOINT_SOCKET"
+
+// Source keeps the X.509 SVIDs streamed by the Workload API
+type Source struct {
+	network, address string
+	client           *http.Client
+
+	mu      sync.RWMutex
+	svids   []svid
+	err     error
+	fetched chan struct{}
+}
+
+// svid is an X.509 SVID and its private key
+type svid struct {
+	id   string
+	cert *tls.Certificate
+}
+
+var sources = struct {
+	sync.Mutex
+	m map[string]*Source
+}{m: make(map[string]*Source)}
+
+// ParseEndpoint returns the network and the address of the Workload API at endpoint, like `unix:///run/spire/sockets/agent.sock`
+// or `tcp://127.0.0.1:8081`
+func ParseEndpoint(endpoint string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		network, address = "unix", strings.TrimPrefix(endpoint, "unix://")
+	case strings.HasPrefix(endpoint, "unix:"):
+		network, address = "unix", strings.TrimPrefix(endpoint, "unix:")
+	case strings.HasPrefix(endpoint, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(endpoint, "tcp://")
+	default:
+		return "", "", fmt.Errorf("%q isn't a unix:// or tcp:// address of the Workload API", endpoint)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("%q has no address", endpoint)
+	}
+	return network, address, nil
+}
+
+// SourceOf returns the source of the SVIDs of the Workload API at endpoint, which streams them for the lifetime of the
+// process from the first call on. It's shared by all the TLS configs using the endpoint
+func SourceOf(endpoint string) (*Source, error) {
+	network, address, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	sources.Lock()
+	defer sources.Unlock()
+	if s, ok := sources.m[endpoint]; ok {
+		return s, nil
+	}
+	s := newSource(network, address)
+	go s.run(context.Background())
+	sources.m[endpoint] = s
+	return s, nil
+}
+
+func newSource(network, address string) *Source {
+	s := &Source{network: network, address: address, fetched: make(chan struct{})}
+	s.client = &http.Client{Transport: grpcutil.NewTransport(nil, func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, s.network, s.address)
+	})}
+	return s
+}
+
+// run streams the SVIDs, and streams them again after a backoff whenever the stream breaks
+func (s *Source) run(ctx context.Context) {
+	delay := time.Second
+	for {
+		err := s.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > 30*time.Second {
+			delay = 30 * time.Second
+		}
+	}
+}
+
+// stream calls FetchX509SVID, and keeps the SVIDs of each response until the stream ends
+func (s *Source) stream(ctx context.Context) error {
+	// the empty X509SVIDRequest
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/SpiffeWorkloadAPI/FetchX509SVID", bytes.NewReader(grpcutil.Frame(nil)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	// required by the Workload API to tell its clients from the proxied requests
+	req.Header.Set("workload.spiffe.io", "true")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch X.509 SVIDs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch X.509 SVIDs: %s", resp.Status)
+	}
+	if status := resp.Header.Get("Grpc-Status"); status != "" && status != "0" {
+		return fmt.Errorf("fetch X.509 SVIDs: grpc-status %s: %s", status, resp.Header.Get("Grpc-Message"))
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		message, err := grpcutil.ReadFrame(r, grpcutil.MaxMessageSize)
+		if errors.Is(err, io.EOF) {
+			code, message, err := grpcutil.Status(resp)
+			if err != nil {
+				return fmt.Errorf("fetch X.509 SVIDs: stream ended with %w", err)
+			}
+			return fmt.Errorf("fetch X.509 SVIDs: stream ended with grpc-status %d: %s", code, message)
+		}
+		if err != nil {
+			return fmt.Errorf("fetch X.509 SVIDs: %w", err)
+		}
+		svids, err := parseX509SVIDResponse(message)
+		if err != nil {
+			return fmt.Errorf("fetch X.509 SVIDs: %w", err)
+		}
+		s.mu.Lock()
+		s.svids, s.err = svids, nil
+		s.mu.Unlock()
+		select {
+		case <-s.fetched:
+		default:
+			close(s.fetched)
+		}
+	}
+}
+
+// fetchTimeout bounds the wait of the handshakes for the first SVIDs, as not all of them are bound by a context
+const fetchTimeout = 5 * time.Second
+
+// ClientCertificate returns the function presenting the SVID of id, or the first one if id is empty,
+// as the client certificate of the TLS handshakes. It waits for the first SVIDs to be fetched, up to the handshake
+func (s *Source) ClientCertificate(id string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		timer := time.NewTimer(fetchTimeout)
+		defer timer.Stop()
+		var err error
+		select {
+		case <-s.fetched:
+		case <-info.Context().Done():
+			err = info.Context().Err()
+		case <-timer.C:
+			err = errors.New("timed out")
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if err != nil {
+			if s.err != nil {
+				err = s.err
+			}
+			return nil, fmt.Errorf("no X.509 SVID fetched yet: %w", err)
+		}
+		for _, svid := range s.svids {
+			if id == "" || svid.id == id {
+				return svid.cert, nil
+			}
+		}
+		return nil, fmt.Errorf("no X.509 SVID of %s", id)
+	}
+}
+
+// parseX509SVIDResponse returns the SVIDs of an X509SVIDResponse, whose certificates and keys are ASN.1 DER encoded
+func parseX509SVIDResponse(b []byte) (svids []svid, err error) {
+	err = parseMessage(b, func(field protowire.Number, v []byte) error {
+		// svids
+		if field != 1 {
+			return nil
+		}
+		var id string
+		var certs, key []byte
+		if err := parseMessage(v, func(field protowire.Number, v []byte) error {
+			switch field {
+			case 1:
+				id = string(v)
+			case 2:
+				certs = v
+			case 3:
+				key = v
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		chain, err := x509.ParseCertificates(certs)
+		if err != nil || len(chain) == 0 {
+			return fmt.Errorf("X.509 SVID of %s: invalid certificates: %v", id, err)
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("X.509 SVID of %s: invalid key: %w", id, err)
+		}
+		cert := &tls.Certificate{PrivateKey: privateKey, Leaf: chain[0]}
+		for _, c := range chain {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		svids = append(svids, svid{id: id, cert: cert})
+		return nil
+	})
+	if err == nil && len(svids) == 0 {
+		err = errors.New("no X.509 SVID in the response")
+	}
+	return svids, err
+}
+
+// parseMessage calls f with the number and the value of each length-delimited field of the protobuf message b,
+// and skips the others
+func parseMessage(b []byte, f func(field protowire.Number, v []byte) error) error {
+	for len(b) > 0 {
+		field, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(field, typ, b); n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := f(field, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// selfSigned returns a self-signed certificate of the serial number, and its key
+func selfSigned(t *testing.T, serial int64) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "emqx-exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, key
+}
+
+// x509SVIDResponse returns an X509SVIDResponse framed as a gRPC message, holding a self-signed SVID of id
+func x509SVIDResponse(t *testing.T, id string, serial int64) []byte {
+	der, key := selfSigned(t, serial)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, id)
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, der)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, pkcs8)
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, svid)
+
+	frame := make([]byte, 5, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+	return append(frame, resp...)
+}
+
+func TestClientCertificate(t *testing.T) {
+	const id = "spiffe://example.org/emqx-exporter"
+	responses := make(chan []byte, 2)
+	responses <- x509SVIDResponse(t, id, 1)
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/SpiffeWorkloadAPI/FetchX509SVID" || r.Header.Get("workload.spiffe.io") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		for {
+			select {
+			case resp := <-responses:
+				w.Write(resp)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}), &http2.Server{})}
+	go server.Serve(l)
+	defer server.Close()
+
+	source, err := SourceOf("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, key := selfSigned(t, 100)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tlsListener.Close()
+	serials := make(chan int64, 1)
+	go func() {
+		for {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			// the client certificate of TLS 1.3 is verified along with the data following the handshake
+			if _, err = conn.Read(make([]byte, 1)); err == nil {
+				serials <- conn.(*tls.Conn).ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+			}
+			conn.Close()
+		}
+	}()
+	// handshake returns the serial number of the client certificate presented for the SVID of id
+	handshake := func(id string) (int64, error) {
+		conn, err := tls.Dial("tcp", tlsListener.Addr().String(), &tls.Config{InsecureSkipVerify: true, GetClientCertificate: source.ClientCertificate(id)})
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		if _, err = conn.Write([]byte{0}); err != nil {
+			return 0, err
+		}
+		return <-serials, nil
+	}
+	serial := func(id string) int64 {
+		n, err := handshake(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := serial(id); n != 1 {
+		t.Errorf("Expected the SVID of serial number 1, got %d", n)
+	}
+	if _, err = handshake("spiffe://example.org/other"); err == nil {
+		t.Error("Expected no SVID of an unknown SPIFFE ID")
+	}
+
+	responses <- x509SVIDResponse(t, id, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for serial("") != 2 {
+		if ctx.Err() != nil {
+			t.Fatal("Expected the rotated SVID to be presented")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"unix:///run/spire/sockets/agent.sock": "unix /run/spire/sockets/agent.sock",
+		"unix:agent.sock":                      "unix agent.sock",
+		"tcp://127.0.0.1:8081":                 "tcp 127.0.0.1:8081",
+		"/run/spire/sockets/agent.sock":        "",
+		"unix://":                              "",
+	} {
+		network, address, err := ParseEndpoint(endpoint)
+		if want == "" {
+			if err == nil {
+				t.Errorf("Expected %q to be invalid", endpoint)
+			}
+			continue
+		}
+		if err != nil || network+" "+address != want {
+			t.Errorf("Expected %q to be %q, got %q, %v", endpoint, want, network+" "+address, err)
+		}
+	}
+}
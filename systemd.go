@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// notifySystemd tells systemd the exporter is ready, and keeps the watchdog alive as long as the handler serves /healthz.
+// Both are no-ops unless the exporter runs as a systemd service with Type=notify, and WatchdogSec for the watchdog
+func notifySystemd(handler http.Handler, logger log.Logger) {
+	if sent, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		level.Warn(logger).Log("msg", "Error notifying systemd of readiness", "err", err)
+	} else if sent {
+		level.Info(logger).Log("msg", "Notified systemd of readiness")
+	}
+
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		level.Warn(logger).Log("msg", "Error reading the systemd watchdog interval", "err", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	level.Info(logger).Log("msg", "Enabled systemd watchdog", "interval", interval)
+	// keep alive twice per interval, as recommended by sd_watchdog_enabled(3)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := checkHealthz(handler, interval/2); err != nil {
+			level.Error(logger).Log("msg", "Skipping systemd watchdog keepalive", "err", err)
+			continue
+		}
+		if _, err := daemon.SdNotify(false, daemon.SdNotifyWatchdog); err != nil {
+			level.Warn(logger).Log("msg", "Error sending systemd watchdog keepalive", "err", err)
+		}
+	}
+}
+
+// checkHealthz serves a /healthz request by the handler in process, and fails if it isn't served OK within the timeout
+func checkHealthz(handler http.Handler, timeout time.Duration) error {
+	code := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		code <- rec.Code
+	}()
+	select {
+	case c := <-code:
+		if c != http.StatusOK {
+			return fmt.Errorf("/healthz responded with status %d", c)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("/healthz didn't respond within %s", timeout)
+	}
+}
+
+// notifySystemdStopping tells systemd the exporter is shutting down
+func notifySystemdStopping(logger log.Logger) {
+	if _, err := daemon.SdNotify(false, daemon.SdNotifyStopping); err != nil {
+		level.Warn(logger).Log("msg", "Error notifying systemd of stopping", "err", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckHealthz(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	if err := checkHealthz(mux, time.Second); err != nil {
+		t.Errorf("Expected /healthz to be healthy, got %s", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	wedged := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	if err := checkHealthz(wedged, 10*time.Millisecond); err == nil {
+		t.Error("Expected a wedged handler to fail the check")
+	}
+}
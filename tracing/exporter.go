@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/emqx/emqx-exporter/internal/protoutil"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/version"
+)
+
+const (
+	// maxQueuedSpans are buffered for the next export, beyond which the spans are dropped
+	maxQueuedSpans = 2048
+	// maxExportBatch spans are exported at most by a request
+	maxExportBatch = 512
+	exportInterval = 5 * time.Second
+)
+
+// Exporter exports the spans via OTLP over HTTP with protobuf in batches, on an interval or once a batch is full
+type Exporter struct {
+	conf    *config.Tracing
+	client  *http.Client
+	url     string
+	spans   chan *Span
+	dropped atomic.Int64
+	logger  log.Logger
+}
+
+// NewExporter returns an exporter to the collector of conf
+func NewExporter(conf *config.Tracing, logger log.Logger) *Exporter {
+	endpoint, _ := url.Parse(conf.Endpoint)
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/traces"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf.TLSClientConfig.ToTLSConfig()
+	return &Exporter{
+		conf:   conf,
+		client: &http.Client{Transport: transport},
+		url:    endpoint.String(),
+		spans:  make(chan *Span, maxQueuedSpans),
+		logger: logger,
+	}
+}
+
+// sample returns whether a new trace is recorded, by the sampling ratio of the config
+func (e *Exporter) sample() bool {
+	ratio := *e.conf.SamplingRatio
+	return ratio >= 1 || rand.Float64() < ratio
+}
+
+// enqueue hands the span to Run, or drops it if too many are queued already
+func (e *Exporter) enqueue(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Run exports the spans until ctx is done, and then the spans ended until then
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, maxExportBatch)
+	flush := func(ctx context.Context) {
+		if dropped := e.dropped.Swap(0); dropped > 0 {
+			level.Warn(e.logger).Log("msg", "Dropped spans queued beyond the capacity of the exporter", "spans", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(ctx, batch); err != nil {
+			level.Warn(e.logger).Log("msg", "Error exporting spans", "spans", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) == maxExportBatch {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			for len(e.spans) > 0 && len(batch) < maxExportBatch {
+				batch = append(batch, <-e.spans)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.conf.Timeout))
+			flush(ctx)
+			cancel()
+			return
+		}
+	}
+}
+
+// export posts the spans to the collector
+func (e *Exporter) export(ctx context.Context, spans []*Span) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.conf.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(encodeExportRequest(spans, e.resourceAttributes())))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "emqx-exporter/"+version.Version)
+	for name, value := range e.conf.Headers {
+		req.Header.Set(name, string(value))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		// the body is a protobuf google.rpc.Status, which has a readable message at least
+		return fmt.Errorf("OTLP export %s: %s: %q", e.url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (e *Exporter) resourceAttributes() map[string]string {
+	attributes := map[string]string{
+		"service.name":    "emqx-exporter",
+		"service.version": version.Version,
+	}
+	for name, value := range e.conf.ResourceAttributes {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// encodeExportRequest encodes an ExportTraceServiceRequest of the spans of a resource
+func encodeExportRequest(spans []*Span, resourceAttributes map[string]string) []byte {
+	names := make([]string, 0, len(resourceAttributes))
+	for name := range resourceAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var resource []byte
+	for _, name := range names {
+		resource = protoutil.AppendMessage(resource, 1, protoutil.EncodeKeyValue(name, resourceAttributes[name]))
+	}
+
+	scope := protoutil.AppendString(nil, 1, "emqx-exporter")
+	scope = protoutil.AppendString(scope, 2, version.Version)
+	scopeSpans := protoutil.AppendMessage(nil, 1, scope)
+	for _, s := range spans {
+		scopeSpans = protoutil.AppendMessage(scopeSpans, 2, encodeSpan(s))
+	}
+
+	resourceSpans := protoutil.AppendMessage(nil, 1, resource)
+	resourceSpans = protoutil.AppendMessage(resourceSpans, 2, scopeSpans)
+	return protoutil.AppendMessage(nil, 1, resourceSpans)
+}
+
+const (
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+func encodeSpan(s *Span) []byte {
+	b := protoutil.AppendBytes(nil, 1, s.context.traceID[:])
+	b = protoutil.AppendBytes(b, 2, s.context.spanID[:])
+	if s.parentID != [8]byte{} {
+		b = protoutil.AppendBytes(b, 4, s.parentID[:])
+	}
+	b = protoutil.AppendString(b, 5, s.name)
+	b = protoutil.AppendVarint(b, 6, spanKindInternal)
+	b = protoutil.AppendFixed64(b, 7, uint64(s.start.UnixNano()))
+	b = protoutil.AppendFixed64(b, 8, uint64(s.end.UnixNano()))
+	for _, a := range s.attributes {
+		b = protoutil.AppendMessage(b, 9, protoutil.EncodeKeyValue(a.key, a.value))
+	}
+	if s.err != nil {
+		status := protoutil.AppendString(nil, 2, s.err.Error())
+		status = protoutil.AppendVarint(status, 3, statusCodeError)
+		b = protoutil.AppendMessage(b, 15, status)
+	}
+	return b
+}
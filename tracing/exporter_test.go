@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emqx/emqx-exporter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+func TestStartWithoutExporter(t *testing.T) {
+	SetExporter(nil)
+	ctx, span := Start(context.Background(), "scrape")
+	if span != nil || ctx != context.Background() {
+		t.Errorf("Expected no span without an exporter")
+	}
+	// the methods of a nil span do nothing
+	span.SetAttributes("cluster", "a")
+	span.End(errors.New("failed"))
+}
+
+func TestExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("Unexpected %s %s with content type %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	ratio := 0.0
+	e := NewExporter(&config.Tracing{Endpoint: srv.URL, SamplingRatio: &ratio, Timeout: model.Duration(time.Second)}, log.NewNopLogger())
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	// nothing is recorded for the new traces, which are never sampled
+	if _, span := Start(context.Background(), "scrape"); span != nil {
+		t.Errorf("Expected no span for an unsampled trace")
+	}
+
+	// but the sampled traces of the callers are continued
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, span := Start(FromRequest(req), "scrape")
+	if span == nil {
+		t.Fatalf("Expected a span for a sampled parent")
+	}
+	if TraceID(ctx) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace of the parent but got %q", TraceID(ctx))
+	}
+	_, child := Start(ctx, "collect")
+	child.SetAttributes("collector", "cluster")
+	child.End(errors.New("failed"))
+	span.End(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+	cancel()
+	<-done
+
+	select {
+	case body := <-bodies:
+		traceID, _ := hex.DecodeString("4bf92f3577b34da6a3ce929d0e0e4736")
+		parentID, _ := hex.DecodeString("00f067aa0ba902b7")
+		for _, want := range [][]byte{traceID, parentID, []byte("scrape"), []byte("collect"), []byte("collector"), []byte("emqx-exporter")} {
+			if !bytes.Contains(body, want) {
+				t.Errorf("Expected %q in the exported spans", want)
+			}
+		}
+	default:
+		t.Errorf("Expected the spans to be flushed when stopped")
+	}
+}
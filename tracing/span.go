@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// exporter receives the spans ended, none are recorded if it's nil
+var exporter atomic.Pointer[Exporter]
+
+// SetExporter makes the spans exported by e, or not recorded at all if e is nil
+func SetExporter(e *Exporter) {
+	exporter.Store(e)
+}
+
+// Span is an operation of a trace, like a scrape, a collector run, an EMQX API request or a probe phase.
+// The methods of a nil Span do nothing, which is what Start returns if tracing is disabled or the trace isn't sampled
+type Span struct {
+	exporter   *Exporter
+	name       string
+	context    spanContext
+	parentID   [8]byte
+	start      time.Time
+	end        time.Time
+	attributes []attribute
+	err        error
+}
+
+// attribute is a key and a value of type string, int, int64 or bool
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Start starts the span of name, as a child of the span carried by ctx if any, or of a new trace sampled by the
+// exporter otherwise. The returned context carries the span for its children, and the span must be ended
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	e := exporter.Load()
+	if e == nil {
+		return ctx, nil
+	}
+	parent, hasParent := ctx.Value(spanContextKey{}).(spanContext)
+	sc := spanContext{traceID: parent.traceID, sampled: parent.sampled}
+	if !hasParent {
+		if !e.sample() {
+			return ctx, nil
+		}
+		rand.Read(sc.traceID[:])
+		sc.sampled = true
+	}
+	rand.Read(sc.spanID[:])
+	ctx = context.WithValue(ctx, spanContextKey{}, sc)
+	if !sc.sampled {
+		return ctx, nil
+	}
+	return ctx, &Span{exporter: e, name: name, context: sc, parentID: parent.spanID, start: time.Now()}
+}
+
+// SetAttributes sets the attributes of keyvals, alternating keys and values like the ones of a log line
+func (s *Span) SetAttributes(keyvals ...interface{}) {
+	if s == nil {
+		return
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		value := keyvals[i+1]
+		switch value.(type) {
+		case string, int, int64, bool:
+		default:
+			value = fmt.Sprint(value)
+		}
+		s.attributes = append(s.attributes, attribute{key: fmt.Sprint(keyvals[i]), value: value})
+	}
+}
+
+// End ends the span, which failed if err isn't nil, and hands it to the exporter
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.exporter.enqueue(s)
+}
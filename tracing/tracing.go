@@ -0,0 +1,86 @@
+// Package tracing carries the trace of a scrape or a probe, so that the metrics it produces can link to it via exemplars,
+// and records its spans for an OpenTelemetry collector if an Exporter is set.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type spanContextKey struct{}
+
+// spanContext identifies the span which a context is carried on behalf of, the remote parent of a traced request included
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// FromRequest returns the context of the request carrying the trace of its W3C `traceparent` header, if any
+func FromRequest(r *http.Request) context.Context {
+	ctx := r.Context()
+	if sc, ok := parseTraceParent(r.Header.Get("traceparent")); ok {
+		ctx = context.WithValue(ctx, spanContextKey{}, sc)
+	}
+	return ctx
+}
+
+// WithTraceID returns a copy of ctx carrying the trace ID
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	var sc spanContext
+	if n, err := hex.Decode(sc.traceID[:], []byte(traceID)); err != nil || n != len(sc.traceID) {
+		return ctx
+	}
+	sc.sampled = true
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Inherit returns a copy of ctx carrying the trace of parent, for work outliving parent to be traced on its behalf
+func Inherit(ctx, parent context.Context) context.Context {
+	if sc, ok := parent.Value(spanContextKey{}).(spanContext); ok {
+		return context.WithValue(ctx, spanContextKey{}, sc)
+	}
+	return ctx
+}
+
+// TraceID returns the trace ID carried by ctx, or "" if it isn't traced
+func TraceID(ctx context.Context) string {
+	sc, ok := ctx.Value(spanContextKey{}).(spanContext)
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(sc.traceID[:])
+}
+
+// Exemplar returns the exemplar labels linking to the trace carried by ctx, or nil if it isn't traced
+func Exemplar(ctx context.Context) prometheus.Labels {
+	traceID := TraceID(ctx)
+	if traceID == "" {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": traceID}
+}
+
+// parseTraceParent returns the span context of a header like `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`
+func parseTraceParent(header string) (sc spanContext, ok bool) {
+	fields := strings.Split(strings.TrimSpace(header), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" || len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(strings.ToLower(fields[1]))); err != nil || sc.traceID == [16]byte{} {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(strings.ToLower(fields[2]))); err != nil || sc.spanID == [8]byte{} {
+		return sc, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(fields[3])); err != nil {
+		return sc, false
+	}
+	sc.sampled = flags[0]&1 == 1
+	return sc, true
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	testcases := map[string]string{
+		"":    "",
+		"foo": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-00": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01": "",
+	}
+
+	for header, expected := range testcases {
+		got := ""
+		if sc, ok := parseTraceParent(header); ok {
+			got = hex.EncodeToString(sc.traceID[:])
+		}
+		if expected != got {
+			t.Errorf("Expected '%s' but got '%s' for '%s'", expected, got, header)
+		}
+	}
+
+	for header, sampled := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00": false,
+	} {
+		if sc, _ := parseTraceParent(header); sc.sampled != sampled {
+			t.Errorf("Expected sampled %v for '%s'", sampled, header)
+		}
+	}
+}